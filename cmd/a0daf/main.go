@@ -23,7 +23,7 @@ import (
 var version = "HEAD"
 
 func main() {
-	if cmd.Main(version, os.Stdout, os.Stderr, os.Args[1:]) != nil {
+	if cmd.Main(version, os.Stdin, os.Stdout, os.Stderr, os.Args[1:]) != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,187 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	neturl "net/url"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is the lifetime of client assertions in seconds.
+const clientAssertionLifetime = 60
+
+// WithClientAssertionSigner enables the client authentication with a signed client assertion (private_key_jwt).
+//
+// Signer can be any crypto.Signer with an RSA key (signs with RS256) or an ECDSA P-256 key (signs with ES256),
+// so private keys can live in PKCS#11 tokens, TPMs or cloud KMSs.
+// When Signer implements ContextSigner, signing is canceled with the request.
+// KeyID is set to kid header of the assertion if given.
+//
+// See: https://auth0.com/docs/get-started/authentication-and-authorization-flow/authenticate-with-private-key-jwt
+type WithClientAssertionSigner struct {
+	Signer crypto.Signer
+	KeyID  string
+}
+
+// ContextSigner is a crypto.Signer which can be canceled with ctx, e.g. a signer calling a remote KMS.
+//
+// Client assertions are signed by SignContext with the context of the request, bounded by WithRequestTimeout.
+type ContextSigner interface {
+	crypto.Signer
+	SignContext(ctx context.Context, rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+func (o WithClientAssertionSigner) apply(daf *DeviceAuthFlow) error {
+	if o.Signer == nil {
+		return errors.New("Signer of WithClientAssertionSigner is nil")
+	}
+
+	if _, err := signingAlgorithm(o.Signer.Public()); err != nil {
+		return err
+	}
+
+	daf.assertionSigner = o.Signer
+	daf.assertionKeyID = o.KeyID
+	return nil
+}
+
+// clientAuthParams returns additional form parameters to authenticate the client at token endpoint.
+// It returns an empty string for public clients.
+func (daf *DeviceAuthFlow) clientAuthParams(ctx context.Context) (string, error) {
+	if daf.clientSecret != "" {
+		return "&client_secret=" + neturl.QueryEscape(daf.clientSecret), nil
+	}
+
+	if daf.assertionSigner == nil {
+		return "", nil
+	}
+
+	assertion, err := daf.signClientAssertion(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("&client_assertion_type=%s&client_assertion=%s", neturl.QueryEscape(clientAssertionType), assertion), nil
+}
+
+func (daf *DeviceAuthFlow) signClientAssertion(ctx context.Context) (string, error) {
+	alg, err := signingAlgorithm(daf.assertionSigner.Public())
+	if err != nil {
+		return "", err
+	}
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if daf.assertionKeyID != "" {
+		header["kid"] = daf.assertionKeyID
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("could not generate jti of client assertion: %w", err)
+	}
+
+	now := daf.timeNow().Unix()
+	claims := map[string]interface{}{
+		"iss": daf.clientID,
+		"sub": daf.clientID,
+		"aud": daf.baseURL + "/",
+		"iat": now,
+		"exp": now + clientAssertionLifetime,
+		"jti": hex.EncodeToString(jti),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("could not encode header of client assertion: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not encode claims of client assertion: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := daf.sign(ctx, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign client assertion: %w", err)
+	}
+
+	if alg == "ES256" {
+		if sig, err = ecdsaSignatureToJWS(sig, 32); err != nil {
+			return "", err
+		}
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// sign signs digest with the signer, with ctx if the signer is a ContextSigner.
+func (daf *DeviceAuthFlow) sign(ctx context.Context, digest []byte) ([]byte, error) {
+	signer, ok := daf.assertionSigner.(ContextSigner)
+	if !ok {
+		return daf.assertionSigner.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+
+	if daf.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, daf.requestTimeout)
+		defer cancel()
+	}
+	return signer.SignContext(ctx, rand.Reader, digest, crypto.SHA256)
+}
+
+func signingAlgorithm(pub crypto.PublicKey) (string, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return "RS256", nil
+	case *ecdsa.PublicKey:
+		if pub.Curve.Params().BitSize != 256 {
+			return "", fmt.Errorf("unsupported curve for client assertion: %s", pub.Curve.Params().Name)
+		}
+		return "ES256", nil
+	default:
+		return "", fmt.Errorf("unsupported key type for client assertion: %T", pub)
+	}
+}
+
+// ecdsaSignatureToJWS converts an ASN.1 DER signature returned by crypto.Signer into the fixed length form of JWS.
+func ecdsaSignatureToJWS(der []byte, size int) ([]byte, error) {
+	var rs struct {
+		R, S *big.Int
+	}
+	if rest, err := asn1.Unmarshal(der, &rs); err != nil || len(rest) != 0 {
+		return nil, errors.New("could not decode ECDSA signature of client assertion")
+	}
+
+	sig := make([]byte, 2*size)
+	rs.R.FillBytes(sig[:size])
+	rs.S.FillBytes(sig[size:])
+	return sig, nil
+}
@@ -0,0 +1,109 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithClientAssertionSigner", func() {
+	It("authenticates token requests with a signed client assertion", func() {
+		// Arrange
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		var form map[string][]string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			form = r.PostForm
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithClientAssertionSigner{Signer: key, KeyID: "kid"},
+			auth.WithTimeNow(newStubTimeNow(0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(form["client_assertion_type"]).To(Equal([]string{"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"}))
+		Expect(form["client_assertion"]).To(HaveLen(1))
+
+		parts := strings.Split(form["client_assertion"][0], ".")
+		Expect(parts).To(HaveLen(3))
+
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig)).To(Succeed())
+
+		headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		var header map[string]string
+		Expect(json.Unmarshal(headerJSON, &header)).To(Succeed())
+		Expect(header).To(Equal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "kid"}))
+
+		claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]interface{}
+		Expect(json.Unmarshal(claimsJSON, &claims)).To(Succeed())
+		Expect(claims).To(HaveKeyWithValue("iss", "clientID"))
+		Expect(claims).To(HaveKeyWithValue("sub", "clientID"))
+		Expect(claims).To(HaveKeyWithValue("aud", ts.URL+"/"))
+		Expect(claims).To(HaveKeyWithValue("exp", BeNumerically("==", baseStubTime.Unix()+60)))
+	})
+
+	It("signs with the context of the request when the signer is a ContextSigner", func() {
+		// Arrange
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		signer := &blockingSigner{key}
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithClientAssertionSigner{Signer: signer},
+			auth.WithRequestTimeout(10*time.Millisecond),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+})
+
+// blockingSigner is a ContextSigner which blocks until ctx is done, like a hung remote KMS.
+type blockingSigner struct {
+	*rsa.PrivateKey
+}
+
+func (s *blockingSigner) SignContext(ctx context.Context, _ io.Reader, _ []byte, _ crypto.SignerOpts) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
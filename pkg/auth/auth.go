@@ -15,61 +15,192 @@
 package auth
 
 import (
+	"context"
+	"crypto"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	neturl "net/url"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/autopp/go-a0daf/pkg/jwks"
 )
 
 // DeviceAuthFlow manages Auth0's Device Authorization Flow.
 type DeviceAuthFlow struct {
-	baseURL   string
-	clientID  string
-	timeNow   func() time.Time
-	timeSleep func(d time.Duration)
+	baseURL          string
+	clientID         string
+	timeNow          func() time.Time
+	timeSleep        func(ctx context.Context, d time.Duration) error
+	assertionSigner  crypto.Signer
+	assertionKeyID   string
+	clientSecret     string
+	organization     string
+	defaultScope     string
+	defaultAudience  string
+	keepRawBody      bool
+	keepMetadata     bool
+	zeroizeBuffers   bool
+	redirectPolicy   RedirectPolicy
+	dialContext      func(ctx context.Context, network, addr string) (net.Conn, error)
+	minTLSVersion    uint16
+	proxyURL         *neturl.URL
+	headers          http.Header
+	acceptLanguage   string
+	rateLimiter      *RateLimiter
+	metrics          *Metrics
+	validators       []WithResponseValidator
+	tokenProcessors  []WithTokenProcessor
+	introspectionURL string
+	endpoints        Endpoints
+	idTokenLeeway    time.Duration
+	jwks             *jwks.Client
+	jwksOnce         sync.Once
+	jwksErr          error
+	flowID           string
+	flowIDHeader     string
+	expiryGrace      time.Duration
+	retryBudget      *RetryBudget
+	strictDecoding   bool
+	redactor         *Redactor
+	requestTimeout   time.Duration
+	retryPolicy      *RetryPolicy
+	customClient     *http.Client
+	httpClient       *http.Client
+	connections      *connectionCounter
 }
 
 // DeviceCodeResponse represents response of Auth0's device code endpoint
 //
 // See: https://auth0.com/docs/api/authentication#device-authorization-flow
-// In addition, it has ExpiresAt which means expiration date of the device code.
+// Message is a human-readable instruction for the user, returned by some providers like Microsoft Entra ID.
+// In addition, it has ExpiresAt which means expiration date of the device code,
+// Extra which holds fields not modeled here (e.g. vendor extensions),
+// and RawBody which is the response body as it is when WithRawResponseBody is given.
 type DeviceCodeResponse struct {
-	DeviceCode              string    `json:"device_code"`
-	UserCode                string    `json:"user_code"`
-	VerificationURI         string    `json:"verification_uri"`
-	VerificationURIComplete string    `json:"verification_uri_complete"`
-	ExpiresIn               int       `json:"expires_in"`
-	Interval                int       `json:"interval"`
-	ExpiresAt               time.Time `json:"-"`
+	DeviceCode              string                     `json:"device_code"`
+	UserCode                string                     `json:"user_code"`
+	VerificationURI         string                     `json:"verification_uri"`
+	VerificationURIComplete string                     `json:"verification_uri_complete"`
+	ExpiresIn               int                        `json:"expires_in"`
+	Interval                int                        `json:"interval"`
+	Message                 string                     `json:"message,omitempty"`
+	ExpiresAt               time.Time                  `json:"-"`
+	Extra                   map[string]json.RawMessage `json:"-"`
+	RawBody                 []byte                     `json:"-"`
+	// organization is the organization requested with the device code, to validate the ID token.
+	organization string
+	// flowID is the flow ID when the device code is fetched, which is shared with its polls.
+	flowID string
+	// retries is the usage of the retry budget, which is shared with its polls.
+	retries *retryUsage
+}
+
+func (dc *DeviceCodeResponse) UnmarshalJSON(b []byte) error {
+	type plain DeviceCodeResponse
+	if err := json.Unmarshal(b, (*plain)(dc)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(b, dc)
+	dc.Extra = extra
+	return err
 }
 
 // TokenResponse represents response of Auth0's token endpoint
 //
 // See: https://auth0.com/docs/api/authentication#device-authorization-flow48
+// In addition, it has Extra which holds fields not modeled here (e.g. scope or vendor extensions),
+// and RawBody which is the response body as it is when WithRawResponseBody is given.
+// Metadata is set when WithResponseMetadata is given.
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	IdToken      string `json:"id_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int    `json:"expires_in"`
+	AccessToken  string                     `json:"access_token"`
+	RefreshToken string                     `json:"refresh_token"`
+	IdToken      string                     `json:"id_token"`
+	TokenType    string                     `json:"token_type"`
+	ExpiresIn    int                        `json:"expires_in"`
+	Extra        map[string]json.RawMessage `json:"-"`
+	RawBody      []byte                     `json:"-"`
+	Metadata     *ResponseMetadata          `json:"-"`
+}
+
+func (t *TokenResponse) UnmarshalJSON(b []byte) error {
+	type plain TokenResponse
+	if err := json.Unmarshal(b, (*plain)(t)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(b, t)
+	t.Extra = extra
+	return err
+}
+
+// extraFields returns fields of JSON object b which are not decoded into struct v.
+// It returns nil when there are no such fields.
+//
+// Keys are matched to fields case-insensitively as encoding/json does, so that e.g. "Access_Token" is not kept in Extra.
+func extraFields(b []byte, v interface{}) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	rt := reflect.TypeOf(v).Elem()
+	names := make([]string, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+
+	for key := range fields {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				delete(fields, key)
+				break
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields, nil
 }
 
 // ErrorResponse represents error response of Auth0
 //
 // See: https://auth0.com/docs/api/authentication#standard-error-responses
+// MFAToken is given with mfa_required error. See MFARequired.
 type ErrorResponse struct {
 	Error            string `json:"error"`
 	ErrorDescription string `json:"error_description"`
+	MFAToken         string `json:"mfa_token,omitempty"`
 }
 
 // APIError is returned by FetchUserCode or PollToken when Auth0 API request is failed.
+//
+// RawBody is the response body as it is when WithRawResponseBody is given.
 type APIError struct {
 	StatusCode int
 	Body       *ErrorResponse
+	RawBody    []byte
 }
 
 func (e *APIError) Error() string {
@@ -93,8 +224,11 @@ type DeviceAuthFlowOption interface {
 // To configure, please pass WithBaseURL and WithClientID
 func NewDeviceAuthFlow(opts ...DeviceAuthFlowOption) (*DeviceAuthFlow, error) {
 	daf := &DeviceAuthFlow{
-		timeNow:   time.Now,
-		timeSleep: time.Sleep,
+		timeNow:       time.Now,
+		timeSleep:     sleepTimer,
+		minTLSVersion: tls.VersionTLS12,
+		idTokenLeeway: defaultIDTokenLeeway,
+		connections:   new(connectionCounter),
 	}
 
 	// apply options
@@ -108,11 +242,28 @@ func NewDeviceAuthFlow(opts ...DeviceAuthFlowOption) (*DeviceAuthFlow, error) {
 	if daf.baseURL == "" {
 		return nil, errors.New("BaseURL is not given, use WithBaseURL()")
 	}
+	if _, err := neturl.Parse(daf.baseURL); err != nil {
+		return nil, fmt.Errorf("BaseURL is invalid: %w", err)
+	}
 
 	if daf.clientID == "" {
 		return nil, errors.New("ClientID is not given, use WithClientID()")
 	}
 
+	if daf.clientSecret != "" && daf.assertionSigner != nil {
+		return nil, errors.New("WithClientSecret and WithClientAssertionSigner cannot be used together")
+	}
+
+	if daf.redactor != nil {
+		daf.redactor.AddValues(daf.clientSecret)
+	}
+
+	httpClient, err := daf.newHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+	daf.httpClient = httpClient
+
 	return daf, nil
 }
 
@@ -137,13 +288,51 @@ func (timeNow WithTimeNow) apply(daf *DeviceAuthFlow) error {
 	return nil
 }
 
+// WithTimeSleep replaces the sleep between requests.
+// When the context is done, the flow returns without waiting for the end of the sleep, which is left running.
+// Use WithTimeSleepContext to stop the sleep with the context.
 type WithTimeSleep func(d time.Duration)
 
 func (timeSleep WithTimeSleep) apply(daf *DeviceAuthFlow) error {
+	daf.timeSleep = func(ctx context.Context, d time.Duration) error {
+		if ctx.Done() == nil {
+			timeSleep(d)
+			return nil
+		}
+
+		slept := make(chan struct{})
+		go func() {
+			timeSleep(d)
+			close(slept)
+		}()
+
+		select {
+		case <-slept:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// WithTimeSleepContext replaces the sleep between requests with the function which returns ctx.Err() when ctx is done.
+type WithTimeSleepContext func(ctx context.Context, d time.Duration) error
+
+func (timeSleep WithTimeSleepContext) apply(daf *DeviceAuthFlow) error {
 	daf.timeSleep = timeSleep
 	return nil
 }
 
+// WithRawResponseBody keeps the exact bytes of response bodies in RawBody of responses and APIError,
+// e.g. for evidence trails of auditing tools.
+type WithRawResponseBody bool
+
+func (keepRawBody WithRawResponseBody) apply(daf *DeviceAuthFlow) error {
+	daf.keepRawBody = bool(keepRawBody)
+	return nil
+}
+
 func (daf *DeviceAuthFlow) BaseURL() string {
 	return daf.baseURL
 }
@@ -153,64 +342,345 @@ func (daf *DeviceAuthFlow) ClientID() string {
 }
 
 // FetchDeviceCode requests device code endpoint and returns a DeviceCodeResponse
+//
+// Empty scope and audience fall back to WithDefaultScope and WithDefaultAudience.
 func (daf *DeviceAuthFlow) FetchDeviceCode(scope string, audience string) (*DeviceCodeResponse, error) {
-	url := daf.baseURL + "/oauth/device/code"
-	payload := strings.NewReader(fmt.Sprintf("client_id=%s&scope=%s&audience=%s", daf.clientID, neturl.QueryEscape(scope), neturl.QueryEscape(audience)))
+	return daf.FetchDeviceCodeContext(context.Background(), scope, audience)
+}
+
+// FetchDeviceCodeContext is like FetchDeviceCode, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) FetchDeviceCodeContext(ctx context.Context, scope string, audience string) (*DeviceCodeResponse, error) {
+	return daf.requestDeviceCode(ctx, &DeviceCodeRequest{Scope: scope, Audience: audience})
+}
+
+// RequestDeviceCode is like FetchDeviceCode, but takes parameters as DeviceCodeRequest.
+func (daf *DeviceAuthFlow) RequestDeviceCode(req *DeviceCodeRequest) (*DeviceCodeResponse, error) {
+	return daf.requestDeviceCode(context.Background(), req)
+}
+
+func (daf *DeviceAuthFlow) requestDeviceCode(ctx context.Context, req *DeviceCodeRequest) (*DeviceCodeResponse, error) {
+	params, err := daf.deviceCodeParams(req)
+	if err != nil {
+		return nil, err
+	}
+
+	flowID := daf.flowIDFromContext(ctx)
+	// retries is shared with polls only when the budget is given
+	var retries *retryUsage
+	if daf.retryBudget != nil {
+		retries = new(retryUsage)
+	}
+	var statusCode int
+	var header http.Header
+	var resBody []byte
+	attempt := 0
+	for {
+		attempt++
+		statusCode, header, resBody, err = daf.postForm(contextWithRequestInfo(ctx, flowID, attempt), daf.deviceCodeURL(), strings.NewReader(params))
+		if err == nil && statusCode != 200 && statusCode/100 != 4 {
+			err = &ServerError{Request: "device code", StatusCode: statusCode, Body: daf.redact(resBody)}
+		}
+		if err == nil && statusCode == http.StatusTooManyRequests {
+			err = daf.apiError("device code", statusCode, header, resBody)
+		}
 
-	statusCode, resBody, err := postForm(url, payload)
+		delay, ok := daf.retryPolicy.backoff(attempt-1, err)
+		if !ok {
+			break
+		}
+		if reset, limited := daf.untilReset(err); limited && reset > delay {
+			delay = reset
+		}
+		if !daf.spendRetry(retries, delay) {
+			break
+		}
+		if err := daf.timeSleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
 	now := daf.timeNow()
 	if err != nil {
 		return nil, err
 	}
 
 	if statusCode != 200 {
-		if statusCode/100 == 4 {
-			er := new(ErrorResponse)
-			if err := json.Unmarshal(resBody, er); err != nil {
-				return nil, fmt.Errorf("could not decode device code response body: %w", err)
-			}
-			return nil, &APIError{StatusCode: statusCode, Body: er}
-		}
-		return nil, fmt.Errorf("device code request was failed: %s", string(resBody))
+		return nil, daf.apiError("device code", statusCode, header, resBody)
 	}
 
 	dc := new(DeviceCodeResponse)
-	if err := json.Unmarshal(resBody, dc); err != nil {
+	defer daf.zeroize(resBody)
+	if err := daf.decodeResponse(resBody, dc); err != nil {
 		return nil, fmt.Errorf("could not decode device code response body: %w", err)
 	}
 
+	// expires_in is relative, so the local clock is immune to the skew against the server unlike its Date header
 	dc.ExpiresAt = now.Add(time.Duration(dc.ExpiresIn) * time.Second)
+	dc.retries = retries
+	dc.RawBody = daf.rawBody(resBody)
+	dc.organization = daf.requestedOrganization(req)
+	dc.flowID = flowID
+
+	if err := daf.validateDeviceCode(contextWithRequestInfo(ctx, flowID, attempt), dc); err != nil {
+		return nil, err
+	}
 
 	return dc, nil
 }
 
+func (daf *DeviceAuthFlow) deviceCodeURL() string {
+	return daf.discoveredOr(daf.endpoints.DeviceAuthorizationEndpoint, "/oauth/device/code")
+}
+
+func (daf *DeviceAuthFlow) deviceCodeParams(req *DeviceCodeRequest) (string, error) {
+	scope := req.Scope
+	if scope == "" {
+		scope = daf.defaultScope
+	}
+	audience := req.Audience
+	if audience == "" {
+		audience = daf.defaultAudience
+	}
+	params := fmt.Sprintf("client_id=%s&scope=%s&audience=%s", daf.clientID, neturl.QueryEscape(scope), neturl.QueryEscape(audience))
+	org := daf.requestedOrganization(req)
+	if org != "" {
+		params += "&organization=" + neturl.QueryEscape(org)
+	}
+	if req.Invitation != "" {
+		if org == "" {
+			return "", errors.New("invitation requires organization")
+		}
+		params += "&invitation=" + neturl.QueryEscape(req.Invitation)
+	}
+
+	extra, err := encodeExtraParams(req.Extra, "client_id", "scope", "audience", "organization", "invitation")
+	if err != nil {
+		return "", err
+	}
+
+	return params + extra, nil
+}
+
+// requestedOrganization returns the organization of req, or the one given by WithOrganization.
+func (daf *DeviceAuthFlow) requestedOrganization(req *DeviceCodeRequest) string {
+	if req.Organization != "" {
+		return req.Organization
+	}
+	return daf.organization
+}
+
+// NewDeviceCodeRequest returns the request which FetchDeviceCode sends, e.g. to show it without sending.
+func (daf *DeviceAuthFlow) NewDeviceCodeRequest(scope string, audience string) (*http.Request, error) {
+	params, err := daf.deviceCodeParams(&DeviceCodeRequest{Scope: scope, Audience: audience})
+	if err != nil {
+		return nil, err
+	}
+	return daf.newFormRequest(context.Background(), daf.deviceCodeURL(), strings.NewReader(params))
+}
+
+// NewTokenRequest returns the request which PollToken sends for the device code, e.g. to show it without sending.
+//
+// With WithClientAssertionSigner, a client assertion is signed for the request.
+func (daf *DeviceAuthFlow) NewTokenRequest(deviceCode string) (*http.Request, error) {
+	authParams, err := daf.clientAuthParams(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return daf.newFormRequest(context.Background(), daf.tokenURL(), strings.NewReader(daf.tokenParams(deviceCode)+authParams))
+}
+
+func (daf *DeviceAuthFlow) tokenURL() string {
+	return daf.discoveredOr(daf.endpoints.TokenEndpoint, "/oauth/token")
+}
+
+func (daf *DeviceAuthFlow) tokenParams(deviceCode string) string {
+	return fmt.Sprintf("grant_type=%s&device_code=%s&client_id=%s", "urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Adevice_code", deviceCode, daf.clientID)
+}
+
+// slowDownStep is the increase of the polling interval on slow_down responses.
+const slowDownStep = 5 * time.Second
+
 // PollToken polls token endpoint and returns a TokenResponse when verified.
 //
+// When slow_down is returned, the polling interval is increased by 5 seconds as RFC 8628 requires.
 // When verification is expired, it returns ExpiredError.
 func (daf *DeviceAuthFlow) PollToken(dc *DeviceCodeResponse) (*TokenResponse, error) {
-	interval := time.Duration(dc.Interval) * time.Second
-	url := daf.baseURL + "/oauth/token"
-	payload := fmt.Sprintf("grant_type=%s&device_code=%s&client_id=%s", "urn%3Aietf%3Aparams%3Aoauth%3Agrant-type%3Adevice_code", dc.DeviceCode, daf.clientID)
+	return daf.PollTokenContext(context.Background(), dc)
+}
+
+// PollTokenContext is like PollToken, but polling is aborted and ctx.Err() is returned when ctx is done.
+func (daf *DeviceAuthFlow) PollTokenContext(ctx context.Context, dc *DeviceCodeResponse) (*TokenResponse, error) {
+	token, _, err := daf.requestToken(ctx, &TokenRequest{DeviceCode: dc})
+	return token, err
+}
+
+// PollStats represents statistics of polling by PollTokenWithStats.
+type PollStats struct {
+	// Attempts is the number of requests to token endpoint.
+	Attempts int
+	// Pending is the number of authorization_pending responses.
+	Pending int
+	// Retries is the number of requests retried because of transient failures.
+	Retries int
+	// SlowDowns is the number of slow_down responses.
+	SlowDowns int
+	// RateLimited is the number of 429 responses, after which polling waited for the reset of the rate limit.
+	RateLimited int
+	// Interval is the polling interval at the end, which is increased by slow_down responses.
+	Interval time.Duration
+	// WallTime is the duration from the start to the end of polling, measured by the real clock regardless of WithTimeNow.
+	WallTime time.Duration
+}
+
+// PollTokenWithStats is like PollToken, but also returns PollStats even if an error is returned.
+func (daf *DeviceAuthFlow) PollTokenWithStats(dc *DeviceCodeResponse) (*TokenResponse, *PollStats, error) {
+	return daf.RequestToken(&TokenRequest{DeviceCode: dc})
+}
+
+// RequestToken is like PollTokenWithStats, but takes parameters as TokenRequest.
+func (daf *DeviceAuthFlow) RequestToken(req *TokenRequest) (*TokenResponse, *PollStats, error) {
+	return daf.requestToken(context.Background(), req)
+}
+
+func (daf *DeviceAuthFlow) requestToken(ctx context.Context, req *TokenRequest) (*TokenResponse, *PollStats, error) {
+	stats := new(PollStats)
+	start := time.Now()
+	token, err := daf.pollTokenWith(ctx, req, stats, func(d time.Duration) error {
+		return daf.timeSleep(ctx, d)
+	})
+	stats.WallTime = time.Since(start)
+	return token, stats, err
+}
+
+// sleepTimer sleeps for d, but returns ctx.Err() without waiting for the end of sleep when ctx is done.
+func sleepTimer(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pollTokenWith polls token endpoint with the device code, calling wait between requests. Polling is aborted when wait returns an error.
+func (daf *DeviceAuthFlow) pollTokenWith(ctx context.Context, req *TokenRequest, stats *PollStats, wait func(d time.Duration) error) (*TokenResponse, error) {
+	dc := req.DeviceCode
+	extra, err := encodeExtraParams(req.Extra, "grant_type", "device_code", "client_id", "client_secret", "client_assertion", "client_assertion_type")
+	if err != nil {
+		return nil, err
+	}
+	organization := dc.organization
+	if organization == "" {
+		organization = daf.organization
+	}
+
+	flowID := daf.pollFlowID(ctx, dc.flowID, dc.DeviceCode)
+
+	return daf.pollGrantWith(ctx, &pollGrant{
+		params:       daf.tokenParams(dc.DeviceCode) + extra,
+		interval:     time.Duration(dc.Interval) * time.Second,
+		expiresIn:    dc.ExpiresIn,
+		expiresAt:    dc.ExpiresAt,
+		retries:      dc.retries,
+		organization: organization,
+		flowID:       flowID,
+	}, stats, wait)
+}
+
+// pollGrant is a grant which is polled at token endpoint until the user authorizes it,
+// i.e. the device code grant or the CIBA grant.
+type pollGrant struct {
+	params       string
+	interval     time.Duration
+	expiresIn    int
+	expiresAt    time.Time
+	retries      *retryUsage
+	organization string
+	flowID       string
+}
+
+// pollGrantWith polls token endpoint with g, calling wait between requests. Polling is aborted when wait returns an error.
+func (daf *DeviceAuthFlow) pollGrantWith(ctx context.Context, g *pollGrant, stats *PollStats, wait func(d time.Duration) error) (*TokenResponse, error) {
+	interval := g.interval
+	stats.Interval = interval
+	url := daf.tokenURL()
+	// failures is the number of consecutive transient failures
+	failures := 0
+	retries := g.retries
+	if retries == nil {
+		retries = new(retryUsage)
+	}
 
 	for {
-		if !daf.timeNow().Before(dc.ExpiresAt) {
+		if daf.expired(g.expiresAt, 0) {
 			return nil, &ExpiredError{
-				ExpiresIn: dc.ExpiresIn,
+				ExpiresIn: g.expiresIn,
 			}
 		}
 
-		statusCode, resBody, err := postForm(url, strings.NewReader(payload))
+		// client assertion is signed for each request because it can be used only once
+		authParams, err := daf.clientAuthParams(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Attempts++
+		reqCtx := contextWithRequestInfo(ctx, g.flowID, stats.Attempts)
+		statusCode, header, resBody, err := daf.postForm(reqCtx, url, strings.NewReader(g.params+authParams))
+		if err == nil && statusCode != 200 && statusCode/100 != 4 {
+			err = &ServerError{Request: "token", StatusCode: statusCode, Body: daf.redact(resBody)}
+		}
+		if err != nil {
+			delay, ok := daf.retryPolicy.backoff(failures, err)
+			if !ok || !daf.spendRetry(retries, delay) {
+				return nil, err
+			}
+			failures++
+			stats.Retries++
+			if err := wait(delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		failures = 0
+
+		// wait for the reset of the rate limit instead of failing, unless the device code expires before that
+		if statusCode == http.StatusTooManyRequests {
+			err := daf.apiError("token", statusCode, header, resBody)
+			reset, _ := daf.untilReset(err)
+			if daf.expired(g.expiresAt, reset) {
+				return nil, err
+			}
+			if reset < interval {
+				reset = interval
+			}
+			if !daf.spendRetry(retries, reset) {
+				return nil, err
+			}
+			stats.RateLimited++
+			if err := wait(reset); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
 		if statusCode == 200 {
 			t := new(TokenResponse)
-			if err = json.Unmarshal(resBody, t); err != nil {
+			defer daf.zeroize(resBody)
+			if err = daf.decodeResponse(resBody, t); err != nil {
 				return nil, fmt.Errorf("could not decode token response body: %w", err)
 			}
-			return t, nil
-		}
-
-		if statusCode/100 != 4 {
-			return nil, fmt.Errorf("token request was failed: %s", string(resBody))
+			if err := validateOrganization(g.organization, t); err != nil {
+				return nil, err
+			}
+			t.RawBody = daf.rawBody(resBody)
+			t.Metadata = daf.metadata(statusCode, header, stats.Attempts)
+			if err := daf.validateToken(reqCtx, t); err != nil {
+				return nil, err
+			}
+			return daf.processToken(reqCtx, t)
 		}
 
 		er := new(ErrorResponse)
@@ -218,30 +688,193 @@ func (daf *DeviceAuthFlow) PollToken(dc *DeviceCodeResponse) (*TokenResponse, er
 			return nil, fmt.Errorf("could not decode token response body: %w", err)
 		}
 
-		if er.Error != "authorization_pending" {
-			return nil, &APIError{StatusCode: statusCode, Body: er}
+		switch er.Error {
+		case "authorization_pending":
+			stats.Pending++
+		case "slow_down":
+			// See: https://datatracker.ietf.org/doc/html/rfc8628#section-3.5
+			interval += slowDownStep
+			stats.SlowDowns++
+			stats.Interval = interval
+		default:
+			return nil, &APIError{StatusCode: statusCode, Body: er, RawBody: daf.redact(daf.rawBody(resBody))}
 		}
 
-		daf.timeSleep(interval)
+		if err := wait(interval); err != nil {
+			return nil, err
+		}
 	}
 }
 
-func postForm(url string, payload io.Reader) (int, []byte, error) {
-	req, err := http.NewRequest("POST", url, payload)
+// ExchangeRefreshToken requests token endpoint with the refresh token grant and returns a new TokenResponse.
+//
+// See: https://auth0.com/docs/api/authentication#refresh-token
+func (daf *DeviceAuthFlow) ExchangeRefreshToken(refreshToken string) (*TokenResponse, error) {
+	return daf.ExchangeRefreshTokenContext(context.Background(), refreshToken)
+}
+
+// ExchangeRefreshTokenContext is like ExchangeRefreshToken, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) ExchangeRefreshTokenContext(ctx context.Context, refreshToken string) (*TokenResponse, error) {
+	return daf.exchangeToken(ctx, fmt.Sprintf("grant_type=refresh_token&client_id=%s&refresh_token=%s", daf.clientID, neturl.QueryEscape(refreshToken)))
+}
+
+// exchangeToken requests token endpoint with params of a grant, which is not polled unlike the device code grant.
+func (daf *DeviceAuthFlow) exchangeToken(ctx context.Context, params string) (*TokenResponse, error) {
+	ctx = contextWithRequestInfo(ctx, daf.flowIDFromContext(ctx), 1)
+	authParams, err := daf.clientAuthParams(ctx)
 	if err != nil {
-		return 0, nil, fmt.Errorf("could not create request: %w", err)
+		return nil, err
+	}
+
+	statusCode, header, resBody, err := daf.postForm(ctx, daf.tokenURL(), strings.NewReader(params+authParams))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			return nil, daf.apiError("token", statusCode, header, resBody)
+		}
+		return nil, &ServerError{Request: "token", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	t := new(TokenResponse)
+	defer daf.zeroize(resBody)
+	if err := daf.decodeResponse(resBody, t); err != nil {
+		return nil, fmt.Errorf("could not decode token response body: %w", err)
+	}
+
+	if err := validateOrganization(daf.organization, t); err != nil {
+		return nil, err
+	}
+	t.RawBody = daf.rawBody(resBody)
+	t.Metadata = daf.metadata(statusCode, header, 1)
+
+	if err := daf.validateToken(ctx, t); err != nil {
+		return nil, err
+	}
+
+	return daf.processToken(ctx, t)
+}
+
+// Authorize runs whole of the device authorization flow.
+//
+// It fetches a device code, passes it to prompt to show the user code and the verification URI to the user,
+// and polls token. When prompt returns an error, Authorize returns it without polling.
+func (daf *DeviceAuthFlow) Authorize(scope string, audience string, prompt func(dc *DeviceCodeResponse) error) (*TokenResponse, error) {
+	dc, err := daf.FetchDeviceCode(scope, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prompt(dc); err != nil {
+		return nil, err
+	}
+
+	return daf.PollToken(dc)
+}
+
+// AuthorizeWithReissue is like Authorize, but fetches a new device code and calls prompt again
+// instead of returning ExpiredError when the device code is expired.
+//
+// New device codes are issued up to maxReissues times, and then ExpiredError is returned.
+// Negative maxReissues means no limit.
+func (daf *DeviceAuthFlow) AuthorizeWithReissue(scope string, audience string, maxReissues int, prompt func(dc *DeviceCodeResponse) error) (*TokenResponse, error) {
+	for reissues := 0; ; reissues++ {
+		token, err := daf.Authorize(scope, audience, prompt)
+		var expiredError *ExpiredError
+		if err == nil || !errors.As(err, &expiredError) || (maxReissues >= 0 && reissues >= maxReissues) {
+			return token, err
+		}
+	}
+}
+
+func (daf *DeviceAuthFlow) rawBody(b []byte) []byte {
+	if !daf.keepRawBody {
+		return nil
+	}
+	return b
+}
+
+// endpointURL returns the URL of the endpoint path like "/oauth/token" under the base URL.
+// The path prefix and the query of the base URL are kept, e.g. for API gateways like https://gateway.example.com/auth0.
+func (daf *DeviceAuthFlow) endpointURL(path string) *neturl.URL {
+	// the base URL is validated by NewDeviceAuthFlow
+	u, _ := neturl.Parse(daf.baseURL)
+	return joinURLPath(u, path)
+}
+
+// joinURLPath appends path to the path of u regardless of the trailing slash, and returns u.
+func joinURLPath(u *neturl.URL, path string) *neturl.URL {
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/") + path
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	return u
+}
+
+// endpoint is like endpointURL, but returns the URL as a string.
+func (daf *DeviceAuthFlow) endpoint(path string) string {
+	return daf.endpointURL(path).String()
+}
+
+// newFormRequest returns a POST request of the form with headers.
+func (daf *DeviceAuthFlow) newFormRequest(ctx context.Context, url string, payload io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
 	}
 	req.Header.Add("content-type", "application/x-www-form-urlencoded")
-	res, err := http.DefaultClient.Do(req)
+	setAcceptEncoding(req)
+	daf.setHeaders(req)
+
+	return req, nil
+}
+
+// postForm posts the form to url. ctx has RequestInfo of the request, or a new flow is started.
+func (daf *DeviceAuthFlow) postForm(ctx context.Context, url string, payload io.Reader) (int, http.Header, []byte, error) {
+	if _, ok := RequestInfoFromContext(ctx); !ok {
+		ctx = contextWithRequestInfo(ctx, daf.flowIDFromContext(ctx), 1)
+	}
+	req, err := daf.newFormRequest(ctx, url, payload)
 	if err != nil {
-		return 0, nil, fmt.Errorf("request was failed: %w", err)
+		return 0, nil, nil, err
+	}
+	return daf.send(ctx, req)
+}
+
+// send sends req with the rate limiter, the timeout and metrics, and returns the response.
+func (daf *DeviceAuthFlow) send(ctx context.Context, req *http.Request) (int, http.Header, []byte, error) {
+	daf.setFlowIDHeader(req)
+	if err := daf.waitRateLimit(ctx); err != nil {
+		return 0, nil, nil, err
+	}
+	if daf.requestTimeout > 0 {
+		// the timeout does not include waiting for the rate limiter
+		reqCtx, cancel := context.WithTimeout(ctx, daf.requestTimeout)
+		defer cancel()
+		req = req.WithContext(reqCtx)
+	}
+	start := time.Now()
+	res, err := daf.httpClient.Do(daf.traceConnection(req))
+	if err != nil {
+		daf.metrics.observe(req.URL.Path, 0, time.Since(start))
+		if ctx.Err() != nil {
+			return 0, nil, nil, ctx.Err()
+		}
+		return 0, nil, nil, &NetworkError{Op: "request", Err: err}
 	}
 	defer res.Body.Close()
 
-	resBody, err := io.ReadAll(res.Body)
+	resBody, err := readBody(res)
+	daf.metrics.observe(req.URL.Path, res.StatusCode, time.Since(start))
 	if err != nil {
-		return 0, nil, fmt.Errorf("could not read response body: %w", err)
+		var encodingError *ContentEncodingError
+		if errors.As(err, &encodingError) || errors.Is(err, ErrResponseTooLarge) {
+			return 0, nil, nil, err
+		}
+		return 0, nil, nil, &NetworkError{Op: "read", Err: err}
 	}
 
-	return res.StatusCode, resBody, nil
+	return res.StatusCode, res.Header, resBody, nil
 }
@@ -1,6 +1,8 @@
 package auth_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +12,7 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
 )
 
 var _ = Describe("DeviceAuthFlow", func() {
@@ -64,15 +67,54 @@ var _ = Describe("DeviceAuthFlow", func() {
 
 			// Assert
 			Expect(err).NotTo(HaveOccurred())
-			Expect(actual).To(Equal(&auth.DeviceCodeResponse{
-				DeviceCode:              deviceCode,
-				UserCode:                userCode,
-				VerificationURI:         verificationURI,
-				VerificationURIComplete: verificationURIComplete,
-				ExpiresIn:               expiresIn,
-				Interval:                interval,
-				ExpiresAt:               baseStubTime.Add(time.Duration(expiresIn) * time.Second),
-			}))
+			// the flow ID kept in the response is random, and is tested in flowctx_test.go
+			Expect(actual).To(PointTo(MatchFields(IgnoreExtras, Fields{
+				"DeviceCode":              Equal(deviceCode),
+				"UserCode":                Equal(userCode),
+				"VerificationURI":         Equal(verificationURI),
+				"VerificationURIComplete": Equal(verificationURIComplete),
+				"ExpiresIn":               Equal(expiresIn),
+				"Interval":                Equal(interval),
+				"Message":                 BeEmpty(),
+				"ExpiresAt":               Equal(baseStubTime.Add(time.Duration(expiresIn) * time.Second)),
+			})))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns DeviceCodeResponse with Message of the provider", func() {
+			// Arrange
+			message := "To sign in, use a web browser to open the page https://example.com/activate and enter the code 123456 to authenticate."
+			ms := newMockServer([]requestExpectation{
+				{
+					path: "/oauth/device/code",
+					form: map[string][]string{
+						"client_id": {clientID},
+						"scope":     {scope},
+						"audience":  {audience},
+					},
+					statusCode: 200,
+					responseBody: fmt.Sprintf(`{
+						"device_code": "%s",
+						"user_code": "%s",
+						"verification_uri": "%s",
+						"expires_in": %d,
+						"interval": %d,
+						"message": "%s"
+					}`, deviceCode, userCode, verificationURI, expiresIn, interval, message),
+				},
+			})
+			defer ms.Close()
+
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			actual, err := daf.FetchDeviceCode(scope, audience)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual.Message).To(Equal(message))
+			Expect(actual.Extra).To(BeNil())
 			Expect(ms.restExpects()).To(BeEmpty())
 		})
 
@@ -195,6 +237,77 @@ var _ = Describe("DeviceAuthFlow", func() {
 			Expect(timeSleep.calls).To(Equal([]time.Duration{intervalD, intervalD}))
 		})
 
+		It("returns PollStats with PollTokenWithStats()", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				authorizationPending,
+				authorizationPending,
+				{
+					path:         apiPath,
+					form:         expectedForm,
+					statusCode:   200,
+					responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithTimeNow(newStubTimeNow(interval)),
+				auth.WithTimeSleep(newMockTimeSleep().f),
+			)
+
+			// Act
+			_, stats, err := daf.PollTokenWithStats(dc)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Attempts).To(Equal(3))
+			Expect(stats.Pending).To(Equal(2))
+			Expect(stats.Retries).To(Equal(0))
+			Expect(stats.WallTime).To(BeNumerically(">", 0))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("increases interval when slow_down is returned", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path:         apiPath,
+					form:         expectedForm,
+					statusCode:   400,
+					responseBody: `{"error": "slow_down", "error_description": "slow down"}`,
+				},
+				authorizationPending,
+				{
+					path:         apiPath,
+					form:         expectedForm,
+					statusCode:   200,
+					responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+				},
+			})
+			defer ms.Close()
+
+			timeSleep := newMockTimeSleep()
+			daf, _ := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithTimeNow(newStubTimeNow(interval)),
+				auth.WithTimeSleep(timeSleep.f),
+			)
+
+			// Act
+			_, stats, err := daf.PollTokenWithStats(dc)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(timeSleep.calls).To(Equal([]time.Duration{intervalD + 5*time.Second, intervalD + 5*time.Second}))
+			Expect(stats.SlowDowns).To(Equal(1))
+			Expect(stats.Interval).To(Equal(intervalD + 5*time.Second))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
 		It("returns ExpiredError when authorization was expired", func() {
 			// Arrange
 			ms := newMockServer([]requestExpectation{
@@ -267,6 +380,320 @@ var _ = Describe("DeviceAuthFlow", func() {
 			Expect(timeSleep.calls).To(BeEmpty())
 		})
 	})
+
+	Describe("ExchangeRefreshToken()", func() {
+		expectedForm := map[string][]string{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {clientID},
+			"refresh_token": {"refresh_token"},
+		}
+
+		It("returns token when succeeded", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path:         "/oauth/token",
+					form:         expectedForm,
+					statusCode:   200,
+					responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+
+			// Act
+			actual, err := daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(&auth.TokenResponse{
+				AccessToken: "access_token",
+				TokenType:   "Bearer",
+				ExpiresIn:   86400,
+			}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns token with fields not modeled in Extra", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path:         "/oauth/token",
+					form:         expectedForm,
+					statusCode:   200,
+					responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400, "scope": "openid profile", "ext": {"tier": 1}}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+
+			// Act
+			actual, err := daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(&auth.TokenResponse{
+				AccessToken: "access_token",
+				TokenType:   "Bearer",
+				ExpiresIn:   86400,
+				Extra: map[string]json.RawMessage{
+					"scope": json.RawMessage(`"openid profile"`),
+					"ext":   json.RawMessage(`{"tier": 1}`),
+				},
+			}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("does not keep fields matched case-insensitively in Extra", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path:         "/oauth/token",
+					form:         expectedForm,
+					statusCode:   200,
+					responseBody: `{"Access_Token": "access_token", "token_type": "Bearer", "EXPIRES_IN": 86400}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+
+			// Act
+			actual, err := daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(&auth.TokenResponse{
+				AccessToken: "access_token",
+				TokenType:   "Bearer",
+				ExpiresIn:   86400,
+			}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns token and APIError with raw response bodies when WithRawResponseBody is given", func() {
+			// Arrange
+			tokenBody := `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`
+			errorBody := `{"error": "invalid_grant", "error_description": "Unknown or invalid refresh token."}`
+			ms := newMockServer([]requestExpectation{
+				{path: "/oauth/token", form: expectedForm, statusCode: 200, responseBody: tokenBody},
+				{path: "/oauth/token", form: expectedForm, statusCode: 403, responseBody: errorBody},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithRawResponseBody(true))
+
+			// Act
+			actual, err := daf.ExchangeRefreshToken("refresh_token")
+			_, apiErr := daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(actual.RawBody)).To(Equal(tokenBody))
+			var apiError *auth.APIError
+			Expect(errors.As(apiErr, &apiError)).To(BeTrue())
+			Expect(string(apiError.RawBody)).To(Equal(errorBody))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns APIError when 4xx occured", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path:         "/oauth/token",
+					form:         expectedForm,
+					statusCode:   403,
+					responseBody: `{"error": "invalid_grant", "error_description": "Unknown or invalid refresh token."}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+
+			// Act
+			_, err := daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			Expect(err).To(MatchError(&auth.APIError{
+				StatusCode: 403,
+				Body:       &auth.ErrorResponse{Error: "invalid_grant", ErrorDescription: "Unknown or invalid refresh token."},
+			}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+	})
+
+	Describe("AuthorizeWithReissue()", func() {
+		scope := "openid profile"
+		audience := "https://example.com/api"
+		expiresIn := 20
+		interval := 5
+
+		deviceCode := func(code string) requestExpectation {
+			return requestExpectation{
+				path: "/oauth/device/code",
+				form: map[string][]string{
+					"client_id": {clientID},
+					"scope":     {scope},
+					"audience":  {audience},
+				},
+				statusCode: 200,
+				responseBody: fmt.Sprintf(`{
+					"device_code": "%s",
+					"user_code": "%s",
+					"verification_uri": "https://example.com/activate",
+					"verification_uri_complete": "https://example.com/activate/?user_code=%s",
+					"expires_in": %d,
+					"interval": %d
+				}`, code, code, code, expiresIn, interval),
+			}
+		}
+		pending := func(code string) requestExpectation {
+			return requestExpectation{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+					"device_code": {code},
+					"client_id":   {clientID},
+				},
+				statusCode:   401,
+				responseBody: `{"error": "authorization_pending", "error_description": "authorization pending"}`,
+			}
+		}
+
+		It("returns token with reissued device code", func() {
+			// Arrange
+			authorized := pending("second")
+			authorized.statusCode = 200
+			authorized.responseBody = `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`
+			ms := newMockServer([]requestExpectation{
+				deviceCode("first"),
+				pending("first"),
+				pending("first"),
+				pending("first"),
+				deviceCode("second"),
+				authorized,
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithTimeNow(newStubTimeNow(interval)),
+				auth.WithTimeSleep(newMockTimeSleep().f),
+			)
+			prompted := make([]string, 0)
+
+			// Act
+			actual, err := daf.AuthorizeWithReissue(scope, audience, 1, func(dc *auth.DeviceCodeResponse) error {
+				prompted = append(prompted, dc.UserCode)
+				return nil
+			})
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(&auth.TokenResponse{
+				AccessToken: "access_token",
+				TokenType:   "Bearer",
+				ExpiresIn:   86400,
+			}))
+			Expect(prompted).To(Equal([]string{"first", "second"}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns ExpiredError when reissued too many times", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				deviceCode("first"),
+				pending("first"),
+				pending("first"),
+				pending("first"),
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithTimeNow(newStubTimeNow(interval)),
+				auth.WithTimeSleep(newMockTimeSleep().f),
+			)
+
+			// Act
+			_, err := daf.AuthorizeWithReissue(scope, audience, 0, func(dc *auth.DeviceCodeResponse) error {
+				return nil
+			})
+
+			// Assert
+			Expect(err).To(MatchError(&auth.ExpiredError{ExpiresIn: expiresIn}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("WithBaseURL", func() {
+	clientID := "clientID"
+
+	It("joins endpoints to the path prefix of the base URL", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/auth0/oauth/device/code",
+				form:         map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}},
+				statusCode:   200,
+				responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`,
+			},
+			{
+				path:         "/auth0/oauth/token",
+				form:         map[string][]string{"grant_type": {"urn:ietf:params:oauth:grant-type:device_code"}, "device_code": {"device_code"}, "client_id": {clientID}},
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL+"/auth0/"),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.Authorize("openid", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("keeps the query of the base URL", func() {
+		// Arrange
+		var requestURI string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestURI = r.URL.RequestURI()
+		}))
+		defer ts.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL+"/gateway/auth0?key=secret"), auth.WithClientID(clientID))
+
+		// Act
+		err := daf.Revoke("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requestURI).To(Equal("/gateway/auth0/oauth/revoke?key=secret"))
+	})
+
+	It("returns error when the base URL is invalid", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com/%zz"), auth.WithClientID(clientID))
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("BaseURL is invalid")))
+	})
 })
 
 // stub auth0 api
@@ -275,6 +702,8 @@ type requestExpectation struct {
 	form         map[string][]string
 	statusCode   int
 	responseBody string
+	// responseHeader is added to the headers of the response
+	responseHeader map[string]string
 }
 
 type mockServer struct {
@@ -310,6 +739,9 @@ func newMockServer(expects []requestExpectation) *mockServer {
 			form:   expected.form,
 		}), "unexpected request")
 
+		for k, v := range expected.responseHeader {
+			w.Header().Set(k, v)
+		}
 		w.WriteHeader(expected.statusCode)
 		w.Header().Add("content-type", "application/json")
 		w.Write([]byte(expected.responseBody))
@@ -0,0 +1,288 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+
+	"github.com/autopp/go-a0daf/pkg/jwt"
+)
+
+// callbackPath is the default path of the redirect URI served by AuthCodeFlow.
+const callbackPath = "/callback"
+
+// AuthCodeFlow is the authorization code flow with PKCE for environments where a browser is available locally.
+// Instead of polling, it receives the code by a loopback HTTP server as RFC 8252 recommends.
+//
+// http://127.0.0.1:PORT/callback must be allowed as a callback URL of the application by default.
+// See WithRedirectURI, WithCallbackPortRange and WithIPv6Loopback to change it.
+//
+// See: https://auth0.com/docs/get-started/authentication-and-authorization-flow/authorization-code-flow-with-pkce
+type AuthCodeFlow struct {
+	daf  *DeviceAuthFlow
+	open func(url string) error
+
+	redirectURI *neturl.URL
+	portFrom    int
+	portTo      int
+	ipv6        bool
+	landing     WithLandingPage
+}
+
+// AuthCodeFlowOption configures the loopback server of AuthCodeFlow.
+type AuthCodeFlowOption interface {
+	apply(f *AuthCodeFlow) error
+}
+
+// NewAuthCodeFlow returns an AuthCodeFlow which shares the configuration of daf.
+//
+// open is called with the authorization URL to open it in the browser.
+// The loopback server listens on any free port unless options are given.
+func (daf *DeviceAuthFlow) NewAuthCodeFlow(open func(url string) error, opts ...AuthCodeFlowOption) (*AuthCodeFlow, error) {
+	f := &AuthCodeFlow{daf: daf, open: open}
+	for _, opt := range opts {
+		if err := opt.apply(f); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.redirectURI != nil && (f.portFrom != 0 || f.ipv6) {
+		return nil, errors.New("WithRedirectURI cannot be given with WithCallbackPortRange or WithIPv6Loopback")
+	}
+
+	return f, nil
+}
+
+// PKCE is a pair of the code verifier and the code challenge of RFC 7636.
+type PKCE struct {
+	Verifier string
+	// Challenge is derived from Verifier with the S256 method.
+	Challenge string
+}
+
+// NewPKCE returns a PKCE with a random verifier.
+func NewPKCE() (*PKCE, error) {
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return &PKCE{Verifier: verifier, Challenge: base64.RawURLEncoding.EncodeToString(sum[:])}, nil
+}
+
+// randomString returns a URL-safe string of 256 random bits.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthorizationError is returned by AuthCodeFlow when the user is redirected back with an error (e.g. access_denied).
+type AuthorizationError struct {
+	Code        string
+	Description string
+}
+
+func (e *AuthorizationError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// pendingAuthorization holds the secrets of an authorization request until its redirect is handled.
+type pendingAuthorization struct {
+	// state binds the redirect to the request to prevent CSRF.
+	state string
+	// nonce binds the ID token to the request to prevent replay.
+	nonce       string
+	pkce        *PKCE
+	redirectURI string
+}
+
+func newPendingAuthorization(redirectURI string) (*pendingAuthorization, error) {
+	pkce, err := NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &pendingAuthorization{state: state, nonce: nonce, pkce: pkce, redirectURI: redirectURI}, nil
+}
+
+// NonceError is returned by AuthCodeFlow when the nonce claim of the ID token does not match the one sent with the request.
+type NonceError struct {
+	Actual string
+}
+
+func (e *NonceError) Error() string {
+	return fmt.Sprintf("ID token has unexpected nonce %q", e.Actual)
+}
+
+// validateNonce validates the nonce claim of the ID token if it is issued.
+func (p *pendingAuthorization) validateNonce(t *TokenResponse) error {
+	if t.IdToken == "" {
+		return nil
+	}
+
+	idToken, err := jwt.Decode(t.IdToken)
+	if err != nil {
+		return fmt.Errorf("could not decode ID token: %w", err)
+	}
+
+	actual, _ := idToken.Claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(actual), []byte(p.nonce)) != 1 {
+		return &NonceError{Actual: actual}
+	}
+
+	return nil
+}
+
+// Authorize opens the authorization URL, waits for the redirect to the loopback server and exchanges the code for a token.
+// The nonce claim of the ID token is validated when it is issued.
+//
+// Empty scope and audience fall back to WithDefaultScope and WithDefaultAudience.
+// It returns ctx.Err() when ctx is done before the redirect.
+func (f *AuthCodeFlow) Authorize(ctx context.Context, scope string, audience string) (*TokenResponse, error) {
+	ln, redirectURI, err := f.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := newPendingAuthorization(redirectURI.String())
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	results := make(chan callbackResult, 1)
+	srv := &http.Server{Handler: callbackHandler(redirectURI.Path, pending.state, &f.landing, results)}
+	go srv.Serve(ln)
+	defer srv.Shutdown(context.Background())
+
+	if err := f.open(f.authorizationURL(pending, scope, audience)); err != nil {
+		return nil, err
+	}
+
+	var result callbackResult
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-results:
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+
+	t, err := f.daf.exchangeToken(ctx, fmt.Sprintf(
+		"grant_type=authorization_code&client_id=%s&code=%s&code_verifier=%s&redirect_uri=%s",
+		f.daf.clientID, neturl.QueryEscape(result.code), pending.pkce.Verifier, neturl.QueryEscape(pending.redirectURI),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pending.validateNonce(t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (f *AuthCodeFlow) authorizationURL(pending *pendingAuthorization, scope string, audience string) string {
+	if scope == "" {
+		scope = f.daf.defaultScope
+	}
+	if audience == "" {
+		audience = f.daf.defaultAudience
+	}
+
+	params := neturl.Values{
+		"response_type":         {"code"},
+		"client_id":             {f.daf.clientID},
+		"redirect_uri":          {pending.redirectURI},
+		"scope":                 {scope},
+		"audience":              {audience},
+		"state":                 {pending.state},
+		"nonce":                 {pending.nonce},
+		"code_challenge":        {pending.pkce.Challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	// parameters are added to the query of the base URL, e.g. a key of the API gateway
+	// the discovered endpoint is validated when Endpoints is applied
+	u, _ := neturl.Parse(f.daf.discoveredOr(f.daf.endpoints.AuthorizationEndpoint, "/authorize"))
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if f.daf.organization != "" {
+		q.Set("organization", f.daf.organization)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// callbackHandler sends the first result of the redirect with state to results.
+// Requests with other states are rejected because they may be forged.
+func callbackHandler(path string, state string, landing *WithLandingPage, results chan<- callbackResult) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		}
+
+		var result callbackResult
+		if code := q.Get("error"); code != "" {
+			result.err = &AuthorizationError{Code: code, Description: q.Get("error_description")}
+			landing.write(w, r, false)
+		} else if code := q.Get("code"); code != "" {
+			result.code = code
+			landing.write(w, r, true)
+		} else {
+			http.Error(w, "code is missing", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case results <- result:
+		default:
+		}
+	})
+	return mux
+}
@@ -0,0 +1,256 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("NewPKCE", func() {
+	It("returns the verifier and the S256 challenge of it", func() {
+		// Act
+		pkce, err := auth.NewPKCE()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pkce.Verifier).To(HaveLen(43))
+		sum := sha256.Sum256([]byte(pkce.Verifier))
+		Expect(pkce.Challenge).To(Equal(base64.RawURLEncoding.EncodeToString(sum[:])))
+	})
+})
+
+var _ = Describe("AuthCodeFlow", func() {
+	clientID := "clientID"
+	newIDToken := func(nonce string) string {
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"nonce": %q}`, nonce))) + ".c2lnbmF0dXJl"
+	}
+
+	newFlow := func(daf *auth.DeviceAuthFlow, open func(string) error, opts ...auth.AuthCodeFlowOption) *auth.AuthCodeFlow {
+		f, err := daf.NewAuthCodeFlow(open, opts...)
+		Expect(err).NotTo(HaveOccurred())
+		return f
+	}
+
+	// browser follows the redirect as the authorization server does, with the query made by callback
+	browser := func(callback func(q url.Values) url.Values) (func(string) error, *url.Values) {
+		authorized := new(url.Values)
+		return func(authorizationURL string) error {
+			u, err := url.Parse(authorizationURL)
+			if err != nil {
+				return err
+			}
+			*authorized = u.Query()
+
+			res, err := http.Get(authorized.Get("redirect_uri") + "?" + callback(*authorized).Encode())
+			if err != nil {
+				return err
+			}
+			return res.Body.Close()
+		}, authorized
+	}
+
+	It("exchanges the code received by the loopback server", func() {
+		// Arrange
+		var tokenForm url.Values
+		open, authorized := browser(func(q url.Values) url.Values {
+			return url.Values{"code": {"code"}, "state": {q.Get("state")}}
+		})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			tokenForm = r.PostForm
+			fmt.Fprintf(w, `{"access_token": "access_token", "id_token": "%s", "token_type": "Bearer", "expires_in": 86400}`, newIDToken(authorized.Get("nonce")))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := newFlow(daf, open).Authorize(context.Background(), "openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+
+		Expect(authorized.Get("response_type")).To(Equal("code"))
+		Expect(authorized.Get("client_id")).To(Equal(clientID))
+		Expect(authorized.Get("scope")).To(Equal("openid"))
+		Expect(authorized.Get("audience")).To(Equal("https://example.com/api"))
+		Expect(authorized.Get("code_challenge_method")).To(Equal("S256"))
+		Expect(authorized.Get("nonce")).NotTo(BeEmpty())
+		Expect(authorized.Get("nonce")).NotTo(Equal(authorized.Get("state")))
+		Expect(authorized.Get("redirect_uri")).To(HavePrefix("http://127.0.0.1:"))
+
+		Expect(tokenForm.Get("grant_type")).To(Equal("authorization_code"))
+		Expect(tokenForm.Get("client_id")).To(Equal(clientID))
+		Expect(tokenForm.Get("code")).To(Equal("code"))
+		Expect(tokenForm.Get("redirect_uri")).To(Equal(authorized.Get("redirect_uri")))
+		sum := sha256.Sum256([]byte(tokenForm.Get("code_verifier")))
+		Expect(authorized.Get("code_challenge")).To(Equal(base64.RawURLEncoding.EncodeToString(sum[:])))
+	})
+
+	It("returns NonceError when the ID token has another nonce", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"access_token": "access_token", "id_token": "%s", "token_type": "Bearer", "expires_in": 86400}`, newIDToken("replayed"))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+		open, _ := browser(func(q url.Values) url.Values {
+			return url.Values{"code": {"code"}, "state": {q.Get("state")}}
+		})
+
+		// Act
+		token, err := newFlow(daf, open).Authorize(context.Background(), "openid", "https://example.com/api")
+
+		// Assert
+		var nonceErr *auth.NonceError
+		Expect(errors.As(err, &nonceErr)).To(BeTrue())
+		Expect(nonceErr.Actual).To(Equal("replayed"))
+		Expect(token).To(BeNil())
+	})
+
+	It("returns AuthorizationError when redirected with an error", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+		open, _ := browser(func(q url.Values) url.Values {
+			return url.Values{"error": {"access_denied"}, "error_description": {"denied"}, "state": {q.Get("state")}}
+		})
+
+		// Act
+		_, err = newFlow(daf, open).Authorize(context.Background(), "openid", "https://example.com/api")
+
+		// Assert
+		var authErr *auth.AuthorizationError
+		Expect(errors.As(err, &authErr)).To(BeTrue())
+		Expect(authErr.Code).To(Equal("access_denied"))
+	})
+
+	It("ignores redirects with another state", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+		var status int
+		open := func(authorizationURL string) error {
+			u, _ := url.Parse(authorizationURL)
+			res, err := http.Get(u.Query().Get("redirect_uri") + "?code=forged&state=" + strings.Repeat("x", 43))
+			if err != nil {
+				return err
+			}
+			status = res.StatusCode
+			return res.Body.Close()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Act
+		_, err = newFlow(daf, open).Authorize(ctx, "openid", "https://example.com/api")
+
+		// Assert
+		Expect(status).To(Equal(http.StatusBadRequest))
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	Describe("loopback server", func() {
+		var ts *httptest.Server
+		BeforeEach(func() {
+			ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+			}))
+			DeferCleanup(ts.Close)
+		})
+
+		redirectURIOf := func(opts ...auth.AuthCodeFlowOption) string {
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+			open, authorized := browser(func(q url.Values) url.Values {
+				return url.Values{"code": {"code"}, "state": {q.Get("state")}}
+			})
+
+			_, err = newFlow(daf, open, opts...).Authorize(context.Background(), "openid", "https://example.com/api")
+			Expect(err).NotTo(HaveOccurred())
+			return authorized.Get("redirect_uri")
+		}
+
+		freePort := func() int {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer ln.Close()
+			return ln.Addr().(*net.TCPAddr).Port
+		}
+
+		It("uses the redirect URI given by WithRedirectURI", func() {
+			// Arrange
+			uri := fmt.Sprintf("http://localhost:%d/oauth/callback", freePort())
+
+			// Act
+			actual := redirectURIOf(auth.WithRedirectURI(uri))
+
+			// Assert
+			Expect(actual).To(Equal(uri))
+		})
+
+		It("listens on the first free port in WithCallbackPortRange", func() {
+			// Arrange
+			busy, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			defer busy.Close()
+			port := busy.Addr().(*net.TCPAddr).Port
+
+			// Act
+			actual := redirectURIOf(auth.WithCallbackPortRange{From: port, To: port + 1})
+
+			// Assert
+			Expect(actual).To(Equal(fmt.Sprintf("http://127.0.0.1:%d/callback", port+1)))
+		})
+
+		It("listens on [::1] with WithIPv6Loopback", func() {
+			// Arrange
+			if ln, err := net.Listen("tcp", "[::1]:0"); err != nil {
+				Skip("IPv6 is not available")
+			} else {
+				ln.Close()
+			}
+
+			// Act
+			actual := redirectURIOf(auth.WithIPv6Loopback(true))
+
+			// Assert
+			Expect(actual).To(HavePrefix("http://[::1]:"))
+		})
+
+		DescribeTable("NewAuthCodeFlow() rejects invalid options",
+			func(opts ...auth.AuthCodeFlowOption) {
+				// Arrange
+				daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+				Expect(err).NotTo(HaveOccurred())
+
+				// Act
+				_, err = daf.NewAuthCodeFlow(func(string) error { return nil }, opts...)
+
+				// Assert
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("https redirect URI", auth.WithRedirectURI("https://localhost:8080/callback")),
+			Entry("remote redirect URI", auth.WithRedirectURI("http://example.com:8080/callback")),
+			Entry("redirect URI without port", auth.WithRedirectURI("http://localhost/callback")),
+			Entry("reversed port range", auth.WithCallbackPortRange{From: 8081, To: 8080}),
+			Entry("redirect URI with port range", auth.WithRedirectURI("http://localhost:8080/callback"), auth.WithCallbackPortRange{From: 8080, To: 8081}),
+		)
+	})
+})
@@ -0,0 +1,304 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// refreshRetryInterval is the interval to retry refreshing in the background after a failure.
+var refreshRetryInterval = 10 * time.Second
+
+// CachedTokenSource caches a token and refreshes it with the refresh token when expired.
+// A token without expires_in is regarded as never expiring.
+//
+// It is safe for concurrent use.
+type CachedTokenSource struct {
+	daf           *DeviceAuthFlow
+	refreshBefore time.Duration
+
+	mu       sync.Mutex
+	token    *TokenResponse
+	issuedAt time.Time
+	// expiresAt is zero when the token never expires.
+	expiresAt time.Time
+
+	// refreshMu serializes refreshing because refresh tokens may be rotated.
+	refreshMu sync.Mutex
+
+	lifecycleMu sync.Mutex
+	cancel      context.CancelFunc
+	done        chan struct{}
+
+	// reauthorize is called by Get when the refresh token is rejected. See SetReauthorize.
+	reauthorize func() (*TokenResponse, error)
+	// err is the error which stopped the background worker. See Err.
+	err error
+}
+
+// NewCachedTokenSource returns a CachedTokenSource which starts with token.
+//
+// refreshBefore is the lead time to refresh the token before its expiry in the background worker.
+// It is shortened to the half of the lifetime for short-lived tokens. See Start.
+func (daf *DeviceAuthFlow) NewCachedTokenSource(token *TokenResponse, refreshBefore time.Duration) *CachedTokenSource {
+	now := daf.timeNow()
+	return &CachedTokenSource{
+		daf:           daf,
+		refreshBefore: refreshBefore,
+		token:         token,
+		issuedAt:      now,
+		expiresAt:     tokenExpiresAt(token, now),
+	}
+}
+
+// NewCachedTokenSourceExpiringAt is like NewCachedTokenSource, but the token expires at expiresAt
+// instead of expires_in from now, e.g. for the token saved by another process.
+func (daf *DeviceAuthFlow) NewCachedTokenSourceExpiringAt(token *TokenResponse, expiresAt time.Time, refreshBefore time.Duration) *CachedTokenSource {
+	return &CachedTokenSource{
+		daf:           daf,
+		refreshBefore: refreshBefore,
+		token:         token,
+		issuedAt:      expiresAt.Add(-time.Duration(token.ExpiresIn) * time.Second),
+		expiresAt:     expiresAt,
+	}
+}
+
+// tokenExpiresAt returns the expiry of token issued at now, or zero time when it has no expires_in.
+func tokenExpiresAt(token *TokenResponse, now time.Time) time.Time {
+	if token.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return now.Add(time.Duration(token.ExpiresIn) * time.Second)
+}
+
+// Get returns the cached token. When the token is expired, it is refreshed before returning.
+//
+// The returned token is a copy, which is not affected by later refreshes and Destroy.
+func (s *CachedTokenSource) Get() (*TokenResponse, error) {
+	s.mu.Lock()
+	token, expiresAt, err, reauthorize := s.token.clone(), s.expiresAt, s.err, s.reauthorize
+	s.mu.Unlock()
+
+	now := s.daf.timeNow()
+	if expiresAt.IsZero() || now.Before(expiresAt) {
+		return token, nil
+	}
+	// the refresh token has been rejected in the background, and nothing can be done without reauthorize
+	if err != nil && reauthorize == nil {
+		return nil, err
+	}
+
+	return s.refresh(context.Background(), now, true)
+}
+
+// RefreshAt returns the time to refresh the token ahead of its expiry, which is refreshBefore its expiry
+// or the half of the lifetime for short-lived tokens. It is zero when the token never expires.
+func (s *CachedTokenSource) RefreshAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refreshAt()
+}
+
+// refreshAt is RefreshAt while s.mu is locked.
+func (s *CachedTokenSource) refreshAt() time.Time {
+	if s.expiresAt.IsZero() {
+		return time.Time{}
+	}
+
+	lead := s.refreshBefore
+	if lifetime := s.expiresAt.Sub(s.issuedAt); lead > lifetime/2 {
+		lead = lifetime / 2
+	}
+	return s.expiresAt.Add(-lead)
+}
+
+// Refresh refreshes the token with the refresh token even if it is not expired, and returns a copy of the new one.
+// The refresh token is kept when the server does not rotate it.
+func (s *CachedTokenSource) Refresh(ctx context.Context) (*TokenResponse, error) {
+	return s.refresh(ctx, time.Time{}, false)
+}
+
+// Err returns the error which stopped the background worker, which is APIError of invalid_grant
+// when the refresh token is rejected without SetReauthorize. It is nil while the worker is running.
+func (s *CachedTokenSource) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// SetReauthorize sets f to obtain a new token (e.g. by Authorize) when Get fails to refresh
+// because the refresh token is rejected with invalid_grant (e.g. revoked or rotated away).
+//
+// f is called only from Get, never from the background worker, so it may interact with the user.
+// Without f, Get returns the APIError.
+func (s *CachedTokenSource) SetReauthorize(f func() (*TokenResponse, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reauthorize = f
+}
+
+// Start starts the background worker which refreshes the token refreshBefore its expiry,
+// so Get does not block on network in the common case.
+//
+// The worker stops when the refresh token is rejected with invalid_grant without SetReauthorize,
+// and then Get returns the error after the expiry. See Err.
+//
+// Calling Start on a running CachedTokenSource does nothing.
+func (s *CachedTokenSource) Start() {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.err = nil
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go s.run(ctx, s.done)
+}
+
+// Stop stops the background worker and waits for it to finish.
+// A refresh in progress in the worker is canceled.
+//
+// Calling Stop on a stopped CachedTokenSource does nothing.
+func (s *CachedTokenSource) Stop() {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+	s.done = nil
+}
+
+func (s *CachedTokenSource) run(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		s.mu.Lock()
+		// there is nothing to refresh ahead without the refresh token or the expiry
+		refreshable := s.token.RefreshToken != "" && !s.expiresAt.IsZero()
+		refreshAt := s.refreshAt()
+		lead := s.expiresAt.Sub(refreshAt)
+		wait := refreshAt.Sub(s.daf.timeNow())
+		s.mu.Unlock()
+
+		if !refreshable {
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := s.refresh(ctx, s.daf.timeNow().Add(lead), false); err != nil {
+			// the rejected refresh token never succeeds, so stop unless Get can authorize again
+			s.mu.Lock()
+			if IsInvalidGrant(err) && s.reauthorize == nil {
+				s.err = err
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+
+			// Get refreshes again when the token is expired
+			timer := time.NewTimer(refreshRetryInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// refresh refreshes the token unless it has been refreshed to be valid at deadline by others.
+// It always refreshes when deadline is zero.
+// When reauthorize is true, the token is obtained by the function given to SetReauthorize
+// if the refresh token is rejected.
+func (s *CachedTokenSource) refresh(ctx context.Context, deadline time.Time, reauthorize bool) (*TokenResponse, error) {
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+
+	s.mu.Lock()
+	current, expiresAt, reauthorizeFunc := s.token, s.expiresAt, s.reauthorize
+	s.mu.Unlock()
+
+	if !deadline.IsZero() && (expiresAt.IsZero() || deadline.Before(expiresAt)) {
+		return current.clone(), nil
+	}
+
+	if current.RefreshToken == "" {
+		return nil, errors.New("token is expired and cannot be refreshed without refresh token")
+	}
+
+	token, err := s.daf.ExchangeRefreshTokenContext(ctx, current.RefreshToken)
+	if err != nil {
+		if !reauthorize || reauthorizeFunc == nil || !IsInvalidGrant(err) {
+			return nil, err
+		}
+		if token, err = reauthorizeFunc(); err != nil {
+			return nil, err
+		}
+	} else if token.RefreshToken == "" {
+		// refresh token is not always rotated
+		token.RefreshToken = current.RefreshToken
+	}
+	now := s.daf.timeNow()
+
+	s.mu.Lock()
+	s.token = token
+	s.issuedAt = now
+	s.expiresAt = tokenExpiresAt(token, now)
+	s.mu.Unlock()
+
+	return token.clone(), nil
+}
+
+// clone returns a copy of t which does not share RawBody and Extra, which are wiped by Destroy.
+func (t *TokenResponse) clone() *TokenResponse {
+	c := *t
+	if t.RawBody != nil {
+		c.RawBody = append([]byte(nil), t.RawBody...)
+	}
+	if t.Extra != nil {
+		c.Extra = make(map[string]json.RawMessage, len(t.Extra))
+		for k, v := range t.Extra {
+			c.Extra[k] = append(json.RawMessage(nil), v...)
+		}
+	}
+	return &c
+}
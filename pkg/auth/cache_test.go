@@ -0,0 +1,329 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CachedTokenSource", func() {
+	clientID := "clientID"
+	refresh := func(responseBody string) requestExpectation {
+		return requestExpectation{
+			path: "/oauth/token",
+			form: map[string][]string{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {clientID},
+				"refresh_token": {"refresh_token"},
+			},
+			statusCode:   200,
+			responseBody: responseBody,
+		}
+	}
+
+	Describe("Get()", func() {
+		It("returns the cached token when it is not expired", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			token := &auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 86400}
+			s := daf.NewCachedTokenSource(token, time.Minute)
+
+			// Act
+			actual, err := s.Get()
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(token))
+		})
+
+		It("refreshes the token and keeps the refresh token when it is expired", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				refresh(`{"access_token": "new_access_token", "token_type": "Bearer", "expires_in": 86400}`),
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(60)))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 60}, time.Minute)
+
+			// Act
+			actual, err := s.Get()
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(&auth.TokenResponse{
+				AccessToken:  "new_access_token",
+				RefreshToken: "refresh_token",
+				TokenType:    "Bearer",
+				ExpiresIn:    86400,
+			}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns the cached token without refreshing when it has no expires_in", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(86400)))
+			token := &auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token"}
+			s := daf.NewCachedTokenSource(token, time.Minute)
+
+			// Act
+			actual, err := s.Get()
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(token))
+		})
+
+		It("returns error when it is expired without refresh token", func() {
+			// Arrange
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(60)))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", ExpiresIn: 60}, time.Minute)
+
+			// Act
+			_, err := s.Get()
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+
+		Context("when the refresh token is rejected with invalid_grant", func() {
+			invalidGrant := refresh(`{"error": "invalid_grant", "error_description": "Unknown or invalid refresh token."}`)
+			invalidGrant.statusCode = 403
+
+			It("returns APIError without SetReauthorize()", func() {
+				// Arrange
+				ms := newMockServer([]requestExpectation{invalidGrant})
+				defer ms.Close()
+
+				daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(60)))
+				s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 60}, time.Minute)
+
+				// Act
+				_, err := s.Get()
+
+				// Assert
+				Expect(auth.IsInvalidGrant(err)).To(BeTrue())
+			})
+
+			It("returns the token obtained by the function given to SetReauthorize()", func() {
+				// Arrange
+				ms := newMockServer([]requestExpectation{invalidGrant})
+				defer ms.Close()
+
+				daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(60)))
+				s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 60}, time.Minute)
+				reauthorized := &auth.TokenResponse{AccessToken: "reauthorized_access_token", ExpiresIn: 86400}
+				calls := 0
+				s.SetReauthorize(func() (*auth.TokenResponse, error) {
+					calls++
+					return reauthorized, nil
+				})
+
+				// Act
+				actual, err := s.Get()
+				cached, _ := s.Get()
+
+				// Assert
+				Expect(err).NotTo(HaveOccurred())
+				Expect(actual).To(Equal(reauthorized))
+				Expect(cached).To(Equal(reauthorized))
+				Expect(calls).To(Equal(1))
+				Expect(ms.restExpects()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("RefreshAt()", func() {
+		It("returns refreshBefore the expiry given to NewCachedTokenSourceExpiringAt()", func() {
+			// Arrange
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			expiresAt := baseStubTime.Add(time.Hour)
+			s := daf.NewCachedTokenSourceExpiringAt(&auth.TokenResponse{AccessToken: "access_token", ExpiresIn: 86400}, expiresAt, time.Minute)
+
+			// Act
+			actual := s.RefreshAt()
+
+			// Assert
+			Expect(actual).To(Equal(expiresAt.Add(-time.Minute)))
+		})
+
+		It("returns the half of the lifetime for short-lived tokens", func() {
+			// Arrange
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			expiresAt := baseStubTime.Add(time.Hour)
+			s := daf.NewCachedTokenSourceExpiringAt(&auth.TokenResponse{AccessToken: "access_token", ExpiresIn: 60}, expiresAt, time.Minute)
+
+			// Act
+			actual := s.RefreshAt()
+
+			// Assert
+			Expect(actual).To(Equal(expiresAt.Add(-30 * time.Second)))
+		})
+
+		It("returns zero for the token without expires_in", func() {
+			// Arrange
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token"}, time.Minute)
+
+			// Act
+			actual := s.RefreshAt()
+
+			// Assert
+			Expect(actual.IsZero()).To(BeTrue())
+		})
+	})
+
+	Describe("Refresh()", func() {
+		It("refreshes the token which is not expired and keeps the refresh token", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				refresh(`{"access_token": "new_access_token", "token_type": "Bearer", "expires_in": 86400}`),
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 86400}, time.Minute)
+
+			// Act
+			actual, err := s.Refresh(context.Background())
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual.AccessToken).To(Equal("new_access_token"))
+			Expect(actual.RefreshToken).To(Equal("refresh_token"))
+			Expect(s.Get()).To(Equal(actual))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+	})
+
+	Describe("Start()", func() {
+		It("refreshes the token in the background before its expiry", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				refresh(`{"access_token": "new_access_token", "token_type": "Bearer", "expires_in": 86400}`),
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 2}, time.Minute)
+
+			// Act
+			s.Start()
+			defer s.Stop()
+
+			// Assert
+			Eventually(func() string {
+				token, err := s.Get()
+				Expect(err).NotTo(HaveOccurred())
+				return token.AccessToken
+			}).WithTimeout(2 * time.Second).Should(Equal("new_access_token"))
+			s.Stop()
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("does nothing after Stop()", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 2}, time.Minute)
+
+			// Act
+			s.Start()
+			s.Stop()
+
+			// Assert
+			Consistently(func() string {
+				token, _ := s.Get()
+				return token.AccessToken
+			}).WithTimeout(500 * time.Millisecond).Should(Equal("access_token"))
+		})
+
+		It("does not refresh the token without expires_in", func() {
+			// Arrange
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+			}))
+			defer ts.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token"}, time.Minute)
+
+			// Act
+			s.Start()
+			defer s.Stop()
+
+			// Assert
+			Consistently(func() int32 { return atomic.LoadInt32(&requests) }).WithTimeout(500 * time.Millisecond).Should(BeZero())
+		})
+
+		It("stops when the refresh token is rejected without SetReauthorize()", func() {
+			// Arrange
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(403)
+				w.Write([]byte(`{"error": "invalid_grant", "error_description": "Unknown or invalid refresh token."}`))
+			}))
+			defer ts.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 1}, time.Minute)
+
+			// Act
+			s.Start()
+			defer s.Stop()
+
+			// Assert
+			Eventually(s.Err).WithTimeout(2 * time.Second).Should(Satisfy(auth.IsInvalidGrant))
+			Eventually(func() error {
+				_, err := s.Get()
+				return err
+			}).WithTimeout(2 * time.Second).Should(Satisfy(auth.IsInvalidGrant))
+			Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+		})
+
+		It("cancels the refresh in progress on Stop()", func() {
+			// Arrange
+			requested := make(chan struct{})
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the server notices the canceled request after reading the body
+				r.ParseForm()
+				close(requested)
+				<-r.Context().Done()
+			}))
+			defer ts.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+			s := daf.NewCachedTokenSource(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 1}, time.Minute)
+			s.Start()
+			Eventually(requested).WithTimeout(2 * time.Second).Should(BeClosed())
+
+			// Act
+			stopped := make(chan struct{})
+			go func() {
+				s.Stop()
+				close(stopped)
+			}()
+
+			// Assert
+			Eventually(stopped).WithTimeout(time.Second).Should(BeClosed())
+		})
+	})
+})
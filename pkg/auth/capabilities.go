@@ -0,0 +1,66 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+// CapabilitySet describes features compiled into this package,
+// so that tools can detect them instead of comparing versions.
+type CapabilitySet struct {
+	// Grants are grant types which can be requested to the token endpoint.
+	Grants []string `json:"grants"`
+	// Storage is where tokens can be kept.
+	Storage []string `json:"storage"`
+	// Providers are authorization servers which are supported.
+	Providers []string `json:"providers"`
+	// Deprecations are features which will be removed in a future release.
+	Deprecations []Deprecation `json:"deprecations"`
+}
+
+// Deprecation describes a deprecated feature.
+type Deprecation struct {
+	Feature string `json:"feature"`
+	// Replacement is the feature to use instead. It is empty if there is no replacement.
+	Replacement string `json:"replacement,omitempty"`
+	Since       string `json:"since"`
+}
+
+// Features with optional dependencies should append themselves in init of the file with its build tags.
+var (
+	capabilityGrants = []string{
+		"urn:ietf:params:oauth:grant-type:device_code",
+		"refresh_token",
+		"authorization_code",
+		"password",
+		passwordRealmGrantType,
+		tokenExchangeGrantType,
+		"urn:openid:params:grant-type:ciba",
+		mfaOTPGrantType,
+		mfaOOBGrantType,
+		passwordlessOTPGrantType,
+	}
+	capabilityStorage      = []string{"memory"}
+	capabilityProviders    = []string{"auth0", "oidc"}
+	capabilityDeprecations = []Deprecation{}
+)
+
+// Capabilities returns features compiled into this package.
+// The returned value can be modified by the caller.
+func Capabilities() *CapabilitySet {
+	return &CapabilitySet{
+		Grants:       append([]string{}, capabilityGrants...),
+		Storage:      append([]string{}, capabilityStorage...),
+		Providers:    append([]string{}, capabilityProviders...),
+		Deprecations: append([]Deprecation{}, capabilityDeprecations...),
+	}
+}
@@ -0,0 +1,34 @@
+package auth_test
+
+import (
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Capabilities", func() {
+	It("returns supported grants, storage and providers", func() {
+		// Act
+		c := auth.Capabilities()
+
+		// Assert
+		Expect(c.Grants).To(ContainElements("urn:ietf:params:oauth:grant-type:device_code", "refresh_token", "urn:openid:params:grant-type:ciba"))
+		Expect(c.Storage).To(ContainElement("memory"))
+		Expect(c.Providers).To(ContainElements("auth0", "oidc"))
+		Expect(c.Deprecations).NotTo(BeNil())
+	})
+
+	It("returns a copy which can be modified", func() {
+		// Arrange
+		c := auth.Capabilities()
+
+		// Act
+		c.Grants[0] = "modified"
+		c.Storage = append(c.Storage, "file")
+
+		// Assert
+		Expect(auth.Capabilities().Grants).NotTo(ContainElement("modified"))
+		Expect(auth.Capabilities().Storage).NotTo(ContainElement("file"))
+	})
+})
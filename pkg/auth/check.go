@@ -0,0 +1,138 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EndpointDiagnostics represents result of CheckEndpoint.
+type EndpointDiagnostics struct {
+	// DiscoveryLatency is the duration taken by the request to the discovery endpoint.
+	DiscoveryLatency time.Duration
+	// DeviceAuthorizationEndpoint is advertised in the discovery metadata.
+	// It is empty when the device grant is not available.
+	DeviceAuthorizationEndpoint string
+	// TokenEndpoint is advertised in the discovery metadata.
+	TokenEndpoint string
+	// TokenEndpointStatusCode is the status code of the token endpoint for an empty request.
+	TokenEndpointStatusCode int
+	// ServerTime is the Date header of the discovery endpoint. It is zero when the header is not available.
+	ServerTime time.Time
+	// ClockSkew is the difference of the local clock from ServerTime.
+	ClockSkew time.Duration
+	// TLSVersion is the negotiated TLS version like tls.VersionTLS13. It is zero for plain HTTP.
+	TLSVersion uint16
+}
+
+// EndpointError is returned by CheckEndpoint when an endpoint is not healthy.
+type EndpointError struct {
+	URL     string
+	Message string
+}
+
+func (e *EndpointError) Error() string {
+	return e.URL + ": " + e.Message
+}
+
+// CheckEndpoint validates that the endpoints respond and advertise the device grant.
+//
+// It returns EndpointDiagnostics filled as far as checked even if an error is returned.
+func (daf *DeviceAuthFlow) CheckEndpoint(ctx context.Context) (*EndpointDiagnostics, error) {
+	diag := new(EndpointDiagnostics)
+
+	url := daf.endpoint("/.well-known/openid-configuration")
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return diag, fmt.Errorf("could not create request: %w", err)
+	}
+
+	setAcceptEncoding(req)
+	daf.setHeaders(req)
+
+	if err := daf.waitRateLimit(ctx); err != nil {
+		return diag, err
+	}
+
+	start := daf.timeNow()
+	res, err := daf.httpClient.Do(req)
+	if err != nil {
+		return diag, &EndpointError{URL: url, Message: err.Error()}
+	}
+	defer res.Body.Close()
+	now := daf.timeNow()
+	diag.DiscoveryLatency = now.Sub(start)
+	if res.TLS != nil {
+		diag.TLSVersion = res.TLS.Version
+	}
+
+	if serverTime, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		diag.ServerTime = serverTime
+		diag.ClockSkew = now.Sub(serverTime)
+	}
+
+	if res.StatusCode != 200 {
+		return diag, &EndpointError{URL: url, Message: "unexpected status " + res.Status}
+	}
+
+	discovery := new(struct {
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+	})
+	body, err := readBody(res)
+	if err != nil {
+		return diag, &EndpointError{URL: url, Message: fmt.Sprintf("could not read discovery metadata: %s", err)}
+	}
+	if err := json.Unmarshal(body, discovery); err != nil {
+		return diag, &EndpointError{URL: url, Message: fmt.Sprintf("could not decode discovery metadata: %s", err)}
+	}
+	diag.DeviceAuthorizationEndpoint = discovery.DeviceAuthorizationEndpoint
+	diag.TokenEndpoint = discovery.TokenEndpoint
+
+	if diag.DeviceAuthorizationEndpoint == "" {
+		return diag, &EndpointError{URL: url, Message: "device grant is not advertised"}
+	}
+
+	// an empty request never issues anything, but the token endpoint should respond with an error
+	tokenURL := daf.tokenURL()
+	req, err = http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(""))
+	if err != nil {
+		return diag, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Add("content-type", "application/x-www-form-urlencoded")
+	daf.setHeaders(req)
+	if err := daf.waitRateLimit(ctx); err != nil {
+		return diag, err
+	}
+	tokenRes, err := daf.httpClient.Do(req)
+	if err != nil {
+		return diag, &EndpointError{URL: tokenURL, Message: err.Error()}
+	}
+	defer tokenRes.Body.Close()
+	io.Copy(io.Discard, tokenRes.Body)
+	diag.TokenEndpointStatusCode = tokenRes.StatusCode
+
+	if tokenRes.StatusCode/100 == 5 {
+		return diag, &EndpointError{URL: tokenURL, Message: "unexpected status " + tokenRes.Status}
+	}
+
+	return diag, nil
+}
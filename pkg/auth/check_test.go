@@ -0,0 +1,78 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeviceAuthFlow", func() {
+	Describe("CheckEndpoint()", func() {
+		newDiscoveryServer := func(discovery string) *httptest.Server {
+			return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/.well-known/openid-configuration":
+					w.Header().Set("Date", "Mon, 29 Aug 2022 10:00:00 GMT")
+					w.Write([]byte(discovery))
+				case "/oauth/token":
+					w.WriteHeader(403)
+					w.Write([]byte(`{"error": "unsupported_grant_type", "error_description": "Unsupported grant type: undefined"}`))
+				default:
+					w.WriteHeader(404)
+				}
+			}))
+		}
+
+		It("returns diagnostics when the device grant is advertised", func() {
+			// Arrange
+			ts := newDiscoveryServer(`{
+				"device_authorization_endpoint": "https://example.com/oauth/device/code",
+				"token_endpoint": "https://example.com/oauth/token"
+			}`)
+			defer ts.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ts.URL),
+				auth.WithClientID("clientID"),
+				auth.WithTimeNow(newStubTimeNow(1)),
+			)
+
+			// Act
+			actual, err := daf.CheckEndpoint(context.Background())
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(&auth.EndpointDiagnostics{
+				DiscoveryLatency:            time.Second,
+				DeviceAuthorizationEndpoint: "https://example.com/oauth/device/code",
+				TokenEndpoint:               "https://example.com/oauth/token",
+				TokenEndpointStatusCode:     403,
+				ServerTime:                  baseStubTime,
+				ClockSkew:                   time.Second,
+			}))
+		})
+
+		It("returns EndpointError when the device grant is not advertised", func() {
+			// Arrange
+			ts := newDiscoveryServer(`{"token_endpoint": "https://example.com/oauth/token"}`)
+			defer ts.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+
+			// Act
+			_, err := daf.CheckEndpoint(context.Background())
+
+			// Assert
+			Expect(err).To(MatchError(&auth.EndpointError{
+				URL:     ts.URL + "/.well-known/openid-configuration",
+				Message: "device grant is not advertised",
+			}))
+		})
+	})
+})
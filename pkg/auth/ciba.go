@@ -0,0 +1,170 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// defaultBackchannelInterval is the polling interval when the backchannel authentication response has no interval.
+const defaultBackchannelInterval = 5
+
+// BackchannelAuthRequest represents parameters of the backchannel authentication request of CIBA.
+//
+// Empty Scope and Audience fall back to WithDefaultScope and WithDefaultAudience. Scope must contain openid.
+type BackchannelAuthRequest struct {
+	// LoginHint identifies the user to authenticate. See IssSubLoginHint for the format of Auth0.
+	LoginHint string
+	// BindingMessage is shown on the authentication device of the user, to bind it to the consumption device.
+	BindingMessage string
+	Scope          string
+	Audience       string
+	// RequestedExpiry is the lifetime of the request in seconds. Zero means the default of the server.
+	RequestedExpiry int
+	// Extra is additional parameters like vendor extensions. Parameters set by DeviceAuthFlow cannot be given.
+	Extra neturl.Values
+}
+
+// BackchannelAuthResponse represents response of the backchannel authentication endpoint of CIBA.
+// In addition, it has ExpiresAt which means expiration date of the request,
+// Extra which holds fields not modeled here,
+// and RawBody which is the response body as it is when WithRawResponseBody is given.
+type BackchannelAuthResponse struct {
+	AuthReqID string                     `json:"auth_req_id"`
+	ExpiresIn int                        `json:"expires_in"`
+	Interval  int                        `json:"interval"`
+	ExpiresAt time.Time                  `json:"-"`
+	Extra     map[string]json.RawMessage `json:"-"`
+	RawBody   []byte                     `json:"-"`
+	// flowID is the flow ID when the request is started, which is shared with its polls.
+	flowID string
+}
+
+func (r *BackchannelAuthResponse) UnmarshalJSON(b []byte) error {
+	type plain BackchannelAuthResponse
+	if err := json.Unmarshal(b, (*plain)(r)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(b, r)
+	r.Extra = extra
+	return err
+}
+
+// IssSubLoginHint returns the login_hint of Auth0 which identifies the user by the issuer (e.g. "https://example.us.auth0.com/")
+// and the user ID (e.g. "auth0|alice").
+func IssSubLoginHint(issuer string, sub string) string {
+	b, _ := json.Marshal(map[string]string{"format": "iss_sub", "iss": issuer, "sub": sub})
+	return string(b)
+}
+
+// StartBackchannelAuth starts Client-Initiated Backchannel Authentication (CIBA).
+// The user is asked to authenticate on their own device (e.g. by a push notification of Guardian),
+// then PollBackchannelToken returns the token.
+//
+// The client must be authenticated with WithClientSecret or WithClientAssertionSigner.
+//
+// See: https://auth0.com/docs/get-started/authentication-and-authorization-flow/client-initiated-backchannel-authentication-flow
+func (daf *DeviceAuthFlow) StartBackchannelAuth(req *BackchannelAuthRequest) (*BackchannelAuthResponse, error) {
+	return daf.StartBackchannelAuthContext(context.Background(), req)
+}
+
+// StartBackchannelAuthContext is like StartBackchannelAuth, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) StartBackchannelAuthContext(ctx context.Context, req *BackchannelAuthRequest) (*BackchannelAuthResponse, error) {
+	scope := req.Scope
+	if scope == "" {
+		scope = daf.defaultScope
+	}
+	audience := req.Audience
+	if audience == "" {
+		audience = daf.defaultAudience
+	}
+
+	params := fmt.Sprintf("client_id=%s&scope=%s&login_hint=%s", daf.clientID, neturl.QueryEscape(scope), neturl.QueryEscape(req.LoginHint))
+	if audience != "" {
+		params += "&audience=" + neturl.QueryEscape(audience)
+	}
+	if req.BindingMessage != "" {
+		params += "&binding_message=" + neturl.QueryEscape(req.BindingMessage)
+	}
+	if req.RequestedExpiry != 0 {
+		params += fmt.Sprintf("&requested_expiry=%d", req.RequestedExpiry)
+	}
+	extra, err := encodeExtraParams(req.Extra, "client_id", "scope", "audience", "login_hint", "binding_message", "requested_expiry", "client_secret", "client_assertion", "client_assertion_type")
+	if err != nil {
+		return nil, err
+	}
+	authParams, err := daf.clientAuthParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flowID := daf.flowIDFromContext(ctx)
+	statusCode, header, resBody, err := daf.postForm(contextWithRequestInfo(ctx, flowID, 1), daf.discoveredOr(daf.endpoints.BackchannelAuthenticationEndpoint, "/bc-authorize"), strings.NewReader(params+extra+authParams))
+	now := daf.timeNow()
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			return nil, daf.apiError("backchannel authentication", statusCode, header, resBody)
+		}
+		return nil, &ServerError{Request: "backchannel authentication", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	r := new(BackchannelAuthResponse)
+	if err := daf.decodeResponse(resBody, r); err != nil {
+		return nil, fmt.Errorf("could not decode backchannel authentication response body: %w", err)
+	}
+	if r.Interval == 0 {
+		r.Interval = defaultBackchannelInterval
+	}
+	r.ExpiresAt = now.Add(time.Duration(r.ExpiresIn) * time.Second)
+	r.RawBody = daf.rawBody(resBody)
+	r.flowID = flowID
+
+	return r, nil
+}
+
+// PollBackchannelToken polls token endpoint with the CIBA grant and returns a TokenResponse when the user authenticates,
+// in the same way as PollToken.
+//
+// When the request is expired, it returns ExpiredError.
+// When the user rejects it, it returns APIError of access_denied.
+func (daf *DeviceAuthFlow) PollBackchannelToken(r *BackchannelAuthResponse) (*TokenResponse, error) {
+	return daf.PollBackchannelTokenContext(context.Background(), r)
+}
+
+// PollBackchannelTokenContext is like PollBackchannelToken, but polling is aborted and ctx.Err() is returned when ctx is done.
+func (daf *DeviceAuthFlow) PollBackchannelTokenContext(ctx context.Context, r *BackchannelAuthResponse) (*TokenResponse, error) {
+	flowID := daf.pollFlowID(ctx, r.flowID, r.AuthReqID)
+	g := &pollGrant{
+		params:       fmt.Sprintf("grant_type=%s&auth_req_id=%s&client_id=%s", neturl.QueryEscape("urn:openid:params:grant-type:ciba"), neturl.QueryEscape(r.AuthReqID), daf.clientID),
+		interval:     time.Duration(r.Interval) * time.Second,
+		expiresIn:    r.ExpiresIn,
+		expiresAt:    r.ExpiresAt,
+		organization: daf.organization,
+		flowID:       flowID,
+	}
+	return daf.pollGrantWith(ctx, g, new(PollStats), func(d time.Duration) error {
+		return daf.timeSleep(ctx, d)
+	})
+}
@@ -0,0 +1,131 @@
+package auth_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CIBA", func() {
+	clientID := "clientID"
+	loginHint := `{"format":"iss_sub","iss":"https://example.us.auth0.com/","sub":"auth0|alice"}`
+	tokenForm := map[string][]string{
+		"grant_type":    {"urn:openid:params:grant-type:ciba"},
+		"auth_req_id":   {"auth_req_id"},
+		"client_id":     {clientID},
+		"client_secret": {"secret"},
+	}
+
+	It("starts backchannel authentication and polls the token", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/bc-authorize",
+				form: map[string][]string{
+					"client_id":       {clientID},
+					"client_secret":   {"secret"},
+					"scope":           {"openid"},
+					"audience":        {"https://example.com/api"},
+					"login_hint":      {loginHint},
+					"binding_message": {"ABC-123"},
+				},
+				statusCode:   200,
+				responseBody: `{"auth_req_id": "auth_req_id", "expires_in": 300, "interval": 2}`,
+			},
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "authorization_pending", "error_description": "The end-user authorization is pending"}`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "slow_down", "error_description": "You are polling faster than allowed"}`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 200, responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`},
+		})
+		defer ms.Close()
+
+		mockTimeSleep := newMockTimeSleep()
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithClientSecret("secret"),
+			auth.WithDefaultAudience("https://example.com/api"),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(mockTimeSleep.f),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		r, err := daf.StartBackchannelAuth(&auth.BackchannelAuthRequest{
+			LoginHint:      auth.IssSubLoginHint("https://example.us.auth0.com/", "auth0|alice"),
+			BindingMessage: "ABC-123",
+			Scope:          "openid",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		token, err := daf.PollBackchannelToken(r)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.ExpiresAt).To(Equal(baseStubTime.Add(300 * time.Second)))
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(mockTimeSleep.calls).To(Equal([]time.Duration{2 * time.Second, 7 * time.Second}))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns APIError when the user rejects the request", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "access_denied", "error_description": "The end-user denied the authorization request"}`},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithClientSecret("secret"), auth.WithTimeNow(newStubTimeNow(0)))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PollBackchannelToken(&auth.BackchannelAuthResponse{AuthReqID: "auth_req_id", ExpiresIn: 300, Interval: 5, ExpiresAt: baseStubTime.Add(300 * time.Second)})
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Body.Error).To(Equal("access_denied"))
+	})
+
+	It("returns ExpiredError when the request is expired", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(0)))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PollBackchannelToken(&auth.BackchannelAuthResponse{AuthReqID: "auth_req_id", ExpiresIn: 300, Interval: 5, ExpiresAt: baseStubTime})
+
+		// Assert
+		Expect(err).To(MatchError(&auth.ExpiredError{ExpiresIn: 300}))
+	})
+
+	It("uses the default interval when the response has no interval", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/bc-authorize",
+				form: map[string][]string{
+					"client_id":     {clientID},
+					"client_secret": {"secret"},
+					"scope":         {"openid"},
+					"login_hint":    {loginHint},
+				},
+				statusCode:   200,
+				responseBody: `{"auth_req_id": "auth_req_id", "expires_in": 300}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithClientSecret("secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		r, err := daf.StartBackchannelAuth(&auth.BackchannelAuthRequest{LoginHint: loginHint, Scope: "openid"})
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Interval).To(Equal(5))
+	})
+})
@@ -0,0 +1,210 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Context", func() {
+	clientID := "clientID"
+
+	It("FetchDeviceCodeContext() returns the error of the canceled context", func() {
+		// Arrange
+		unblock := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-unblock
+		}))
+		defer ts.Close()
+		defer close(unblock)
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// Act
+		_, err = daf.FetchDeviceCodeContext(ctx, "openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("ExchangeRefreshTokenContext() returns the error of the canceled context", func() {
+		// Arrange
+		unblock := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-unblock
+		}))
+		defer ts.Close()
+		defer close(unblock)
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// Act
+		_, err = daf.ExchangeRefreshTokenContext(ctx, "refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("PollTokenContext() stops polling when the context is canceled", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+					"device_code": {"device_code"},
+					"client_id":   {clientID},
+				},
+				statusCode:   401,
+				responseBody: `{"error": "authorization_pending", "error_description": "authorization pending"}`,
+			},
+		})
+		defer ms.Close()
+
+		sleeping := make(chan struct{}, 1)
+		unblock := make(chan struct{})
+		defer close(unblock)
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(0)),
+			auth.WithTimeSleep(func(time.Duration) {
+				sleeping <- struct{}{}
+				<-unblock
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 20, Interval: 5, ExpiresAt: baseStubTime.Add(20 * time.Second)}
+		ctx, cancel := context.WithCancel(context.Background())
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := daf.PollTokenContext(ctx, dc)
+			errCh <- err
+		}()
+		Eventually(sleeping).Should(Receive())
+
+		// Act
+		cancel()
+
+		// Assert
+		Eventually(errCh).Should(Receive(MatchError(context.Canceled)))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("PollTokenContext() stops sleeping between polls when the context is canceled", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+					"device_code": {"device_code"},
+					"client_id":   {clientID},
+				},
+				statusCode:   401,
+				responseBody: `{"error": "authorization_pending", "error_description": "authorization pending"}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(0)))
+		Expect(err).NotTo(HaveOccurred())
+
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 600, Interval: 60, ExpiresAt: baseStubTime.Add(600 * time.Second)}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		// Act
+		_, err = daf.PollTokenContext(ctx, dc)
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	Context("WithTimeSleepContext", func() {
+		authorizationPending := requestExpectation{
+			path: "/oauth/token",
+			form: map[string][]string{
+				"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+				"device_code": {"device_code"},
+				"client_id":   {clientID},
+			},
+			statusCode:   401,
+			responseBody: `{"error": "authorization_pending", "error_description": "authorization pending"}`,
+		}
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 600, Interval: 5, ExpiresAt: baseStubTime.Add(600 * time.Second)}
+
+		It("sleeps between polls with the function", func() {
+			// Arrange
+			success := authorizationPending
+			success.statusCode = 200
+			success.responseBody = `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`
+			ms := newMockServer([]requestExpectation{authorizationPending, success})
+			defer ms.Close()
+
+			calls := make([]time.Duration, 0)
+			daf, err := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithTimeNow(newStubTimeNow(0)),
+				auth.WithTimeSleepContext(func(ctx context.Context, d time.Duration) error {
+					calls = append(calls, d)
+					return nil
+				}),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			token, err := daf.PollTokenContext(context.Background(), dc)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("access_token"))
+			Expect(calls).To(Equal([]time.Duration{5 * time.Second}))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+
+		It("returns the error of the function when the context is canceled during the sleep", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{authorizationPending})
+			defer ms.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			daf, err := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithTimeNow(newStubTimeNow(0)),
+				auth.WithTimeSleepContext(func(ctx context.Context, _ time.Duration) error {
+					cancel()
+					<-ctx.Done()
+					return ctx.Err()
+				}),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			_, err = daf.PollTokenContext(ctx, dc)
+
+			// Assert
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,31 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+// WithDefaultScope sets the scope used when FetchDeviceCode, Authorize and so on are called with an empty scope.
+type WithDefaultScope string
+
+func (scope WithDefaultScope) apply(daf *DeviceAuthFlow) error {
+	daf.defaultScope = string(scope)
+	return nil
+}
+
+// WithDefaultAudience sets the audience used when FetchDeviceCode, Authorize and so on are called with an empty audience.
+type WithDefaultAudience string
+
+func (audience WithDefaultAudience) apply(daf *DeviceAuthFlow) error {
+	daf.defaultAudience = string(audience)
+	return nil
+}
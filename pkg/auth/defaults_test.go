@@ -0,0 +1,48 @@
+package auth_test
+
+import (
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithDefaultScope and WithDefaultAudience", func() {
+	responseBody := `{"device_code": "device_code", "user_code": "123456", "verification_uri": "https://example.com/activate", "expires_in": 20, "interval": 5}`
+
+	DescribeTable("FetchDeviceCode() falls back to the defaults",
+		func(scope, audience, expectedScope, expectedAudience string) {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path: "/oauth/device/code",
+					form: map[string][]string{
+						"client_id": {"clientID"},
+						"scope":     {expectedScope},
+						"audience":  {expectedAudience},
+					},
+					statusCode:   200,
+					responseBody: responseBody,
+				},
+			})
+			defer ms.Close()
+
+			daf, err := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID("clientID"),
+				auth.WithDefaultScope("openid profile"),
+				auth.WithDefaultAudience("https://example.com/api"),
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			_, err = daf.FetchDeviceCode(scope, audience)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ms.restExpects()).To(BeEmpty())
+		},
+		Entry("with empty arguments", "", "", "openid profile", "https://example.com/api"),
+		Entry("with explicit arguments", "openid", "https://example.com/other", "openid", "https://example.com/other"),
+	)
+})
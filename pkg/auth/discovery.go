@@ -0,0 +1,143 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// Endpoints represents endpoints of an OpenID Connect issuer, which are usually discovered by DiscoverEndpoints.
+//
+// It can be given to NewDeviceAuthFlow as an option, then the flow requests the endpoints instead of the paths of Auth0
+// under the base URL, and the base URL defaults to Issuer. Empty endpoints fall back to the paths of Auth0.
+//
+// See: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type Endpoints struct {
+	Issuer                            string `json:"issuer"`
+	AuthorizationEndpoint             string `json:"authorization_endpoint"`
+	DeviceAuthorizationEndpoint       string `json:"device_authorization_endpoint"`
+	TokenEndpoint                     string `json:"token_endpoint"`
+	UserinfoEndpoint                  string `json:"userinfo_endpoint"`
+	JWKSURI                           string `json:"jwks_uri"`
+	RevocationEndpoint                string `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string `json:"introspection_endpoint"`
+	BackchannelAuthenticationEndpoint string `json:"backchannel_authentication_endpoint"`
+}
+
+// DiscoverEndpoints fetches the discovery metadata of the issuer like https://example.us.auth0.com/
+// from /.well-known/openid-configuration under it, and returns Endpoints advertised in it.
+func DiscoverEndpoints(issuerURL string) (*Endpoints, error) {
+	return DiscoverEndpointsContext(context.Background(), issuerURL)
+}
+
+// DiscoverEndpointsContext is like DiscoverEndpoints, but the request is canceled when ctx is done.
+func DiscoverEndpointsContext(ctx context.Context, issuerURL string) (*Endpoints, error) {
+	issuer, err := neturl.Parse(issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("issuer URL is invalid: %w", err)
+	}
+	url := joinURLPath(issuer, "/.well-known/openid-configuration").String()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	setAcceptEncoding(req)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, &EndpointError{URL: url, Message: err.Error()}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, &EndpointError{URL: url, Message: "unexpected status " + res.Status}
+	}
+
+	body, err := readBody(res)
+	if err != nil {
+		return nil, &EndpointError{URL: url, Message: fmt.Sprintf("could not read discovery metadata: %s", err)}
+	}
+	e := new(Endpoints)
+	if err := json.Unmarshal(body, e); err != nil {
+		return nil, &EndpointError{URL: url, Message: fmt.Sprintf("could not decode discovery metadata: %s", err)}
+	}
+
+	// the issuer must be identical to the URL used for the discovery, except for the trailing slash of Auth0
+	// See: https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if strings.TrimSuffix(e.Issuer, "/") != strings.TrimSuffix(issuerURL, "/") {
+		return nil, &EndpointError{URL: url, Message: fmt.Sprintf("issuer %q does not match", e.Issuer)}
+	}
+	if e.TokenEndpoint == "" {
+		return nil, &EndpointError{URL: url, Message: "token endpoint is not advertised"}
+	}
+	if err := e.validate(); err != nil {
+		return nil, &EndpointError{URL: url, Message: err.Error()}
+	}
+
+	return e, nil
+}
+
+func (e *Endpoints) apply(daf *DeviceAuthFlow) error {
+	if e == nil {
+		return errors.New("Endpoints is nil")
+	}
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	daf.endpoints = *e
+	if daf.baseURL == "" {
+		daf.baseURL = strings.TrimSuffix(e.Issuer, "/")
+	}
+	return nil
+}
+
+// validate returns error if endpoints other than empty ones are not absolute URLs.
+func (e *Endpoints) validate() error {
+	for name, endpoint := range map[string]string{
+		"authorization_endpoint":              e.AuthorizationEndpoint,
+		"device_authorization_endpoint":       e.DeviceAuthorizationEndpoint,
+		"token_endpoint":                      e.TokenEndpoint,
+		"userinfo_endpoint":                   e.UserinfoEndpoint,
+		"jwks_uri":                            e.JWKSURI,
+		"revocation_endpoint":                 e.RevocationEndpoint,
+		"introspection_endpoint":              e.IntrospectionEndpoint,
+		"backchannel_authentication_endpoint": e.BackchannelAuthenticationEndpoint,
+	} {
+		if endpoint == "" {
+			continue
+		}
+		if u, err := neturl.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s is not an absolute URL: %q", name, endpoint)
+		}
+	}
+
+	return nil
+}
+
+// discoveredOr returns the discovered endpoint if it is given, or the endpoint path under the base URL.
+func (daf *DeviceAuthFlow) discoveredOr(discovered string, path string) string {
+	if discovered != "" {
+		return discovered
+	}
+	return daf.endpoint(path)
+}
@@ -0,0 +1,102 @@
+package auth_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DiscoverEndpoints", func() {
+	clientID := "clientID"
+
+	// newDiscoveryServer returns a server responding the discovery metadata built by metadata with its URL.
+	newDiscoveryServer := func(metadata func(url string) string) *httptest.Server {
+		var ts *httptest.Server
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal("GET"))
+			Expect(r.URL.Path).To(Equal("/tenant/.well-known/openid-configuration"))
+			w.Header().Set("content-type", "application/json")
+			fmt.Fprint(w, metadata(ts.URL))
+		}))
+		return ts
+	}
+
+	It("returns the endpoints which configure DeviceAuthFlow", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/custom/device",
+				form:         map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}},
+				statusCode:   200,
+				responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`,
+			},
+			{
+				path:         "/custom/token",
+				form:         map[string][]string{"grant_type": {"urn:ietf:params:oauth:grant-type:device_code"}, "device_code": {"device_code"}, "client_id": {clientID}},
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		ts := newDiscoveryServer(func(url string) string {
+			return fmt.Sprintf(`{
+				"issuer": "%s/tenant/",
+				"device_authorization_endpoint": "%s/custom/device",
+				"token_endpoint": "%s/custom/token",
+				"jwks_uri": "%s/custom/jwks.json"
+			}`, url, ms.URL, ms.URL, ms.URL)
+		})
+		defer ts.Close()
+
+		// Act
+		e, err := auth.DiscoverEndpoints(ts.URL + "/tenant")
+		Expect(err).NotTo(HaveOccurred())
+		daf, err := auth.NewDeviceAuthFlow(e, auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(1)), auth.WithTimeSleep(newMockTimeSleep().f))
+		Expect(err).NotTo(HaveOccurred())
+		token, err := daf.Authorize("openid", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(e.JWKSURI).To(Equal(ms.URL + "/custom/jwks.json"))
+		Expect(daf.BaseURL()).To(Equal(ts.URL + "/tenant"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	DescribeTable("returns EndpointError when the metadata is invalid",
+		func(metadata string, message string) {
+			// Arrange
+			ts := newDiscoveryServer(func(url string) string {
+				return fmt.Sprintf(metadata, url)
+			})
+			defer ts.Close()
+
+			// Act
+			_, err := auth.DiscoverEndpoints(ts.URL + "/tenant")
+
+			// Assert
+			var endpointErr *auth.EndpointError
+			Expect(errors.As(err, &endpointErr)).To(BeTrue())
+			Expect(endpointErr.Message).To(ContainSubstring(message))
+		},
+		Entry("issuer is different", `{"issuer": "https://evil.example.com/", "token_endpoint": "%s/token"}`, "does not match"),
+		Entry("token endpoint is missing", `{"issuer": "%s/tenant"}`, "token endpoint is not advertised"),
+		Entry("endpoint is relative", `{"issuer": "%s/tenant", "token_endpoint": "/token"}`, "token_endpoint is not an absolute URL"),
+	)
+
+	It("returns error when invalid Endpoints is given", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(&auth.Endpoints{Issuer: "https://example.com/", TokenEndpoint: "token"}, auth.WithClientID(clientID))
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("token_endpoint is not an absolute URL")))
+	})
+})
@@ -0,0 +1,73 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxResponseBodySize is the maximum size of decompressed response bodies.
+// Responses of the endpoints are small JSON, so larger bodies are treated as broken or malicious.
+const maxResponseBodySize = 1 << 20
+
+// ErrResponseTooLarge is returned when a (decompressed) response body exceeds the size limit.
+var ErrResponseTooLarge = errors.New("response body is too large")
+
+// ContentEncodingError is returned when a response is encoded with an unsupported content coding.
+type ContentEncodingError struct {
+	Encoding string
+}
+
+func (e *ContentEncodingError) Error() string {
+	return fmt.Sprintf("unsupported content encoding: %q", e.Encoding)
+}
+
+// setAcceptEncoding requests gzip explicitly.
+// Because of it, net/http does not decompress responses transparently and readBody handles them.
+func setAcceptEncoding(req *http.Request) {
+	req.Header.Set("accept-encoding", "gzip")
+}
+
+// readBody reads the response body, decompressing gzip and limiting the size.
+func readBody(res *http.Response) ([]byte, error) {
+	var r io.Reader = res.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("content-encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	default:
+		return nil, &ContentEncodingError{Encoding: encoding}
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, maxResponseBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxResponseBodySize {
+		return nil, ErrResponseTooLarge
+	}
+
+	return b, nil
+}
@@ -0,0 +1,82 @@
+package auth_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Content encoding", func() {
+	gzipped := func(b []byte) []byte {
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+
+	newServer := func(encoding string, body []byte) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("accept-encoding")).To(Equal("gzip"))
+
+			w.Header().Set("content-type", "application/json")
+			if encoding != "" {
+				w.Header().Set("content-encoding", encoding)
+			}
+			w.Write(body)
+		}))
+	}
+
+	It("decompresses gzip responses", func() {
+		// Arrange
+		ts := newServer("gzip", gzipped([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`)))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+	})
+
+	It("rejects unsupported encodings", func() {
+		// Arrange
+		ts := newServer("br", []byte("compressed"))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(&auth.ContentEncodingError{Encoding: "br"}))
+	})
+
+	It("rejects too large decompressed bodies", func() {
+		// Arrange
+		ts := newServer("gzip", gzipped(bytes.Repeat([]byte(" "), 2<<20)))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(auth.ErrResponseTooLarge))
+	})
+})
@@ -0,0 +1,121 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+)
+
+// NetworkError is returned when a request could not be sent or its response could not be read.
+type NetworkError struct {
+	// Op is "request" or "read".
+	Op  string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	if e.Op == "read" {
+		return fmt.Sprintf("could not read response body: %s", e.Err)
+	}
+	return fmt.Sprintf("request was failed: %s", e.Err)
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the error is caused by a timeout.
+func (e *NetworkError) Timeout() bool {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+// Temporary reports whether the request may succeed when retried,
+// e.g. timeouts, refused or reset connections and temporary DNS failures.
+// Refused redirects and TLS verification failures are not temporary.
+func (e *NetworkError) Temporary() bool {
+	if e.Timeout() {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(e.Err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	return errors.Is(e.Err, syscall.ECONNREFUSED) ||
+		errors.Is(e.Err, syscall.ECONNRESET) ||
+		errors.Is(e.Err, io.EOF) ||
+		errors.Is(e.Err, io.ErrUnexpectedEOF)
+}
+
+// ServerError is returned when Auth0 API responds with an unexpected status other than 4xx.
+type ServerError struct {
+	// Request is the kind of the request like "device code", "token", "revoke", "introspection" or "backchannel authentication".
+	Request    string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s request was failed: %s", e.Request, string(e.Body))
+}
+
+// Timeout reports whether the status is 504 Gateway Timeout.
+func (e *ServerError) Timeout() bool {
+	return e.StatusCode == 504
+}
+
+// Temporary reports whether the status is 5xx.
+func (e *ServerError) Temporary() bool {
+	return e.StatusCode/100 == 5
+}
+
+// Timeout always returns false because 4xx errors are not caused by timeouts.
+func (e *APIError) Timeout() bool {
+	return false
+}
+
+// Temporary reports whether the status is 429 Too Many Requests.
+func (e *APIError) Temporary() bool {
+	return e.StatusCode == 429
+}
+
+// Retryable reports whether err or an error wrapped by it is temporary or a timeout,
+// so that retrying the same request may succeed.
+func Retryable(err error) bool {
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) && temporary.Temporary() {
+		return true
+	}
+
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// IsInvalidGrant reports whether err or an error wrapped by it is APIError of invalid_grant,
+// e.g. the refresh token is revoked or rotated away and the user has to authorize again.
+func IsInvalidGrant(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Body != nil && apiErr.Body.Error == "invalid_grant"
+}
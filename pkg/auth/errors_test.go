@@ -0,0 +1,93 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Retryable", func() {
+	DescribeTable("classifies errors",
+		func(err error, expected bool) {
+			// Act
+			actual := auth.Retryable(err)
+
+			// Assert
+			Expect(actual).To(Equal(expected))
+		},
+		Entry("503", &auth.ServerError{Request: "token", StatusCode: 503}, true),
+		Entry("504", &auth.ServerError{Request: "token", StatusCode: 504}, true),
+		Entry("301", &auth.ServerError{Request: "token", StatusCode: 301}, false),
+		Entry("429", &auth.APIError{StatusCode: 429, Body: &auth.ErrorResponse{Error: "too_many_requests"}}, true),
+		Entry("403", &auth.APIError{StatusCode: 403, Body: &auth.ErrorResponse{Error: "access_denied"}}, false),
+		Entry("deadline exceeded", &auth.NetworkError{Op: "request", Err: context.DeadlineExceeded}, true),
+		Entry("temporary DNS failure", &auth.NetworkError{Op: "request", Err: &net.DNSError{IsTemporary: true}}, true),
+		Entry("not found host", &auth.NetworkError{Op: "request", Err: &net.DNSError{IsNotFound: true}}, false),
+		Entry("refused redirect", &auth.NetworkError{Op: "request", Err: &auth.RedirectError{From: "https://a", To: "https://b"}}, false),
+		Entry("wrapped", fmt.Errorf("wrapped: %w", &auth.ServerError{Request: "token", StatusCode: 502}), true),
+		Entry("expired", &auth.ExpiredError{ExpiresIn: 900}, false),
+		Entry("other", errors.New("error"), false),
+	)
+
+	It("returns true for 5xx responses of token endpoint", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(503)
+			w.Write([]byte("unavailable"))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(&auth.ServerError{Request: "token", StatusCode: 503, Body: []byte("unavailable")}))
+		Expect(auth.Retryable(err)).To(BeTrue())
+	})
+
+	It("returns true for refused connections", func() {
+		// Arrange
+		ts := httptest.NewServer(http.NotFoundHandler())
+		url := ts.URL
+		ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(url), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.FetchDeviceCode("openid", "audience")
+
+		// Assert
+		var networkError *auth.NetworkError
+		Expect(errors.As(err, &networkError)).To(BeTrue())
+		Expect(auth.Retryable(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("IsInvalidGrant", func() {
+	DescribeTable("classifies errors",
+		func(err error, expected bool) {
+			// Act
+			actual := auth.IsInvalidGrant(err)
+
+			// Assert
+			Expect(actual).To(Equal(expected))
+		},
+		Entry("invalid_grant", &auth.APIError{StatusCode: 403, Body: &auth.ErrorResponse{Error: "invalid_grant"}}, true),
+		Entry("wrapped", fmt.Errorf("wrapped: %w", &auth.APIError{StatusCode: 400, Body: &auth.ErrorResponse{Error: "invalid_grant"}}), true),
+		Entry("access_denied", &auth.APIError{StatusCode: 403, Body: &auth.ErrorResponse{Error: "access_denied"}}, false),
+		Entry("server error", &auth.ServerError{Request: "token", StatusCode: 503}, false),
+		Entry("nil", nil, false),
+	)
+})
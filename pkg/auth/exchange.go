@@ -0,0 +1,93 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	neturl "net/url"
+)
+
+// tokenExchangeGrantType is the grant type of RFC 8693.
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers of RFC 8693.
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchangeRequest represents parameters of the token exchange request.
+//
+// Empty SubjectTokenType is TokenTypeAccessToken, and empty Scope and Audience fall back to WithDefaultScope and WithDefaultAudience.
+// The issued_token_type of the response is kept in Extra of TokenResponse.
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	Audience           string
+	Scope              string
+	RequestedTokenType string
+	// Extra is additional parameters like actor_token. Parameters set by DeviceAuthFlow cannot be given.
+	Extra neturl.Values
+}
+
+// Exchange exchanges the subject token for a token of another audience, e.g. to call downstream services on behalf of the user.
+//
+// See: https://www.rfc-editor.org/rfc/rfc8693
+func (daf *DeviceAuthFlow) Exchange(req *TokenExchangeRequest) (*TokenResponse, error) {
+	return daf.ExchangeContext(context.Background(), req)
+}
+
+// ExchangeContext is like Exchange, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) ExchangeContext(ctx context.Context, req *TokenExchangeRequest) (*TokenResponse, error) {
+	if req.SubjectToken == "" {
+		return nil, errors.New("subject token is required for the token exchange")
+	}
+
+	params := neturl.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {req.SubjectToken},
+		"subject_token_type": {req.SubjectTokenType},
+	}
+	if req.SubjectTokenType == "" {
+		params.Set("subject_token_type", TokenTypeAccessToken)
+	}
+	scope := req.Scope
+	if scope == "" {
+		scope = daf.defaultScope
+	}
+	if scope != "" {
+		params.Set("scope", scope)
+	}
+	audience := req.Audience
+	if audience == "" {
+		audience = daf.defaultAudience
+	}
+	if audience != "" {
+		params.Set("audience", audience)
+	}
+	if req.RequestedTokenType != "" {
+		params.Set("requested_token_type", req.RequestedTokenType)
+	}
+
+	extra, err := encodeExtraParams(req.Extra, "grant_type", "client_id", "subject_token", "subject_token_type", "scope", "audience", "requested_token_type")
+	if err != nil {
+		return nil, err
+	}
+
+	return daf.exchangeToken(ctx, "client_id="+daf.clientID+"&"+params.Encode()+extra)
+}
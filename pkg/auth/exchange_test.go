@@ -0,0 +1,69 @@
+package auth_test
+
+import (
+	"net/url"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exchange()", func() {
+	clientID := "clientID"
+
+	It("exchanges the subject token for a token of the audience", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+					"client_id":            {clientID},
+					"subject_token":        {"subject_token"},
+					"subject_token_type":   {"urn:ietf:params:oauth:token-type:access_token"},
+					"audience":             {"https://downstream.example.com"},
+					"scope":                {"read"},
+					"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+					"actor_token":          {"actor_token"},
+				},
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "issued_token_type": "urn:ietf:params:oauth:token-type:access_token", "token_type": "Bearer", "expires_in": 3600}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithDefaultScope("read"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.Exchange(&auth.TokenExchangeRequest{
+			SubjectToken:       "subject_token",
+			Audience:           "https://downstream.example.com",
+			RequestedTokenType: auth.TokenTypeAccessToken,
+			Extra:              url.Values{"actor_token": {"actor_token"}},
+		})
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(string(token.Extra["issued_token_type"])).To(Equal(`"urn:ietf:params:oauth:token-type:access_token"`))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid requests",
+		func(req *auth.TokenExchangeRequest) {
+			// Arrange
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			_, err = daf.Exchange(req)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("without subject token", &auth.TokenExchangeRequest{Audience: "https://downstream.example.com"}),
+		Entry("with reserved parameter in Extra", &auth.TokenExchangeRequest{SubjectToken: "subject_token", Extra: url.Values{"subject_token": {"other"}}}),
+	)
+})
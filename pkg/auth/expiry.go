@@ -0,0 +1,39 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// WithExpiryGracePeriod specifies how long polling continues after ExpiresAt of the device code or the CIBA request
+// before ExpiredError is returned, so that the server decides whether the code is expired.
+// ExpiresAt is computed from expires_in with the local clock, which is not affected by the skew against the server,
+// so the grace period only tolerates delays such as the latency of the response. It is zero by default.
+type WithExpiryGracePeriod time.Duration
+
+func (d WithExpiryGracePeriod) apply(daf *DeviceAuthFlow) error {
+	if d < 0 {
+		return errors.New("expiry grace period must not be negative")
+	}
+	daf.expiryGrace = time.Duration(d)
+	return nil
+}
+
+// expired reports whether the grant expiring at expiresAt is expired after d from now, with the grace period.
+func (daf *DeviceAuthFlow) expired(expiresAt time.Time, d time.Duration) bool {
+	return !daf.timeNow().Add(d).Before(expiresAt.Add(daf.expiryGrace))
+}
@@ -0,0 +1,118 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Expiry", func() {
+	clientID := "clientID"
+	deviceCodeForm := map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}}
+	tokenForm := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+	pending := requestExpectation{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "authorization_pending", "error_description": "pending"}`}
+	authorized := requestExpectation{path: "/oauth/token", form: tokenForm, statusCode: 200, responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`}
+
+	It("computes ExpiresAt with the local clock regardless of the Date header", func() {
+		// Arrange
+		// the local clock is 1 hour ahead of the server
+		serverTime := baseStubTime.Add(-time.Hour)
+		ms := newMockServer([]requestExpectation{
+			{
+				path:           "/oauth/device/code",
+				form:           deviceCodeForm,
+				statusCode:     200,
+				responseBody:   `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`,
+				responseHeader: map[string]string{"Date": serverTime.Format(http.TimeFormat)},
+			},
+			pending,
+			authorized,
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+		)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+		Expect(err).NotTo(HaveOccurred())
+		token, err := daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.ExpiresAt).To(Equal(baseStubTime.Add(20 * time.Second)))
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("keeps polling during WithExpiryGracePeriod and returns the error of the server", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			pending,
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "expired_token", "error_description": "expired"}`},
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(5)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithExpiryGracePeriod(10*time.Second),
+		)
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 5, Interval: 5, ExpiresAt: baseStubTime.Add(5 * time.Second)}
+
+		// Act
+		_, err := daf.PollToken(dc)
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Body.Error).To(Equal("expired_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns ExpiredError after WithExpiryGracePeriod", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{pending, pending})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(5)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithExpiryGracePeriod(5*time.Second),
+		)
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 5, Interval: 5, ExpiresAt: baseStubTime.Add(5 * time.Second)}
+
+		// Act
+		_, err := daf.PollToken(dc)
+
+		// Assert
+		var expiredErr *auth.ExpiredError
+		Expect(errors.As(err, &expiredErr)).To(BeTrue())
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("rejects the negative grace period", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), auth.WithExpiryGracePeriod(-time.Second))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,138 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// RequestInfo identifies a request to the endpoints. It is given to hooks via the context of the request,
+// i.e. WithDialContext, Transport of WithHTTPClient and context-aware hooks of WithResponseValidator,
+// so that they can be correlated with tracing systems of the application.
+type RequestInfo struct {
+	// FlowID is shared by requests of a flow. It is given by ContextWithFlowID or WithFlowID, or a random one
+	// for each flow. The ID when the device code is fetched is kept by it for its polls.
+	FlowID string
+	// Attempt is the number of the request to the same endpoint in the flow from 1, which is incremented by polls and retries.
+	Attempt int
+}
+
+type flowIDKey struct{}
+
+type requestInfoKey struct{}
+
+// WithFlowID specifies the flow ID of all requests of DeviceAuthFlow unless ContextWithFlowID is given,
+// so that a login can be traced across fetching the device code, polls and refreshes after it.
+// By default, a random ID is used for each flow.
+type WithFlowID string
+
+func (id WithFlowID) apply(daf *DeviceAuthFlow) error {
+	if id == "" {
+		return errors.New("flow ID must not be empty")
+	}
+	daf.flowID = string(id)
+	return nil
+}
+
+// WithFlowIDHeader specifies the name of the request header to send the flow ID (e.g. X-Flow-ID),
+// to correlate requests with logs of proxies and the authorization server. It is not sent by default.
+type WithFlowIDHeader string
+
+func (name WithFlowIDHeader) apply(daf *DeviceAuthFlow) error {
+	daf.flowIDHeader = string(name)
+	return nil
+}
+
+// ContextWithFlowID returns ctx with the flow ID, which is used by requests with ctx instead of a random one.
+func ContextWithFlowID(ctx context.Context, flowID string) context.Context {
+	return context.WithValue(ctx, flowIDKey{}, flowID)
+}
+
+// RequestInfoFromContext returns RequestInfo of the request whose context is ctx.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info, ok
+}
+
+// FlowID returns the flow ID of polls of the device code.
+func (dc *DeviceCodeResponse) FlowID() string {
+	if dc.flowID != "" {
+		return dc.flowID
+	}
+	return deriveFlowID(dc.DeviceCode)
+}
+
+// contextWithRequestInfo returns ctx with RequestInfo of the attempt in the flow.
+func contextWithRequestInfo(ctx context.Context, flowID string, attempt int) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, RequestInfo{FlowID: flowID, Attempt: attempt})
+}
+
+// givenFlowID returns the flow ID given by ContextWithFlowID, or empty.
+func givenFlowID(ctx context.Context) string {
+	flowID, _ := ctx.Value(flowIDKey{}).(string)
+	return flowID
+}
+
+// flowIDFromContext returns the flow ID given by ContextWithFlowID or WithFlowID, or a new random one.
+func (daf *DeviceAuthFlow) flowIDFromContext(ctx context.Context) string {
+	if flowID := givenFlowID(ctx); flowID != "" {
+		return flowID
+	}
+	if daf.flowID != "" {
+		return daf.flowID
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// pollFlowID returns the flow ID of polls of the grant, given by ContextWithFlowID,
+// kept when the grant is issued (stored), given by WithFlowID, or derived from the grant in this order.
+func (daf *DeviceAuthFlow) pollFlowID(ctx context.Context, stored string, grant string) string {
+	if flowID := givenFlowID(ctx); flowID != "" {
+		return flowID
+	}
+	if stored != "" {
+		return stored
+	}
+	if daf.flowID != "" {
+		return daf.flowID
+	}
+	return deriveFlowID(grant)
+}
+
+// setFlowIDHeader sets the flow ID of the request to the header given by WithFlowIDHeader.
+func (daf *DeviceAuthFlow) setFlowIDHeader(req *http.Request) {
+	if daf.flowIDHeader == "" {
+		return
+	}
+	if info, ok := RequestInfoFromContext(req.Context()); ok && info.FlowID != "" {
+		req.Header.Set(daf.flowIDHeader, info.FlowID)
+	}
+}
+
+// deriveFlowID returns the flow ID of polls of the grant like the device code, without revealing it.
+func deriveFlowID(grant string) string {
+	sum := sha256.Sum256([]byte(grant))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,199 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequestInfo", func() {
+	clientID := "clientID"
+	deviceCodeForm := map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}}
+	tokenForm := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+	expectations := []requestExpectation{
+		{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 200, responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 60, "interval": 5}`},
+		{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "authorization_pending", "error_description": "pending"}`},
+		{path: "/oauth/token", form: tokenForm, statusCode: 200, responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`},
+	}
+
+	// recordingClient returns http.Client recording RequestInfo of requests to infos.
+	recordingClient := func(infos *[]auth.RequestInfo) auth.WithHTTPClient {
+		return auth.WithHTTPClient{Client: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			info, ok := auth.RequestInfoFromContext(req.Context())
+			Expect(ok).To(BeTrue())
+			*infos = append(*infos, info)
+			return http.DefaultTransport.RoundTrip(req)
+		})}}
+	}
+
+	It("gives the flow ID given by ContextWithFlowID and attempts to the transport", func() {
+		// Arrange
+		ms := newMockServer(expectations)
+		defer ms.Close()
+
+		var infos []auth.RequestInfo
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			recordingClient(&infos),
+		)
+		ctx := auth.ContextWithFlowID(context.Background(), "flow-1")
+
+		// Act
+		dc, err := daf.FetchDeviceCodeContext(ctx, "openid", "https://example.com/api")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.FlowID()).To(Equal("flow-1"))
+		Expect(infos).To(Equal([]auth.RequestInfo{
+			{FlowID: "flow-1", Attempt: 1},
+			{FlowID: "flow-1", Attempt: 1},
+			{FlowID: "flow-1", Attempt: 2},
+		}))
+	})
+
+	It("shares the flow ID derived from the device code between polls", func() {
+		// Arrange
+		ms := newMockServer(expectations[1:])
+		defer ms.Close()
+
+		var infos []auth.RequestInfo
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			recordingClient(&infos),
+		)
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 60, Interval: 5, ExpiresAt: baseStubTime.Add(60 * time.Second)}
+
+		// Act
+		_, err := daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.FlowID()).NotTo(BeEmpty())
+		Expect(dc.FlowID()).NotTo(ContainSubstring("device_code"))
+		Expect(infos).To(Equal([]auth.RequestInfo{{FlowID: dc.FlowID(), Attempt: 1}, {FlowID: dc.FlowID(), Attempt: 2}}))
+	})
+
+	It("shares a random flow ID between fetching the device code and polls", func() {
+		// Arrange
+		ms := newMockServer(expectations)
+		defer ms.Close()
+
+		var infos []auth.RequestInfo
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			recordingClient(&infos),
+		)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.FlowID()).To(MatchRegexp(`^[0-9a-f]{16}$`))
+		Expect(infos).To(Equal([]auth.RequestInfo{
+			{FlowID: dc.FlowID(), Attempt: 1},
+			{FlowID: dc.FlowID(), Attempt: 1},
+			{FlowID: dc.FlowID(), Attempt: 2},
+		}))
+	})
+
+	It("sends the flow ID of WithFlowID in the header of WithFlowIDHeader until refreshes", func() {
+		// Arrange
+		ms := newMockServer(append(expectations, requestExpectation{
+			path:         "/oauth/token",
+			form:         map[string][]string{"grant_type": {"refresh_token"}, "client_id": {clientID}, "refresh_token": {"refresh_token"}},
+			statusCode:   200,
+			responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+		}))
+		defer ms.Close()
+
+		var headers []string
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithFlowID("login-1"),
+			auth.WithFlowIDHeader("X-Flow-ID"),
+			auth.WithHTTPClient{Client: &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				headers = append(headers, req.Header.Get("X-Flow-ID"))
+				return http.DefaultTransport.RoundTrip(req)
+			})}},
+		)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = daf.PollToken(dc)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.FlowID()).To(Equal("login-1"))
+		Expect(headers).To(Equal([]string{"login-1", "login-1", "login-1", "login-1"}))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("rejects the empty flow ID", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), auth.WithFlowID(""))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("gives RequestInfo to context-aware validators", func() {
+		// Arrange
+		ms := newMockServer(expectations)
+		defer ms.Close()
+
+		var infos []auth.RequestInfo
+		record := func(ctx context.Context) {
+			info, _ := auth.RequestInfoFromContext(ctx)
+			infos = append(infos, info)
+		}
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithResponseValidator{
+				DeviceCodeContext: func(ctx context.Context, dc *auth.DeviceCodeResponse) error { record(ctx); return nil },
+				TokenContext:      func(ctx context.Context, t *auth.TokenResponse) error { record(ctx); return nil },
+			},
+		)
+		ctx := auth.ContextWithFlowID(context.Background(), "flow-1")
+
+		// Act
+		dc, err := daf.FetchDeviceCodeContext(ctx, "openid", "https://example.com/api")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(Equal([]auth.RequestInfo{{FlowID: "flow-1", Attempt: 1}, {FlowID: "flow-1", Attempt: 2}}))
+	})
+})
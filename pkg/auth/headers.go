@@ -0,0 +1,79 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// reservedHeaders are headers set by DeviceAuthFlow or net/http, which cannot be overridden by WithHeaders.
+var reservedHeaders = []string{"Accept-Encoding", "Content-Encoding", "Content-Length", "Content-Type", "Host", "Transfer-Encoding"}
+
+// WithHeaders adds static headers to all requests to the endpoints,
+// e.g. tenant routing headers required by API gateways in front of the tenant.
+// It can be given multiple times, and values of the same header are appended.
+type WithHeaders http.Header
+
+func (headers WithHeaders) apply(daf *DeviceAuthFlow) error {
+	if daf.headers == nil {
+		daf.headers = make(http.Header)
+	}
+
+	for name, values := range headers {
+		name = http.CanonicalHeaderKey(name)
+		for _, reserved := range reservedHeaders {
+			if name == reserved {
+				return fmt.Errorf("header %s cannot be given with WithHeaders", name)
+			}
+		}
+		for _, v := range values {
+			daf.headers.Add(name, v)
+		}
+	}
+
+	return nil
+}
+
+// WithAcceptLanguage sends Accept-Language header like "ja-JP, en;q=0.8" to the endpoints,
+// so that error_description of errors and messages of the server are localized if the tenant supports the language.
+// It overrides Accept-Language given by WithHeaders.
+type WithAcceptLanguage string
+
+func (language WithAcceptLanguage) apply(daf *DeviceAuthFlow) error {
+	if language == "" {
+		return errors.New("language of WithAcceptLanguage is empty")
+	}
+	if strings.ContainsAny(string(language), "\r\n") {
+		return fmt.Errorf("invalid language of WithAcceptLanguage: %q", string(language))
+	}
+
+	daf.acceptLanguage = string(language)
+	return nil
+}
+
+// setHeaders sets the headers given by WithHeaders to req.
+func (daf *DeviceAuthFlow) setHeaders(req *http.Request) {
+	for name, values := range daf.headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if daf.acceptLanguage != "" {
+		req.Header.Set("Accept-Language", daf.acceptLanguage)
+	}
+}
@@ -0,0 +1,89 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithHeaders", func() {
+	It("adds the headers to requests", func() {
+		// Arrange
+		var got http.Header
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header
+			w.Header().Set("content-type", "application/json")
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithHeaders{"x-forwarded-client": {"a0daf"}},
+			auth.WithHeaders{"X-Tenant": {"a", "b"}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Values("X-Forwarded-Client")).To(Equal([]string{"a0daf"}))
+		Expect(got.Values("X-Tenant")).To(Equal([]string{"a", "b"}))
+		Expect(got.Get("Content-Type")).To(Equal("application/x-www-form-urlencoded"))
+	})
+
+	It("rejects reserved headers", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL("https://example.com"),
+			auth.WithClientID("clientID"),
+			auth.WithHeaders{"content-type": {"text/plain"}},
+		)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("WithAcceptLanguage", func() {
+	It("sends Accept-Language overriding WithHeaders", func() {
+		// Arrange
+		var got http.Header
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Header
+			w.Header().Set("content-type", "application/json")
+			w.Write([]byte(`{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithAcceptLanguage("ja-JP, en;q=0.8"),
+			auth.WithHeaders{"Accept-Language": {"fr"}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Values("Accept-Language")).To(Equal([]string{"ja-JP, en;q=0.8"}))
+	})
+
+	It("rejects line breaks", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithAcceptLanguage("ja\r\nX-Injected: 1"))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
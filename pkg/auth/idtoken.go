@@ -0,0 +1,253 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/jwks"
+	"github.com/autopp/go-a0daf/pkg/jwt"
+)
+
+// defaultIDTokenLeeway is the default of WithIDTokenLeeway.
+const defaultIDTokenLeeway = time.Minute
+
+// IDTokenClaims are standard claims of the ID token returned by ValidateIDToken.
+// Claims has all claims including them, e.g. to read custom claims.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#IDToken
+type IDTokenClaims struct {
+	Issuer          string
+	Subject         string
+	Audience        []string
+	ExpiresAt       time.Time
+	IssuedAt        time.Time
+	AuthTime        time.Time
+	Nonce           string
+	AuthorizedParty string
+	Name            string
+	Email           string
+	EmailVerified   bool
+	Claims          map[string]interface{}
+}
+
+// IDTokenError is returned by ValidateIDToken when the ID token is not valid.
+type IDTokenError struct {
+	Message string
+}
+
+func (e *IDTokenError) Error() string {
+	return "invalid ID token: " + e.Message
+}
+
+// WithIDTokenLeeway specifies the tolerance of clock skew to validate exp and iat of ID tokens. It is 1 minute by default.
+type WithIDTokenLeeway time.Duration
+
+func (leeway WithIDTokenLeeway) apply(daf *DeviceAuthFlow) error {
+	if leeway < 0 {
+		return fmt.Errorf("WithIDTokenLeeway must not be negative: %s", time.Duration(leeway))
+	}
+	daf.idTokenLeeway = time.Duration(leeway)
+	return nil
+}
+
+// WithJWKS specifies the client of JWKS to verify signatures of ID tokens, which can be shared among DeviceAuthFlows.
+// By default, JWKS at jwks_uri of Endpoints or /.well-known/jwks.json under the base URL is fetched with the HTTP client of the flow.
+type WithJWKS struct {
+	Client *jwks.Client
+}
+
+func (o WithJWKS) apply(daf *DeviceAuthFlow) error {
+	if o.Client == nil {
+		return errors.New("Client of WithJWKS is nil")
+	}
+	daf.jwks = o.Client
+	return nil
+}
+
+// ValidateIDToken verifies the signature of the ID token with JWKS of the tenant (or the client secret for HS256),
+// validates iss, aud, azp, exp and iat claims, and returns the claims.
+func (daf *DeviceAuthFlow) ValidateIDToken(idToken string) (*IDTokenClaims, error) {
+	return daf.ValidateIDTokenContext(context.Background(), idToken)
+}
+
+// ValidateIDTokenContext is like ValidateIDToken, but fetching JWKS is canceled when ctx is done.
+func (daf *DeviceAuthFlow) ValidateIDTokenContext(ctx context.Context, idToken string) (*IDTokenClaims, error) {
+	t, err := jwt.Decode(idToken)
+	if err != nil {
+		return nil, &IDTokenError{Message: err.Error()}
+	}
+	if err := daf.verifyJWTSignature(ctx, t.Algorithm(), t.KeyID(), t.SigningInput, t.Signature); err != nil {
+		return nil, err
+	}
+
+	return daf.validateIDTokenClaims(t)
+}
+
+// verifyJWTSignature verifies sig of signingInput with the key of kid in JWKS, or the client secret for HS256.
+func (daf *DeviceAuthFlow) verifyJWTSignature(ctx context.Context, alg string, kid string, signingInput string, sig []byte) error {
+	if alg == "HS256" {
+		if daf.clientSecret == "" {
+			return &IDTokenError{Message: "HS256 requires the client secret"}
+		}
+		mac := hmac.New(sha256.New, []byte(daf.clientSecret))
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return &IDTokenError{Message: "signature is invalid"}
+		}
+		return nil
+	}
+
+	client, err := daf.jwksClient()
+	if err != nil {
+		return err
+	}
+	key, err := client.Key(ctx, kid)
+	if err != nil {
+		return err
+	}
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return &IDTokenError{Message: fmt.Sprintf("alg %q does not match the key %q for %q", alg, kid, key.Algorithm)}
+	}
+
+	if !verifySignature(alg, key.Public, []byte(signingInput), sig) {
+		return &IDTokenError{Message: fmt.Sprintf("signature is invalid with alg %q", alg)}
+	}
+	return nil
+}
+
+// jwsHashes are hash functions of supported algorithms of JWS except EdDSA.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7518#section-3.1
+var jwsHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// verifySignature reports whether sig is a valid JWS signature of alg. Unsupported algorithms including "none" are never valid.
+func verifySignature(alg string, public crypto.PublicKey, signingInput []byte, sig []byte) bool {
+	if alg == "EdDSA" {
+		key, ok := public.(ed25519.PublicKey)
+		return ok && ed25519.Verify(key, signingInput, sig)
+	}
+
+	h, ok := jwsHashes[alg]
+	if !ok {
+		return false
+	}
+	hasher := h.New()
+	hasher.Write(signingInput)
+	digest := hasher.Sum(nil)
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(key, h, digest, sig) == nil
+		case "PS":
+			return rsa.VerifyPSS(key, h, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		// the signature is R and S in fixed length, not ASN.1
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[:2] != "ES" || len(sig) != 2*size {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+
+	return false
+}
+
+// jwksClient returns the client given by WithJWKS, or creates it with the HTTP client of the flow.
+func (daf *DeviceAuthFlow) jwksClient() (*jwks.Client, error) {
+	daf.jwksOnce.Do(func() {
+		if daf.jwks != nil {
+			return
+		}
+		url := daf.discoveredOr(daf.endpoints.JWKSURI, "/.well-known/jwks.json")
+		daf.jwks, daf.jwksErr = jwks.NewClient(url, jwks.WithHTTPClient{Client: daf.httpClient}, jwks.WithTimeNow(daf.timeNow))
+	})
+	return daf.jwks, daf.jwksErr
+}
+
+// validateIDTokenClaims validates claims of the verified ID token.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+func (daf *DeviceAuthFlow) validateIDTokenClaims(t *jwt.Token) (*IDTokenClaims, error) {
+	c := &IDTokenClaims{
+		Issuer:          t.Standard.Issuer,
+		Subject:         t.Standard.Subject,
+		Audience:        t.Standard.Audience,
+		ExpiresAt:       t.Standard.ExpiresAt,
+		IssuedAt:        t.Standard.IssuedAt,
+		AuthTime:        jwt.NumericDate(t.Claims["auth_time"]),
+		AuthorizedParty: t.Standard.AuthorizedParty,
+		Claims:          t.Claims,
+	}
+	c.Nonce, _ = t.Claims["nonce"].(string)
+	c.Name, _ = t.Claims["name"].(string)
+	c.Email, _ = t.Claims["email"].(string)
+	c.EmailVerified, _ = t.Claims["email_verified"].(bool)
+
+	// the issuer of Auth0 has the trailing slash
+	issuer := daf.endpoints.Issuer
+	if issuer == "" {
+		issuer = strings.TrimSuffix(daf.baseURL, "/") + "/"
+	}
+	if c.Issuer != issuer {
+		return nil, &IDTokenError{Message: fmt.Sprintf("iss %q is not %q", c.Issuer, issuer)}
+	}
+
+	if !containsAudience(c.Audience, daf.clientID) {
+		return nil, &IDTokenError{Message: fmt.Sprintf("aud %q does not contain the client ID", c.Audience)}
+	}
+	if (len(c.Audience) > 1 || c.AuthorizedParty != "") && c.AuthorizedParty != daf.clientID {
+		return nil, &IDTokenError{Message: fmt.Sprintf("azp %q is not the client ID", c.AuthorizedParty)}
+	}
+
+	now := daf.timeNow()
+	if c.ExpiresAt.IsZero() || !now.Before(c.ExpiresAt.Add(daf.idTokenLeeway)) {
+		return nil, &IDTokenError{Message: "token is expired or exp is missing"}
+	}
+	if c.IssuedAt.IsZero() || c.IssuedAt.After(now.Add(daf.idTokenLeeway)) {
+		return nil, &IDTokenError{Message: "token is issued in the future or iat is missing"}
+	}
+
+	return c, nil
+}
+
+func containsAudience(audience []string, clientID string) bool {
+	for _, a := range audience {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/mockauth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// newJWT returns a JWT of header and claims signed by sign.
+func newJWT(header map[string]string, claims map[string]interface{}, sign func(signingInput []byte) []byte) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+var _ = Describe("ValidateIDToken", func() {
+	clientID := "clientID"
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signES256 := func(signingInput []byte) []byte {
+		sum := sha256.Sum256(signingInput)
+		r, s, _ := ecdsa.Sign(rand.Reader, key, sum[:])
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig
+	}
+	header := map[string]string{"alg": "ES256", "typ": "JWT", "kid": "key"}
+
+	var ts *httptest.Server
+	var claims map[string]interface{}
+	BeforeEach(func() {
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/.well-known/jwks.json"))
+			fmt.Fprintf(w, `{"keys": [{"kty": "EC", "kid": "key", "alg": "ES256", "crv": "P-256", "x": "%s", "y": "%s"}]}`,
+				base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))))
+		}))
+		claims = map[string]interface{}{
+			"iss":   ts.URL + "/",
+			"sub":   "auth0|alice",
+			"aud":   clientID,
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"email": "alice@example.com",
+			"org":   "custom",
+		}
+	})
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	newFlow := func(opts ...auth.DeviceAuthFlowOption) *auth.DeviceAuthFlow {
+		opts = append([]auth.DeviceAuthFlowOption{auth.WithBaseURL(ts.URL), auth.WithClientID(clientID), auth.WithTimeNow(func() time.Time { return now })}, opts...)
+		daf, err := auth.NewDeviceAuthFlow(opts...)
+		Expect(err).NotTo(HaveOccurred())
+		return daf
+	}
+
+	It("returns claims of the valid ID token", func() {
+		// Arrange
+		daf := newFlow()
+
+		// Act
+		actual, err := daf.ValidateIDToken(newJWT(header, claims, signES256))
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.Issuer).To(Equal(ts.URL + "/"))
+		Expect(actual.Subject).To(Equal("auth0|alice"))
+		Expect(actual.Audience).To(Equal([]string{clientID}))
+		Expect(actual.ExpiresAt.Equal(now.Add(time.Hour))).To(BeTrue())
+		Expect(actual.IssuedAt.Equal(now)).To(BeTrue())
+		Expect(actual.Email).To(Equal("alice@example.com"))
+		Expect(actual.Claims["org"]).To(Equal("custom"))
+	})
+
+	It("accepts the token expired within the leeway", func() {
+		// Arrange
+		claims["exp"] = now.Add(-30 * time.Second).Unix()
+		token := newJWT(header, claims, signES256)
+
+		// Act
+		_, errDefault := newFlow().ValidateIDToken(token)
+		_, errStrict := newFlow(auth.WithIDTokenLeeway(0)).ValidateIDToken(token)
+
+		// Assert
+		Expect(errDefault).NotTo(HaveOccurred())
+		Expect(errStrict).To(MatchError(ContainSubstring("expired")))
+	})
+
+	DescribeTable("returns IDTokenError when the ID token is invalid",
+		func(modify func(h map[string]string, c map[string]interface{}) string, message string) {
+			// Arrange
+			daf := newFlow()
+			h := map[string]string{}
+			for k, v := range header {
+				h[k] = v
+			}
+
+			// Act
+			_, err := daf.ValidateIDToken(modify(h, claims))
+
+			// Assert
+			var idTokenErr *auth.IDTokenError
+			Expect(errors.As(err, &idTokenErr)).To(BeTrue())
+			Expect(idTokenErr.Message).To(ContainSubstring(message))
+		},
+		Entry("malformed", func(h map[string]string, c map[string]interface{}) string {
+			return "header.payload"
+		}, "malformed JWT"),
+		Entry("signature is invalid", func(h map[string]string, c map[string]interface{}) string {
+			signed := newJWT(h, c, signES256)
+			c["sub"] = "auth0|mallory"
+			tampered := newJWT(h, c, func([]byte) []byte { return nil })
+			return tampered + signed[strings.LastIndex(signed, ".")+1:]
+		}, "signature is invalid"),
+		Entry("alg is none", func(h map[string]string, c map[string]interface{}) string {
+			h["alg"] = "none"
+			return newJWT(h, c, func([]byte) []byte { return nil })
+		}, "alg \"none\" does not match"),
+		Entry("issuer is different", func(h map[string]string, c map[string]interface{}) string {
+			c["iss"] = "https://evil.example.com/"
+			return newJWT(h, c, signES256)
+		}, "iss"),
+		Entry("audience is different", func(h map[string]string, c map[string]interface{}) string {
+			c["aud"] = "other"
+			return newJWT(h, c, signES256)
+		}, "aud"),
+		Entry("azp is missing for multiple audiences", func(h map[string]string, c map[string]interface{}) string {
+			c["aud"] = []string{clientID, "other"}
+			return newJWT(h, c, signES256)
+		}, "azp"),
+		Entry("expired", func(h map[string]string, c map[string]interface{}) string {
+			c["exp"] = now.Add(-time.Hour).Unix()
+			return newJWT(h, c, signES256)
+		}, "expired"),
+		Entry("issued in the future", func(h map[string]string, c map[string]interface{}) string {
+			c["iat"] = now.Add(time.Hour).Unix()
+			return newJWT(h, c, signES256)
+		}, "future"),
+	)
+
+	It("verifies HS256 with the client secret", func() {
+		// Arrange
+		daf := newFlow(auth.WithClientSecret("secret"))
+		signHS256 := func(signingInput []byte) []byte {
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write(signingInput)
+			return mac.Sum(nil)
+		}
+
+		// Act
+		actual, err := daf.ValidateIDToken(newJWT(map[string]string{"alg": "HS256", "typ": "JWT"}, claims, signHS256))
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.Subject).To(Equal("auth0|alice"))
+	})
+
+	It("validates ID tokens issued by mockauth", func() {
+		// Arrange
+		server, _ := mockauth.New([]mockauth.User{{Subject: "auth0|bob"}})
+		ms := httptest.NewServer(server)
+		defer ms.Close()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeSleep(func(time.Duration) {}))
+		token, err := daf.Authorize("openid", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		actual, err := daf.ValidateIDTokenContext(context.Background(), token.IdToken)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.Subject).To(Equal("auth0|bob"))
+	})
+})
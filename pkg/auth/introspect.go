@@ -0,0 +1,133 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// WithIntrospectionEndpoint specifies the URL of the token introspection endpoint of RFC 7662.
+// Auth0 does not serve it itself, so give the one of the authorization server in front of resource servers.
+// By default, /oauth/introspect of the base URL is used.
+type WithIntrospectionEndpoint string
+
+func (url WithIntrospectionEndpoint) apply(daf *DeviceAuthFlow) error {
+	daf.introspectionURL = string(url)
+	return nil
+}
+
+// IntrospectionResponse represents response of the token introspection endpoint.
+// Other fields than Active are optional, and all of them except Active are empty for inactive tokens.
+// In addition, it has Extra which holds fields not modeled here (e.g. custom claims),
+// and RawBody which is the response body as it is when WithRawResponseBody is given.
+//
+// See: https://www.rfc-editor.org/rfc/rfc7662#section-2.2
+type IntrospectionResponse struct {
+	Active    bool                       `json:"active"`
+	Scope     string                     `json:"scope,omitempty"`
+	ClientID  string                     `json:"client_id,omitempty"`
+	Username  string                     `json:"username,omitempty"`
+	TokenType string                     `json:"token_type,omitempty"`
+	Exp       int64                      `json:"exp,omitempty"`
+	Iat       int64                      `json:"iat,omitempty"`
+	Nbf       int64                      `json:"nbf,omitempty"`
+	Sub       string                     `json:"sub,omitempty"`
+	Aud       Audience                   `json:"aud,omitempty"`
+	Iss       string                     `json:"iss,omitempty"`
+	Jti       string                     `json:"jti,omitempty"`
+	Extra     map[string]json.RawMessage `json:"-"`
+	RawBody   []byte                     `json:"-"`
+}
+
+func (r *IntrospectionResponse) UnmarshalJSON(b []byte) error {
+	type plain IntrospectionResponse
+	if err := json.Unmarshal(b, (*plain)(r)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(b, r)
+	r.Extra = extra
+	return err
+}
+
+// Audience is the aud claim, which is a string or an array of strings in JSON.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+
+	var ss []string
+	if err := json.Unmarshal(b, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+// Introspect asks the introspection endpoint whether the token is active and returns its metadata,
+// for resource servers which cannot validate tokens locally (e.g. opaque tokens).
+// The client is authenticated with WithClientSecret or WithClientAssertionSigner as the endpoint requires.
+//
+// Inactive tokens are not errors; check Active of the response.
+// APIError is returned when the server rejects the request (e.g. invalid_client).
+//
+// See: https://www.rfc-editor.org/rfc/rfc7662
+func (daf *DeviceAuthFlow) Introspect(token string) (*IntrospectionResponse, error) {
+	return daf.IntrospectContext(context.Background(), token)
+}
+
+// IntrospectContext is like Introspect, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) IntrospectContext(ctx context.Context, token string) (*IntrospectionResponse, error) {
+	authParams, err := daf.clientAuthParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := fmt.Sprintf("client_id=%s&token=%s", daf.clientID, neturl.QueryEscape(token))
+
+	statusCode, header, resBody, err := daf.postForm(ctx, daf.introspectionEndpoint(), strings.NewReader(params+authParams))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			return nil, daf.apiError("introspection", statusCode, header, resBody)
+		}
+		return nil, &ServerError{Request: "introspection", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	r := new(IntrospectionResponse)
+	if err := daf.decodeResponse(resBody, r); err != nil {
+		return nil, fmt.Errorf("could not decode introspection response body: %w", err)
+	}
+	r.RawBody = daf.rawBody(resBody)
+
+	return r, nil
+}
+
+func (daf *DeviceAuthFlow) introspectionEndpoint() string {
+	if daf.introspectionURL != "" {
+		return daf.introspectionURL
+	}
+	return daf.discoveredOr(daf.endpoints.IntrospectionEndpoint, "/oauth/introspect")
+}
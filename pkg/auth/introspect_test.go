@@ -0,0 +1,108 @@
+package auth_test
+
+import (
+	"errors"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Introspect()", func() {
+	clientID := "clientID"
+	expectedForm := map[string][]string{
+		"client_id":     {clientID},
+		"client_secret": {"secret"},
+		"token":         {"access_token"},
+	}
+
+	It("returns the metadata of the active token", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/oauth/introspect",
+				form:         expectedForm,
+				statusCode:   200,
+				responseBody: `{"active": true, "scope": "read:items", "client_id": "clientID", "exp": 1661908800, "sub": "auth0|alice", "aud": ["https://example.com/api", "https://example.us.auth0.com/userinfo"], "org_id": "org_123"}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithClientSecret("secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		r, err := daf.Introspect("access_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Active).To(BeTrue())
+		Expect(r.Scope).To(Equal("read:items"))
+		Expect(r.Exp).To(Equal(int64(1661908800)))
+		Expect(r.Sub).To(Equal("auth0|alice"))
+		Expect(r.Aud).To(Equal(auth.Audience{"https://example.com/api", "https://example.us.auth0.com/userinfo"}))
+		Expect(string(r.Extra["org_id"])).To(Equal(`"org_123"`))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns inactive tokens without error", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/introspect", form: expectedForm, statusCode: 200, responseBody: `{"active": false}`},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL("https://example.com"),
+			auth.WithClientID(clientID),
+			auth.WithClientSecret("secret"),
+			auth.WithIntrospectionEndpoint(ms.URL+"/introspect"),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		r, err := daf.Introspect("access_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Active).To(BeFalse())
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns APIError when the request is rejected", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/oauth/introspect",
+				form:         expectedForm,
+				statusCode:   401,
+				responseBody: `{"error": "invalid_client", "error_description": "Client authentication failed"}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithClientSecret("secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.Introspect("access_token")
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Body.Error).To(Equal("invalid_client"))
+	})
+
+	It("accepts a single audience as a string", func() {
+		// Arrange
+		var r auth.IntrospectionResponse
+
+		// Act
+		err := r.UnmarshalJSON([]byte(`{"active": true, "aud": "https://example.com/api"}`))
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Aud).To(Equal(auth.Audience{"https://example.com/api"}))
+	})
+})
@@ -0,0 +1,70 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+)
+
+// WithLandingPage customizes the page shown in the browser after the redirect to the loopback server of AuthCodeFlow,
+// e.g. for branded CLIs. For each of success and failure, either HTML to show or a URL to redirect to can be given.
+// Plain text is shown by default.
+type WithLandingPage struct {
+	SuccessHTML string
+	SuccessURL  string
+	FailureHTML string
+	FailureURL  string
+}
+
+func (p WithLandingPage) apply(f *AuthCodeFlow) error {
+	if (p.SuccessHTML != "" && p.SuccessURL != "") || (p.FailureHTML != "" && p.FailureURL != "") {
+		return errors.New("either HTML or URL of the landing page can be given")
+	}
+	for _, url := range []string{p.SuccessURL, p.FailureURL} {
+		if url == "" {
+			continue
+		}
+		if u, err := neturl.Parse(url); err != nil || !u.IsAbs() {
+			return fmt.Errorf("URL of the landing page must be absolute: %s", url)
+		}
+	}
+
+	f.landing = p
+	return nil
+}
+
+func (p *WithLandingPage) write(w http.ResponseWriter, r *http.Request, succeeded bool) {
+	url, html, status, text := p.SuccessURL, p.SuccessHTML, http.StatusOK, "Authorized. You can close this window."
+	if !succeeded {
+		url, html, status, text = p.FailureURL, p.FailureHTML, http.StatusForbidden, "Authorization failed. You can close this window."
+	}
+
+	switch {
+	case url != "":
+		http.Redirect(w, r, url, http.StatusFound)
+	case html != "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		io.WriteString(w, html)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, text)
+	}
+}
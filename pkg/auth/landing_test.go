@@ -0,0 +1,96 @@
+package auth_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithLandingPage", func() {
+	clientID := "clientID"
+
+	// landing follows the redirect with query and returns the landing page shown in the browser
+	landing := func(page auth.WithLandingPage, query func(state string) url.Values) *http.Response {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		var res *http.Response
+		f, err := daf.NewAuthCodeFlow(func(authorizationURL string) error {
+			u, _ := url.Parse(authorizationURL)
+			q := u.Query()
+			res, err = client.Get(q.Get("redirect_uri") + "?" + query(q.Get("state")).Encode())
+			return err
+		}, page)
+		Expect(err).NotTo(HaveOccurred())
+
+		f.Authorize(context.Background(), "openid", "https://example.com/api")
+		return res
+	}
+	succeeded := func(state string) url.Values {
+		return url.Values{"code": {"code"}, "state": {state}}
+	}
+	failed := func(state string) url.Values {
+		return url.Values{"error": {"access_denied"}, "state": {state}}
+	}
+
+	It("shows the HTML on success", func() {
+		// Act
+		res := landing(auth.WithLandingPage{SuccessHTML: "<h1>Welcome</h1>", FailureHTML: "<h1>Sorry</h1>"}, succeeded)
+
+		// Assert
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+		Expect(res.Header.Get("Content-Type")).To(HavePrefix("text/html"))
+		Expect(string(body)).To(Equal("<h1>Welcome</h1>"))
+	})
+
+	It("redirects to the URL on failure", func() {
+		// Act
+		res := landing(auth.WithLandingPage{SuccessHTML: "<h1>Welcome</h1>", FailureURL: "https://example.com/failed"}, failed)
+
+		// Assert
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusFound))
+		Expect(res.Header.Get("Location")).To(Equal("https://example.com/failed"))
+	})
+
+	It("shows plain text by default", func() {
+		// Act
+		res := landing(auth.WithLandingPage{}, failed)
+
+		// Assert
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusForbidden))
+		Expect(res.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+	})
+
+	DescribeTable("rejects invalid pages",
+		func(page auth.WithLandingPage) {
+			// Arrange
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			_, err = daf.NewAuthCodeFlow(func(string) error { return nil }, page)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("both HTML and URL", auth.WithLandingPage{SuccessHTML: "<h1>Welcome</h1>", SuccessURL: "https://example.com/"}),
+		Entry("relative URL", auth.WithLandingPage{FailureURL: "/failed"}),
+	)
+})
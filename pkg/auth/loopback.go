@@ -0,0 +1,108 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strconv"
+)
+
+// WithRedirectURI fixes the redirect URI of AuthCodeFlow, e.g. http://localhost:8080/callback,
+// when the application allows only specific callback URLs. It must be an http URL on a loopback host with a port.
+type WithRedirectURI string
+
+func (uri WithRedirectURI) apply(f *AuthCodeFlow) error {
+	u, err := neturl.Parse(string(uri))
+	if err != nil {
+		return fmt.Errorf("invalid redirect URI: %w", err)
+	}
+	if u.Scheme != "http" || !isLoopbackHost(u.Hostname()) || u.Port() == "" {
+		return fmt.Errorf("redirect URI must be http on a loopback host with a port: %s", uri)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	f.redirectURI = u
+	return nil
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP address.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// WithCallbackPortRange makes the loopback server of AuthCodeFlow listen on the first free port from From to To inclusive,
+// when the application allows callback URLs of specific ports.
+type WithCallbackPortRange struct {
+	From int
+	To   int
+}
+
+func (r WithCallbackPortRange) apply(f *AuthCodeFlow) error {
+	if r.From < 1 || r.To > 65535 || r.From > r.To {
+		return fmt.Errorf("invalid callback port range: %d-%d", r.From, r.To)
+	}
+
+	f.portFrom = r.From
+	f.portTo = r.To
+	return nil
+}
+
+// WithIPv6Loopback makes the loopback server of AuthCodeFlow listen on [::1] instead of 127.0.0.1.
+type WithIPv6Loopback bool
+
+func (ipv6 WithIPv6Loopback) apply(f *AuthCodeFlow) error {
+	f.ipv6 = bool(ipv6)
+	return nil
+}
+
+// listen starts listening for the callback and returns the listener and the redirect URI.
+func (f *AuthCodeFlow) listen() (net.Listener, *neturl.URL, error) {
+	if f.redirectURI != nil {
+		ln, err := net.Listen("tcp", f.redirectURI.Host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not listen for callback: %w", err)
+		}
+		return ln, f.redirectURI, nil
+	}
+
+	host := "127.0.0.1"
+	if f.ipv6 {
+		host = "::1"
+	}
+
+	var lastErr error
+	for port := f.portFrom; port <= f.portTo; port++ {
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return ln, &neturl.URL{Scheme: "http", Host: ln.Addr().String(), Path: callbackPath}, nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no port is available")
+	}
+	return nil, nil, fmt.Errorf("could not listen for callback: %w", lastErr)
+}
@@ -0,0 +1,43 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import "net/http"
+
+// ResponseMetadata describes how a token was issued, e.g. to be recorded by logging or compliance layers.
+type ResponseMetadata struct {
+	// StatusCode is the HTTP status of the response which issued the token.
+	StatusCode int
+	// Header is the HTTP headers of the response, e.g. to record request IDs of the tenant.
+	Header http.Header
+	// Attempt is the 1-based index of the request to token endpoint which issued the token.
+	// It is greater than 1 when the token is issued after polling.
+	Attempt int
+}
+
+// WithResponseMetadata sets ResponseMetadata to Metadata of TokenResponse.
+type WithResponseMetadata bool
+
+func (keepMetadata WithResponseMetadata) apply(daf *DeviceAuthFlow) error {
+	daf.keepMetadata = bool(keepMetadata)
+	return nil
+}
+
+func (daf *DeviceAuthFlow) metadata(statusCode int, header http.Header, attempt int) *ResponseMetadata {
+	if !daf.keepMetadata {
+		return nil
+	}
+	return &ResponseMetadata{StatusCode: statusCode, Header: header.Clone(), Attempt: attempt}
+}
@@ -0,0 +1,71 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithResponseMetadata", func() {
+	clientID := "clientID"
+
+	It("sets the status, the headers and the attempt to the token polled", func() {
+		// Arrange
+		attempts := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.Header().Set("content-type", "application/json")
+			w.Header().Set("x-request-id", "request-id")
+			if attempts == 1 {
+				w.WriteHeader(403)
+				w.Write([]byte(`{"error": "authorization_pending", "error_description": "authorization pending"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithResponseMetadata(true),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 20, Interval: 5, ExpiresAt: baseStubTime.Add(20 * time.Second)}
+
+		// Act
+		token, err := daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.Metadata.StatusCode).To(Equal(200))
+		Expect(token.Metadata.Header.Get("X-Request-Id")).To(Equal("request-id"))
+		Expect(token.Metadata.Attempt).To(Equal(2))
+	})
+
+	It("sets nothing by default", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.Metadata).To(BeNil())
+	})
+})
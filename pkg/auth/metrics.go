@@ -0,0 +1,214 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are upper bounds of durations in seconds of Metrics, which are the default buckets of Prometheus.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics counts requests to the endpoints and their durations, which can be shared among DeviceAuthFlows with WithMetrics.
+//
+// It is exposed in the text format of Prometheus by WriteTo and ServeHTTP, and Requests returns the values.
+// The collector of client_golang is provided by the separate module github.com/autopp/go-a0daf/pkg/prommetrics.
+type Metrics struct {
+	buckets   []float64
+	mu        sync.Mutex
+	endpoints map[string]*endpointMetrics
+}
+
+type endpointMetrics struct {
+	codes       map[int]uint64
+	count       uint64
+	durationSum float64
+	// bucketCounts are not cumulative
+	bucketCounts []uint64
+}
+
+// RequestStats is the statistics of requests to an endpoint.
+type RequestStats struct {
+	// Endpoint is the path of the endpoint like "/oauth/token".
+	Endpoint string
+	// Codes is the number of responses by status code. Requests without responses, e.g. network errors, are counted as 0.
+	Codes map[int]uint64
+	// Count is the number of requests.
+	Count uint64
+	// DurationSum is the sum of durations of requests in seconds.
+	DurationSum float64
+	// DurationBuckets is the cumulative number of requests by upper bounds of durations in seconds, like histograms of Prometheus.
+	DurationBuckets map[float64]uint64
+}
+
+// NewMetrics returns Metrics with buckets of durations in seconds. DefaultDurationBuckets is used if buckets is empty.
+func NewMetrics(buckets ...float64) (*Metrics, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	for i, b := range buckets {
+		if i > 0 && b <= buckets[i-1] {
+			return nil, errors.New("buckets of Metrics must be in increasing order")
+		}
+	}
+
+	return &Metrics{buckets: append([]float64(nil), buckets...), endpoints: make(map[string]*endpointMetrics)}, nil
+}
+
+// WithMetrics records requests to the endpoints in the Metrics, which can be shared among DeviceAuthFlows.
+type WithMetrics struct {
+	Metrics *Metrics
+}
+
+func (o WithMetrics) apply(daf *DeviceAuthFlow) error {
+	if o.Metrics == nil {
+		return errors.New("Metrics of WithMetrics is nil")
+	}
+
+	daf.metrics = o.Metrics
+	return nil
+}
+
+// observe records the request to the endpoint. m can be nil when WithMetrics is not given.
+func (m *Metrics) observe(endpoint string, statusCode int, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.endpoints[endpoint]
+	if !ok {
+		e = &endpointMetrics{codes: make(map[int]uint64), bucketCounts: make([]uint64, len(m.buckets))}
+		m.endpoints[endpoint] = e
+	}
+
+	seconds := d.Seconds()
+	e.codes[statusCode]++
+	e.count++
+	e.durationSum += seconds
+	for i, b := range m.buckets {
+		if seconds <= b {
+			e.bucketCounts[i]++
+			break
+		}
+	}
+}
+
+// Requests returns RequestStats of each endpoint in order of Endpoint.
+func (m *Metrics) Requests() []RequestStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]RequestStats, 0, len(m.endpoints))
+	for endpoint, e := range m.endpoints {
+		s := RequestStats{Endpoint: endpoint, Codes: make(map[int]uint64), Count: e.count, DurationSum: e.durationSum, DurationBuckets: make(map[float64]uint64)}
+		for code, n := range e.codes {
+			s.Codes[code] = n
+		}
+		cumulative := uint64(0)
+		for i, b := range m.buckets {
+			cumulative += e.bucketCounts[i]
+			s.DurationBuckets[b] = cumulative
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Endpoint < stats[j].Endpoint })
+
+	return stats
+}
+
+// WriteTo writes the metrics in the text format of Prometheus, i.e. a0daf_requests_total counter by endpoint and code
+// ("error" for requests without responses) and a0daf_request_duration_seconds histogram by endpoint.
+//
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	stats := m.Requests()
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+
+	fmt.Fprintln(cw, "# HELP a0daf_requests_total Requests to the endpoints by status code.")
+	fmt.Fprintln(cw, "# TYPE a0daf_requests_total counter")
+	for _, s := range stats {
+		codes := make([]int, 0, len(s.Codes))
+		for code := range s.Codes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			label := "error"
+			if code != 0 {
+				label = strconv.Itoa(code)
+			}
+			fmt.Fprintf(cw, "a0daf_requests_total{endpoint=\"%s\",code=\"%s\"} %d\n", escapeLabel(s.Endpoint), label, s.Codes[code])
+		}
+	}
+
+	fmt.Fprintln(cw, "# HELP a0daf_request_duration_seconds Durations of requests to the endpoints.")
+	fmt.Fprintln(cw, "# TYPE a0daf_request_duration_seconds histogram")
+	for _, s := range stats {
+		endpoint := escapeLabel(s.Endpoint)
+		for _, b := range m.buckets {
+			fmt.Fprintf(cw, "a0daf_request_duration_seconds_bucket{endpoint=\"%s\",le=\"%s\"} %d\n", endpoint, strconv.FormatFloat(b, 'g', -1, 64), s.DurationBuckets[b])
+		}
+		fmt.Fprintf(cw, "a0daf_request_duration_seconds_bucket{endpoint=\"%s\",le=\"+Inf\"} %d\n", endpoint, s.Count)
+		fmt.Fprintf(cw, "a0daf_request_duration_seconds_sum{endpoint=\"%s\"} %s\n", endpoint, strconv.FormatFloat(s.DurationSum, 'g', -1, 64))
+		fmt.Fprintf(cw, "a0daf_request_duration_seconds_count{endpoint=\"%s\"} %d\n", endpoint, s.Count)
+	}
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// ServeHTTP responds the metrics in the text format of Prometheus, so that Metrics can be mounted on /metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// countingWriter counts written bytes and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,109 @@
+package auth_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	clientID := "clientID"
+	tokenForm := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+
+	It("counts requests to the endpoints by status code", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "authorization_pending", "error_description": "pending"}`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 200, responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`},
+		})
+		defer ms.Close()
+
+		metrics, err := auth.NewMetrics(60)
+		Expect(err).NotTo(HaveOccurred())
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithMetrics{Metrics: metrics},
+		)
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 60, Interval: 5, ExpiresAt: baseStubTime.Add(60 * time.Second)}
+
+		// Act
+		_, err = daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		requests := metrics.Requests()
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Endpoint).To(Equal("/oauth/token"))
+		Expect(requests[0].Codes).To(Equal(map[int]uint64{200: 1, 400: 1}))
+		Expect(requests[0].Count).To(Equal(uint64(2)))
+		Expect(requests[0].DurationBuckets).To(Equal(map[float64]uint64{60: 2}))
+	})
+
+	It("writes the metrics in the text format of Prometheus", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/revoke", form: map[string][]string{"client_id": {clientID}, "token": {"refresh_token"}}, statusCode: 200},
+		})
+		defer ms.Close()
+
+		metrics, _ := auth.NewMetrics(1, 60)
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithMetrics{Metrics: metrics})
+		Expect(daf.Revoke("refresh_token")).To(Succeed())
+		w := httptest.NewRecorder()
+
+		// Act
+		metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+		// Assert
+		Expect(w.Header().Get("content-type")).To(HavePrefix("text/plain; version=0.0.4"))
+		body := w.Body.String()
+		Expect(body).To(ContainSubstring("# TYPE a0daf_requests_total counter\n"))
+		Expect(body).To(ContainSubstring("a0daf_requests_total{endpoint=\"/oauth/revoke\",code=\"200\"} 1\n"))
+		Expect(body).To(ContainSubstring("# TYPE a0daf_request_duration_seconds histogram\n"))
+		Expect(body).To(ContainSubstring("a0daf_request_duration_seconds_bucket{endpoint=\"/oauth/revoke\",le=\"60\"} 1\n"))
+		Expect(body).To(ContainSubstring("a0daf_request_duration_seconds_bucket{endpoint=\"/oauth/revoke\",le=\"+Inf\"} 1\n"))
+		Expect(body).To(ContainSubstring("a0daf_request_duration_seconds_count{endpoint=\"/oauth/revoke\"} 1\n"))
+	})
+
+	It("writes only headers without requests", func() {
+		// Arrange
+		metrics, _ := auth.NewMetrics()
+		buf := new(bytes.Buffer)
+
+		// Act
+		n, err := metrics.WriteTo(buf)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(buf.Len())))
+		Expect(buf.String()).NotTo(ContainSubstring("a0daf_requests_total{"))
+	})
+
+	It("rejects buckets not in increasing order", func() {
+		// Act
+		_, err := auth.NewMetrics(1, 1)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects nil Metrics", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), auth.WithMetrics{})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,128 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// Grant types of Auth0 to complete the MFA step with the mfa_token.
+const (
+	mfaOTPGrantType = "http://auth0.com/oauth/grant-type/mfa-otp"
+	mfaOOBGrantType = "http://auth0.com/oauth/grant-type/mfa-oob"
+)
+
+// MFARequired reports whether err or an error wrapped by it is APIError of mfa_required,
+// and returns the mfa_token to complete the MFA step with MFAChallenge, MFAOTPGrant or MFAOOBGrant.
+func MFARequired(err error) (string, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Body == nil || apiErr.Body.Error != "mfa_required" {
+		return "", false
+	}
+	return apiErr.Body.MFAToken, true
+}
+
+// MFAChallengeResponse represents response of the MFA challenge endpoint.
+//
+// See: https://auth0.com/docs/api/authentication#challenge-request
+type MFAChallengeResponse struct {
+	// ChallengeType is "otp" or "oob".
+	ChallengeType string `json:"challenge_type"`
+	// OOBCode is given for "oob" challenges to be passed to MFAOOBGrant.
+	OOBCode string `json:"oob_code,omitempty"`
+	// BindingMethod is "prompt" when the user has to enter the code sent to the authenticator as the binding code.
+	BindingMethod string `json:"binding_method,omitempty"`
+}
+
+// MFAChallenge requests a challenge for the MFA step.
+//
+// challengeTypes is space separated types like "otp oob", and authenticatorID is optional.
+func (daf *DeviceAuthFlow) MFAChallenge(mfaToken string, challengeTypes string, authenticatorID string) (*MFAChallengeResponse, error) {
+	return daf.MFAChallengeContext(context.Background(), mfaToken, challengeTypes, authenticatorID)
+}
+
+// MFAChallengeContext is like MFAChallenge, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) MFAChallengeContext(ctx context.Context, mfaToken string, challengeTypes string, authenticatorID string) (*MFAChallengeResponse, error) {
+	authParams, err := daf.clientAuthParams(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := fmt.Sprintf("client_id=%s&mfa_token=%s&challenge_type=%s", daf.clientID, neturl.QueryEscape(mfaToken), neturl.QueryEscape(challengeTypes))
+	if authenticatorID != "" {
+		params += "&authenticator_id=" + neturl.QueryEscape(authenticatorID)
+	}
+
+	statusCode, header, resBody, err := daf.postForm(ctx, daf.endpoint("/mfa/challenge"), strings.NewReader(params+authParams))
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			return nil, daf.apiError("MFA challenge", statusCode, header, resBody)
+		}
+		return nil, &ServerError{Request: "MFA challenge", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	challenge := new(MFAChallengeResponse)
+	if err := daf.decodeResponse(resBody, challenge); err != nil {
+		return nil, fmt.Errorf("could not decode MFA challenge response body: %w", err)
+	}
+
+	return challenge, nil
+}
+
+// MFAOTPGrant completes the MFA step with the one-time password of the authenticator app.
+//
+// See: https://auth0.com/docs/api/authentication#verify-with-one-time-password-otp-
+func (daf *DeviceAuthFlow) MFAOTPGrant(mfaToken string, otp string) (*TokenResponse, error) {
+	return daf.MFAOTPGrantContext(context.Background(), mfaToken, otp)
+}
+
+// MFAOTPGrantContext is like MFAOTPGrant, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) MFAOTPGrantContext(ctx context.Context, mfaToken string, otp string) (*TokenResponse, error) {
+	return daf.exchangeToken(ctx, fmt.Sprintf(
+		"grant_type=%s&client_id=%s&mfa_token=%s&otp=%s",
+		neturl.QueryEscape(mfaOTPGrantType), daf.clientID, neturl.QueryEscape(mfaToken), neturl.QueryEscape(otp),
+	))
+}
+
+// MFAOOBGrant completes the MFA step with the oob_code of MFAChallengeResponse.
+// bindingCode is required when BindingMethod is "prompt", and empty otherwise.
+//
+// While the user has not approved a push notification, APIError of authorization_pending is returned,
+// so call it again after a while.
+//
+// See: https://auth0.com/docs/api/authentication#verify-with-out-of-band-oob-
+func (daf *DeviceAuthFlow) MFAOOBGrant(mfaToken string, oobCode string, bindingCode string) (*TokenResponse, error) {
+	return daf.MFAOOBGrantContext(context.Background(), mfaToken, oobCode, bindingCode)
+}
+
+// MFAOOBGrantContext is like MFAOOBGrant, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) MFAOOBGrantContext(ctx context.Context, mfaToken string, oobCode string, bindingCode string) (*TokenResponse, error) {
+	params := fmt.Sprintf(
+		"grant_type=%s&client_id=%s&mfa_token=%s&oob_code=%s",
+		neturl.QueryEscape(mfaOOBGrantType), daf.clientID, neturl.QueryEscape(mfaToken), neturl.QueryEscape(oobCode),
+	)
+	if bindingCode != "" {
+		params += "&binding_code=" + neturl.QueryEscape(bindingCode)
+	}
+
+	return daf.exchangeToken(ctx, params)
+}
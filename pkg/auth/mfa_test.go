@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"errors"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MFA", func() {
+	clientID := "clientID"
+	tokenResponseBody := `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`
+
+	It("MFARequired() returns mfa_token of mfa_required error", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type": {"password"},
+					"client_id":  {clientID},
+					"username":   {"user@example.com"},
+					"password":   {"password"},
+					"scope":      {"openid"},
+					"audience":   {"https://example.com/api"},
+				},
+				statusCode:   403,
+				responseBody: `{"error": "mfa_required", "error_description": "Multifactor authentication required", "mfa_token": "mfa_token"}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PasswordGrant("user@example.com", "password", "openid", "https://example.com/api")
+		mfaToken, ok := auth.MFARequired(err)
+
+		// Assert
+		Expect(ok).To(BeTrue())
+		Expect(mfaToken).To(Equal("mfa_token"))
+	})
+
+	DescribeTable("MFARequired() reports false for other errors",
+		func(err error) {
+			// Act
+			_, ok := auth.MFARequired(err)
+
+			// Assert
+			Expect(ok).To(BeFalse())
+		},
+		Entry("invalid_grant", &auth.APIError{StatusCode: 403, Body: &auth.ErrorResponse{Error: "invalid_grant"}}),
+		Entry("other", errors.New("error")),
+	)
+
+	It("MFAChallenge() returns the challenge", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/mfa/challenge",
+				form: map[string][]string{
+					"client_id":        {clientID},
+					"mfa_token":        {"mfa_token"},
+					"challenge_type":   {"otp oob"},
+					"authenticator_id": {"sms|dev_123"},
+				},
+				statusCode:   200,
+				responseBody: `{"challenge_type": "oob", "oob_code": "oob_code", "binding_method": "prompt"}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		challenge, err := daf.MFAChallenge("mfa_token", "otp oob", "sms|dev_123")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(challenge).To(Equal(&auth.MFAChallengeResponse{ChallengeType: "oob", OOBCode: "oob_code", BindingMethod: "prompt"}))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("MFAOTPGrant() exchanges the one-time password for token", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type": {"http://auth0.com/oauth/grant-type/mfa-otp"},
+					"client_id":  {clientID},
+					"mfa_token":  {"mfa_token"},
+					"otp":        {"123456"},
+				},
+				statusCode:   200,
+				responseBody: tokenResponseBody,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.MFAOTPGrant("mfa_token", "123456")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("MFAOOBGrant() exchanges the oob code and the binding code for token", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":   {"http://auth0.com/oauth/grant-type/mfa-oob"},
+					"client_id":    {clientID},
+					"mfa_token":    {"mfa_token"},
+					"oob_code":     {"oob_code"},
+					"binding_code": {"000000"},
+				},
+				statusCode:   200,
+				responseBody: tokenResponseBody,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.MFAOOBGrant("mfa_token", "oob_code", "000000")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+})
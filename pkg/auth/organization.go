@@ -0,0 +1,108 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/jwt"
+)
+
+// WithOrganization specifies the organization (ID or name) to log in to.
+//
+// It is sent as organization parameter of the device code request,
+// and org_id (or org_name for names) claim of the returned ID token is validated.
+//
+// See: https://auth0.com/docs/manage-users/organizations/using-tokens
+type WithOrganization string
+
+func (org WithOrganization) apply(daf *DeviceAuthFlow) error {
+	daf.organization = string(org)
+	return nil
+}
+
+// OrganizationError is returned when the ID token is not issued for the organization given by WithOrganization.
+type OrganizationError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *OrganizationError) Error() string {
+	return fmt.Sprintf("ID token was issued for organization %q, expected %q", e.Actual, e.Expected)
+}
+
+// validateOrganization validates the claim of the organization in the ID token.
+func validateOrganization(organization string, t *TokenResponse) error {
+	if organization == "" || t.IdToken == "" {
+		return nil
+	}
+
+	idToken, err := jwt.Decode(t.IdToken)
+	if err != nil {
+		return fmt.Errorf("could not decode ID token: %w", err)
+	}
+
+	// organization names are case-insensitive and org_name claim is in lower case
+	claim, expected := "org_id", organization
+	if !strings.HasPrefix(organization, "org_") {
+		claim, expected = "org_name", strings.ToLower(organization)
+	}
+
+	actual, _ := idToken.Claims[claim].(string)
+	if actual != expected {
+		return &OrganizationError{Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
+
+// ParseInvitationURL returns the organization and the invitation ticket ID in the invitation link sent to the user,
+// like https://example.com/login?invitation=INVITATION&organization=ORGANIZATION&organization_name=NAME.
+//
+// See: https://auth0.com/docs/manage-users/organizations/configure-organizations/invite-members
+func ParseInvitationURL(rawURL string) (organization string, invitation string, err error) {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("could not parse invitation URL: %w", err)
+	}
+
+	q := u.Query()
+	organization, invitation = q.Get("organization"), q.Get("invitation")
+	if organization == "" || invitation == "" {
+		return "", "", errors.New("invitation URL must have organization and invitation parameters")
+	}
+
+	return organization, invitation, nil
+}
+
+// IsOrganizationError reports whether err or an error wrapped by it is related to the organization or the invitation,
+// i.e. OrganizationError or APIError whose description mentions them
+// (e.g. the user is not a member of the organization, or the invitation is expired or already accepted).
+func IsOrganizationError(err error) bool {
+	var orgErr *OrganizationError
+	if errors.As(err, &orgErr) {
+		return true
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Body == nil {
+		return false
+	}
+	description := strings.ToLower(apiErr.Body.ErrorDescription)
+	return strings.Contains(description, "organization") || strings.Contains(description, "invitation")
+}
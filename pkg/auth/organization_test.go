@@ -0,0 +1,159 @@
+package auth_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithOrganization", func() {
+	clientID := "clientID"
+	orgID := "org_W30ZADBhmPqnZ4Qp"
+
+	newIDToken := func(claims string) string {
+		return "eyJhbGciOiJSUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+	}
+
+	It("sends organization parameter on device code request", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/device/code",
+				form: map[string][]string{
+					"client_id":    {clientID},
+					"scope":        {"openid"},
+					"audience":     {"https://example.com/api"},
+					"organization": {orgID},
+				},
+				statusCode:   200,
+				responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithOrganization(orgID))
+
+		// Act
+		_, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	DescribeTable("validates organization claim of ID token",
+		func(org string, claims string, expectedErr error) {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path: "/oauth/token",
+					form: map[string][]string{
+						"grant_type":    {"refresh_token"},
+						"client_id":     {clientID},
+						"refresh_token": {"refresh_token"},
+					},
+					statusCode:   200,
+					responseBody: fmt.Sprintf(`{"access_token": "access_token", "id_token": "%s", "token_type": "Bearer", "expires_in": 86400}`, newIDToken(claims)),
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(
+				auth.WithBaseURL(ms.URL),
+				auth.WithClientID(clientID),
+				auth.WithOrganization(org),
+				auth.WithTimeNow(func() time.Time { return baseStubTime }),
+			)
+
+			// Act
+			_, err := daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			if expectedErr == nil {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(MatchError(expectedErr))
+			}
+		},
+		Entry("with matched org_id", orgID, `{"org_id": "org_W30ZADBhmPqnZ4Qp"}`, nil),
+		Entry("with matched org_name", "Acme", `{"org_name": "acme"}`, nil),
+		Entry("with unmatched org_id", orgID, `{"org_id": "org_other"}`, &auth.OrganizationError{Expected: orgID, Actual: "org_other"}),
+		Entry("without org_id", orgID, `{}`, &auth.OrganizationError{Expected: orgID, Actual: ""}),
+	)
+})
+
+var _ = Describe("Invitation", func() {
+	clientID := "clientID"
+	orgID := "org_W30ZADBhmPqnZ4Qp"
+
+	It("sends invitation parameter with organization on device code request", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/device/code",
+				form: map[string][]string{
+					"client_id":    {clientID},
+					"scope":        {"openid"},
+					"audience":     {"https://example.com/api"},
+					"organization": {orgID},
+					"invitation":   {"inv_123"},
+				},
+				statusCode:   200,
+				responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+
+		// Act
+		_, err := daf.RequestDeviceCode(&auth.DeviceCodeRequest{Scope: "openid", Audience: "https://example.com/api", Organization: orgID, Invitation: "inv_123"})
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("requires organization with invitation", func() {
+		// Arrange
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+
+		// Act
+		_, err := daf.RequestDeviceCode(&auth.DeviceCodeRequest{Invitation: "inv_123"})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("ParseInvitationURL",
+		func(rawURL string, expectedOrg string, expectedInvitation string, expectedOK bool) {
+			// Act
+			org, invitation, err := auth.ParseInvitationURL(rawURL)
+
+			// Assert
+			Expect(err == nil).To(Equal(expectedOK))
+			Expect(org).To(Equal(expectedOrg))
+			Expect(invitation).To(Equal(expectedInvitation))
+		},
+		Entry("with both parameters", "https://example.com/login?invitation=inv_123&organization=org_W30ZADBhmPqnZ4Qp&organization_name=acme", orgID, "inv_123", true),
+		Entry("without invitation", "https://example.com/login?organization=org_W30ZADBhmPqnZ4Qp", "", "", false),
+		Entry("malformed URL", "https://example.com/%zz", "", "", false),
+	)
+
+	DescribeTable("IsOrganizationError",
+		func(err error, expected bool) {
+			// Act & Assert
+			Expect(auth.IsOrganizationError(err)).To(Equal(expected))
+		},
+		Entry("OrganizationError", fmt.Errorf("wrapped: %w", &auth.OrganizationError{Expected: orgID}), true),
+		Entry("invalid invitation", &auth.APIError{StatusCode: 400, Body: &auth.ErrorResponse{Error: "invalid_request", ErrorDescription: "Invitation not found or already used"}}, true),
+		Entry("not a member", &auth.APIError{StatusCode: 403, Body: &auth.ErrorResponse{Error: "access_denied", ErrorDescription: "user is not a member of the organization"}}, true),
+		Entry("other APIError", &auth.APIError{StatusCode: 400, Body: &auth.ErrorResponse{Error: "invalid_grant", ErrorDescription: "Invalid refresh token"}}, false),
+		Entry("nil", nil, false),
+	)
+})
@@ -0,0 +1,72 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	neturl "net/url"
+)
+
+// PasswordGrant requests token endpoint with the resource owner password grant, for test tenants and legacy integrations.
+// The grant must be enabled for the application.
+//
+// Empty scope and audience fall back to WithDefaultScope and WithDefaultAudience.
+//
+// See: https://auth0.com/docs/api/authentication#resource-owner-password
+func (daf *DeviceAuthFlow) PasswordGrant(username string, password string, scope string, audience string) (*TokenResponse, error) {
+	return daf.PasswordGrantContext(context.Background(), username, password, scope, audience)
+}
+
+// PasswordGrantContext is like PasswordGrant, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) PasswordGrantContext(ctx context.Context, username string, password string, scope string, audience string) (*TokenResponse, error) {
+	return daf.exchangeToken(ctx, "grant_type=password&"+daf.passwordParams(username, password, scope, audience))
+}
+
+// passwordRealmGrantType is the extension grant of Auth0 to specify the realm (database connection) of the user.
+const passwordRealmGrantType = "http://auth0.com/oauth/grant-type/password-realm"
+
+// PasswordRealmGrant is like PasswordGrant, but authenticates the user against realm,
+// which is the name of a database connection, for tenants with multiple database connections.
+//
+// See: https://auth0.com/docs/get-started/authentication-and-authorization-flow/resource-owner-password-flow#realm-support
+func (daf *DeviceAuthFlow) PasswordRealmGrant(realm string, username string, password string, scope string, audience string) (*TokenResponse, error) {
+	return daf.PasswordRealmGrantContext(context.Background(), realm, username, password, scope, audience)
+}
+
+// PasswordRealmGrantContext is like PasswordRealmGrant, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) PasswordRealmGrantContext(ctx context.Context, realm string, username string, password string, scope string, audience string) (*TokenResponse, error) {
+	if realm == "" {
+		return nil, errors.New("realm is required for the password realm grant")
+	}
+
+	params := fmt.Sprintf("grant_type=%s&realm=%s&", neturl.QueryEscape(passwordRealmGrantType), neturl.QueryEscape(realm))
+	return daf.exchangeToken(ctx, params+daf.passwordParams(username, password, scope, audience))
+}
+
+func (daf *DeviceAuthFlow) passwordParams(username string, password string, scope string, audience string) string {
+	if scope == "" {
+		scope = daf.defaultScope
+	}
+	if audience == "" {
+		audience = daf.defaultAudience
+	}
+
+	return fmt.Sprintf(
+		"client_id=%s&username=%s&password=%s&scope=%s&audience=%s",
+		daf.clientID, neturl.QueryEscape(username), neturl.QueryEscape(password), neturl.QueryEscape(scope), neturl.QueryEscape(audience),
+	)
+}
@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"errors"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PasswordGrant()", func() {
+	clientID := "clientID"
+	expectedForm := map[string][]string{
+		"grant_type": {"password"},
+		"client_id":  {clientID},
+		"username":   {"user@example.com"},
+		"password":   {"p@ss word"},
+		"scope":      {"openid profile"},
+		"audience":   {"https://example.com/api"},
+	}
+
+	It("returns token for the username and the password", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/oauth/token",
+				form:         expectedForm,
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithDefaultScope("openid profile"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.PasswordGrant("user@example.com", "p@ss word", "", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns APIError when the credentials are wrong", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/oauth/token",
+				form:         expectedForm,
+				statusCode:   403,
+				responseBody: `{"error": "invalid_grant", "error_description": "Wrong email or password."}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PasswordGrant("user@example.com", "p@ss word", "openid profile", "https://example.com/api")
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(403))
+		Expect(apiErr.Body.Error).To(Equal("invalid_grant"))
+	})
+})
+
+var _ = Describe("PasswordRealmGrant()", func() {
+	clientID := "clientID"
+
+	It("returns token for the user in the realm", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type": {"http://auth0.com/oauth/grant-type/password-realm"},
+					"realm":      {"Username-Password-Authentication"},
+					"client_id":  {clientID},
+					"username":   {"user@example.com"},
+					"password":   {"password"},
+					"scope":      {"openid"},
+					"audience":   {"https://example.com/api"},
+				},
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.PasswordRealmGrant("Username-Password-Authentication", "user@example.com", "password", "openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns error without realm", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PasswordRealmGrant("", "user@example.com", "password", "openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
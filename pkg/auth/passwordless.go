@@ -0,0 +1,106 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// Connections of passwordless login, which are also the realms of the OTP grant.
+const (
+	PasswordlessEmail = "email"
+	PasswordlessSMS   = "sms"
+)
+
+// passwordlessOTPGrantType is the extension grant of Auth0 to exchange the one-time code for a token.
+const passwordlessOTPGrantType = "http://auth0.com/oauth/grant-type/passwordless/otp"
+
+// StartPasswordless sends a one-time code to recipient, which is an email address for PasswordlessEmail
+// or a phone number for PasswordlessSMS. Exchange the code with PasswordlessOTPGrant.
+//
+// See: https://auth0.com/docs/api/authentication#get-code-or-link
+func (daf *DeviceAuthFlow) StartPasswordless(connection string, recipient string) error {
+	return daf.StartPasswordlessContext(context.Background(), connection, recipient)
+}
+
+// StartPasswordlessContext is like StartPasswordless, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) StartPasswordlessContext(ctx context.Context, connection string, recipient string) error {
+	recipientParam, err := passwordlessRecipientParam(connection)
+	if err != nil {
+		return err
+	}
+
+	authParams, err := daf.clientAuthParams(ctx)
+	if err != nil {
+		return err
+	}
+	params := fmt.Sprintf("client_id=%s&connection=%s&%s=%s&send=code", daf.clientID, connection, recipientParam, neturl.QueryEscape(recipient))
+
+	statusCode, header, resBody, err := daf.postForm(ctx, daf.endpoint("/passwordless/start"), strings.NewReader(params+authParams))
+	if err != nil {
+		return err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			return daf.apiError("passwordless start", statusCode, header, resBody)
+		}
+		return &ServerError{Request: "passwordless start", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	return nil
+}
+
+// PasswordlessOTPGrant exchanges the one-time code sent by StartPasswordless for a token.
+//
+// Empty scope and audience fall back to WithDefaultScope and WithDefaultAudience.
+//
+// See: https://auth0.com/docs/api/authentication#authenticate-user
+func (daf *DeviceAuthFlow) PasswordlessOTPGrant(connection string, recipient string, otp string, scope string, audience string) (*TokenResponse, error) {
+	return daf.PasswordlessOTPGrantContext(context.Background(), connection, recipient, otp, scope, audience)
+}
+
+// PasswordlessOTPGrantContext is like PasswordlessOTPGrant, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) PasswordlessOTPGrantContext(ctx context.Context, connection string, recipient string, otp string, scope string, audience string) (*TokenResponse, error) {
+	if _, err := passwordlessRecipientParam(connection); err != nil {
+		return nil, err
+	}
+	if scope == "" {
+		scope = daf.defaultScope
+	}
+	if audience == "" {
+		audience = daf.defaultAudience
+	}
+
+	return daf.exchangeToken(ctx, fmt.Sprintf(
+		"grant_type=%s&client_id=%s&realm=%s&username=%s&otp=%s&scope=%s&audience=%s",
+		neturl.QueryEscape(passwordlessOTPGrantType), daf.clientID, connection, neturl.QueryEscape(recipient), neturl.QueryEscape(otp), neturl.QueryEscape(scope), neturl.QueryEscape(audience),
+	))
+}
+
+// passwordlessRecipientParam returns the name of the parameter of the recipient for connection.
+func passwordlessRecipientParam(connection string) (string, error) {
+	switch connection {
+	case PasswordlessEmail:
+		return "email", nil
+	case PasswordlessSMS:
+		return "phone_number", nil
+	default:
+		return "", fmt.Errorf("unknown passwordless connection: %s", connection)
+	}
+}
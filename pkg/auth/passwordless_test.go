@@ -0,0 +1,123 @@
+package auth_test
+
+import (
+	"errors"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Passwordless", func() {
+	clientID := "clientID"
+
+	Describe("StartPasswordless()", func() {
+		DescribeTable("sends the code to the recipient",
+			func(connection, recipientParam, recipient string) {
+				// Arrange
+				ms := newMockServer([]requestExpectation{
+					{
+						path: "/passwordless/start",
+						form: map[string][]string{
+							"client_id":    {clientID},
+							"connection":   {connection},
+							recipientParam: {recipient},
+							"send":         {"code"},
+						},
+						statusCode:   200,
+						responseBody: `{"_id": "id"}`,
+					},
+				})
+				defer ms.Close()
+
+				daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+				Expect(err).NotTo(HaveOccurred())
+
+				// Act
+				err = daf.StartPasswordless(connection, recipient)
+
+				// Assert
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ms.restExpects()).To(BeEmpty())
+			},
+			Entry("email", auth.PasswordlessEmail, "email", "user@example.com"),
+			Entry("sms", auth.PasswordlessSMS, "phone_number", "+81 90-0000-0000"),
+		)
+
+		It("returns APIError when the request is rejected", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path: "/passwordless/start",
+					form: map[string][]string{
+						"client_id":  {clientID},
+						"connection": {"email"},
+						"email":      {"user@example.com"},
+						"send":       {"code"},
+					},
+					statusCode:   400,
+					responseBody: `{"error": "bad.connection", "error_description": "Connection does not exist"}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			err = daf.StartPasswordless(auth.PasswordlessEmail, "user@example.com")
+
+			// Assert
+			var apiErr *auth.APIError
+			Expect(errors.As(err, &apiErr)).To(BeTrue())
+			Expect(apiErr.Body.Error).To(Equal("bad.connection"))
+		})
+
+		It("returns error for unknown connections", func() {
+			// Arrange
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			err = daf.StartPasswordless("fax", "0000")
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("PasswordlessOTPGrant()", func() {
+		It("exchanges the code for token", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path: "/oauth/token",
+					form: map[string][]string{
+						"grant_type": {"http://auth0.com/oauth/grant-type/passwordless/otp"},
+						"client_id":  {clientID},
+						"realm":      {"email"},
+						"username":   {"user@example.com"},
+						"otp":        {"123456"},
+						"scope":      {"openid"},
+						"audience":   {"https://example.com/api"},
+					},
+					statusCode:   200,
+					responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			token, err := daf.PasswordlessOTPGrant(auth.PasswordlessEmail, "user@example.com", "123456", "openid", "https://example.com/api")
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(token.AccessToken).To(Equal("access_token"))
+			Expect(ms.restExpects()).To(BeEmpty())
+		})
+	})
+})
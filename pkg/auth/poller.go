@@ -0,0 +1,156 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPollerStopped is returned by Poll when the Poller is stopped.
+var ErrPollerStopped = errors.New("poller was stopped")
+
+// Poller polls token endpoint like PollToken, and can be paused, resumed and stopped while polling,
+// e.g. to suspend polling while an interactive UI shows a modal.
+//
+// The expiry of the device code is not extended while paused.
+type Poller struct {
+	daf      *DeviceAuthFlow
+	dc       *DeviceCodeResponse
+	stats    PollStats
+	mu       sync.Mutex
+	paused   bool
+	resume   chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewPoller returns a Poller of the device code.
+func (daf *DeviceAuthFlow) NewPoller(dc *DeviceCodeResponse) *Poller {
+	return &Poller{daf: daf, dc: dc, stop: make(chan struct{})}
+}
+
+// Poll polls token endpoint until the token is issued, an error occurs, ctx is done or the Poller is stopped.
+// While paused, no request is sent.
+func (p *Poller) Poll(ctx context.Context) (*TokenResponse, error) {
+	if err := p.waitResumed(ctx); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	defer func() { p.stats.WallTime += time.Since(start) }()
+
+	// Stop cancels the in-flight request and the sleep via pollCtx
+	pollCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stop:
+			cancel()
+		case <-pollCtx.Done():
+		}
+	}()
+
+	token, err := p.daf.pollTokenWith(pollCtx, &TokenRequest{DeviceCode: p.dc}, &p.stats, func(d time.Duration) error {
+		if err := p.daf.timeSleep(pollCtx, d); err != nil {
+			return err
+		}
+		return p.waitResumed(pollCtx)
+	})
+	if err != nil && p.stopped() {
+		return nil, ErrPollerStopped
+	}
+	return token, err
+}
+
+// Stats returns statistics of polling. It should be called after Poll returns.
+func (p *Poller) Stats() PollStats {
+	return p.stats
+}
+
+// Pause suspends polling after the current request.
+func (p *Poller) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		p.paused = true
+		p.resume = make(chan struct{})
+	}
+}
+
+// Resume continues paused polling.
+func (p *Poller) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		p.paused = false
+		close(p.resume)
+	}
+}
+
+// Paused reports whether the Poller is paused.
+func (p *Poller) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused
+}
+
+// Stop cancels the in-flight request and makes Poll return ErrPollerStopped. Stopped Poller cannot be resumed.
+func (p *Poller) Stop() {
+	p.stopOnce.Do(func() { close(p.stop) })
+}
+
+// stopped reports whether Stop is called.
+func (p *Poller) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitResumed blocks while the Poller is paused.
+func (p *Poller) waitResumed(ctx context.Context) error {
+	for {
+		select {
+		case <-p.stop:
+			return ErrPollerStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		p.mu.Lock()
+		paused, resume := p.paused, p.resume
+		p.mu.Unlock()
+		if !paused {
+			return nil
+		}
+
+		select {
+		case <-resume:
+		case <-p.stop:
+			return ErrPollerStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
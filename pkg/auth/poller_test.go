@@ -0,0 +1,166 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Poller", func() {
+	clientID := "clientID"
+	interval := 5
+
+	dc := &auth.DeviceCodeResponse{
+		DeviceCode: "device_code",
+		ExpiresIn:  20,
+		Interval:   interval,
+		ExpiresAt:  baseStubTime.Add(20 * time.Second),
+	}
+
+	form := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+	authorizationPending := requestExpectation{
+		path:         "/oauth/token",
+		form:         form,
+		statusCode:   401,
+		responseBody: `{"error": "authorization_pending", "error_description": "authorization pending"}`,
+	}
+	issued := requestExpectation{
+		path:         "/oauth/token",
+		form:         form,
+		statusCode:   200,
+		responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+	}
+
+	type result struct {
+		token *auth.TokenResponse
+		err   error
+	}
+
+	newPoller := func(ms *mockServer) *auth.Poller {
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(interval)),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		return daf.NewPoller(dc)
+	}
+
+	poll := func(ctx context.Context, p *auth.Poller) <-chan result {
+		ch := make(chan result, 1)
+		go func() {
+			token, err := p.Poll(ctx)
+			ch <- result{token: token, err: err}
+		}()
+		return ch
+	}
+
+	It("polls until the token is issued", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{authorizationPending, issued})
+		defer ms.Close()
+		p := newPoller(ms)
+
+		// Act
+		token, err := p.Poll(context.Background())
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(p.Stats().Attempts).To(Equal(2))
+		Expect(p.Stats().Pending).To(Equal(1))
+	})
+
+	It("does not poll while paused and continues after Resume", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{issued})
+		defer ms.Close()
+		p := newPoller(ms)
+		p.Pause()
+
+		// Act
+		ch := poll(context.Background(), p)
+
+		// Assert
+		Consistently(ch, 100*time.Millisecond).ShouldNot(Receive())
+		Expect(p.Paused()).To(BeTrue())
+
+		p.Resume()
+		var r result
+		Eventually(ch).Should(Receive(&r))
+		Expect(r.err).NotTo(HaveOccurred())
+		Expect(r.token.AccessToken).To(Equal("access_token"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns ErrPollerStopped when stopped", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{})
+		defer ms.Close()
+		p := newPoller(ms)
+		p.Pause()
+		ch := poll(context.Background(), p)
+
+		// Act
+		p.Stop()
+
+		// Assert
+		var r result
+		Eventually(ch).Should(Receive(&r))
+		Expect(r.err).To(MatchError(auth.ErrPollerStopped))
+	})
+
+	It("returns the error of the context when it is done", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{})
+		defer ms.Close()
+		p := newPoller(ms)
+		p.Pause()
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := poll(ctx, p)
+
+		// Act
+		cancel()
+
+		// Assert
+		var r result
+		Eventually(ch).Should(Receive(&r))
+		Expect(r.err).To(MatchError(context.Canceled))
+	})
+
+	It("cancels the in-flight request when stopped", func() {
+		// Arrange
+		requested := make(chan struct{}, 1)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			requested <- struct{}{}
+			<-r.Context().Done()
+		}))
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID), auth.WithTimeNow(newStubTimeNow(0)))
+		Expect(err).NotTo(HaveOccurred())
+		p := daf.NewPoller(dc)
+		ch := poll(context.Background(), p)
+		Eventually(requested).Should(Receive())
+
+		// Act
+		p.Stop()
+
+		// Assert
+		var r result
+		Eventually(ch).Should(Receive(&r))
+		Expect(r.err).To(MatchError(auth.ErrPollerStopped))
+	})
+})
@@ -0,0 +1,58 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// WithTokenProcessor registers a hook to shape tokens after they are acquired and validated by WithResponseValidator,
+// before they are returned to callers to be persisted or output, e.g. to exchange them for downstream tokens,
+// to wrap them in a custom envelope or to stamp metadata in Extra.
+// The token returned by the hook is used instead, which may be the given one modified or a new one.
+// An error returned by the hook is returned as it is instead of the token.
+//
+// It can be given multiple times, and hooks are called in the order with the token returned by the previous one.
+// Nil hooks are skipped. Tokens requested by hooks with the context (e.g. ExchangeContext) are not processed again.
+type WithTokenProcessor func(ctx context.Context, t *TokenResponse) (*TokenResponse, error)
+
+func (p WithTokenProcessor) apply(daf *DeviceAuthFlow) error {
+	if p != nil {
+		daf.tokenProcessors = append(daf.tokenProcessors, p)
+	}
+	return nil
+}
+
+// processingKey marks contexts given to token processors.
+type processingKey struct{}
+
+func (daf *DeviceAuthFlow) processToken(ctx context.Context, t *TokenResponse) (*TokenResponse, error) {
+	if len(daf.tokenProcessors) == 0 || ctx.Value(processingKey{}) != nil {
+		return t, nil
+	}
+
+	ctx = context.WithValue(ctx, processingKey{}, true)
+	for _, p := range daf.tokenProcessors {
+		var err error
+		if t, err = p(ctx, t); err != nil {
+			return nil, err
+		}
+		if t == nil {
+			return nil, errors.New("token processor returned no token")
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,162 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithTokenProcessor", func() {
+	newServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			w.Header().Set("content-type", "application/json")
+			if r.URL.Path == "/oauth/device/code" {
+				w.Write([]byte(`{"device_code": "device_code", "user_code": "ABCD-EFGH", "verification_uri": "https://example.com/activate", "expires_in": 900, "interval": 5}`))
+				return
+			}
+			if r.PostForm.Get("grant_type") == "urn:ietf:params:oauth:grant-type:token-exchange" {
+				w.Write([]byte(`{"access_token": "downstream_token", "token_type": "Bearer", "expires_in": 600}`))
+				return
+			}
+			w.Write([]byte(`{"access_token": "access_token", "refresh_token": "refresh_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+	}
+
+	It("returns the token shaped by the processors in the order", func() {
+		// Arrange
+		ts := newServer()
+		defer ts.Close()
+
+		calls := make([]string, 0)
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithTokenProcessor(func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+				calls = append(calls, "stamp")
+				t.Extra = map[string]json.RawMessage{"issued_by": json.RawMessage(`"a0daf"`)}
+				return t, nil
+			}),
+			auth.WithTokenProcessor(nil),
+			auth.WithTokenProcessor(func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+				calls = append(calls, "wrap")
+				Expect(t.Extra).To(HaveKey("issued_by"))
+				return &auth.TokenResponse{AccessToken: "envelope." + t.AccessToken, TokenType: t.TokenType, ExpiresIn: t.ExpiresIn, Extra: t.Extra}, nil
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("envelope.access_token"))
+		Expect(token.Extra).To(HaveKey("issued_by"))
+		Expect(calls).To(Equal([]string{"stamp", "wrap"}))
+	})
+
+	It("does not process tokens requested by the processor again", func() {
+		// Arrange
+		ts := newServer()
+		defer ts.Close()
+
+		var daf *auth.DeviceAuthFlow
+		calls := 0
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithTokenProcessor(func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+				calls++
+				return daf.ExchangeContext(ctx, &auth.TokenExchangeRequest{SubjectToken: t.AccessToken, Audience: "https://downstream.example.com"})
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("downstream_token"))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("processes tokens of the device code grant", func() {
+		// Arrange
+		ts := newServer()
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithTimeSleep(newMockTimeSleep().f),
+			auth.WithTokenProcessor(func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+				info, _ := auth.RequestInfoFromContext(ctx)
+				Expect(info.FlowID).To(Equal("flow"))
+				t.AccessToken = "processed_" + t.AccessToken
+				return t, nil
+			}),
+			auth.WithFlowID("flow"),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.Authorize("openid", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("processed_access_token"))
+	})
+
+	It("returns the error of the processor instead of the token", func() {
+		// Arrange
+		ts := newServer()
+		defer ts.Close()
+
+		rejected := errors.New("rejected")
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithTokenProcessor(func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+				return nil, rejected
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(rejected))
+		Expect(token).To(BeNil())
+	})
+
+	It("returns error when the processor returns no token", func() {
+		// Arrange
+		ts := newServer()
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithTokenProcessor(func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+				return nil, nil
+			}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("no token")))
+	})
+})
@@ -0,0 +1,132 @@
+package auth_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// startSOCKS5Server starts a minimal SOCKS5 server with username/password authentication (RFC 1928, RFC 1929),
+// and returns its address and a channel receiving requested destinations.
+func startSOCKS5Server(user, password string) (net.Listener, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	dests := make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				// greeting: VER NMETHODS METHODS, select username/password
+				b := make([]byte, 2)
+				if _, err := io.ReadFull(conn, b); err != nil {
+					return
+				}
+				io.ReadFull(conn, make([]byte, b[1]))
+				conn.Write([]byte{5, 2})
+
+				// authentication: VER ULEN UNAME PLEN PASSWD
+				io.ReadFull(conn, b)
+				u := make([]byte, b[1])
+				io.ReadFull(conn, u)
+				io.ReadFull(conn, b[:1])
+				p := make([]byte, b[0])
+				io.ReadFull(conn, p)
+				if string(u) != user || string(p) != password {
+					conn.Write([]byte{1, 1})
+					return
+				}
+				conn.Write([]byte{1, 0})
+
+				// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+				req := make([]byte, 4)
+				io.ReadFull(conn, req)
+				var host string
+				switch req[3] {
+				case 1:
+					ip := make([]byte, 4)
+					io.ReadFull(conn, ip)
+					host = net.IP(ip).String()
+				case 3:
+					io.ReadFull(conn, b[:1])
+					name := make([]byte, b[0])
+					io.ReadFull(conn, name)
+					host = string(name)
+				default:
+					return
+				}
+				io.ReadFull(conn, b)
+				dest := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(b))))
+				dests <- dest
+
+				upstream, err := net.Dial("tcp", dest)
+				if err != nil {
+					conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+
+	return l, dests
+}
+
+var _ = Describe("WithSOCKS5Proxy", func() {
+	It("sends requests via the SOCKS5 proxy with authentication", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		l, dests := startSOCKS5Server("user", "p@ss")
+		defer l.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithSOCKS5Proxy("socks5://user:p%40ss@"+l.Addr().String()),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(dests).To(Receive(Equal(ts.Listener.Addr().String())))
+	})
+
+	DescribeTable("rejects invalid proxies",
+		func(proxy string) {
+			// Act
+			_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithSOCKS5Proxy(proxy))
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("HTTP proxy", "http://localhost:8080"),
+		Entry("without port", "socks5://localhost"),
+		Entry("empty", ""),
+	)
+})
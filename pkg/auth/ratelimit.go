@@ -0,0 +1,222 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter paces requests with token buckets keyed by base URL.
+//
+// Share a RateLimiter among DeviceAuthFlows with WithRateLimiter,
+// so that a process acquiring many tokens does not exceed rate limits of the tenant.
+type RateLimiter struct {
+	rate    float64
+	burst   int
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter which allows rate requests per second to each tenant, with bursts of up to burst requests.
+func NewRateLimiter(rate float64, burst int) (*RateLimiter, error) {
+	if rate <= 0 {
+		return nil, errors.New("rate of RateLimiter must be positive")
+	}
+	if burst < 1 {
+		return nil, errors.New("burst of RateLimiter must be positive")
+	}
+
+	return &RateLimiter{rate: rate, burst: burst, buckets: make(map[string]*tokenBucket)}, nil
+}
+
+// Wait blocks until a request to the tenant of key is allowed, or returns ctx.Err() when ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context, key string) error {
+	for {
+		wait := l.reserve(key)
+		if wait == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token of the bucket and returns 0, or returns how long to wait for the next token.
+func (l *RateLimiter) reserve(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// WithRateLimiter paces requests to the endpoints with the RateLimiter, which can be shared among DeviceAuthFlows.
+type WithRateLimiter struct {
+	Limiter *RateLimiter
+}
+
+func (o WithRateLimiter) apply(daf *DeviceAuthFlow) error {
+	if o.Limiter == nil {
+		return errors.New("Limiter of WithRateLimiter is nil")
+	}
+
+	daf.rateLimiter = o.Limiter
+	return nil
+}
+
+// waitRateLimit waits for the RateLimiter given by WithRateLimiter if any.
+func (daf *DeviceAuthFlow) waitRateLimit(ctx context.Context) error {
+	if daf.rateLimiter == nil {
+		return nil
+	}
+	return daf.rateLimiter.Wait(ctx, daf.baseURL)
+}
+
+// RateLimitError is returned when Auth0 API responds with 429 Too Many Requests.
+// It wraps APIError of the response, so that errors.As with APIError still works.
+//
+// See: https://auth0.com/docs/troubleshoot/customer-support/operational-policies/rate-limit-policy
+type RateLimitError struct {
+	Err *APIError
+	// Limit and Remaining are X-RateLimit-Limit and X-RateLimit-Remaining headers, or -1 if not given.
+	Limit     int
+	Remaining int
+	// Reset is when the request may be retried, given by Retry-After or X-RateLimit-Reset header.
+	// It is zero if neither is given.
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Reset.IsZero() {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (retry after %s)", e.Err.Error(), e.Reset.Format(time.RFC3339))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout always returns false because 429 responses are not caused by timeouts.
+func (e *RateLimitError) Timeout() bool {
+	return false
+}
+
+// Temporary always returns true because the request may succeed after Reset.
+func (e *RateLimitError) Temporary() bool {
+	return true
+}
+
+// newRateLimitError returns RateLimitError of the 429 response with header, received at now.
+func newRateLimitError(apiErr *APIError, header http.Header, now time.Time) *RateLimitError {
+	e := &RateLimitError{Err: apiErr, Limit: headerInt(header, "X-RateLimit-Limit"), Remaining: headerInt(header, "X-RateLimit-Remaining")}
+
+	// Retry-After is delay-seconds or HTTP-date
+	// See: https://datatracker.ietf.org/doc/html/rfc9110#section-10.2.3
+	if v := header.Get("Retry-After"); v != "" {
+		if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+			e.Reset = now.Add(time.Duration(sec) * time.Second)
+		} else if t, err := http.ParseTime(v); err == nil {
+			e.Reset = t
+		}
+	}
+	// X-RateLimit-Reset of Auth0 is the UNIX time
+	if e.Reset.IsZero() {
+		if sec, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil && sec > 0 {
+			e.Reset = time.Unix(sec, 0)
+		}
+	}
+
+	return e
+}
+
+func headerInt(header http.Header, key string) int {
+	n, err := strconv.Atoi(header.Get(key))
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
+
+// apiError returns APIError of the 4xx response of the request, or RateLimitError of the 429 response.
+// request is the kind of the request used in the error message like "token".
+func (daf *DeviceAuthFlow) apiError(request string, statusCode int, header http.Header, resBody []byte) error {
+	er := new(ErrorResponse)
+	if err := json.Unmarshal(resBody, er); err != nil {
+		// 429 responses may be returned by proxies without JSON body
+		if statusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("could not decode %s response body: %w", request, err)
+		}
+		er = &ErrorResponse{Error: "too_many_requests", ErrorDescription: http.StatusText(statusCode)}
+	}
+
+	apiErr := &APIError{StatusCode: statusCode, Body: er, RawBody: daf.redact(daf.rawBody(resBody))}
+	if statusCode == http.StatusTooManyRequests {
+		return newRateLimitError(apiErr, header, daf.timeNow())
+	}
+	return apiErr
+}
+
+// untilReset returns how long to wait for the reset of the rate limit if err is RateLimitError.
+func (daf *DeviceAuthFlow) untilReset(err error) (time.Duration, bool) {
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		return 0, false
+	}
+	if rateLimitErr.Reset.IsZero() {
+		return 0, true
+	}
+
+	d := rateLimitErr.Reset.Sub(daf.timeNow())
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
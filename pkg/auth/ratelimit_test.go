@@ -0,0 +1,212 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RateLimiter", func() {
+	It("allows bursts and then paces requests", func() {
+		// Arrange
+		l, err := auth.NewRateLimiter(20, 2)
+		Expect(err).NotTo(HaveOccurred())
+		start := time.Now()
+
+		// Act
+		for i := 0; i < 4; i++ {
+			Expect(l.Wait(context.Background(), "https://example.com")).To(Succeed())
+		}
+
+		// Assert
+		Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+	})
+
+	It("has separate buckets for each key", func() {
+		// Arrange
+		l, err := auth.NewRateLimiter(1, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Wait(context.Background(), "https://a.example.com")).To(Succeed())
+		start := time.Now()
+
+		// Act
+		err = l.Wait(context.Background(), "https://b.example.com")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 100*time.Millisecond))
+	})
+
+	It("returns the error of the context while waiting", func() {
+		// Arrange
+		l, err := auth.NewRateLimiter(0.1, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(l.Wait(context.Background(), "https://example.com")).To(Succeed())
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// Act
+		err = l.Wait(ctx, "https://example.com")
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("is shared among flows of the same tenant", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			w.Write([]byte(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+		defer ts.Close()
+
+		l, err := auth.NewRateLimiter(10, 1)
+		Expect(err).NotTo(HaveOccurred())
+		daf1, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("client1"), auth.WithRateLimiter{Limiter: l})
+		Expect(err).NotTo(HaveOccurred())
+		daf2, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("client2"), auth.WithRateLimiter{Limiter: l})
+		Expect(err).NotTo(HaveOccurred())
+		start := time.Now()
+
+		// Act
+		_, err1 := daf1.ExchangeRefreshToken("refresh_token")
+		_, err2 := daf2.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err1).NotTo(HaveOccurred())
+		Expect(err2).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+	})
+
+	DescribeTable("rejects invalid parameters",
+		func(rate float64, burst int) {
+			// Act
+			_, err := auth.NewRateLimiter(rate, burst)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("zero rate", 0.0, 1),
+		Entry("zero burst", 1.0, 0),
+	)
+})
+
+var _ = Describe("RateLimitError", func() {
+	clientID := "clientID"
+	deviceCodeForm := map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}}
+	tokenForm := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+	tooManyRequests := `{"error": "too_many_requests", "error_description": "Global limit has been reached"}`
+	timeNow := func() time.Time { return baseStubTime }
+
+	It("waits for Retry-After while polling", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/token", form: tokenForm, statusCode: 429, responseBody: tooManyRequests, responseHeader: map[string]string{"Retry-After": "30"}},
+			{path: "/oauth/token", form: tokenForm, statusCode: 200, responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`},
+		})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(timeNow), auth.WithTimeSleep(timeSleep.f))
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 60, Interval: 5, ExpiresAt: baseStubTime.Add(60 * time.Second)}
+
+		// Act
+		token, stats, err := daf.PollTokenWithStats(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(stats.RateLimited).To(Equal(1))
+		Expect(timeSleep.calls).To(Equal([]time.Duration{30 * time.Second}))
+	})
+
+	It("is returned by polling when the rate limit is reset after the expiry", func() {
+		// Arrange
+		reset := baseStubTime.Add(90 * time.Second)
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/token", form: tokenForm, statusCode: 429, responseBody: tooManyRequests, responseHeader: map[string]string{
+				"X-RateLimit-Limit":     "30",
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(reset.Unix(), 10),
+			}},
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(timeNow), auth.WithTimeSleep(newMockTimeSleep().f))
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 60, Interval: 5, ExpiresAt: baseStubTime.Add(60 * time.Second)}
+
+		// Act
+		_, err := daf.PollToken(dc)
+
+		// Assert
+		var rateLimitErr *auth.RateLimitError
+		Expect(errors.As(err, &rateLimitErr)).To(BeTrue())
+		Expect(rateLimitErr.Limit).To(Equal(30))
+		Expect(rateLimitErr.Remaining).To(Equal(0))
+		Expect(rateLimitErr.Reset.Equal(reset)).To(BeTrue())
+		Expect(auth.Retryable(err)).To(BeTrue())
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Body.Error).To(Equal("too_many_requests"))
+	})
+
+	It("is returned by the device code request without RetryPolicy", func() {
+		// Arrange
+		reset := baseStubTime.Add(10 * time.Second)
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 429, responseBody: `Too Many Requests`, responseHeader: map[string]string{"Retry-After": reset.UTC().Format(http.TimeFormat)}},
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeNow(timeNow))
+
+		// Act
+		_, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var rateLimitErr *auth.RateLimitError
+		Expect(errors.As(err, &rateLimitErr)).To(BeTrue())
+		Expect(rateLimitErr.Reset.Equal(reset)).To(BeTrue())
+		Expect(rateLimitErr.Limit).To(Equal(-1))
+		Expect(rateLimitErr.Err.Body.Error).To(Equal("too_many_requests"))
+		Expect(err.Error()).To(ContainSubstring("retry after"))
+	})
+
+	It("is retried by RetryPolicy after the reset", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 429, responseBody: tooManyRequests, responseHeader: map[string]string{"Retry-After": "10"}},
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 200, responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`},
+		})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(timeNow),
+			auth.WithTimeSleep(timeSleep.f),
+			auth.WithRetryPolicy{MaxAttempts: 2, BaseDelay: time.Second},
+		)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.UserCode).To(Equal("123456"))
+		Expect(timeSleep.calls).To(Equal([]time.Duration{10 * time.Second}))
+	})
+})
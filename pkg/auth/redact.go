@@ -0,0 +1,169 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets redacted by Redactor.
+const Redacted = "[REDACTED]"
+
+// defaultSensitiveNames are names of parameters, headers and JSON fields which are always redacted.
+var defaultSensitiveNames = []string{
+	"access_token",
+	"actor_token",
+	"client_assertion",
+	"client_secret",
+	"code_verifier",
+	"id_token",
+	"mfa_token",
+	"otp",
+	"password",
+	"refresh_token",
+	"subject_token",
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Set-Cookie",
+}
+
+// Redactor redacts secrets in strings shown to users, like error messages, dumps of requests and diagnostics.
+//
+// Values of sensitive names are redacted in form parameters (name=value), JSON fields ("name": "value")
+// and header lines (Name: value), and registered secret values are redacted wherever they appear.
+// Names are matched case-insensitively. Extra names like internal header names can be registered with AddNames.
+// It is safe for concurrent use.
+type Redactor struct {
+	mu     sync.Mutex
+	names  map[string]bool
+	values []string
+	// patterns are compiled from names lazily, and cleared when names are added.
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a Redactor of the default sensitive names like client_secret and Authorization.
+func NewRedactor() *Redactor {
+	r := &Redactor{names: make(map[string]bool)}
+	r.AddNames(defaultSensitiveNames...)
+	return r
+}
+
+// AddNames registers extra sensitive names of parameters, headers or JSON fields.
+func (r *Redactor) AddNames(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			r.names[strings.ToLower(name)] = true
+		}
+	}
+	r.patterns = nil
+}
+
+// AddValues registers secret values like the client secret, which are redacted wherever they appear.
+func (r *Redactor) AddValues(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range values {
+		if v != "" {
+			r.values = append(r.values, v)
+		}
+	}
+}
+
+// Sensitive reports whether the value of the parameter, header or JSON field is redacted.
+func (r *Redactor) Sensitive(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.names[strings.ToLower(name)]
+}
+
+// String returns s with the secrets redacted.
+func (r *Redactor) String(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	for _, p := range r.compile() {
+		s = p.ReplaceAllString(s, "${1}"+Redacted+"${2}")
+	}
+	return s
+}
+
+// Bytes is like String, but for bytes like response bodies. It returns nil for nil.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return []byte(r.String(string(b)))
+}
+
+// compile returns patterns matching values of the names, whose first and second groups are kept as they are.
+// r.mu must be held.
+func (r *Redactor) compile() []*regexp.Regexp {
+	if r.patterns != nil || len(r.names) == 0 {
+		return r.patterns
+	}
+
+	quoted := make([]string, 0, len(r.names))
+	for name := range r.names {
+		quoted = append(quoted, regexp.QuoteMeta(name))
+	}
+	names := "(?:" + strings.Join(quoted, "|") + ")"
+
+	r.patterns = []*regexp.Regexp{
+		// form parameters and queries
+		regexp.MustCompile(`(?i)((?:^|[?&\s])` + names + `=)[^&\s]*()`),
+		// JSON fields of strings
+		regexp.MustCompile(`(?i)("` + names + `"\s*:\s*")(?:[^"\\]|\\.)*(")`),
+		// header lines
+		regexp.MustCompile(`(?im)(^` + names + `:[ \t]*)[^\r\n]*()`),
+	}
+	return r.patterns
+}
+
+// WithRedactor redacts secrets in bodies of error responses held by APIError and ServerError with the Redactor,
+// so that they can be logged or shown safely. The client secret given by WithClientSecret is registered to it.
+//
+// The Redactor can be shared with the application to redact its own output consistently.
+type WithRedactor struct {
+	Redactor *Redactor
+}
+
+func (o WithRedactor) apply(daf *DeviceAuthFlow) error {
+	if o.Redactor == nil {
+		return errors.New("Redactor of WithRedactor is nil")
+	}
+
+	daf.redactor = o.Redactor
+	return nil
+}
+
+// redact redacts b with the Redactor given by WithRedactor if any.
+func (daf *DeviceAuthFlow) redact(b []byte) []byte {
+	if daf.redactor == nil {
+		return b
+	}
+	return daf.redactor.Bytes(b)
+}
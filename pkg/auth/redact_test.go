@@ -0,0 +1,85 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redactor", func() {
+	DescribeTable("String",
+		func(s string, expected string) {
+			// Arrange
+			r := auth.NewRedactor()
+			r.AddNames("X-Internal-Token")
+			r.AddValues("s3cr3t")
+
+			// Act
+			actual := r.String(s)
+
+			// Assert
+			Expect(actual).To(Equal(expected))
+		},
+		Entry("form parameters", "grant_type=refresh_token&refresh_token=abc&client_id=id", "grant_type=refresh_token&refresh_token=[REDACTED]&client_id=id"),
+		Entry("JSON fields", `{"error": "x", "access_token": "a\"b", "Password":"p"}`, `{"error": "x", "access_token": "[REDACTED]", "Password":"[REDACTED]"}`),
+		Entry("header lines", "Authorization: Bearer abc\r\nx-internal-token: t\r\nAccept: */*", "Authorization: [REDACTED]\r\nx-internal-token: [REDACTED]\r\nAccept: */*"),
+		Entry("registered values", "invalid secret s3cr3t given", "invalid secret [REDACTED] given"),
+		Entry("names in other words", "client_secret_post is not allowed", "client_secret_post is not allowed"),
+	)
+
+	It("reports sensitive names", func() {
+		// Arrange
+		r := auth.NewRedactor()
+		r.AddNames("X-Internal-Token")
+
+		// Act & Assert
+		Expect(r.Sensitive("client_secret")).To(BeTrue())
+		Expect(r.Sensitive("authorization")).To(BeTrue())
+		Expect(r.Sensitive("X-INTERNAL-TOKEN")).To(BeTrue())
+		Expect(r.Sensitive("client_id")).To(BeFalse())
+	})
+})
+
+var _ = Describe("WithRedactor", func() {
+	It("redacts bodies of error responses", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			w.WriteHeader(502)
+			w.Write([]byte("upstream rejected client_secret=" + r.PostForm.Get("client_secret") + "&refresh_token=" + r.PostForm.Get("refresh_token")))
+		}))
+		defer ts.Close()
+
+		r := auth.NewRedactor()
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithClientSecret("s3cr3t"),
+			auth.WithRedactor{Redactor: r},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(err.Error()).NotTo(ContainSubstring("s3cr3t"))
+		Expect(string(serverErr.Body)).To(Equal("upstream rejected client_secret=[REDACTED]&refresh_token=[REDACTED]"))
+		Expect(r.String("s3cr3t")).To(Equal(auth.Redacted))
+	})
+
+	It("rejects nil", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithRedactor{})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
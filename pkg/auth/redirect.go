@@ -0,0 +1,78 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// RedirectPolicy specifies how HTTP redirects from the endpoints are handled.
+type RedirectPolicy int
+
+const (
+	// RefuseRedirects refuses all redirects. It is the default,
+	// because requests to the token endpoint must not be forwarded to unexpected hosts.
+	RefuseRedirects RedirectPolicy = iota
+	// SameHostRedirects follows redirects to the same host only.
+	SameHostRedirects
+	// FollowRedirects follows all redirects like http.DefaultClient.
+	FollowRedirects
+)
+
+// maxRedirects is the same limit as http.DefaultClient.
+const maxRedirects = 10
+
+// WithRedirectPolicy specifies RedirectPolicy. By default, RefuseRedirects is used.
+type WithRedirectPolicy RedirectPolicy
+
+func (policy WithRedirectPolicy) apply(daf *DeviceAuthFlow) error {
+	switch RedirectPolicy(policy) {
+	case RefuseRedirects, SameHostRedirects, FollowRedirects:
+		daf.redirectPolicy = RedirectPolicy(policy)
+		return nil
+	default:
+		return fmt.Errorf("unknown redirect policy: %d", policy)
+	}
+}
+
+// RedirectError is returned when a redirect is refused by RedirectPolicy.
+type RedirectError struct {
+	From string
+	To   string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirect from %s to %s was refused", e.From, e.To)
+}
+
+func (policy RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+
+	from := via[len(via)-1].URL
+	switch policy {
+	case FollowRedirects:
+		return nil
+	case SameHostRedirects:
+		if req.URL.Scheme == from.Scheme && req.URL.Host == from.Host {
+			return nil
+		}
+	}
+
+	return &RedirectError{From: from.String(), To: req.URL.String()}
+}
@@ -0,0 +1,60 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithRedirectPolicy", func() {
+	var ts *httptest.Server
+
+	BeforeEach(func() {
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/oauth/device/code":
+				http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+			case "/moved":
+				w.Write([]byte(`{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`))
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	newDeviceAuthFlow := func(opts ...auth.DeviceAuthFlowOption) *auth.DeviceAuthFlow {
+		daf, err := auth.NewDeviceAuthFlow(append([]auth.DeviceAuthFlowOption{auth.WithBaseURL(ts.URL), auth.WithClientID("clientID")}, opts...)...)
+		Expect(err).NotTo(HaveOccurred())
+		return daf
+	}
+
+	It("refuses redirects by default", func() {
+		// Act
+		_, err := newDeviceAuthFlow().FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var redirectError *auth.RedirectError
+		Expect(errors.As(err, &redirectError)).To(BeTrue())
+		Expect(redirectError).To(Equal(&auth.RedirectError{From: ts.URL + "/oauth/device/code", To: ts.URL + "/moved"}))
+	})
+
+	DescribeTable("follows redirects to the same host when allowed",
+		func(policy auth.RedirectPolicy) {
+			// Act
+			dc, err := newDeviceAuthFlow(auth.WithRedirectPolicy(policy)).FetchDeviceCode("openid", "https://example.com/api")
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dc.UserCode).To(Equal("123456"))
+		},
+		Entry("with SameHostRedirects", auth.SameHostRedirects),
+		Entry("with FollowRedirects", auth.FollowRedirects),
+	)
+})
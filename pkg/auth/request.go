@@ -0,0 +1,57 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+	neturl "net/url"
+)
+
+// DeviceCodeRequest represents parameters of the device code request.
+//
+// Empty Scope and Audience fall back to WithDefaultScope and WithDefaultAudience,
+// and empty Organization falls back to WithOrganization.
+type DeviceCodeRequest struct {
+	Scope        string
+	Audience     string
+	Organization string
+	// Invitation is the ID of the organization invitation ticket to accept. It requires Organization or WithOrganization.
+	// See ParseInvitationURL to take them from the invitation link.
+	Invitation string
+	// Extra is additional parameters like vendor extensions. Parameters set by DeviceAuthFlow cannot be given.
+	Extra neturl.Values
+}
+
+// TokenRequest represents parameters of the token requests polled with the device code.
+type TokenRequest struct {
+	DeviceCode *DeviceCodeResponse
+	// Extra is additional parameters like vendor extensions. Parameters set by DeviceAuthFlow cannot be given.
+	Extra neturl.Values
+}
+
+// encodeExtraParams encodes extra as a suffix of form parameters, rejecting reserved parameters.
+func encodeExtraParams(extra neturl.Values, reserved ...string) (string, error) {
+	if len(extra) == 0 {
+		return "", nil
+	}
+
+	for _, name := range reserved {
+		if _, ok := extra[name]; ok {
+			return "", fmt.Errorf("parameter %s cannot be given in Extra", name)
+		}
+	}
+
+	return "&" + extra.Encode(), nil
+}
@@ -0,0 +1,142 @@
+package auth_test
+
+import (
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Requests", func() {
+	readForm := func(body io.Reader) url.Values {
+		b, err := io.ReadAll(body)
+		Expect(err).NotTo(HaveOccurred())
+		form, err := url.ParseQuery(string(b))
+		Expect(err).NotTo(HaveOccurred())
+		return form
+	}
+
+	It("NewDeviceCodeRequest returns the request of FetchDeviceCode", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithOrganization("org_123"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		req, err := daf.NewDeviceCodeRequest("openid profile", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.Method).To(Equal("POST"))
+		Expect(req.URL.String()).To(Equal("https://example.com/oauth/device/code"))
+		Expect(req.Header.Get("content-type")).To(Equal("application/x-www-form-urlencoded"))
+		Expect(readForm(req.Body)).To(Equal(url.Values{
+			"client_id":    {"clientID"},
+			"scope":        {"openid profile"},
+			"audience":     {"https://example.com/api"},
+			"organization": {"org_123"},
+		}))
+	})
+
+	It("NewTokenRequest returns the request of PollToken", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithClientSecret("secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		req, err := daf.NewTokenRequest("device_code")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.URL.String()).To(Equal("https://example.com/oauth/token"))
+		Expect(readForm(req.Body)).To(Equal(url.Values{
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code":   {"device_code"},
+			"client_id":     {"clientID"},
+			"client_secret": {"secret"},
+		}))
+	})
+
+	It("RequestDeviceCode sends parameters of DeviceCodeRequest", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/device/code",
+				form: map[string][]string{
+					"client_id":    {"clientID"},
+					"scope":        {"openid"},
+					"audience":     {"https://example.com/api"},
+					"organization": {"org_456"},
+					"ext":          {"value"},
+				},
+				statusCode:   200,
+				responseBody: `{"device_code": "device_code", "user_code": "123456", "verification_uri": "https://example.com/activate", "expires_in": 20, "interval": 5}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID("clientID"), auth.WithOrganization("org_123"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		dc, err := daf.RequestDeviceCode(&auth.DeviceCodeRequest{
+			Scope:        "openid",
+			Audience:     "https://example.com/api",
+			Organization: "org_456",
+			Extra:        url.Values{"ext": {"value"}},
+		})
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.DeviceCode).To(Equal("device_code"))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("RequestToken sends parameters of TokenRequest", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+					"device_code": {"device_code"},
+					"client_id":   {"clientID"},
+					"ext":         {"value"},
+				},
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID("clientID"), auth.WithTimeNow(newStubTimeNow(0)))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, stats, err := daf.RequestToken(&auth.TokenRequest{
+			DeviceCode: &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 20, Interval: 5, ExpiresAt: baseStubTime.Add(20 * time.Second)},
+			Extra:      url.Values{"ext": {"value"}},
+		})
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(stats.Attempts).To(Equal(1))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("rejects reserved parameters in Extra", func() {
+		// Arrange
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.RequestDeviceCode(&auth.DeviceCodeRequest{Extra: url.Values{"client_id": {"other"}}})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,150 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy specifies how requests which failed transiently, i.e. 5xx and 429 responses and temporary network errors, are retried.
+// Retries of 429 responses wait until Reset of RateLimitError if it is later than the delay.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a request including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, which is doubled on each retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay. Zero means no cap.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay from 0 to 1 which is randomly reduced, so that clients do not retry in lockstep.
+	Jitter float64
+}
+
+// WithRetryPolicy retries requests of FetchDeviceCode and PollToken (and their variants) with exponential backoff,
+// so that a flaky connection does not abort a flow the user already approved. Requests are not retried by default.
+//
+// Retries while polling do not extend the expiry of the device code, and are counted in Retries of PollStats.
+type WithRetryPolicy RetryPolicy
+
+func (policy WithRetryPolicy) apply(daf *DeviceAuthFlow) error {
+	if policy.MaxAttempts < 1 {
+		return fmt.Errorf("MaxAttempts of WithRetryPolicy must be positive: %d", policy.MaxAttempts)
+	}
+	if policy.BaseDelay < 0 || policy.MaxDelay < 0 {
+		return errors.New("delays of WithRetryPolicy must not be negative")
+	}
+	if policy.Jitter < 0 || policy.Jitter > 1 {
+		return fmt.Errorf("Jitter of WithRetryPolicy must be from 0 to 1: %g", policy.Jitter)
+	}
+
+	p := RetryPolicy(policy)
+	daf.retryPolicy = &p
+	return nil
+}
+
+// RetryBudget caps retries of a flow, i.e. fetching the device code and its polls, which is shared by all transient
+// failures (network errors, 5xx and 429 responses), so that retries of each request and waits for rate limits
+// cannot add up to unbounded delays.
+type RetryBudget struct {
+	// MaxRetries is the maximum number of retries in a flow. Zero means no limit.
+	MaxRetries int
+	// MaxDelay is the maximum total delay before retries in a flow. Zero means no limit.
+	MaxDelay time.Duration
+}
+
+// WithRetryBudget limits retries of WithRetryPolicy and waits for rate limits while polling by RetryBudget.
+// When the budget is exhausted, the last error is returned. There is no budget by default.
+type WithRetryBudget RetryBudget
+
+func (budget WithRetryBudget) apply(daf *DeviceAuthFlow) error {
+	if budget.MaxRetries < 0 || budget.MaxDelay < 0 {
+		return errors.New("limits of WithRetryBudget must not be negative")
+	}
+
+	b := RetryBudget(budget)
+	daf.retryBudget = &b
+	return nil
+}
+
+// retryUsage is the usage of the retry budget in a flow.
+type retryUsage struct {
+	retries int
+	delay   time.Duration
+}
+
+// spendRetry reports whether a retry after d is within the budget, and records it to u if so.
+func (daf *DeviceAuthFlow) spendRetry(u *retryUsage, d time.Duration) bool {
+	b := daf.retryBudget
+	if b == nil {
+		return true
+	}
+	if (b.MaxRetries > 0 && u.retries >= b.MaxRetries) || (b.MaxDelay > 0 && u.delay+d > b.MaxDelay) {
+		return false
+	}
+
+	u.retries++
+	u.delay += d
+	return true
+}
+
+// backoff returns the delay before retrying the request which failed with err after failures of previous attempts,
+// and false if it should not be retried.
+func (p *RetryPolicy) backoff(failures int, err error) (time.Duration, bool) {
+	if p == nil || err == nil || failures+1 >= p.MaxAttempts || !transient(err) {
+		return 0, false
+	}
+
+	d := p.BaseDelay
+	for i := 0; i < failures && d < time.Hour; i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * randomFraction() * float64(d))
+	}
+
+	return d, true
+}
+
+// transient reports whether err is a 5xx or 429 response, or a temporary network error.
+// Unlike Retryable, 429 responses without RateLimitError are not included because they should be handled by the caller.
+func transient(err error) bool {
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return true
+	}
+
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return serverErr.Temporary()
+	}
+
+	var networkErr *NetworkError
+	return errors.As(err, &networkErr) && networkErr.Temporary()
+}
+
+// randomFraction returns a random number in [0, 1). crypto/rand is used because math/rand is not seeded with go 1.18.
+func randomFraction() float64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0
+	}
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
@@ -0,0 +1,237 @@
+package auth_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithRetryPolicy", func() {
+	clientID := "clientID"
+	deviceCodeForm := map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}}
+	tokenForm := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+	policy := auth.WithRetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+
+	It("retries device code requests failed with 5xx", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 503, responseBody: `unavailable`},
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 200, responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`},
+		})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeSleep(timeSleep.f), policy)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.UserCode).To(Equal("123456"))
+		Expect(ms.restExpects()).To(BeEmpty())
+		Expect(timeSleep.calls).To(Equal([]time.Duration{time.Second}))
+	})
+
+	It("retries polls failed with 5xx and counts them", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/token", form: tokenForm, statusCode: 502, responseBody: `bad gateway`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "authorization_pending", "error_description": "pending"}`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 502, responseBody: `bad gateway`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 200, responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`},
+		})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(timeSleep.f),
+			policy,
+		)
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 60, Interval: 5, ExpiresAt: baseStubTime.Add(60 * time.Second)}
+
+		// Act
+		token, stats, err := daf.PollTokenWithStats(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("access_token"))
+		Expect(stats.Attempts).To(Equal(4))
+		Expect(stats.Retries).To(Equal(2))
+		// consecutive failures are reset by the pending response
+		Expect(timeSleep.calls).To(Equal([]time.Duration{time.Second, 5 * time.Second, time.Second}))
+	})
+
+	It("gives up after MaxAttempts with exponential backoff", func() {
+		// Arrange
+		failure := requestExpectation{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 500, responseBody: `error`}
+		ms := newMockServer([]requestExpectation{failure, failure, failure})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeSleep(timeSleep.f), policy)
+
+		// Act
+		_, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(ms.restExpects()).To(BeEmpty())
+		Expect(timeSleep.calls).To(Equal([]time.Duration{time.Second, 2 * time.Second}))
+	})
+
+	It("does not retry 4xx responses", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 400, responseBody: `{"error": "invalid_request", "error_description": "invalid"}`},
+		})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithTimeSleep(timeSleep.f), policy)
+
+		// Act
+		_, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(timeSleep.calls).To(BeEmpty())
+	})
+
+	DescribeTable("rejects invalid policies",
+		func(policy auth.WithRetryPolicy) {
+			// Act
+			_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), policy)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("no attempts", auth.WithRetryPolicy{}),
+		Entry("negative delay", auth.WithRetryPolicy{MaxAttempts: 2, BaseDelay: -time.Second}),
+		Entry("jitter over 1", auth.WithRetryPolicy{MaxAttempts: 2, Jitter: 1.5}),
+	)
+})
+
+var _ = Describe("WithRetryBudget", func() {
+	clientID := "clientID"
+	deviceCodeForm := map[string][]string{"client_id": {clientID}, "scope": {"openid"}, "audience": {"https://example.com/api"}}
+	tokenForm := map[string][]string{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {"device_code"},
+		"client_id":   {clientID},
+	}
+	policy := auth.WithRetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}
+
+	It("shares the budget between fetching the device code and polls", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 503, responseBody: `unavailable`},
+			{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 200, responseBody: `{"device_code": "device_code", "user_code": "123456", "expires_in": 60, "interval": 5}`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 502, responseBody: `bad gateway`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 400, responseBody: `{"error": "authorization_pending", "error_description": "pending"}`},
+			{path: "/oauth/token", form: tokenForm, statusCode: 502, responseBody: `bad gateway`},
+		})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(timeSleep.f),
+			policy,
+			auth.WithRetryBudget{MaxRetries: 2},
+		)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+		Expect(err).NotTo(HaveOccurred())
+		_, stats, err := daf.PollTokenWithStats(dc)
+
+		// Assert
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(stats.Retries).To(Equal(1))
+		Expect(ms.restExpects()).To(BeEmpty())
+		Expect(timeSleep.calls).To(Equal([]time.Duration{time.Second, time.Second, 5 * time.Second}))
+	})
+
+	It("gives up when the total delay exceeds MaxDelay", func() {
+		// Arrange
+		failure := requestExpectation{path: "/oauth/device/code", form: deviceCodeForm, statusCode: 500, responseBody: `error`}
+		ms := newMockServer([]requestExpectation{failure, failure})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeSleep(timeSleep.f),
+			policy,
+			auth.WithRetryBudget{MaxDelay: 2500 * time.Millisecond},
+		)
+
+		// Act
+		_, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(ms.restExpects()).To(BeEmpty())
+		// the second retry after 2s exceeds the budget
+		Expect(timeSleep.calls).To(Equal([]time.Duration{time.Second}))
+	})
+
+	It("counts waits for rate limits while polling", func() {
+		// Arrange
+		rateLimited := requestExpectation{
+			path:           "/oauth/token",
+			form:           tokenForm,
+			statusCode:     429,
+			responseBody:   `{"error": "too_many_requests", "error_description": "rate limited"}`,
+			responseHeader: map[string]string{"Retry-After": "1"},
+		}
+		ms := newMockServer([]requestExpectation{rateLimited, rateLimited})
+		defer ms.Close()
+
+		timeSleep := newMockTimeSleep()
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ms.URL),
+			auth.WithClientID(clientID),
+			auth.WithTimeNow(newStubTimeNow(1)),
+			auth.WithTimeSleep(timeSleep.f),
+			auth.WithRetryBudget{MaxRetries: 1},
+		)
+		dc := &auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 60, Interval: 5, ExpiresAt: baseStubTime.Add(60 * time.Second)}
+
+		// Act
+		_, stats, err := daf.PollTokenWithStats(dc)
+
+		// Assert
+		var rateLimitErr *auth.RateLimitError
+		Expect(errors.As(err, &rateLimitErr)).To(BeTrue())
+		Expect(stats.RateLimited).To(Equal(1))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("rejects negative limits", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID), auth.WithRetryBudget{MaxRetries: -1})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,54 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// Revoke invalidates the refresh token, e.g. on logout. Access tokens issued with it are not revoked.
+//
+// APIError is returned when Auth0 rejects the request (e.g. invalid_request for unknown clients).
+//
+// See: https://auth0.com/docs/api/authentication#revoke-refresh-token
+func (daf *DeviceAuthFlow) Revoke(refreshToken string) error {
+	return daf.RevokeContext(context.Background(), refreshToken)
+}
+
+// RevokeContext is like Revoke, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) RevokeContext(ctx context.Context, refreshToken string) error {
+	authParams, err := daf.clientAuthParams(ctx)
+	if err != nil {
+		return err
+	}
+	params := fmt.Sprintf("client_id=%s&token=%s", daf.clientID, neturl.QueryEscape(refreshToken))
+
+	statusCode, header, resBody, err := daf.postForm(ctx, daf.discoveredOr(daf.endpoints.RevocationEndpoint, "/oauth/revoke"), strings.NewReader(params+authParams))
+	if err != nil {
+		return err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			return daf.apiError("revoke", statusCode, header, resBody)
+		}
+		return &ServerError{Request: "revoke", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	return nil
+}
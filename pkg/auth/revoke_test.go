@@ -0,0 +1,79 @@
+package auth_test
+
+import (
+	"errors"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Revoke()", func() {
+	clientID := "clientID"
+	expectedForm := map[string][]string{
+		"client_id": {clientID},
+		"token":     {"refresh_token"},
+	}
+
+	It("revokes the refresh token", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/revoke", form: expectedForm, statusCode: 200, responseBody: ""},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		err = daf.Revoke("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("returns APIError when the request is rejected", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/oauth/revoke",
+				form:         expectedForm,
+				statusCode:   401,
+				responseBody: `{"error": "invalid_client", "error_description": "Client authentication failed"}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		err = daf.Revoke("refresh_token")
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Body.Error).To(Equal("invalid_client"))
+	})
+
+	It("returns ServerError for 5xx", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{path: "/oauth/revoke", form: expectedForm, statusCode: 503, responseBody: "unavailable"},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		err = daf.Revoke("refresh_token")
+
+		// Assert
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(serverErr.Request).To(Equal("revoke"))
+	})
+})
@@ -0,0 +1,82 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"sort"
+	"strings"
+)
+
+// Scopes represents a set of scopes keeping the order.
+type Scopes []string
+
+// ParseScopes parses a space separated scope string like "openid profile" and removes duplicated scopes.
+func ParseScopes(scope string) Scopes {
+	return Scopes(strings.Fields(scope)).Dedupe()
+}
+
+// String returns the space separated scope string.
+func (s Scopes) String() string {
+	return strings.Join(s, " ")
+}
+
+// Contains reports whether s contains scope.
+func (s Scopes) Contains(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Dedupe returns Scopes without duplicated scopes keeping the order.
+func (s Scopes) Dedupe() Scopes {
+	seen := make(map[string]bool, len(s))
+	deduped := make(Scopes, 0, len(s))
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			deduped = append(deduped, v)
+		}
+	}
+	return deduped
+}
+
+// Sorted returns deduped and sorted Scopes.
+func (s Scopes) Sorted() Scopes {
+	sorted := s.Dedupe()
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Union returns scopes in s or other, in order of s and then other.
+func (s Scopes) Union(other Scopes) Scopes {
+	union := make(Scopes, 0, len(s)+len(other))
+	union = append(union, s...)
+	union = append(union, other...)
+	return union.Dedupe()
+}
+
+// Difference returns scopes in s but not in other.
+func (s Scopes) Difference(other Scopes) Scopes {
+	diff := make(Scopes, 0)
+	for _, v := range s.Dedupe() {
+		if !other.Contains(v) {
+			diff = append(diff, v)
+		}
+	}
+	return diff
+}
@@ -0,0 +1,43 @@
+package auth_test
+
+import (
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scopes", func() {
+	DescribeTable("ParseScopes()",
+		func(scope string, expected auth.Scopes) {
+			Expect(auth.ParseScopes(scope)).To(Equal(expected))
+		},
+		Entry("with single scope", "openid", auth.Scopes{"openid"}),
+		Entry("with extra spaces", " openid  profile\temail ", auth.Scopes{"openid", "profile", "email"}),
+		Entry("with duplicated scopes", "openid profile openid", auth.Scopes{"openid", "profile"}),
+		Entry("with empty string", "", auth.Scopes{}),
+	)
+
+	It("String() returns space separated scopes", func() {
+		Expect(auth.Scopes{"openid", "profile"}.String()).To(Equal("openid profile"))
+	})
+
+	It("Contains() reports whether the scope is contained", func() {
+		s := auth.Scopes{"openid", "profile"}
+
+		Expect(s.Contains("profile")).To(BeTrue())
+		Expect(s.Contains("email")).To(BeFalse())
+	})
+
+	It("Sorted() returns deduped and sorted scopes", func() {
+		Expect(auth.Scopes{"profile", "openid", "email", "openid"}.Sorted()).To(Equal(auth.Scopes{"email", "openid", "profile"}))
+	})
+
+	It("Union() returns scopes in either of them", func() {
+		Expect(auth.Scopes{"openid", "profile"}.Union(auth.Scopes{"profile", "email"})).To(Equal(auth.Scopes{"openid", "profile", "email"}))
+	})
+
+	It("Difference() returns scopes only in the receiver", func() {
+		Expect(auth.Scopes{"openid", "profile", "email"}.Difference(auth.Scopes{"profile"})).To(Equal(auth.Scopes{"openid", "email"}))
+	})
+})
@@ -0,0 +1,31 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import "errors"
+
+// WithClientSecret enables the client authentication with the client secret (client_secret_post) for confidential clients.
+//
+// See: https://auth0.com/docs/get-started/applications/confidential-and-public-applications
+type WithClientSecret string
+
+func (clientSecret WithClientSecret) apply(daf *DeviceAuthFlow) error {
+	if clientSecret == "" {
+		return errors.New("client secret of WithClientSecret is empty")
+	}
+
+	daf.clientSecret = string(clientSecret)
+	return nil
+}
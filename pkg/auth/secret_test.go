@@ -0,0 +1,58 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithClientSecret", func() {
+	It("authenticates token requests with the client secret", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path: "/oauth/token",
+				form: map[string][]string{
+					"grant_type":    {"refresh_token"},
+					"client_id":     {"clientID"},
+					"refresh_token": {"refresh_token"},
+					"client_secret": {"s3cr&t"},
+				},
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID("clientID"), auth.WithClientSecret("s3cr&t"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	It("cannot be used with WithClientAssertionSigner", func() {
+		// Arrange
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = auth.NewDeviceAuthFlow(
+			auth.WithBaseURL("https://example.com"),
+			auth.WithClientID("clientID"),
+			auth.WithClientSecret("secret"),
+			auth.WithClientAssertionSigner{Signer: key},
+		)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
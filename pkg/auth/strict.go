@@ -0,0 +1,94 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WithStrictDecoding rejects successful responses which have fields not modeled in the response types with UnknownFieldsError,
+// e.g. in integration tests to detect changes of the contract of the server instead of keeping the fields in Extra silently.
+//
+// Error responses are decoded leniently, so that APIError is not hidden by UnknownFieldsError.
+type WithStrictDecoding bool
+
+func (strict WithStrictDecoding) apply(daf *DeviceAuthFlow) error {
+	daf.strictDecoding = bool(strict)
+	return nil
+}
+
+// UnknownFieldsError is returned with WithStrictDecoding when the response has fields not modeled in the response type.
+type UnknownFieldsError struct {
+	// Fields are the names of the unknown fields in sorted order.
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return "response has unknown fields: " + strings.Join(e.Fields, ", ")
+}
+
+// withUnknownFields is implemented by response types which keep unknown fields in Extra.
+type withUnknownFields interface {
+	unknownFields() map[string]json.RawMessage
+}
+
+func (dc *DeviceCodeResponse) unknownFields() map[string]json.RawMessage     { return dc.Extra }
+func (t *TokenResponse) unknownFields() map[string]json.RawMessage           { return t.Extra }
+func (r *BackchannelAuthResponse) unknownFields() map[string]json.RawMessage { return r.Extra }
+func (r *IntrospectionResponse) unknownFields() map[string]json.RawMessage   { return r.Extra }
+
+// unknownFieldPrefix is the prefix of errors of json.Decoder for unknown fields, which has no dedicated type.
+const unknownFieldPrefix = "json: unknown field "
+
+// decodeResponse decodes the body of a successful response into v as json.Unmarshal does,
+// but rejects unknown fields with UnknownFieldsError when WithStrictDecoding is given.
+func (daf *DeviceAuthFlow) decodeResponse(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if daf.strictDecoding {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(v); err != nil {
+		if msg := err.Error(); strings.HasPrefix(msg, unknownFieldPrefix) {
+			name := strings.TrimPrefix(msg, unknownFieldPrefix)
+			if unquoted, err := strconv.Unquote(name); err == nil {
+				name = unquoted
+			}
+			return &UnknownFieldsError{Fields: []string{name}}
+		}
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("invalid character after top-level value")
+	}
+
+	// DisallowUnknownFields does not affect types with UnmarshalJSON, which keep unknown fields in Extra
+	if r, ok := v.(withUnknownFields); ok && daf.strictDecoding && len(r.unknownFields()) != 0 {
+		fields := make([]string, 0, len(r.unknownFields()))
+		for name := range r.unknownFields() {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		return &UnknownFieldsError{Fields: fields}
+	}
+
+	return nil
+}
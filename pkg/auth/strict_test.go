@@ -0,0 +1,95 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithStrictDecoding", func() {
+	newServer := func(statusCode int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(statusCode)
+			w.Write([]byte(body))
+		}))
+	}
+
+	DescribeTable("rejects unknown fields of successful responses",
+		func(body string, strict bool, expectedFields []string) {
+			// Arrange
+			ts := newServer(200, body)
+			defer ts.Close()
+
+			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithStrictDecoding(strict))
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			_, err = daf.ExchangeRefreshToken("refresh_token")
+
+			// Assert
+			if expectedFields == nil {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			var unknownErr *auth.UnknownFieldsError
+			Expect(errors.As(err, &unknownErr)).To(BeTrue())
+			Expect(unknownErr.Fields).To(Equal(expectedFields))
+		},
+		Entry("known fields only", `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`, true, nil),
+		Entry("unknown fields", `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400, "scope": "openid", "issued_at": 0}`, true, []string{"issued_at", "scope"}),
+		Entry("unknown fields without strict mode", `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400, "scope": "openid"}`, false, nil),
+	)
+
+	It("rejects unknown fields of types without Extra", func() {
+		// Arrange
+		ts := newServer(200, `{"challenge_type": "otp", "expires_in": 300}`)
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithStrictDecoding(true))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.MFAChallenge("mfa_token", "otp", "")
+
+		// Assert
+		var unknownErr *auth.UnknownFieldsError
+		Expect(errors.As(err, &unknownErr)).To(BeTrue())
+		Expect(unknownErr.Fields).To(Equal([]string{"expires_in"}))
+	})
+
+	It("decodes error responses leniently", func() {
+		// Arrange
+		ts := newServer(403, `{"error": "invalid_grant", "error_description": "Unknown or invalid refresh token.", "error_uri": "https://example.com"}`)
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithStrictDecoding(true))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(auth.IsInvalidGrant(err)).To(BeTrue())
+	})
+
+	It("rejects data after the response", func() {
+		// Arrange
+		ts := newServer(200, `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400} {}`)
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
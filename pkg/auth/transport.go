@@ -0,0 +1,156 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// WithDialContext overrides the dialer of connections to the endpoints,
+// e.g. to pin an IP address, to dial via a jump host, or to dial a unix socket of a local fake server.
+//
+// Host names in the URLs are still used for TLS verification.
+type WithDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (dialContext WithDialContext) apply(daf *DeviceAuthFlow) error {
+	daf.dialContext = dialContext
+	return nil
+}
+
+// WithMinTLSVersion sets the minimum TLS version of connections to the endpoints, e.g. tls.VersionTLS13.
+//
+// TLS 1.2 is required by default, and older versions cannot be allowed.
+type WithMinTLSVersion uint16
+
+func (minTLSVersion WithMinTLSVersion) apply(daf *DeviceAuthFlow) error {
+	if minTLSVersion != tls.VersionTLS12 && minTLSVersion != tls.VersionTLS13 {
+		return fmt.Errorf("unsupported minimum TLS version: %s", tls.VersionName(uint16(minTLSVersion)))
+	}
+
+	daf.minTLSVersion = uint16(minTLSVersion)
+	return nil
+}
+
+// newTransport returns http.RoundTripper configured by options.
+func (daf *DeviceAuthFlow) newTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if daf.dialContext != nil {
+		transport.DialContext = daf.dialContext
+	}
+	transport.TLSClientConfig = &tls.Config{MinVersion: daf.minTLSVersion}
+	if daf.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(daf.proxyURL)
+	}
+
+	return transport
+}
+
+// WithRequestTimeout limits the time of each request to the endpoints including reading the response body,
+// e.g. so that PollToken does not block forever on a hung endpoint. Requests timed out are NetworkError whose Timeout is true.
+//
+// Zero means no timeout, which is the default. Waiting between polls is not included.
+type WithRequestTimeout time.Duration
+
+func (requestTimeout WithRequestTimeout) apply(daf *DeviceAuthFlow) error {
+	if requestTimeout < 0 {
+		return fmt.Errorf("request timeout must not be negative: %s", time.Duration(requestTimeout))
+	}
+
+	daf.requestTimeout = time.Duration(requestTimeout)
+	return nil
+}
+
+// WithHTTPClient sends requests to the endpoints with the client, e.g. to instrument its Transport or to set Timeout.
+//
+// The client is copied, and CheckRedirect of it takes precedence over WithRedirectPolicy if it is set.
+// It cannot be used with options configuring the transport: WithDialContext, WithMinTLSVersion and WithSOCKS5Proxy.
+type WithHTTPClient struct {
+	Client *http.Client
+}
+
+func (o WithHTTPClient) apply(daf *DeviceAuthFlow) error {
+	if o.Client == nil {
+		return errors.New("Client of WithHTTPClient is nil")
+	}
+
+	daf.customClient = o.Client
+	return nil
+}
+
+// newHTTPClient returns http.Client of WithHTTPClient, or a new one with the transport configured by options.
+func (daf *DeviceAuthFlow) newHTTPClient() (*http.Client, error) {
+	if daf.customClient == nil {
+		return &http.Client{
+			Transport:     daf.newTransport(),
+			CheckRedirect: daf.redirectPolicy.checkRedirect,
+		}, nil
+	}
+
+	if daf.dialContext != nil || daf.minTLSVersion != tls.VersionTLS12 || daf.proxyURL != nil {
+		return nil, errors.New("WithHTTPClient cannot be used with WithDialContext, WithMinTLSVersion or WithSOCKS5Proxy")
+	}
+
+	client := *daf.customClient
+	if client.CheckRedirect == nil {
+		client.CheckRedirect = daf.redirectPolicy.checkRedirect
+	}
+	return &client, nil
+}
+
+// ConnectionStats represents how requests of DeviceAuthFlow got connections to the endpoints.
+// All requests of a DeviceAuthFlow (e.g. fetching the device code and polling) share a pool of connections,
+// so Reused is Requests - 1 on a stable network.
+type ConnectionStats struct {
+	// Requests is the number of requests which got a connection.
+	Requests int
+	// Reused is the number of requests which reused an idle connection without a new handshake.
+	Reused int
+}
+
+// connectionCounter counts connections got by requests. It is updated atomically,
+// and allocated separately so that its fields are 64-bit aligned on 32-bit platforms.
+type connectionCounter struct {
+	requests int64
+	reused   int64
+}
+
+// ConnectionStats returns ConnectionStats of requests since daf was created.
+func (daf *DeviceAuthFlow) ConnectionStats() ConnectionStats {
+	return ConnectionStats{
+		Requests: int(atomic.LoadInt64(&daf.connections.requests)),
+		Reused:   int(atomic.LoadInt64(&daf.connections.reused)),
+	}
+}
+
+// traceConnection returns req which counts the connection it gets.
+func (daf *DeviceAuthFlow) traceConnection(req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			atomic.AddInt64(&daf.connections.requests, 1)
+			if info.Reused {
+				atomic.AddInt64(&daf.connections.reused, 1)
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
@@ -0,0 +1,221 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithDialContext", func() {
+	It("dials with the given function", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`))
+		}))
+		defer ts.Close()
+
+		dialed := make([]string, 0)
+		dialer := new(net.Dialer)
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL("http://tenant.example.com"),
+			auth.WithClientID("clientID"),
+			auth.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = append(dialed, addr)
+				return dialer.DialContext(ctx, network, ts.Listener.Addr().String())
+			}),
+		)
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.UserCode).To(Equal("123456"))
+		Expect(dialed).To(Equal([]string{"tenant.example.com:80"}))
+	})
+})
+
+var _ = Describe("WithMinTLSVersion", func() {
+	It("refuses servers not supporting the minimum version", func() {
+		// Arrange
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`))
+		}))
+		ts.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+		ts.StartTLS()
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithMinTLSVersion(tls.VersionTLS13))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("protocol version")))
+	})
+
+	It("cannot allow versions older than TLS 1.2", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithMinTLSVersion(tls.VersionTLS11))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("WithRequestTimeout", func() {
+	It("aborts a hung request", func() {
+		// Arrange
+		block := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-block
+		}))
+		defer ts.Close()
+		defer close(block)
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithRequestTimeout(100*time.Millisecond))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PollToken(&auth.DeviceCodeResponse{DeviceCode: "device_code", ExpiresIn: 20, Interval: 5, ExpiresAt: time.Now().Add(20 * time.Second)})
+
+		// Assert
+		var networkErr *auth.NetworkError
+		Expect(errors.As(err, &networkErr)).To(BeTrue())
+		Expect(networkErr.Timeout()).To(BeTrue())
+		Expect(auth.Retryable(err)).To(BeTrue())
+	})
+
+	It("rejects negative durations", func() {
+		// Act
+		_, err := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"), auth.WithRequestTimeout(-time.Second))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("WithHTTPClient", func() {
+	It("sends requests with the client", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`))
+		}))
+		defer ts.Close()
+
+		var roundTrips int64
+		client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			atomic.AddInt64(&roundTrips, 1)
+			return http.DefaultTransport.RoundTrip(req)
+		})}
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithHTTPClient{Client: client})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.UserCode).To(Equal("123456"))
+		Expect(atomic.LoadInt64(&roundTrips)).To(Equal(int64(1)))
+	})
+
+	It("keeps refusing redirects", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://other.example.com/oauth/device/code", http.StatusTemporaryRedirect)
+		}))
+		defer ts.Close()
+
+		client := &http.Client{Timeout: time.Second}
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithHTTPClient{Client: client})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var redirectErr *auth.RedirectError
+		Expect(errors.As(err, &redirectErr)).To(BeTrue())
+		Expect(client.CheckRedirect).To(BeNil())
+	})
+
+	DescribeTable("rejects invalid options",
+		func(opts ...auth.DeviceAuthFlowOption) {
+			// Arrange
+			opts = append(opts, auth.WithBaseURL("https://example.com"), auth.WithClientID("clientID"))
+
+			// Act
+			_, err := auth.NewDeviceAuthFlow(opts...)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("nil client", auth.WithHTTPClient{}),
+		Entry("with WithMinTLSVersion", auth.WithHTTPClient{Client: new(http.Client)}, auth.WithMinTLSVersion(tls.VersionTLS13)),
+		Entry("with WithSOCKS5Proxy", auth.WithSOCKS5Proxy("localhost:1080"), auth.WithHTTPClient{Client: new(http.Client)}),
+	)
+})
+
+// roundTripperFunc is http.RoundTripper of a function.
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("ConnectionStats", func() {
+	// newCountingServer returns a server counting new connections, which responds with bodies in order.
+	newCountingServer := func(bodies ...string) (*httptest.Server, *int64) {
+		var conns int64
+		ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body := bodies[0]
+			bodies = bodies[1:]
+			if strings.Contains(body, "authorization_pending") {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+			w.Write([]byte(body))
+		}))
+		ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddInt64(&conns, 1)
+			}
+		}
+		ts.Start()
+		return ts, &conns
+	}
+
+	It("reuses the connection of fetching the device code for polling", func() {
+		// Arrange
+		ts, conns := newCountingServer(
+			`{"device_code": "device_code", "user_code": "123456", "expires_in": 20, "interval": 5}`,
+			`{"error": "authorization_pending", "error_description": "User has yet to authorize device code."}`,
+			`{"error": "authorization_pending", "error_description": "User has yet to authorize device code."}`,
+			`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+		)
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithTimeSleep(func(time.Duration) {}))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.Authorize("openid", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(daf.ConnectionStats()).To(Equal(auth.ConnectionStats{Requests: 4, Reused: 3}))
+		Expect(atomic.LoadInt64(conns)).To(Equal(int64(1)))
+	})
+})
@@ -0,0 +1,138 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// UserInfo represents the response of the userinfo endpoint, which has standard claims of the user.
+// Claims are empty if the scope to release them (profile, email or phone) was not requested.
+// In addition, it has Extra which holds claims not modeled here (e.g. custom claims, address and updated_at),
+// and RawBody which is the response body as it is when WithRawResponseBody is given.
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+type UserInfo struct {
+	Subject             string                     `json:"sub"`
+	Name                string                     `json:"name,omitempty"`
+	GivenName           string                     `json:"given_name,omitempty"`
+	FamilyName          string                     `json:"family_name,omitempty"`
+	MiddleName          string                     `json:"middle_name,omitempty"`
+	Nickname            string                     `json:"nickname,omitempty"`
+	PreferredUsername   string                     `json:"preferred_username,omitempty"`
+	Profile             string                     `json:"profile,omitempty"`
+	Picture             string                     `json:"picture,omitempty"`
+	Website             string                     `json:"website,omitempty"`
+	Email               string                     `json:"email,omitempty"`
+	EmailVerified       bool                       `json:"email_verified,omitempty"`
+	Gender              string                     `json:"gender,omitempty"`
+	Birthdate           string                     `json:"birthdate,omitempty"`
+	Zoneinfo            string                     `json:"zoneinfo,omitempty"`
+	Locale              string                     `json:"locale,omitempty"`
+	PhoneNumber         string                     `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool                       `json:"phone_number_verified,omitempty"`
+	Extra               map[string]json.RawMessage `json:"-"`
+	RawBody             []byte                     `json:"-"`
+}
+
+func (u *UserInfo) UnmarshalJSON(b []byte) error {
+	type plain UserInfo
+	if err := json.Unmarshal(b, (*plain)(u)); err != nil {
+		return err
+	}
+
+	extra, err := extraFields(b, u)
+	u.Extra = extra
+	return err
+}
+
+// FetchUserInfo requests the userinfo endpoint with the access token and returns claims of the user who logged in.
+// The access token must be issued for the userinfo endpoint (e.g. with openid scope).
+//
+// APIError is returned when the token is rejected (e.g. invalid_token for expired tokens).
+//
+// See: https://openid.net/specs/openid-connect-core-1_0.html#UserInfo
+func (daf *DeviceAuthFlow) FetchUserInfo(accessToken string) (*UserInfo, error) {
+	return daf.FetchUserInfoContext(context.Background(), accessToken)
+}
+
+// FetchUserInfoContext is like FetchUserInfo, but the request is canceled when ctx is done.
+func (daf *DeviceAuthFlow) FetchUserInfoContext(ctx context.Context, accessToken string) (*UserInfo, error) {
+	if _, ok := RequestInfoFromContext(ctx); !ok {
+		ctx = contextWithRequestInfo(ctx, daf.flowIDFromContext(ctx), 1)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", daf.discoveredOr(daf.endpoints.UserinfoEndpoint, "/userinfo"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	setAcceptEncoding(req)
+	daf.setHeaders(req)
+
+	statusCode, header, resBody, err := daf.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusCode != 200 {
+		if statusCode/100 == 4 {
+			if er := bearerError(header); er != nil {
+				return nil, &APIError{StatusCode: statusCode, Body: er, RawBody: daf.redact(daf.rawBody(resBody))}
+			}
+			return nil, daf.apiError("userinfo", statusCode, header, resBody)
+		}
+		return nil, &ServerError{Request: "userinfo", StatusCode: statusCode, Body: daf.redact(resBody)}
+	}
+
+	u := new(UserInfo)
+	if err := daf.decodeResponse(resBody, u); err != nil {
+		return nil, fmt.Errorf("could not decode userinfo response body: %w", err)
+	}
+	u.RawBody = daf.rawBody(resBody)
+
+	return u, nil
+}
+
+var bearerParamPattern = regexp.MustCompile(`([a-z_]+)="([^"]*)"`)
+
+// bearerError returns the error in WWW-Authenticate header of the response, which may not have the body.
+// It returns nil if the header has no error.
+//
+// See: https://www.rfc-editor.org/rfc/rfc6750#section-3
+func bearerError(header http.Header) *ErrorResponse {
+	challenge := header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil
+	}
+
+	er := new(ErrorResponse)
+	for _, m := range bearerParamPattern.FindAllStringSubmatch(challenge, -1) {
+		switch m[1] {
+		case "error":
+			er.Error = m[2]
+		case "error_description":
+			er.ErrorDescription = m[2]
+		}
+	}
+	if er.Error == "" {
+		return nil
+	}
+	return er
+}
@@ -0,0 +1,130 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FetchUserInfo", func() {
+	clientID := "clientID"
+
+	// newUserInfoServer returns a server which responds to requests with the access token at path.
+	newUserInfoServer := func(path string, statusCode int, header map[string]string, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal("GET"))
+			Expect(r.URL.Path).To(Equal(path))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer access_token"))
+			for k, v := range header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(statusCode)
+			fmt.Fprint(w, body)
+		}))
+	}
+
+	It("returns claims of the user", func() {
+		// Arrange
+		ts := newUserInfoServer("/userinfo", 200, nil, `{
+			"sub": "auth0|alice",
+			"name": "Alice",
+			"nickname": "alice",
+			"picture": "https://example.com/alice.png",
+			"email": "alice@example.com",
+			"email_verified": true,
+			"updated_at": "2022-01-01T00:00:00.000Z",
+			"https://example.com/roles": ["admin"]
+		}`)
+		defer ts.Close()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+
+		// Act
+		u, err := daf.FetchUserInfo("access_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Subject).To(Equal("auth0|alice"))
+		Expect(u.Name).To(Equal("Alice"))
+		Expect(u.Nickname).To(Equal("alice"))
+		Expect(u.Picture).To(Equal("https://example.com/alice.png"))
+		Expect(u.Email).To(Equal("alice@example.com"))
+		Expect(u.EmailVerified).To(BeTrue())
+		Expect(u.Extra).To(Equal(map[string]json.RawMessage{
+			"updated_at":                json.RawMessage(`"2022-01-01T00:00:00.000Z"`),
+			"https://example.com/roles": json.RawMessage(`["admin"]`),
+		}))
+	})
+
+	It("requests the userinfo endpoint of the discovery metadata", func() {
+		// Arrange
+		ts := newUserInfoServer("/custom/userinfo", 200, nil, `{"sub": "auth0|alice"}`)
+		defer ts.Close()
+		daf, _ := auth.NewDeviceAuthFlow(
+			auth.WithClientID(clientID),
+			&auth.Endpoints{Issuer: ts.URL + "/", TokenEndpoint: ts.URL + "/oauth/token", UserinfoEndpoint: ts.URL + "/custom/userinfo"},
+		)
+
+		// Act
+		u, err := daf.FetchUserInfo("access_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(u.Subject).To(Equal("auth0|alice"))
+	})
+
+	It("returns APIError with the error of WWW-Authenticate header", func() {
+		// Arrange
+		ts := newUserInfoServer("/userinfo", 401, map[string]string{
+			"WWW-Authenticate": `Bearer realm="example", error="invalid_token", error_description="The access token expired"`,
+		}, ``)
+		defer ts.Close()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+
+		// Act
+		_, err := daf.FetchUserInfo("access_token")
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(401))
+		Expect(apiErr.Body).To(Equal(&auth.ErrorResponse{Error: "invalid_token", ErrorDescription: "The access token expired"}))
+	})
+
+	It("returns APIError with the error of the body", func() {
+		// Arrange
+		ts := newUserInfoServer("/userinfo", 403, nil, `{"error": "insufficient_scope", "error_description": "openid scope is required"}`)
+		defer ts.Close()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+
+		// Act
+		_, err := daf.FetchUserInfo("access_token")
+
+		// Assert
+		var apiErr *auth.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.Body.Error).To(Equal("insufficient_scope"))
+	})
+
+	It("returns ServerError for 5xx", func() {
+		// Arrange
+		ts := newUserInfoServer("/userinfo", 503, nil, `unavailable`)
+		defer ts.Close()
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID(clientID))
+
+		// Act
+		_, err := daf.FetchUserInfo("access_token")
+
+		// Assert
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(serverErr.Request).To(Equal("userinfo"))
+	})
+})
@@ -0,0 +1,112 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// WithResponseValidator registers hooks to validate decoded responses before they are returned.
+// An error returned by a hook is returned as it is instead of the response.
+// It can be given multiple times, and hooks are called in the order. Nil hooks are skipped.
+type WithResponseValidator struct {
+	// DeviceCode validates responses of device code endpoint.
+	DeviceCode func(dc *DeviceCodeResponse) error
+	// Token validates responses of token endpoint.
+	Token func(t *TokenResponse) error
+	// DeviceCodeContext is like DeviceCode, but takes the context of the request with RequestInfo.
+	DeviceCodeContext func(ctx context.Context, dc *DeviceCodeResponse) error
+	// TokenContext is like Token, but takes the context of the request with RequestInfo.
+	TokenContext func(ctx context.Context, t *TokenResponse) error
+}
+
+func (v WithResponseValidator) apply(daf *DeviceAuthFlow) error {
+	daf.validators = append(daf.validators, v)
+	return nil
+}
+
+func (daf *DeviceAuthFlow) validateDeviceCode(ctx context.Context, dc *DeviceCodeResponse) error {
+	for _, v := range daf.validators {
+		if v.DeviceCode != nil {
+			if err := v.DeviceCode(dc); err != nil {
+				return err
+			}
+		}
+		if v.DeviceCodeContext != nil {
+			if err := v.DeviceCodeContext(ctx, dc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (daf *DeviceAuthFlow) validateToken(ctx context.Context, t *TokenResponse) error {
+	for _, v := range daf.validators {
+		if v.Token != nil {
+			if err := v.Token(t); err != nil {
+				return err
+			}
+		}
+		if v.TokenContext != nil {
+			if err := v.TokenContext(ctx, t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// VerificationURIError is returned by the hook of ValidateVerificationURIHost.
+type VerificationURIError struct {
+	URI string
+}
+
+func (e *VerificationURIError) Error() string {
+	return fmt.Sprintf("verification URI %s is not on the expected hosts", e.URI)
+}
+
+// ValidateVerificationURIHost returns a hook for WithResponseValidator which rejects device codes
+// whose verification URIs are not on hosts, e.g. to prevent users from being led to phishing sites.
+func ValidateVerificationURIHost(hosts ...string) func(dc *DeviceCodeResponse) error {
+	return func(dc *DeviceCodeResponse) error {
+		for _, uri := range []string{dc.VerificationURI, dc.VerificationURIComplete} {
+			if uri == "" {
+				continue
+			}
+			if !isOnHosts(uri, hosts) {
+				return &VerificationURIError{URI: uri}
+			}
+		}
+		return nil
+	}
+}
+
+func isOnHosts(uri string, hosts []string) bool {
+	u, err := neturl.Parse(uri)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+
+	for _, host := range hosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+	return false
+}
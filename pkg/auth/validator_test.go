@@ -0,0 +1,105 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WithResponseValidator", func() {
+	newServer := func(body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("content-type", "application/json")
+			w.Write([]byte(body))
+		}))
+	}
+
+	It("rejects device codes with the error of the hook", func() {
+		// Arrange
+		ts := newServer(`{"device_code": "device_code", "user_code": "ABCD-EFGH", "verification_uri": "https://evil.example.com/activate", "expires_in": 900, "interval": 5}`)
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithResponseValidator{Token: func(t *auth.TokenResponse) error { return nil }},
+			auth.WithResponseValidator{DeviceCode: auth.ValidateVerificationURIHost("example.us.auth0.com")},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		var uriErr *auth.VerificationURIError
+		Expect(errors.As(err, &uriErr)).To(BeTrue())
+		Expect(uriErr.URI).To(Equal("https://evil.example.com/activate"))
+	})
+
+	It("accepts device codes on the expected hosts", func() {
+		// Arrange
+		ts := newServer(`{"device_code": "device_code", "user_code": "ABCD-EFGH", "verification_uri": "https://Example.us.auth0.com/activate", "verification_uri_complete": "https://example.us.auth0.com/activate?user_code=ABCD-EFGH", "expires_in": 900, "interval": 5}`)
+		defer ts.Close()
+
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithResponseValidator{DeviceCode: auth.ValidateVerificationURIHost("example.us.auth0.com")},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		dc, err := daf.FetchDeviceCode("openid", "https://example.com/api")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dc.UserCode).To(Equal("ABCD-EFGH"))
+	})
+
+	It("rejects tokens with the error of the hook", func() {
+		// Arrange
+		ts := newServer(`{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`)
+		defer ts.Close()
+
+		rejected := errors.New("rejected")
+		var validated *auth.TokenResponse
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithResponseValidator{Token: func(t *auth.TokenResponse) error {
+				validated = t
+				return rejected
+			}},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).To(MatchError(rejected))
+		Expect(token).To(BeNil())
+		Expect(validated.AccessToken).To(Equal("access_token"))
+	})
+})
+
+var _ = Describe("ValidateVerificationURIHost", func() {
+	DescribeTable("validates verification URIs",
+		func(uri string, expected bool) {
+			// Act
+			err := auth.ValidateVerificationURIHost("example.us.auth0.com")(&auth.DeviceCodeResponse{VerificationURI: uri})
+
+			// Assert
+			Expect(err == nil).To(Equal(expected))
+		},
+		Entry("expected host", "https://example.us.auth0.com/activate", true),
+		Entry("other host", "https://example.us.auth0.com.evil.example/activate", false),
+		Entry("plain HTTP", "http://example.us.auth0.com/activate", false),
+		Entry("user info", "https://example.us.auth0.com@evil.example/activate", false),
+	)
+})
@@ -0,0 +1,75 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import "encoding/json"
+
+// WithZeroizeBuffers wipes buffers of response bodies containing device codes or tokens after decoding them,
+// for environments with memory dump concerns.
+//
+// It is best-effort because Go strings cannot be wiped. Call Destroy of responses to drop them as soon as possible.
+// Response bodies kept by WithRawResponseBody are not wiped.
+type WithZeroizeBuffers bool
+
+func (zeroizeBuffers WithZeroizeBuffers) apply(daf *DeviceAuthFlow) error {
+	daf.zeroizeBuffers = bool(zeroizeBuffers)
+	return nil
+}
+
+func (daf *DeviceAuthFlow) zeroize(b []byte) {
+	if daf.zeroizeBuffers && !daf.keepRawBody {
+		zeroize(b)
+	}
+}
+
+// Destroy wipes RawBody and Extra, and drops references to the secrets.
+func (dc *DeviceCodeResponse) Destroy() {
+	zeroize(dc.RawBody)
+	zeroizeExtra(dc.Extra)
+	*dc = DeviceCodeResponse{}
+}
+
+// Destroy wipes RawBody and Extra, and drops references to the tokens.
+func (t *TokenResponse) Destroy() {
+	zeroize(t.RawBody)
+	zeroizeExtra(t.Extra)
+	*t = TokenResponse{}
+}
+
+// Destroy stops the background worker and destroys the cached token.
+// Tokens returned by Get and Refresh are copies, so the callers have to destroy them.
+func (s *CachedTokenSource) Destroy() {
+	s.Stop()
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token.Destroy()
+	s.expiresAt = s.issuedAt
+}
+
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func zeroizeExtra(extra map[string]json.RawMessage) {
+	for _, v := range extra {
+		zeroize(v)
+	}
+}
@@ -0,0 +1,117 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Zeroization", func() {
+	clientID := "clientID"
+	expectedForm := map[string][]string{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {clientID},
+		"refresh_token": {"refresh_token"},
+	}
+
+	It("returns token with WithZeroizeBuffers", func() {
+		// Arrange
+		ms := newMockServer([]requestExpectation{
+			{
+				path:         "/oauth/token",
+				form:         expectedForm,
+				statusCode:   200,
+				responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400}`,
+			},
+		})
+		defer ms.Close()
+
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithZeroizeBuffers(true))
+
+		// Act
+		actual, err := daf.ExchangeRefreshToken("refresh_token")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual).To(Equal(&auth.TokenResponse{AccessToken: "access_token", TokenType: "Bearer", ExpiresIn: 86400}))
+		Expect(ms.restExpects()).To(BeEmpty())
+	})
+
+	Describe("TokenResponse.Destroy()", func() {
+		It("wipes the raw body and drops the tokens", func() {
+			// Arrange
+			ms := newMockServer([]requestExpectation{
+				{
+					path:         "/oauth/token",
+					form:         expectedForm,
+					statusCode:   200,
+					responseBody: `{"access_token": "access_token", "token_type": "Bearer", "expires_in": 86400, "scope": "openid"}`,
+				},
+			})
+			defer ms.Close()
+
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ms.URL), auth.WithClientID(clientID), auth.WithRawResponseBody(true))
+			token, _ := daf.ExchangeRefreshToken("refresh_token")
+			raw := token.RawBody
+			scope := token.Extra["scope"]
+
+			// Act
+			token.Destroy()
+
+			// Assert
+			Expect(token).To(Equal(&auth.TokenResponse{}))
+			Expect(raw).To(Equal(make([]byte, len(raw))))
+			Expect([]byte(scope)).To(Equal(make([]byte, len(scope))))
+		})
+	})
+
+	Describe("CachedTokenSource.Destroy()", func() {
+		It("destroys the cached token", func() {
+			// Arrange
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			token := &auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", ExpiresIn: 86400}
+			s := daf.NewCachedTokenSource(token, time.Minute)
+			s.Start()
+
+			// Act
+			s.Destroy()
+
+			// Assert
+			Expect(token).To(Equal(&auth.TokenResponse{}))
+			_, err := s.Get()
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("does not destroy the token returned by Get()", func() {
+			// Arrange
+			daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL("https://example.com"), auth.WithClientID(clientID))
+			token := &auth.TokenResponse{
+				AccessToken:  "access_token",
+				RefreshToken: "refresh_token",
+				ExpiresIn:    86400,
+				Extra:        map[string]json.RawMessage{"scope": json.RawMessage(`"openid"`)},
+				RawBody:      []byte(`{"access_token": "access_token"}`),
+			}
+			s := daf.NewCachedTokenSource(token, time.Minute)
+			got, err := s.Get()
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			s.Destroy()
+
+			// Assert
+			Expect(got).To(Equal(&auth.TokenResponse{
+				AccessToken:  "access_token",
+				RefreshToken: "refresh_token",
+				ExpiresIn:    86400,
+				Extra:        map[string]json.RawMessage{"scope": json.RawMessage(`"openid"`)},
+				RawBody:      []byte(`{"access_token": "access_token"}`),
+			}))
+			Expect(token).To(Equal(&auth.TokenResponse{}))
+		})
+	})
+})
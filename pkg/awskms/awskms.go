@@ -0,0 +1,317 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package awskms provides crypto.Signer backed by asymmetric keys of AWS KMS.
+//
+// It is intended to be used with auth.WithClientAssertionSigner, so that confidential clients never have private keys on disk.
+// Requests are signed and credentials are retrieved by the AWS SDK, and the two actions of the KMS API are called directly.
+// It is a separate module, so that the main module does not carry the AWS SDK for users who do not need it.
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// Signer implements crypto.Signer with an asymmetric key of AWS KMS.
+type Signer struct {
+	keyID       string
+	region      string
+	endpoint    string
+	credentials aws.CredentialsProvider
+	client      aws.HTTPClient
+	signer      *v4.Signer
+	timeNow     func() time.Time
+	public      crypto.PublicKey
+}
+
+// defaultTimeout is the timeout of requests to KMS and credential endpoints unless WithHTTPClient is given.
+const defaultTimeout = 10 * time.Second
+
+// APIError is returned when KMS API request is failed.
+type APIError struct {
+	StatusCode int
+	Type       string `json:"__type"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("KMS request was failed with status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+type SignerOption interface {
+	apply(s *Signer) error
+}
+
+// WithRegion specifies the region of the key. By default, the region of the AWS config (e.g. AWS_REGION) is used.
+type WithRegion string
+
+func (region WithRegion) apply(s *Signer) error {
+	s.region = string(region)
+	return nil
+}
+
+// WithEndpoint overrides the endpoint of KMS (e.g. VPC endpoints).
+type WithEndpoint string
+
+func (endpoint WithEndpoint) apply(s *Signer) error {
+	s.endpoint = string(endpoint)
+	return nil
+}
+
+// WithCredentials specifies static credentials.
+//
+// By default, credentials are retrieved by the default credential chain of the AWS SDK:
+// environment variables, the shared config and credentials files, the web identity of AWS_WEB_IDENTITY_TOKEN_FILE,
+// the container credentials endpoint of ECS, and the instance profile of EC2.
+// Temporary credentials of roles are refreshed before they expire.
+type WithCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func (c WithCredentials) apply(s *Signer) error {
+	s.credentials = credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)
+	return nil
+}
+
+// WithCredentialsProvider retrieves credentials with the provider of the AWS SDK, e.g. Credentials of aws.Config.
+// Credentials are cached until they expire.
+type WithCredentialsProvider struct {
+	Provider aws.CredentialsProvider
+}
+
+func (o WithCredentialsProvider) apply(s *Signer) error {
+	if o.Provider == nil {
+		return errors.New("Provider of WithCredentialsProvider is nil")
+	}
+
+	s.credentials = o.Provider
+	return nil
+}
+
+// WithHTTPClient sends requests to KMS and credential endpoints with the client.
+// By default, a client of the AWS SDK with 10 seconds timeout is used.
+// AWS_CA_BUNDLE cannot be applied to the given client, so configure its root CAs instead.
+type WithHTTPClient struct {
+	Client *http.Client
+}
+
+func (o WithHTTPClient) apply(s *Signer) error {
+	if o.Client == nil {
+		return errors.New("Client of WithHTTPClient is nil")
+	}
+
+	s.client = o.Client
+	return nil
+}
+
+type WithTimeNow func() time.Time
+
+func (timeNow WithTimeNow) apply(s *Signer) error {
+	s.timeNow = timeNow
+	return nil
+}
+
+// NewSigner returns new instance of Signer for the key specified by keyID (key ID, key ARN, alias name or alias ARN).
+//
+// It fetches the public key of the key, so the caller needs kms:GetPublicKey permission in addition to kms:Sign.
+func NewSigner(ctx context.Context, keyID string, opts ...SignerOption) (*Signer, error) {
+	s := &Signer{
+		keyID:   keyID,
+		signer:  v4.NewSigner(),
+		timeNow: time.Now,
+	}
+
+	// apply options
+	for _, opt := range opts {
+		if err := opt.apply(s); err != nil {
+			return nil, err
+		}
+	}
+
+	// complete instance
+	if s.client == nil {
+		// the client of the AWS SDK, which also supports AWS_CA_BUNDLE
+		s.client = awshttp.NewBuildableClient().WithTimeout(defaultTimeout)
+	}
+
+	configOpts := []func(*config.LoadOptions) error{config.WithHTTPClient(s.client)}
+	if s.region != "" {
+		configOpts = append(configOpts, config.WithRegion(s.region))
+	}
+	if s.credentials != nil {
+		configOpts = append(configOpts, config.WithCredentialsProvider(s.credentials))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, configOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not load AWS config: %w", err)
+	}
+
+	if cfg.Region == "" {
+		return nil, errors.New("region is not given, use WithRegion() or AWS_REGION")
+	}
+	s.region = cfg.Region
+	// the config wraps credentials with aws.CredentialsCache
+	s.credentials = cfg.Credentials
+
+	if s.endpoint == "" {
+		s.endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", s.region)
+	}
+
+	res := new(struct {
+		PublicKey []byte `json:"PublicKey"`
+	})
+	if err := s.call(ctx, "GetPublicKey", map[string]interface{}{"KeyId": keyID}, res); err != nil {
+		return nil, err
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(res.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key: %w", err)
+	}
+	s.public = pub
+
+	return s, nil
+}
+
+// Public returns the public key of the KMS key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs digest with the KMS key.
+//
+// For ECDSA keys, the signature is ASN.1 DER encoded as crypto/ecdsa does.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.SignContext(context.Background(), rand, digest, opts)
+}
+
+// SignContext is like Sign, but the request to KMS is canceled when ctx is done.
+//
+// auth.WithClientAssertionSigner signs with the context of the request by this method.
+func (s *Signer) SignContext(ctx context.Context, _ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	alg, err := s.signingAlgorithm(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := new(struct {
+		Signature []byte `json:"Signature"`
+	})
+	req := map[string]interface{}{
+		"KeyId":            s.keyID,
+		"Message":          digest,
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": alg,
+	}
+	if err := s.call(ctx, "Sign", req, res); err != nil {
+		return nil, err
+	}
+
+	return res.Signature, nil
+}
+
+func (s *Signer) signingAlgorithm(opts crypto.SignerOpts) (string, error) {
+	var bits string
+	switch opts.HashFunc() {
+	case crypto.SHA256:
+		bits = "256"
+	case crypto.SHA384:
+		bits = "384"
+	case crypto.SHA512:
+		bits = "512"
+	default:
+		return "", fmt.Errorf("unsupported hash function: %s", opts.HashFunc())
+	}
+
+	switch s.public.(type) {
+	case *rsa.PublicKey:
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			return "RSASSA_PSS_SHA_" + bits, nil
+		}
+		return "RSASSA_PKCS1_V1_5_SHA_" + bits, nil
+	case *ecdsa.PublicKey:
+		return "ECDSA_SHA_" + bits, nil
+	default:
+		return "", fmt.Errorf("unsupported key type: %T", s.public)
+	}
+}
+
+// call invokes the action of KMS API with the request signed by Signature Version 4.
+func (s *Signer) call(ctx context.Context, action string, reqBody interface{}, resBody interface{}) error {
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return fmt.Errorf("could not encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint+"/", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("content-type", "application/x-amz-json-1.1")
+	req.Header.Set("x-amz-target", "TrentService."+action)
+	credentials, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("could not retrieve credentials: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	if err := s.signer.SignHTTP(ctx, credentials, req, hex.EncodeToString(sum[:]), "kms", s.region, s.timeNow()); err != nil {
+		return fmt.Errorf("could not sign request: %w", err)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request was failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response body: %w", err)
+	}
+
+	if res.StatusCode != 200 {
+		apiErr := &APIError{StatusCode: res.StatusCode}
+		if err := json.Unmarshal(body, apiErr); err != nil {
+			apiErr.Message = string(body)
+		}
+		return apiErr
+	}
+
+	if err := json.Unmarshal(body, resBody); err != nil {
+		return fmt.Errorf("could not decode response body: %w", err)
+	}
+
+	return nil
+}
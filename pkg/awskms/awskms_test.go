@@ -0,0 +1,280 @@
+package awskms_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/awskms"
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signer", func() {
+	keyID := "alias/a0daf"
+	credentials := awskms.WithCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}
+	stubTime, _ := time.Parse(time.RFC3339, "2022-08-29T10:00:00Z")
+
+	var key *rsa.PrivateKey
+	var ts *httptest.Server
+	var authorizations []string
+	var securityTokens []string
+
+	BeforeEach(func() {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).NotTo(HaveOccurred())
+		authorizations = make([]string, 0)
+		securityTokens = make([]string, 0)
+		// CA bundles cannot be applied to the client given by WithHTTPClient
+		setenv("AWS_CA_BUNDLE", "")
+
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			authorizations = append(authorizations, r.Header.Get("authorization"))
+			if token := r.Header.Get("x-amz-security-token"); token != "" {
+				securityTokens = append(securityTokens, token)
+			}
+			Expect(r.Header.Get("x-amz-date")).To(Equal("20220829T100000Z"))
+
+			var req map[string]interface{}
+			Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+			Expect(req).To(HaveKeyWithValue("KeyId", keyID))
+
+			switch r.Header.Get("x-amz-target") {
+			case "TrentService.GetPublicKey":
+				der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+				json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": keyID, "PublicKey": der})
+			case "TrentService.Sign":
+				Expect(req).To(HaveKeyWithValue("MessageType", "DIGEST"))
+				Expect(req).To(HaveKeyWithValue("SigningAlgorithm", "RSASSA_PKCS1_V1_5_SHA_256"))
+				var body struct{ Message []byte }
+				b, _ := json.Marshal(req)
+				json.Unmarshal(b, &body)
+				sig, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, body.Message)
+				json.NewEncoder(w).Encode(map[string]interface{}{"KeyId": keyID, "Signature": sig})
+			default:
+				w.WriteHeader(400)
+				w.Write([]byte(`{"__type": "UnknownOperationException", "message": "unknown"}`))
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	It("signs digest with the KMS key", func() {
+		// Arrange
+		signer, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithEndpoint(ts.URL),
+			credentials,
+			awskms.WithTimeNow(func() time.Time { return stubTime }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		digest := sha256.Sum256([]byte("message"))
+
+		// Act
+		sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(signer.Public()).To(Equal(&key.PublicKey))
+		Expect(rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig)).To(Succeed())
+		Expect(authorizations).To(HaveLen(2))
+		for _, a := range authorizations {
+			Expect(a).To(HavePrefix("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20220829/us-east-1/kms/aws4_request, "))
+		}
+	})
+
+	It("returns error when region is not given", func() {
+		// Act
+		_, err := awskms.NewSigner(context.Background(), keyID, awskms.WithRegion(""), awskms.WithEndpoint(ts.URL), credentials)
+
+		// Assert
+		Expect(err).To(MatchError("region is not given, use WithRegion() or AWS_REGION"))
+	})
+
+	It("signs requests with Signature Version 4", func() {
+		// Arrange
+		var req *http.Request
+		var body []byte
+		client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			req = r
+			body, _ = io.ReadAll(r.Body)
+			der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+			b, _ := json.Marshal(map[string]interface{}{"KeyId": keyID, "PublicKey": der})
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(string(b))), Header: make(http.Header)}, nil
+		})}
+
+		// Act
+		_, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithHTTPClient{Client: client},
+			credentials,
+			awskms.WithTimeNow(func() time.Time { return stubTime }),
+		)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(req.URL.String()).To(Equal("https://kms.us-east-1.amazonaws.com/"))
+		Expect(string(body)).To(Equal(`{"KeyId":"alias/a0daf"}`))
+		// known answer of the canonical request:
+		// POST / (empty query) with content-length:23, content-type:application/x-amz-json-1.1, host:kms.us-east-1.amazonaws.com,
+		// x-amz-date:20220829T100000Z and x-amz-target:TrentService.GetPublicKey, signed by the secret key "secret"
+		Expect(req.Header.Get("authorization")).To(Equal("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20220829/us-east-1/kms/aws4_request, " +
+			"SignedHeaders=content-length;content-type;host;x-amz-date;x-amz-target, " +
+			"Signature=fe22dc666bd7a1c240924a6695e96edc9c7e8787687e0a8fe7cbe350f9a3a6f1"))
+	})
+
+	It("caches credentials of the provider until they expire", func() {
+		// Arrange
+		retrievals := 0
+		provider := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			retrievals++
+			return aws.Credentials{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "session", CanExpire: true, Expires: time.Now().Add(time.Hour)}, nil
+		})
+		signer, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithEndpoint(ts.URL),
+			awskms.WithCredentialsProvider{Provider: provider},
+			awskms.WithTimeNow(func() time.Time { return stubTime }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		digest := sha256.Sum256([]byte("message"))
+
+		// Act
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievals).To(Equal(1))
+		Expect(securityTokens).To(Equal([]string{"session", "session"}))
+	})
+
+	It("retrieves credentials of the provider again after they expire", func() {
+		// Arrange
+		retrievals := 0
+		provider := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			retrievals++
+			return aws.Credentials{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "session", CanExpire: true, Expires: time.Now().Add(-time.Minute)}, nil
+		})
+		signer, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithEndpoint(ts.URL),
+			awskms.WithCredentialsProvider{Provider: provider},
+			awskms.WithTimeNow(func() time.Time { return stubTime }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		digest := sha256.Sum256([]byte("message"))
+
+		// Act
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retrievals).To(Equal(2))
+	})
+
+	It("retrieves credentials from the container credentials endpoint", func() {
+		// Arrange
+		cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Header.Get("authorization")).To(Equal("container-token"))
+			w.Write([]byte(`{"AccessKeyId": "ASIAEXAMPLE", "SecretAccessKey": "secret", "Token": "session", "Expiration": "2022-08-29T11:00:00Z"}`))
+		}))
+		defer cs.Close()
+		setenv("AWS_ACCESS_KEY_ID", "")
+		setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+		setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+		setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", cs.URL+"/credentials")
+		setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "container-token")
+
+		signer, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithEndpoint(ts.URL),
+			awskms.WithTimeNow(func() time.Time { return stubTime }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		digest := sha256.Sum256([]byte("message"))
+
+		// Act
+		_, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authorizations[0]).To(HavePrefix("AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/20220829/us-east-1/kms/aws4_request, "))
+		Expect(securityTokens).To(Equal([]string{"session", "session"}))
+	})
+
+	It("rejects the container credentials endpoint on other hosts than loopback", func() {
+		// Arrange
+		setenv("AWS_ACCESS_KEY_ID", "")
+		setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+		setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+		setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "http://192.0.2.1/credentials")
+		setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "container-token")
+
+		// Act
+		_, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithEndpoint(ts.URL),
+		)
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("only loopback hosts are allowed")))
+		Expect(authorizations).To(BeEmpty())
+	})
+
+	It("returns error when ctx is done while signing", func() {
+		// Arrange
+		signer, err := awskms.NewSigner(context.Background(), keyID,
+			awskms.WithRegion("us-east-1"),
+			awskms.WithEndpoint(ts.URL),
+			credentials,
+			awskms.WithTimeNow(func() time.Time { return stubTime }),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		digest := sha256.Sum256([]byte("message"))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Act
+		_, err = signer.SignContext(ctx, rand.Reader, digest[:], crypto.SHA256)
+
+		// Assert
+		Expect(err).To(MatchError(context.Canceled))
+	})
+})
+
+// setenv sets the environment variable during the spec.
+func setenv(key, value string) {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	DeferCleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
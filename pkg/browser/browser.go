@@ -0,0 +1,88 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package browser opens URLs in the default browser of the platform.
+package browser
+
+import (
+	"bytes"
+	"fmt"
+	neturl "net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/headless"
+)
+
+// Error is returned by Open when the browser cannot be opened.
+type Error struct {
+	URL     string
+	Command string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("cannot open %s: %s", e.URL, e.Err)
+	}
+	return fmt.Sprintf("cannot open %s with %s: %s", e.URL, e.Command, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Open opens url in the default browser.
+//
+// It uses open on macOS, rundll32 on Windows, wslview on WSL and xdg-open on other platforms.
+// Only http and https URLs can be opened.
+func Open(url string) error {
+	u, err := neturl.Parse(url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return &Error{URL: url, Err: fmt.Errorf("only http or https URL can be opened")}
+	}
+
+	args := command(url)
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return &Error{URL: url, Command: args[0], Err: err}
+	}
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(path, args[1:]...)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return &Error{URL: url, Command: args[0], Err: err}
+	}
+
+	return nil
+}
+
+func command(url string) []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open", url}
+	case "windows":
+		return []string{"rundll32", "url.dll,FileProtocolHandler", url}
+	}
+
+	if headless.Detect().WSL {
+		return []string{"wslview", url}
+	}
+	return []string{"xdg-open", url}
+}
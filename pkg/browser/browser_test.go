@@ -0,0 +1,39 @@
+package browser_test
+
+import (
+	"errors"
+	"os"
+
+	"github.com/autopp/go-a0daf/pkg/browser"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Open()", func() {
+	It("refuses URLs other than http or https", func() {
+		// Act
+		err := browser.Open("file:///etc/passwd")
+
+		// Assert
+		var browserError *browser.Error
+		Expect(errors.As(err, &browserError)).To(BeTrue())
+		Expect(browserError.URL).To(Equal("file:///etc/passwd"))
+		Expect(browserError.Command).To(BeEmpty())
+	})
+
+	It("returns Error when the command is not found", func() {
+		// Arrange
+		path := os.Getenv("PATH")
+		os.Setenv("PATH", "")
+		DeferCleanup(func() { os.Setenv("PATH", path) })
+
+		// Act
+		err := browser.Open("https://example.com/activate")
+
+		// Assert
+		var browserError *browser.Error
+		Expect(errors.As(err, &browserError)).To(BeTrue())
+		Expect(browserError.Command).NotTo(BeEmpty())
+	})
+})
@@ -0,0 +1,93 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clipboard copies text to the clipboard of the platform.
+package clipboard
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/headless"
+)
+
+// Error is returned by Copy when the text cannot be copied.
+type Error struct {
+	Command string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Command == "" {
+		return fmt.Sprintf("cannot copy to clipboard: %s", e.Err)
+	}
+	return fmt.Sprintf("cannot copy to clipboard with %s: %s", e.Command, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Copy copies text to the clipboard.
+//
+// It uses pbcopy on macOS, clip on Windows, clip.exe on WSL,
+// and wl-copy on Wayland or the first found of xclip and xsel on other platforms.
+func Copy(text string) error {
+	var args []string
+	for _, candidate := range commands() {
+		if _, err := exec.LookPath(candidate[0]); err == nil {
+			args = candidate
+			break
+		}
+	}
+	if args == nil {
+		return &Error{Err: errors.New("no clipboard command is found")}
+	}
+
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return &Error{Command: args[0], Err: err}
+	}
+
+	return nil
+}
+
+// commands returns candidates of the clipboard command in order of preference.
+func commands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	}
+
+	if headless.Detect().WSL {
+		return [][]string{{"clip.exe"}}
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		return [][]string{{"wl-copy"}}
+	}
+	return [][]string{{"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+}
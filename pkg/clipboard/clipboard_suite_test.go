@@ -0,0 +1,13 @@
+package clipboard_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestClipboard(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Clipboard Suite")
+}
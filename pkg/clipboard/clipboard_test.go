@@ -0,0 +1,60 @@
+package clipboard_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/autopp/go-a0daf/pkg/clipboard"
+	"github.com/autopp/go-a0daf/pkg/headless"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Copy()", func() {
+	setEnv := func(key, value string) {
+		old, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		DeferCleanup(func() {
+			if ok {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+
+	It("returns Error when no command is found", func() {
+		// Arrange
+		setEnv("PATH", "")
+
+		// Act
+		err := clipboard.Copy("ABCD-EFGH")
+
+		// Assert
+		var clipboardError *clipboard.Error
+		Expect(errors.As(err, &clipboardError)).To(BeTrue())
+		Expect(clipboardError.Command).To(BeEmpty())
+	})
+
+	It("writes the text to stdin of the first found command", func() {
+		// Arrange
+		if runtime.GOOS != "linux" || headless.Detect().WSL {
+			Skip("xclip and xsel are used only on Linux")
+		}
+		dir := GinkgoT().TempDir()
+		copied := filepath.Join(dir, "copied")
+		Expect(os.WriteFile(filepath.Join(dir, "xsel"), []byte("#!/bin/sh\n/bin/cat > "+copied+"\n"), 0o755)).To(Succeed())
+		setEnv("PATH", dir)
+		setEnv("WAYLAND_DISPLAY", "")
+
+		// Act
+		err := clipboard.Copy("ABCD-EFGH")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.ReadFile(copied)).To(Equal([]byte("ABCD-EFGH")))
+	})
+})
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/spf13/cobra"
+)
+
+// batchJob is a token acquisition in batch command.
+type batchJob struct {
+	// label identifies the job in progress lines and the output, which is the audience or the profile name.
+	label  string
+	config *config
+}
+
+// progress writes progress lines of concurrent jobs without interleaving.
+type progress struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *progress) printf(label string, format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "[%s] %s\n", label, fmt.Sprintf(format, args...))
+}
+
+func newBatchCommand(stdout, stderr io.Writer) *cobra.Command {
+	audienceFlag := "audience"
+	allFlag := "all"
+	parallelFlag := "parallel"
+	rateLimitFlag := "rate-limit"
+	completeFlag := "complete"
+	timeFormatFlag := "time-format"
+
+	cmd := &cobra.Command{
+		Use:   "batch",
+		Short: "acquire tokens for many audiences concurrently",
+		Long: `Acquire tokens for each audience given by --audience, or for each profile of the config file with --all.
+Codes are issued and polled concurrently, and progress of each audience is written to stderr.
+Tokens are written to stdout as a JSON object keyed by the audience (or the profile name).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			audiences, err := cmd.Flags().GetStringSlice(audienceFlag)
+			if err != nil {
+				return err
+			}
+
+			all, err := cmd.Flags().GetBool(allFlag)
+			if err != nil {
+				return err
+			}
+
+			parallel, err := cmd.Flags().GetInt(parallelFlag)
+			if err != nil {
+				return err
+			}
+
+			rateLimit, err := cmd.Flags().GetFloat64(rateLimitFlag)
+			if err != nil {
+				return err
+			}
+
+			complete, err := cmd.Flags().GetBool(completeFlag)
+			if err != nil {
+				return err
+			}
+
+			timeFormat, err := cmd.Flags().GetString(timeFormatFlag)
+			if err != nil {
+				return err
+			}
+
+			if err := validateTimeFormat(timeFormat); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			if parallel < 1 {
+				err := fmt.Errorf("--%s must be positive", parallelFlag)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			if all == (len(audiences) != 0) {
+				err := fmt.Errorf("either --%s or --%s is required", audienceFlag, allFlag)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			var jobs []batchJob
+			if all {
+				jobs, err = profileJobs(os.LookupEnv)
+			} else {
+				jobs, err = audienceJobs(os.LookupEnv, dedupe(splitFlagValues(audiences)))
+			}
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			// all flows share the limiter, so that requests to each tenant are paced in total
+			opts := make([]auth.DeviceAuthFlowOption, 0)
+			if rateLimit > 0 {
+				burst := int(rateLimit)
+				if burst < 1 {
+					burst = 1
+				}
+				limiter, err := auth.NewRateLimiter(rateLimit, burst)
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				opts = append(opts, auth.WithRateLimiter{Limiter: limiter})
+			}
+
+			tokens, failed := runBatch(jobs, parallel, &progress{w: stderr}, opts, complete, timeFormat)
+
+			tokensJSON, err := json.Marshal(tokens)
+			if err != nil {
+				err := fmt.Errorf("cannot encode token responses to json: %w", err)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			fmt.Fprintln(stdout, string(tokensJSON))
+
+			if failed != 0 {
+				err := fmt.Errorf("%d of %d audience(s) failed", failed, len(jobs))
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice(audienceFlag, nil, "audience to acquire a token for (repeatable)")
+	cmd.Flags().Bool(allFlag, false, "acquire tokens for all profiles of the config file")
+	cmd.Flags().Int(parallelFlag, 4, "maximum number of audiences processed concurrently")
+	cmd.Flags().Float64(rateLimitFlag, 0, "maximum requests per second to each tenant (0 means unlimited)")
+	cmd.Flags().Bool(completeFlag, false, "auto complete user code")
+	cmd.Flags().String(timeFormatFlag, timeFormatLocal, "how to show expiries (local, utc, rfc3339)")
+
+	return cmd
+}
+
+// audienceJobs returns jobs for the audiences with the configuration of the active profile.
+func audienceJobs(lookupEnv func(key string) (string, bool), audiences []string) ([]batchJob, error) {
+	jobs := make([]batchJob, 0, len(audiences))
+	for _, audience := range audiences {
+		c, err := loadConfig(lookupEnv, &configFlags{audiences: []string{audience}})
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, batchJob{label: audience, config: c})
+	}
+
+	return jobs, nil
+}
+
+// profileJobs returns jobs for all profiles of the config file. Environment variables still take precedence over them.
+func profileJobs(lookupEnv func(key string) (string, bool)) ([]batchJob, error) {
+	path, err := configPath(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	cf, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(cf.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles are defined in %s", path)
+	}
+
+	names := make([]string, 0, len(cf.Profiles))
+	for name := range cf.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	jobs := make([]batchJob, 0, len(names))
+	for _, name := range names {
+		name := name
+		c, err := loadConfig(func(key string) (string, bool) {
+			if key == profileEnv {
+				return name, true
+			}
+			return lookupEnv(key)
+		}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+		jobs = append(jobs, batchJob{label: name, config: c})
+	}
+
+	return jobs, nil
+}
+
+// runBatch runs jobs with at most parallel workers, and returns acquired tokens keyed by labels and the number of failed jobs.
+func runBatch(jobs []batchJob, parallel int, p *progress, opts []auth.DeviceAuthFlowOption, complete bool, timeFormat string) (map[string]*auth.TokenResponse, int) {
+	var mu sync.Mutex
+	tokens := make(map[string]*auth.TokenResponse, len(jobs))
+	failed := 0
+
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		job := job
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			token, err := runBatchJob(job, p, opts, complete, timeFormat)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				p.printf(job.label, "failed: %s", job.config.redactor.String(err.Error()))
+				failed++
+				return
+			}
+			tokens[job.label] = token
+		}()
+	}
+	wg.Wait()
+
+	return tokens, failed
+}
+
+func runBatchJob(job batchJob, p *progress, opts []auth.DeviceAuthFlowOption, complete bool, timeFormat string) (*auth.TokenResponse, error) {
+	daf, err := job.config.newDeviceAuthFlow(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p.printf(job.label, "requesting device code")
+	dc, err := daf.FetchDeviceCode(job.config.scope, job.config.audience)
+	if err != nil {
+		return nil, err
+	}
+
+	url := dc.VerificationURI
+	if complete {
+		url = dc.VerificationURIComplete
+	}
+	p.printf(job.label, "code %s at %s (expires %s)", dc.UserCode, url, formatTime(dc.ExpiresAt, time.Now(), timeFormat))
+
+	token, err := daf.PollToken(dc)
+	if err != nil {
+		var expiredError *auth.ExpiredError
+		if errors.As(err, &expiredError) {
+			return nil, errors.New("code was expired before verification")
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	p.printf(job.label, "ok, token expires %s", formatTime(now.Add(time.Duration(token.ExpiresIn)*time.Second), now, timeFormat))
+	return token, nil
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/jwt"
+	"github.com/autopp/go-a0daf/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newCacheCommand(stdout, stderr io.Writer) *cobra.Command {
+	dirFlag := "dir"
+	namespaceFlag := "namespace"
+	timeFormatFlag := "time-format"
+
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "manage tokens stored in files",
+		Long: `Manage tokens stored by FileStore of the library, which are kept in a JSON file for each profile.
+Encrypted files are read with the key in the environment variable given by --key-env,
+or with the passphrase in the environment variable given by --passphrase-env.`,
+		Args: cobra.NoArgs,
+	}
+
+	defaultDir, _ := store.DefaultDir()
+	cmd.PersistentFlags().String(dirFlag, defaultDir, "directory of the token files")
+	cmd.PersistentFlags().String(namespaceFlag, "", "namespace of the tokens, which is the subdirectory of --dir")
+	cmd.PersistentFlags().String(keyEnvFlag, "", "environment variable of the base64 encryption key of the encrypted files")
+	cmd.PersistentFlags().String(passphraseEnvFlag, "", "environment variable of the passphrase of the encrypted files")
+
+	// openStore opens the store by the flags without creating the directory, and returns it with the name of the backend.
+	openStore := func(cmd *cobra.Command) (*store.FileStore, string, error) {
+		dir, err := cmd.Flags().GetString(dirFlag)
+		if err != nil {
+			return nil, "", err
+		}
+		if dir == "" {
+			return nil, "", fmt.Errorf("cannot find the directory of the token files, specify --%s", dirFlag)
+		}
+		namespace, err := cmd.Flags().GetString(namespaceFlag)
+		if err != nil {
+			return nil, "", err
+		}
+		keyEnv, err := cmd.Flags().GetString(keyEnvFlag)
+		if err != nil {
+			return nil, "", err
+		}
+		passphraseEnv, err := cmd.Flags().GetString(passphraseEnvFlag)
+		if err != nil {
+			return nil, "", err
+		}
+
+		o := &tokenStoreOptions{dir: dir, namespace: namespace, keyEnv: keyEnv, passphraseEnv: passphraseEnv}
+		return o.open(false)
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list stored tokens with the audience, the expiry and the backend",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			timeFormat, err := cmd.Flags().GetString(timeFormatFlag)
+			if err != nil {
+				return err
+			}
+			if err := validateTimeFormat(timeFormat); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			s, backend, err := openStore(cmd)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			profiles, err := s.Profiles()
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			now := time.Now()
+			w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PROFILE\tAUDIENCE\tEXPIRES\tBACKEND")
+			for _, profile := range profiles {
+				token, err := s.Load(profile)
+				if err != nil {
+					// the other entries are still listed, e.g. when a file is encrypted with another key
+					fmt.Fprintln(stderr, err)
+					fmt.Fprintf(w, "%s\t-\t(unreadable)\t%s\n", profile, backend)
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", profile, audienceOf(token), formatExpiry(token.ExpiresAt, now, timeFormat), backend)
+			}
+			return w.Flush()
+		},
+	}
+	listCmd.Flags().String(timeFormatFlag, timeFormatLocal, "how to show expiries (local, utc, rfc3339)")
+	cmd.AddCommand(listCmd)
+
+	showCmd := &cobra.Command{
+		Use:   "show PROFILE",
+		Short: "show the stored token of the profile with the tokens masked",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			timeFormat, err := cmd.Flags().GetString(timeFormatFlag)
+			if err != nil {
+				return err
+			}
+			if err := validateTimeFormat(timeFormat); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			s, backend, err := openStore(cmd)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			token, err := s.Load(args[0])
+			if err != nil {
+				err = fmt.Errorf("cannot load the token of %s: %w", args[0], err)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			writeCachedToken(stdout, args[0], backend, token, time.Now(), timeFormat)
+			return nil
+		},
+	}
+	showCmd.Flags().String(timeFormatFlag, timeFormatLocal, "how to show expiries (local, utc, rfc3339)")
+	cmd.AddCommand(showCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rm PROFILE...",
+		Short: "remove the stored tokens of the profiles",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, _, err := openStore(cmd)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			for _, profile := range args {
+				if err := s.Delete(profile); err != nil {
+					err = fmt.Errorf("cannot remove the token of %s: %w", profile, err)
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// audienceOf returns the audience of the access token, or "-" when it is not a JWT (e.g. opaque tokens).
+func audienceOf(token *store.Token) string {
+	t, err := jwt.Decode(token.Response.AccessToken)
+	if err != nil || len(t.Standard.Audience) == 0 {
+		return "-"
+	}
+	return strings.Join(t.Standard.Audience, ",")
+}
+
+// formatExpiry formats the expiry of the stored token like formatTime, or "never" when it has no expiry.
+func formatExpiry(t, now time.Time, format string) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return formatTime(t, now, format)
+}
+
+// writeCachedToken writes the stored token like writeMaskedToken, with the claims of the access token.
+// Values in extra fields are not written, because they may be sensitive.
+func writeCachedToken(w io.Writer, profile, backend string, token *store.Token, now time.Time, timeFormat string) {
+	r := token.Response
+	fmt.Fprintf(w, "Profile: %s\n", profile)
+	fmt.Fprintf(w, "Backend: %s\n", backend)
+
+	tokens := []struct {
+		label string
+		value string
+	}{
+		{"Access Token", r.AccessToken},
+		{"Refresh Token", r.RefreshToken},
+		{"ID Token", r.IdToken},
+	}
+	for _, t := range tokens {
+		if t.value == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s (%d characters)\n", t.label, maskToken(t.value), len(t.value))
+	}
+
+	fmt.Fprintf(w, "Token Type: %s\n", r.TokenType)
+	fmt.Fprintf(w, "Expires: %s\n", formatExpiry(token.ExpiresAt, now, timeFormat))
+	fmt.Fprintf(w, "Audience: %s\n", audienceOf(token))
+	if t, err := jwt.Decode(r.AccessToken); err == nil && t.Standard.Scope != "" {
+		fmt.Fprintf(w, "Scope: %s\n", t.Standard.Scope)
+	}
+
+	if len(r.Extra) != 0 {
+		names := make([]string, 0, len(r.Extra))
+		for name := range r.Extra {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(w, "Extra Fields: %s\n", strings.Join(names, ", "))
+	}
+}
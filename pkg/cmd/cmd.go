@@ -1,26 +1,67 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/browser"
+	"github.com/autopp/go-a0daf/pkg/headless"
+	"github.com/autopp/go-a0daf/pkg/qrcode"
 	"github.com/spf13/cobra"
 )
 
-func Main(version string, stdout, stderr io.Writer, args []string) error {
+const (
+	flowDevice   = "device"
+	flowAuthCode = "auth-code"
+)
+
+func Main(version string, stdin io.Reader, stdout, stderr io.Writer, args []string) error {
 	versionFlag := "version"
 	completeFlag := "complete"
-	baseURLEnv := "A0DAF_BASE_URL"
-	clientIDEnv := "A0DAF_CLIENT_ID"
-	scopeEnv := "A0DAF_SCOPE"
-	audienceEnv := "A0DAF_AUDIENCE"
+	serverMessageFlag := "server-message"
+	openFlag := "open"
+	qrFileFlag := "qr-file"
+	retryFlag := "retry"
+	maxReissuesFlag := "max-reissues"
+	formatFlag := "format"
+	nameFlag := "name"
+	namespaceFlag := "namespace"
+	showTokenFlag := "show-token"
+	timeFormatFlag := "time-format"
+	scopeFlag := "scope"
+	audienceFlag := "audience"
+	clientSecretFileFlag := "client-secret-file"
+	clientSecretStdinFlag := "client-secret-stdin"
+	otelEndpointFlag := "otel-endpoint"
+	statusFileFlag := "status-file"
+	statsFlag := "stats"
+	dryRunFlag := "dry-run"
+	promptFlag := "prompt"
+	flowFlag := "flow"
+	callbackPortFlag := "callback-port"
+	redirectURIFlag := "redirect-uri"
+	invitationFlag := "invitation"
+	remindAfterFlag := "remind-after"
+	copyFlag := "copy"
+	flowIDFlag := "flow-id"
+	flowIDHeaderFlag := "flow-id-header"
+	quietFlag := "quiet"
+
+	// redactor is set when the configuration is loaded, to redact errors written by --quiet
+	var redactor *auth.Redactor
 
 	cmd := &cobra.Command{
 		Use:           "a0daf",
+		Short:         "CLI for the device authorization flow of Auth0",
 		SilenceErrors: true,
 		SilenceUsage:  true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -39,62 +80,437 @@ func Main(version string, stdout, stderr io.Writer, args []string) error {
 				return err
 			}
 
-			undefinedEnvs := make([]string, 0)
-			baseURL, ok := os.LookupEnv(baseURLEnv)
-			if !ok {
-				undefinedEnvs = append(undefinedEnvs, baseURLEnv)
+			serverMessage, err := cmd.Flags().GetBool(serverMessageFlag)
+			if err != nil {
+				return err
+			}
+
+			open, err := cmd.Flags().GetBool(openFlag)
+			if err != nil {
+				return err
+			}
+
+			qrFile, err := cmd.Flags().GetString(qrFileFlag)
+			if err != nil {
+				return err
+			}
+
+			remindAfter, err := cmd.Flags().GetDuration(remindAfterFlag)
+			if err != nil {
+				return err
+			}
+
+			copyCode, err := cmd.Flags().GetBool(copyFlag)
+			if err != nil {
+				return err
+			}
+
+			retry, err := cmd.Flags().GetBool(retryFlag)
+			if err != nil {
+				return err
+			}
+
+			maxReissues, err := cmd.Flags().GetInt(maxReissuesFlag)
+			if err != nil {
+				return err
+			}
+
+			format, err := cmd.Flags().GetString(formatFlag)
+			if err != nil {
+				return err
+			}
+
+			name, err := cmd.Flags().GetString(nameFlag)
+			if err != nil {
+				return err
+			}
+
+			namespace, err := cmd.Flags().GetString(namespaceFlag)
+			if err != nil {
+				return err
+			}
+
+			showToken, err := cmd.Flags().GetBool(showTokenFlag)
+			if err != nil {
+				return err
+			}
+
+			timeFormat, err := cmd.Flags().GetString(timeFormatFlag)
+			if err != nil {
+				return err
+			}
+
+			quiet, err := cmd.Flags().GetBool(quietFlag)
+			if err != nil {
+				return err
+			}
+			if quiet && format != formatJSON && format != formatRaw {
+				err := fmt.Errorf("--%s can be used only with --format %s or %s", quietFlag, formatJSON, formatRaw)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			// the token is not masked by --quiet, which writes it in a line
+			o := &outputOptions{
+				format:      format,
+				name:        name,
+				namespace:   namespace,
+				showToken:   showToken,
+				timeFormat:  timeFormat,
+				interactive: isTerminal(stdout) && !quiet,
+			}
+			if err := o.validate(); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			flow, err := cmd.Flags().GetString(flowFlag)
+			if err != nil {
+				return err
 			}
-			clientID, ok := os.LookupEnv(clientIDEnv)
-			if !ok {
-				undefinedEnvs = append(undefinedEnvs, clientIDEnv)
+			if flow != flowDevice && flow != flowAuthCode {
+				err := fmt.Errorf("unknown flow: %s", flow)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			callbackPort, err := cmd.Flags().GetInt(callbackPortFlag)
+			if err != nil {
+				return err
 			}
-			scope, ok := os.LookupEnv(scopeEnv)
-			if !ok {
-				undefinedEnvs = append(undefinedEnvs, scopeEnv)
+
+			redirectURI, err := cmd.Flags().GetString(redirectURIFlag)
+			if err != nil {
+				return err
 			}
-			audience, ok := os.LookupEnv(audienceEnv)
-			if !ok {
-				undefinedEnvs = append(undefinedEnvs, audienceEnv)
+
+			promptMode, err := cmd.Flags().GetString(promptFlag)
+			if err != nil {
+				return err
 			}
-			if len(undefinedEnvs) != 0 {
-				err := fmt.Errorf("undefined environment variables: %s", strings.Join(undefinedEnvs, ", "))
+			if err := validatePrompt(promptMode); err != nil {
 				fmt.Fprintln(stderr, err)
 				return err
 			}
 
-			daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(baseURL), auth.WithClientID(clientID))
+			promptOut := stdout
+			if o.isMachineReadable() || quiet {
+				promptOut = stderr
+			}
+			if quiet {
+				// only the prompt is shown on stderr for the user, and the result is written to stdout at last
+				stderr = io.Discard
+			}
+
+			lookupEnv := os.LookupEnv
+			if format == formatTerraformExternal {
+				query, err := readTerraformQuery(stdin)
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				lookupEnv = lookupQuery(query)
+
+				// Terraform shows stderr only when the program failed, so show the code on the terminal directly if possible
+				if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+					defer tty.Close()
+					promptOut = tty
+				}
+			}
+
+			scopes, err := cmd.Flags().GetStringSlice(scopeFlag)
+			if err != nil {
+				return err
+			}
+
+			audiences, err := cmd.Flags().GetStringSlice(audienceFlag)
+			if err != nil {
+				return err
+			}
+
+			otelEndpoint, err := cmd.Flags().GetString(otelEndpointFlag)
+			if err != nil {
+				return err
+			}
+			otlp, err := newOTLPExporter(otelEndpoint, os.Getenv)
 			if err != nil {
 				fmt.Fprintln(stderr, err)
 				return err
 			}
 
-			dc, err := daf.FetchDeviceCode(scope, audience)
+			statusFilePath, err := cmd.Flags().GetString(statusFileFlag)
+			if err != nil {
+				return err
+			}
+
+			flowID, err := cmd.Flags().GetString(flowIDFlag)
 			if err != nil {
+				return err
+			}
+			if flowID == "" {
+				flowID = randomHex(8)
+			}
+
+			flowIDHeader, err := cmd.Flags().GetString(flowIDHeaderFlag)
+			if err != nil {
+				return err
+			}
+
+			statsFormat, err := cmd.Flags().GetString(statsFlag)
+			if err != nil {
+				return err
+			}
+			if statsFormat != "" && statsFormat != statsText && statsFormat != statsJSON {
+				err := fmt.Errorf("unknown stats format: %s", statsFormat)
 				fmt.Fprintln(stderr, err)
 				return err
 			}
 
-			fmt.Fprintf(stdout, "Code: %s\n", dc.UserCode)
-			if complete {
-				fmt.Fprintf(stdout, "Access: %s\n", dc.VerificationURIComplete)
+			clientSecretFile, err := cmd.Flags().GetString(clientSecretFileFlag)
+			if err != nil {
+				return err
+			}
+
+			clientSecretStdin, err := cmd.Flags().GetBool(clientSecretStdinFlag)
+			if err != nil {
+				return err
+			}
+
+			dryRun, err := cmd.Flags().GetBool(dryRunFlag)
+			if err != nil {
+				return err
+			}
+
+			invitation, err := cmd.Flags().GetString(invitationFlag)
+			if err != nil {
+				return err
+			}
+			if invitation != "" && (flow != flowDevice || dryRun) {
+				err := fmt.Errorf("--%s can be used only with --%s %s and without --%s", invitationFlag, flowFlag, flowDevice, dryRunFlag)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			flags := &configFlags{scopes: scopes, audiences: audiences, clientSecretFile: clientSecretFile}
+			if clientSecretStdin {
+				if format == formatTerraformExternal {
+					err := fmt.Errorf("--%s cannot be used with --format %s", clientSecretStdinFlag, formatTerraformExternal)
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				flags.clientSecretStdin = stdin
+			}
+
+			c, err := loadConfig(lookupEnv, flags)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			redactor = c.redactor
+
+			stderr := &redactWriter{w: stderr, redactor: c.redactor}
+			status := newStatusFile(statusFilePath, flowID, stderr, c.redactor)
+			defer status.close()
+
+			daf, err := c.newDeviceAuthFlow(append(status.options(), flowIDOptions(flowID, flowIDHeader)...)...)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			dcReq := &auth.DeviceCodeRequest{Scope: c.scope, Audience: c.audience}
+			if strings.Contains(invitation, "://") {
+				dcReq.Organization, dcReq.Invitation, err = auth.ParseInvitationURL(invitation)
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
 			} else {
-				fmt.Fprintf(stdout, "Access: %s\n", dc.VerificationURI)
+				dcReq.Invitation = invitation
+			}
+
+			if dryRun {
+				if quiet {
+					err := fmt.Errorf("--%s cannot be used with --%s", dryRunFlag, quietFlag)
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				if flow != flowDevice {
+					err := fmt.Errorf("--%s cannot be used with --%s %s", dryRunFlag, flowFlag, flow)
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				if err := writeDryRun(stdout, daf, c); err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				return nil
 			}
 
-			token, err := daf.PollToken(dc)
+			// the store is opened before the flow, so that the user does not authorize in vain
+			saver, err := newTokenSaver(cmd, lookupEnv)
 			if err != nil {
 				fmt.Fprintln(stderr, err)
 				return err
 			}
 
-			tokenJSON, err := json.Marshal(token)
+			pr, err := newPrompter(promptMode, promptOut, &promptOptions{complete: complete, serverMessage: serverMessage, timeFormat: o.timeFormat, flowID: flowID})
 			if err != nil {
-				err = fmt.Errorf("cannot encode token response to json: %w", err)
 				fmt.Fprintln(stderr, err)
 				return err
 			}
 
-			fmt.Fprintln(stdout, string(tokenJSON))
+			tr := newTracer(c.redactor)
+			root := tr.start("login", nil)
+			root.setString("a0daf.flow_id", flowID)
+
+			stats := &loginStats{FlowID: flowID}
+			reissues := 0
+			authorize := func() (*auth.TokenResponse, error) {
+				for ; ; reissues++ {
+					status.requestingCode(reissues)
+					fetchSpan := tr.start("fetch device code", root)
+					dc, err := daf.RequestDeviceCode(dcReq)
+					fetchSpan.finish(err)
+					if err != nil {
+						fmt.Fprintln(stderr, err)
+						printOrganizationHint(stderr, err, dcReq.Invitation != "")
+						return nil, err
+					}
+					stats.TimeToDeviceCode = fetchSpan.end.Sub(root.start)
+					if err := pr.deviceCode(dc); err != nil {
+						fmt.Fprintln(stderr, err)
+						return nil, err
+					}
+					if open {
+						openVerificationURI(stderr, dc, complete)
+					}
+					if qrFile != "" {
+						if err := writeQRCode(qrFile, dc, complete); err != nil {
+							fmt.Fprintln(stderr, err)
+							return nil, err
+						}
+					}
+					if copyCode {
+						copyUserCode(stderr, dc)
+					}
+					status.waitingForUser(dc)
+
+					pollSpan := tr.start("poll token", root)
+					stopReminder := startReminder(remindAfter, func(waited time.Duration) {
+						pr.remind(dc, waited)
+						if copyCode {
+							copyUserCode(stderr, dc)
+						}
+					})
+					token, pollStats, err := daf.PollTokenWithStats(dc)
+					stopReminder()
+					pollSpan.setInt("a0daf.polls", pollStats.Attempts)
+					pollSpan.finish(err)
+					stats.Polls += pollStats.Attempts
+					pr.done(err)
+
+					if err == nil {
+						return token, nil
+					}
+
+					fmt.Fprintln(stderr, err)
+					printOrganizationHint(stderr, err, dcReq.Invitation != "")
+					status.failed(err, false)
+					var expiredError *auth.ExpiredError
+					if !errors.As(err, &expiredError) || reissues >= maxReissues {
+						return nil, err
+					}
+
+					if !retry {
+						// no question can be asked in --quiet
+						if quiet {
+							return nil, err
+						}
+						ok, cerr := confirm(stdin, stderr, "Issue a new code? [y/N]: ")
+						if cerr != nil {
+							fmt.Fprintln(stderr, cerr)
+							return nil, cerr
+						}
+						if !ok {
+							return nil, err
+						}
+					}
+				}
+			}
+
+			if flow == flowAuthCode {
+				var acfOpts []auth.AuthCodeFlowOption
+				if callbackPort != 0 {
+					acfOpts = append(acfOpts, auth.WithCallbackPortRange{From: callbackPort, To: callbackPort})
+				}
+				if redirectURI != "" {
+					acfOpts = append(acfOpts, auth.WithRedirectURI(redirectURI))
+				}
+				acf, err := daf.NewAuthCodeFlow(func(url string) error {
+					fmt.Fprintf(promptOut, "Open: %s\n", url)
+					openURL(stderr, url)
+					status.waitingForUser(nil)
+					return nil
+				}, acfOpts...)
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+
+				authorize = func() (*auth.TokenResponse, error) {
+					span := tr.start("authorize with code", root)
+					token, err := acf.Authorize(context.Background(), c.scope, c.audience)
+					span.finish(err)
+					if err != nil {
+						fmt.Fprintln(stderr, err)
+					}
+					return token, err
+				}
+			}
+
+			token, err := authorize()
+			root.setInt("a0daf.reissues", reissues)
+			root.finish(err)
+			if err != nil {
+				status.failed(err, true)
+			} else {
+				status.authorized(token, time.Time{})
+			}
+
+			stats.Reissues = reissues
+			stats.Connections = daf.ConnectionStats()
+			stats.Total = root.end.Sub(root.start)
+			if token != nil {
+				stats.ExpiresAt = root.end.Add(time.Duration(token.ExpiresIn) * time.Second)
+			}
+			if statsFormat != "" {
+				if err := writeStats(stderr, statsFormat, o.timeFormat, stats); err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+			}
+
+			if otlp != nil {
+				if err := tr.export(otlp, version); err != nil {
+					fmt.Fprintf(stderr, "warning: %s\n", err)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			warnScopeMismatch(stderr, c.scope, token)
+
+			// the token is still written, because the user has authorized
+			if err := saver.save(token, root.end); err != nil {
+				fmt.Fprintf(stderr, "warning: %s\n", err)
+			}
+
+			if err := writeToken(stdout, token, o); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
 
 			return nil
 		},
@@ -102,8 +518,201 @@ func Main(version string, stdout, stderr io.Writer, args []string) error {
 
 	cmd.Flags().Bool(versionFlag, false, "show version")
 	cmd.Flags().Bool(completeFlag, false, "auto complete user code")
+	cmd.Flags().Bool(serverMessageFlag, true, "show the message of the server (e.g. Microsoft Entra ID) instead of the code and the URL if given")
+	cmd.Flags().String(promptFlag, promptAuto, "how to show the code (auto, plain, tui, json, silent)")
+	cmd.Flags().Bool(openFlag, false, "open the URL in the browser unless headless")
+	cmd.Flags().String(qrFileFlag, "", "write QR code of the URL to the file (.png or .svg)")
+	cmd.Flags().Duration(remindAfterFlag, 0, "show the code again every duration while waiting for authorization (e.g. 1m, default never)")
+	cmd.Flags().Bool(copyFlag, false, "copy the user code to the clipboard, again on each reminder")
+	cmd.Flags().Bool(retryFlag, false, "issue a new code without asking when the code is expired")
+	cmd.Flags().Int(maxReissuesFlag, 3, "maximum number of times to issue a new code")
+	cmd.Flags().String(formatFlag, formatJSON, "output format (json, raw, k8s-secret, terraform-external)")
+	cmd.Flags().String(nameFlag, "", "name of the Secret for --format k8s-secret")
+	cmd.Flags().String(namespaceFlag, "", "namespace of the Secret for --format k8s-secret")
+	cmd.Flags().Bool(showTokenFlag, false, "show the full token on terminal")
+	cmd.Flags().String(timeFormatFlag, timeFormatLocal, "how to show expiries (local, utc, rfc3339)")
+	cmd.Flags().StringSlice(scopeFlag, nil, "scope to request in addition to A0DAF_SCOPE (repeatable)")
+	cmd.Flags().StringSlice(audienceFlag, nil, "audience to request instead of A0DAF_AUDIENCE")
+	cmd.Flags().String(clientSecretFileFlag, "", "path of the file containing the client secret (e.g. /dev/fd/3) instead of A0DAF_CLIENT_SECRET_FILE")
+	cmd.Flags().Bool(clientSecretStdinFlag, false, "read the client secret from the first line of stdin")
+	cmd.Flags().String(statsFlag, "", "show a summary of the flow on stderr (text, json)")
+	cmd.Flags().Lookup(statsFlag).NoOptDefVal = statsText
+	cmd.Flags().String(flowFlag, flowDevice, "flow to authorize (device, auth-code)")
+	cmd.Flags().Int(callbackPortFlag, 0, "port of the loopback server for --flow auth-code (default any free port)")
+	cmd.Flags().String(redirectURIFlag, "", "fixed redirect URI on a loopback host for --flow auth-code (e.g. http://localhost:8080/callback)")
+	cmd.Flags().String(invitationFlag, "", "organization invitation to accept, as the invitation link or the ticket ID with A0DAF_ORGANIZATION")
+	cmd.Flags().Bool(dryRunFlag, false, "show the requests without sending them")
+	cmd.Flags().String(otelEndpointFlag, "", "OTLP/HTTP endpoint to export spans of the flow (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	cmd.Flags().String(statusFileFlag, "", "write the state of the flow in JSON to the file or named pipe on every transition")
+	cmd.Flags().String(flowIDFlag, "", "ID of the login shown in the status file, --prompt json, --stats and spans (default random)")
+	cmd.Flags().String(flowIDHeaderFlag, "", "request header to send the flow ID in (e.g. X-Flow-ID)")
+	cmd.Flags().BoolP(quietFlag, "q", false, "write only a line of the token or the error in JSON to stdout, and only the code to stderr")
+	cmd.Flags().Bool(saveFlag, false, "save the token to the token files under the name of the profile for a0daf token and a0daf cache")
+	addTokenStoreFlags(cmd)
+
+	// --quiet writes the error to stdout in place of the token
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		err := run(cmd, args)
+		if quiet, _ := cmd.Flags().GetBool(quietFlag); quiet && err != nil {
+			writeErrorLine(stdout, err, redactor)
+		}
+		return err
+	}
+
+	cmd.AddCommand(newWatchCommand(stdin, stdout, stderr))
+	cmd.AddCommand(newBatchCommand(stdout, stderr))
+	cmd.AddCommand(newDoctorCommand(stdout, stderr))
+	cmd.AddCommand(newPingCommand(stdout, stderr))
+	cmd.AddCommand(newSelfUpdateCommand(version, stdout, stderr))
+	cmd.AddCommand(newDocsCommand(stdout, stderr))
+	cmd.AddCommand(newConfigCommand(stdout, stderr))
+	cmd.AddCommand(newCacheCommand(stdout, stderr))
+	cmd.AddCommand(newTokenCommand(stdout, stderr))
+	cmd.AddCommand(newEnvCommand(stdout, stderr))
+	cmd.AddCommand(newReportCommand(version, stdout, stderr))
+	cmd.AddCommand(newServeOIDCStubCommand(stdout, stderr))
+	cmd.AddCommand(newFeaturesCommand(stdout, stderr))
+
+	if _, _, err := cmd.Find(args); err != nil && len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		if path, ok := lookupPlugin(args[0]); ok {
+			return runPlugin(path, args[1:], stdin, stdout, stderr)
+		}
+	}
 
 	cmd.SetArgs(args)
 
 	return cmd.Execute()
 }
+
+// printDeviceCode shows the code and the URL, or the message of the server instead if serverMessage is true and it is given.
+func printDeviceCode(w io.Writer, dc *auth.DeviceCodeResponse, complete bool, serverMessage bool, timeFormat string) {
+	if serverMessage && dc.Message != "" {
+		fmt.Fprintln(w, dc.Message)
+	} else {
+		fmt.Fprintf(w, "Code: %s\n", dc.UserCode)
+		if complete {
+			fmt.Fprintf(w, "Access: %s\n", dc.VerificationURIComplete)
+		} else {
+			fmt.Fprintf(w, "Access: %s\n", dc.VerificationURI)
+		}
+	}
+	fmt.Fprintf(w, "Expires: %s\n", formatTime(dc.ExpiresAt, time.Now(), timeFormat))
+
+	// the URL cannot be opened on this machine in SSH sessions, containers and so on
+	if env := headless.Detect(); env.IsHeadless() {
+		fmt.Fprintln(w, env.Instruction())
+	}
+}
+
+// openVerificationURI opens the URL shown by printDeviceCode in the browser.
+// It does nothing in headless environments because the user is asked to use another device.
+func openVerificationURI(w io.Writer, dc *auth.DeviceCodeResponse, complete bool) {
+	if headless.Detect().IsHeadless() {
+		return
+	}
+
+	url := dc.VerificationURI
+	if complete {
+		url = dc.VerificationURIComplete
+	}
+	openURL(w, url)
+}
+
+// openURL opens url in the browser and warns to w on failure.
+func openURL(w io.Writer, url string) {
+	if err := browser.Open(url); err != nil {
+		fmt.Fprintf(w, "warning: %s\n", err)
+	}
+}
+
+// writeQRCode writes QR code of the URL shown by printDeviceCode to path, as SVG if its extension is .svg or PNG otherwise.
+func writeQRCode(path string, dc *auth.DeviceCodeResponse, complete bool) error {
+	url := dc.VerificationURI
+	if complete {
+		url = dc.VerificationURIComplete
+	}
+
+	code, err := qrcode.Encode(url)
+	if err != nil {
+		return fmt.Errorf("cannot encode QR code: %w", err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot write QR code: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		err = code.WriteSVG(f, 8)
+	} else {
+		err = code.WritePNG(f, 8)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write QR code: %w", err)
+	}
+
+	return f.Close()
+}
+
+// warnScopeMismatch warns when scopes granted in the token response are less than requested.
+func warnScopeMismatch(w io.Writer, scope string, token *auth.TokenResponse) {
+	raw, ok := token.Extra["scope"]
+	if !ok {
+		return
+	}
+
+	var granted string
+	if err := json.Unmarshal(raw, &granted); err != nil {
+		return
+	}
+
+	if missing := auth.ParseScopes(scope).Difference(auth.ParseScopes(granted)); len(missing) != 0 {
+		fmt.Fprintf(w, "warning: requested scopes are not granted: %s\n", missing)
+	}
+}
+
+// printOrganizationHint shows how to resolve errors related to the organization or the invitation.
+func printOrganizationHint(w io.Writer, err error, invited bool) {
+	if !auth.IsOrganizationError(err) {
+		return
+	}
+
+	if invited {
+		fmt.Fprintln(w, "hint: check the invitation link; invitations expire and can be accepted only once")
+		return
+	}
+	fmt.Fprintf(w, "hint: check %s and that the user is a member of the organization\n", organizationEnv)
+}
+
+// isTerminal reports whether w is a terminal.
+func isTerminal(w interface{}) bool {
+	if rw, ok := w.(*redactWriter); ok {
+		w = rw.w
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm asks a yes/no question and reports whether the answer is yes.
+// An empty answer or EOF is treated as no.
+func confirm(stdin io.Reader, w io.Writer, question string) (bool, error) {
+	fmt.Fprint(w, question)
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("cannot read answer: %w", err)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
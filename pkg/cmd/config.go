@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	baseURLEnv          = "A0DAF_BASE_URL"
+	clientIDEnv         = "A0DAF_CLIENT_ID"
+	scopeEnv            = "A0DAF_SCOPE"
+	audienceEnv         = "A0DAF_AUDIENCE"
+	organizationEnv     = "A0DAF_ORGANIZATION"
+	clientSecretFileEnv = "A0DAF_CLIENT_SECRET_FILE"
+	assertionKeyFileEnv = "A0DAF_CLIENT_ASSERTION_KEY_FILE"
+	assertionKeyIDEnv   = "A0DAF_CLIENT_ASSERTION_KEY_ID"
+	socksProxyEnv       = "A0DAF_SOCKS_PROXY"
+	redactEnv           = "A0DAF_REDACT"
+	localeEnv           = "A0DAF_LOCALE"
+	tokenProcessorEnv   = "A0DAF_TOKEN_PROCESSOR"
+	profileEnv          = "A0DAF_PROFILE"
+	configEnv           = "A0DAF_CONFIG"
+)
+
+// defaultProfile is used when no profile is selected.
+const defaultProfile = "default"
+
+// profileFile selects the profile for the directory and its descendants, like .nvmrc.
+const profileFile = ".a0daf-profile"
+
+// configKeys maps environment variables to keys in profiles of the config file and the query of Terraform.
+var configKeys = map[string]string{
+	baseURLEnv:          "base_url",
+	clientIDEnv:         "client_id",
+	scopeEnv:            "scope",
+	audienceEnv:         "audience",
+	organizationEnv:     "organization",
+	clientSecretFileEnv: "client_secret_file",
+	assertionKeyFileEnv: "client_assertion_key_file",
+	assertionKeyIDEnv:   "client_assertion_key_id",
+	socksProxyEnv:       "socks_proxy",
+	redactEnv:           "redact",
+	localeEnv:           "locale",
+	tokenProcessorEnv:   "token_processor",
+}
+
+// config holds configurations given by environment variables or the profile.
+type config struct {
+	baseURL      string
+	clientID     string
+	scope        string
+	audience     string
+	organization string
+	clientSecret string
+	// assertionSigner is the private key for private_key_jwt, with the key ID in assertionKeyID.
+	assertionSigner crypto.Signer
+	assertionKeyID  string
+	socksProxy      string
+	// locale is sent as Accept-Language, like "ja-JP".
+	locale string
+	// tokenProcessor is the command line which shapes tokens before they are output.
+	tokenProcessor string
+	// redactor redacts secrets in output, with the client secret registered by newDeviceAuthFlow.
+	redactor *auth.Redactor
+}
+
+// configFile represents the config file.
+//
+//	profiles:
+//	  default:
+//	    base_url: https://example.us.auth0.com
+//	    client_id: xxxx
+//	    scope: openid profile
+//	    audience: https://example.com/your/api
+type configFile struct {
+	Profiles map[string]map[string]string `yaml:"profiles"`
+}
+
+// configFlags holds configurations given by flags.
+type configFlags struct {
+	scopes           []string
+	audiences        []string
+	clientSecretFile string
+	// clientSecretStdin is stdin when the client secret should be read from it.
+	clientSecretStdin io.Reader
+}
+
+// loadConfig loads configurations with lookupEnv, which is usually os.LookupEnv.
+//
+// Environment variables take precedence over the profile of the config file.
+// Scopes in flags are merged into them, and an audience in flags overrides them.
+func loadConfig(lookupEnv func(key string) (string, bool), flags *configFlags) (*config, error) {
+	lookup, err := lookupWithProfile(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	if flags != nil {
+		if lookup, err = flags.wrap(lookup); err != nil {
+			return nil, err
+		}
+	}
+
+	undefinedEnvs := make([]string, 0)
+	baseURL, ok := lookup(baseURLEnv)
+	if !ok {
+		undefinedEnvs = append(undefinedEnvs, baseURLEnv)
+	}
+	clientID, ok := lookup(clientIDEnv)
+	if !ok {
+		undefinedEnvs = append(undefinedEnvs, clientIDEnv)
+	}
+	scope, ok := lookup(scopeEnv)
+	if !ok {
+		undefinedEnvs = append(undefinedEnvs, scopeEnv)
+	}
+	audience, ok := lookup(audienceEnv)
+	if !ok {
+		undefinedEnvs = append(undefinedEnvs, audienceEnv)
+	}
+	if len(undefinedEnvs) != 0 {
+		return nil, fmt.Errorf("undefined environment variables: %s (run \"a0daf env\" to see the configuration)", strings.Join(undefinedEnvs, ", "))
+	}
+
+	// optional
+	organization, _ := lookup(organizationEnv)
+	socksProxy, _ := lookup(socksProxyEnv)
+	redact, _ := lookup(redactEnv)
+	locale, ok := lookup(localeEnv)
+	if !ok {
+		locale = posixLocale(lookup)
+	}
+	tokenProcessor, _ := lookup(tokenProcessorEnv)
+
+	clientSecret, err := readClientSecret(lookup, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	assertionSigner, err := readAssertionKey(lookup)
+	if err != nil {
+		return nil, err
+	}
+	if clientSecret != "" && assertionSigner != nil {
+		return nil, fmt.Errorf("client secret and %s cannot be used together", assertionKeyFileEnv)
+	}
+	assertionKeyID, _ := lookup(assertionKeyIDEnv)
+
+	return &config{
+		baseURL:         baseURL,
+		clientID:        clientID,
+		scope:           scope,
+		audience:        audience,
+		organization:    organization,
+		clientSecret:    clientSecret,
+		assertionSigner: assertionSigner,
+		assertionKeyID:  assertionKeyID,
+		socksProxy:      socksProxy,
+		locale:          locale,
+		tokenProcessor:  tokenProcessor,
+		redactor:        newRedactor(redact),
+	}, nil
+}
+
+// lookupWithProfile returns a function like lookupEnv which falls back to the active profile.
+func lookupWithProfile(lookupEnv func(key string) (string, bool)) (func(key string) (string, bool), error) {
+	_, _, profile, err := loadProfile(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(key string) (string, bool) {
+		if v, ok := lookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := profile[configKeys[key]]
+		return v, ok
+	}, nil
+}
+
+// loadProfile returns the name of the active profile, the path of the config file and the profile in it.
+// The profile is nil when the default profile is not defined.
+func loadProfile(lookupEnv func(key string) (string, bool)) (name string, path string, profile map[string]string, err error) {
+	name, explicit, err := activeProfile(lookupEnv)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	path, err = configPath(lookupEnv)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	cf, err := readConfigFile(path)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	profile, ok := cf.Profiles[name]
+	if !ok && explicit {
+		return "", "", nil, fmt.Errorf("profile %q is not found in %s", name, path)
+	}
+
+	return name, path, profile, nil
+}
+
+// wrap returns a function like lookup which merges the flags.
+func (f *configFlags) wrap(lookup func(key string) (string, bool)) (func(key string) (string, bool), error) {
+	audiences := dedupe(splitFlagValues(f.audiences))
+	if len(audiences) > 1 {
+		return nil, fmt.Errorf("only one audience can be given, but got %s", strings.Join(audiences, ", "))
+	}
+
+	return func(key string) (string, bool) {
+		v, ok := lookup(key)
+		switch key {
+		case scopeEnv:
+			if len(f.scopes) != 0 {
+				return auth.ParseScopes(v).Union(splitFlagValues(f.scopes)).String(), true
+			}
+		case audienceEnv:
+			if len(audiences) != 0 {
+				return audiences[0], true
+			}
+		case clientSecretFileEnv:
+			if f.clientSecretFile != "" {
+				return f.clientSecretFile, true
+			}
+		}
+		return v, ok
+	}, nil
+}
+
+// readClientSecret reads the optional client secret from stdin or the file, so it never appears in argv or shell history.
+// A file descriptor can be given as a file like /dev/fd/3.
+func readClientSecret(lookup func(key string) (string, bool), flags *configFlags) (string, error) {
+	if flags != nil && flags.clientSecretStdin != nil {
+		secret, err := readLine(flags.clientSecretStdin)
+		if err != nil {
+			return "", fmt.Errorf("cannot read client secret from stdin: %w", err)
+		}
+		if secret == "" {
+			return "", errors.New("client secret from stdin is empty")
+		}
+		return secret, nil
+	}
+
+	path, ok := lookup(clientSecretFileEnv)
+	if !ok || path == "" {
+		return "", nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read client secret: %w", err)
+	}
+	secret := strings.TrimRight(string(b), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("client secret in %s is empty", path)
+	}
+
+	return secret, nil
+}
+
+// readAssertionKey reads the optional private key for private_key_jwt from the PEM file,
+// which is PKCS#8 ("PRIVATE KEY"), PKCS#1 ("RSA PRIVATE KEY") or SEC 1 ("EC PRIVATE KEY").
+func readAssertionKey(lookup func(key string) (string, bool)) (crypto.Signer, error) {
+	path, ok := lookup(assertionKeyFileEnv)
+	if !ok || path == "" {
+		return nil, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read client assertion key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("client assertion key in %s is not PEM", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block of client assertion key in %s: %s", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse client assertion key in %s: %w", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("client assertion key in %s cannot sign", path)
+	}
+	return signer, nil
+}
+
+// readLine reads a line from r without reading ahead, so that r can be read after that.
+func readLine(r io.Reader) (string, error) {
+	line := make([]byte, 0)
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return strings.TrimRight(string(line), "\r"), nil
+}
+
+// posixLocale returns the language tag of the locale for messages given by LC_ALL, LC_MESSAGES or LANG,
+// e.g. "ja-JP" for "ja_JP.UTF-8". It returns empty for the C locale.
+func posixLocale(lookupEnv func(key string) (string, bool)) string {
+	for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v, _ := lookupEnv(key)
+		if v == "" {
+			continue
+		}
+		if i := strings.IndexAny(v, ".@"); i >= 0 {
+			v = v[:i]
+		}
+		if v == "C" || v == "POSIX" {
+			return ""
+		}
+		return strings.ReplaceAll(v, "_", "-")
+	}
+	return ""
+}
+
+// splitFlagValues splits values of a repeatable flag, each of which may be separated by spaces.
+func splitFlagValues(values []string) []string {
+	splitted := make([]string, 0, len(values))
+	for _, v := range values {
+		splitted = append(splitted, strings.Fields(v)...)
+	}
+	return splitted
+}
+
+// dedupe removes duplicated values keeping the order.
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	deduped := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			deduped = append(deduped, v)
+		}
+	}
+	return deduped
+}
+
+// activeProfile returns the name of the profile selected by A0DAF_PROFILE or .a0daf-profile.
+// explicit is false when the default profile is used.
+func activeProfile(lookupEnv func(key string) (string, bool)) (name string, explicit bool, err error) {
+	if name, ok := lookupEnv(profileEnv); ok && name != "" {
+		return name, true, nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false, fmt.Errorf("cannot get working directory: %w", err)
+	}
+
+	for {
+		b, err := os.ReadFile(filepath.Join(dir, profileFile))
+		if err == nil {
+			name := strings.TrimSpace(string(b))
+			if name == "" {
+				return "", false, fmt.Errorf("%s is empty", filepath.Join(dir, profileFile))
+			}
+			return name, true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", false, fmt.Errorf("cannot read %s: %w", profileFile, err)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return defaultProfile, false, nil
+		}
+		dir = parent
+	}
+}
+
+// configPath returns the path of the config file. It can be overridden by A0DAF_CONFIG.
+func configPath(lookupEnv func(key string) (string, bool)) (string, error) {
+	if path, ok := lookupEnv(configEnv); ok && path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "a0daf", "config.yaml"), nil
+}
+
+// readConfigFile reads the config file. It returns an empty configFile when the file does not exist.
+func readConfigFile(path string) (*configFile, error) {
+	cf := new(configFile)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cf, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	doc := new(yaml.Node)
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+	if err := validateConfigFile(path, doc); err != nil {
+		return nil, err
+	}
+	if err := doc.Decode(cf); err != nil {
+		return nil, fmt.Errorf("cannot parse config file %s: %w", path, err)
+	}
+
+	return cf, nil
+}
+
+// lookupQuery returns a function like os.LookupEnv which prefers values in the query of Terraform.
+func lookupQuery(query map[string]string) func(key string) (string, bool) {
+	return func(key string) (string, bool) {
+		if v, ok := query[configKeys[key]]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	}
+}
+
+// flowIDOptions returns options of DeviceAuthFlow to share flowID by all requests, and send it in header if given.
+func flowIDOptions(flowID string, header string) []auth.DeviceAuthFlowOption {
+	opts := []auth.DeviceAuthFlowOption{auth.WithFlowID(flowID)}
+	if header != "" {
+		opts = append(opts, auth.WithFlowIDHeader(header))
+	}
+	return opts
+}
+
+func (c *config) newDeviceAuthFlow(extraOpts ...auth.DeviceAuthFlowOption) (*auth.DeviceAuthFlow, error) {
+	opts := []auth.DeviceAuthFlowOption{auth.WithBaseURL(c.baseURL), auth.WithClientID(c.clientID), auth.WithRedactor{Redactor: c.redactor}}
+	if c.organization != "" {
+		opts = append(opts, auth.WithOrganization(c.organization))
+	}
+	if c.clientSecret != "" {
+		opts = append(opts, auth.WithClientSecret(c.clientSecret))
+	}
+	if c.assertionSigner != nil {
+		opts = append(opts, auth.WithClientAssertionSigner{Signer: c.assertionSigner, KeyID: c.assertionKeyID})
+	}
+	if c.socksProxy != "" {
+		opts = append(opts, auth.WithSOCKS5Proxy(c.socksProxy))
+	}
+	if c.locale != "" {
+		opts = append(opts, auth.WithAcceptLanguage(c.locale))
+	}
+	if c.tokenProcessor != "" {
+		opts = append(opts, commandTokenProcessor(c.tokenProcessor))
+	}
+	opts = append(opts, extraOpts...)
+
+	return auth.NewDeviceAuthFlow(opts...)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func newDocsCommand(stdout, stderr io.Writer) *cobra.Command {
+	dirFlag := "dir"
+	formatFlag := "format"
+
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "generate man pages or markdown documents for all commands",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := cmd.Flags().GetString(dirFlag)
+			if err != nil {
+				return err
+			}
+
+			format, err := cmd.Flags().GetString(formatFlag)
+			if err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				err = fmt.Errorf("cannot create directory: %w", err)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+			switch format {
+			case "man":
+				err = doc.GenManTree(root, &doc.GenManHeader{Title: "A0DAF", Section: "1"}, dir)
+			case "markdown":
+				err = doc.GenMarkdownTree(root, dir)
+			default:
+				err = fmt.Errorf("unknown format: %s", format)
+			}
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			fmt.Fprintf(stdout, "generated documents in %s\n", dir)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(dirFlag, "docs", "directory to write documents")
+	cmd.Flags().String(formatFlag, "man", "format of documents (man, markdown)")
+
+	return cmd
+}
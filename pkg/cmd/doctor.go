@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/spf13/cobra"
+)
+
+// maxClockSkew is the maximum clock skew against the server treated as healthy.
+const maxClockSkew = 30 * time.Second
+
+// checkResult is a result of a check of doctor command.
+type checkResult struct {
+	name    string
+	ok      bool
+	message string
+	hint    string
+}
+
+func newDoctorCommand(stdout, stderr io.Writer) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "diagnose configuration and connectivity",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			failed := writeCheckResults(stdout, runChecks())
+			if failed != 0 {
+				err := fmt.Errorf("%d check(s) failed", failed)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+// writeCheckResults writes results and returns the number of failed checks.
+func writeCheckResults(w io.Writer, results []checkResult) int {
+	failed := 0
+	for _, r := range results {
+		mark := "PASS"
+		if !r.ok {
+			mark = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "[%s] %s: %s\n", mark, r.name, r.message)
+		if !r.ok && r.hint != "" {
+			fmt.Fprintf(w, "       hint: %s\n", r.hint)
+		}
+	}
+
+	return failed
+}
+
+// runChecks runs checks in order. Checks depending on failed checks are not run.
+func runChecks() []checkResult {
+	results := make([]checkResult, 0)
+
+	lookup, err := lookupWithProfile(os.LookupEnv)
+	if err != nil {
+		return append(results, checkResult{
+			name:    "profile",
+			message: err.Error(),
+			hint:    fmt.Sprintf("check %s, %s and the config file", profileEnv, profileFile),
+		})
+	}
+
+	undefinedEnvs := make([]string, 0)
+	for _, env := range []string{baseURLEnv, clientIDEnv, scopeEnv, audienceEnv} {
+		if _, ok := lookup(env); !ok {
+			undefinedEnvs = append(undefinedEnvs, env)
+		}
+	}
+	if len(undefinedEnvs) != 0 {
+		results = append(results, checkResult{
+			name:    "configuration",
+			message: "undefined " + strings.Join(undefinedEnvs, ", "),
+			hint:    "define them as environment variables or in the profile of the config file",
+		})
+	} else {
+		results = append(results, checkResult{name: "configuration", ok: true, message: "all defined"})
+	}
+
+	baseURL, ok := lookup(baseURLEnv)
+	if !ok {
+		return results
+	}
+
+	u, err := neturl.Parse(baseURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return append(results, checkResult{
+			name:    "base URL",
+			message: fmt.Sprintf("%q is not a valid https URL", baseURL),
+			hint:    fmt.Sprintf("set %s like https://example.us.auth0.com", baseURLEnv),
+		})
+	}
+	results = append(results, checkResult{name: "base URL", ok: true, message: baseURL})
+
+	addrs, err := net.LookupHost(u.Hostname())
+	if err != nil {
+		return append(results, checkResult{
+			name:    "DNS",
+			message: err.Error(),
+			hint:    fmt.Sprintf("check the domain in %s and your DNS settings", baseURLEnv),
+		})
+	}
+	results = append(results, checkResult{name: "DNS", ok: true, message: fmt.Sprintf("%s resolved to %s", u.Hostname(), strings.Join(addrs, ", "))})
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", net.JoinHostPort(u.Hostname(), port), &tls.Config{MinVersion: tls.VersionTLS12})
+	if err != nil {
+		return append(results, checkResult{
+			name:    "TLS",
+			message: err.Error(),
+			hint:    "check your network, proxy and firewall settings",
+		})
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	results = append(results, checkResult{
+		name:    "TLS",
+		ok:      true,
+		message: fmt.Sprintf("%s, certificate expires at %s", tls.VersionName(state.Version), state.PeerCertificates[0].NotAfter.Format(time.RFC3339)),
+	})
+
+	clientID, ok := lookup(clientIDEnv)
+	if !ok {
+		return results
+	}
+
+	opts := []auth.DeviceAuthFlowOption{auth.WithBaseURL(baseURL), auth.WithClientID(clientID)}
+	if proxy, ok := lookup(socksProxyEnv); ok && proxy != "" {
+		opts = append(opts, auth.WithSOCKS5Proxy(proxy))
+	}
+	daf, err := auth.NewDeviceAuthFlow(opts...)
+	if err != nil {
+		return append(results, checkResult{
+			name:    "client",
+			message: err.Error(),
+			hint:    fmt.Sprintf("check %s", socksProxyEnv),
+		})
+	}
+
+	diag, err := daf.CheckEndpoint(context.Background())
+	if err != nil {
+		hint := fmt.Sprintf("check %s points to the Auth0 tenant", baseURLEnv)
+		if diag.TokenEndpoint != "" && diag.DeviceAuthorizationEndpoint == "" {
+			hint = "enable Device Code grant in the application settings of Auth0 dashboard"
+		}
+		results = append(results, checkResult{name: "endpoints", message: err.Error(), hint: hint})
+	} else {
+		results = append(results, checkResult{
+			name:    "endpoints",
+			ok:      true,
+			message: fmt.Sprintf("device grant is available at %s over %s", diag.DeviceAuthorizationEndpoint, tls.VersionName(diag.TLSVersion)),
+		})
+	}
+
+	if !diag.ServerTime.IsZero() {
+		results = append(results, checkClockSkew(diag.ClockSkew))
+	}
+
+	return results
+}
+
+func checkClockSkew(skew time.Duration) checkResult {
+	skew = skew.Round(time.Second)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return checkResult{
+			name:    "clock skew",
+			message: fmt.Sprintf("local clock differs from server by %s", skew),
+			hint:    "synchronize the system clock (e.g. with NTP)",
+		}
+	}
+
+	return checkResult{name: "clock skew", ok: true, message: skew.String()}
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// dryRunDeviceCode is shown as the device code in the token request, because no device code is issued in dry run.
+const dryRunDeviceCode = "<device code>"
+
+// writeDryRun writes the requests of the flow without sending them.
+func writeDryRun(w io.Writer, daf *auth.DeviceAuthFlow, c *config) error {
+	req, err := daf.NewDeviceCodeRequest(c.scope, c.audience)
+	if err != nil {
+		return err
+	}
+	if err := writeRequest(w, req, c.redactor); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+
+	req, err = daf.NewTokenRequest(neturl.QueryEscape(dryRunDeviceCode))
+	if err != nil {
+		return err
+	}
+	return writeRequest(w, req, c.redactor)
+}
+
+// writeRequest writes the method, URL, headers and decoded form parameters of req, redacting secrets.
+func writeRequest(w io.Writer, req *http.Request, redactor *auth.Redactor) error {
+	fmt.Fprintf(w, "%s %s\n", req.Method, req.URL)
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range req.Header.Values(name) {
+			if redactor.Sensitive(name) {
+				v = auth.Redacted
+			}
+			fmt.Fprintf(w, "%s: %s\n", name, v)
+		}
+	}
+
+	fmt.Fprintln(w)
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read request body: %w", err)
+	}
+	// parameters are written in the order of the body, unlike url.ParseQuery
+	for _, param := range strings.Split(string(body), "&") {
+		kv := strings.SplitN(param, "=", 2)
+		key, _ := neturl.QueryUnescape(kv[0])
+		value := ""
+		if len(kv) == 2 {
+			value, _ = neturl.QueryUnescape(kv[1])
+		}
+		if redactor.Sensitive(key) {
+			value = auth.Redacted
+		}
+		fmt.Fprintf(w, "%s=%s\n", key, value)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	sourceFlag      = "flag"
+	sourceEnv       = "env"
+	sourceFile      = "file"
+	sourceDefault   = "default"
+	sourceUndefined = "undefined"
+)
+
+// envEntry is a configuration key and where its value comes from.
+type envEntry struct {
+	key      string
+	value    string
+	source   string
+	required bool
+}
+
+func newEnvCommand(stdout, stderr io.Writer) *cobra.Command {
+	scopeFlag := "scope"
+	audienceFlag := "audience"
+	clientSecretFileFlag := "client-secret-file"
+
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "print configuration keys with their values and sources",
+		Long: `Print environment variables used by a0daf as a template, with their current values and
+where they come from (flag, env, file or default). Required keys which are undefined are marked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			scopes, err := cmd.Flags().GetStringSlice(scopeFlag)
+			if err != nil {
+				return err
+			}
+
+			audiences, err := cmd.Flags().GetStringSlice(audienceFlag)
+			if err != nil {
+				return err
+			}
+
+			clientSecretFile, err := cmd.Flags().GetString(clientSecretFileFlag)
+			if err != nil {
+				return err
+			}
+
+			entries, err := resolveEnv(os.LookupEnv, &configFlags{scopes: scopes, audiences: audiences, clientSecretFile: clientSecretFile})
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			for _, e := range entries {
+				comment := e.source
+				if e.required && e.source == sourceUndefined {
+					comment += ", required"
+				}
+				fmt.Fprintf(stdout, "%s=%s # %s\n", e.key, e.value, comment)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice(scopeFlag, nil, "scope to request in addition to A0DAF_SCOPE (repeatable)")
+	cmd.Flags().StringSlice(audienceFlag, nil, "audience to request instead of A0DAF_AUDIENCE")
+	cmd.Flags().String(clientSecretFileFlag, "", "path of the file containing the client secret instead of A0DAF_CLIENT_SECRET_FILE")
+
+	return cmd
+}
+
+// resolveEnv resolves configuration keys in the same way as loadConfig, and records where their values come from.
+func resolveEnv(lookupEnv func(key string) (string, bool), flags *configFlags) ([]envEntry, error) {
+	name, path, profile, err := loadProfile(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup, err := flags.wrap(func(key string) (string, bool) {
+		if v, ok := lookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := profile[configKeys[key]]
+		return v, ok
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]envEntry, 0)
+	for _, key := range []string{baseURLEnv, clientIDEnv, scopeEnv, audienceEnv, organizationEnv, clientSecretFileEnv, assertionKeyFileEnv, assertionKeyIDEnv, socksProxyEnv, redactEnv, localeEnv, tokenProcessorEnv} {
+		e := envEntry{key: key, source: sourceUndefined, required: key == baseURLEnv || key == clientIDEnv || key == scopeEnv || key == audienceEnv}
+		if _, ok := lookupEnv(key); ok {
+			e.source = sourceEnv
+		} else if _, ok := profile[configKeys[key]]; ok {
+			e.source = fmt.Sprintf("%s (profile %q in %s)", sourceFile, name, path)
+		}
+
+		switch {
+		case key == scopeEnv && len(flags.scopes) != 0:
+			if e.source == sourceUndefined {
+				e.source = sourceFlag
+			} else {
+				e.source += " + " + sourceFlag
+			}
+		case key == audienceEnv && len(flags.audiences) != 0, key == clientSecretFileEnv && flags.clientSecretFile != "":
+			e.source = sourceFlag
+		}
+
+		e.value, _ = lookup(key)
+		if key == localeEnv && e.source == sourceUndefined {
+			if e.value = posixLocale(lookupEnv); e.value != "" {
+				e.source = sourceDefault
+			}
+		}
+		e.value = redactURLPassword(e.value)
+		entries = append(entries, e)
+	}
+
+	profileEntry := envEntry{key: profileEnv, value: name, source: sourceDefault}
+	if v, ok := lookupEnv(profileEnv); ok && v != "" {
+		profileEntry.source = sourceEnv
+	} else if name != defaultProfile {
+		profileEntry.source = sourceFile + " (" + profileFile + ")"
+	}
+
+	configEntry := envEntry{key: configEnv, value: path, source: sourceDefault}
+	if v, ok := lookupEnv(configEnv); ok && v != "" {
+		configEntry.source = sourceEnv
+	}
+
+	return append(entries, profileEntry, configEntry), nil
+}
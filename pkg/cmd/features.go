@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/spf13/cobra"
+)
+
+const (
+	featuresText = "text"
+	featuresJSON = "json"
+)
+
+func newFeaturesCommand(stdout, stderr io.Writer) *cobra.Command {
+	formatFlag := "format"
+
+	cmd := &cobra.Command{
+		Use:   "features",
+		Short: "print features compiled into this binary",
+		Long: `Print grant types, token storage and providers supported by this binary, and deprecated features.
+Tools can use it to detect features instead of comparing versions.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := cmd.Flags().GetString(formatFlag)
+			if err != nil {
+				return err
+			}
+
+			if err := writeFeatures(stdout, format, cliCapabilities()); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String(formatFlag, featuresText, "output format (text or json)")
+
+	return cmd
+}
+
+// cliCapabilities returns capabilities of the auth package and ones added by the CLI.
+func cliCapabilities() *auth.CapabilitySet {
+	c := auth.Capabilities()
+	// watch command writes tokens to files
+	c.Storage = append(c.Storage, "file")
+	return c
+}
+
+func writeFeatures(w io.Writer, format string, c *auth.CapabilitySet) error {
+	switch format {
+	case featuresText:
+		fmt.Fprintf(w, "Grants: %s\n", strings.Join(c.Grants, ", "))
+		fmt.Fprintf(w, "Storage: %s\n", strings.Join(c.Storage, ", "))
+		fmt.Fprintf(w, "Providers: %s\n", strings.Join(c.Providers, ", "))
+		for _, d := range c.Deprecations {
+			replacement := ""
+			if d.Replacement != "" {
+				replacement = fmt.Sprintf(", use %s instead", d.Replacement)
+			}
+			fmt.Fprintf(w, "Deprecated: %s (since %s%s)\n", d.Feature, d.Since, replacement)
+		}
+		return nil
+	case featuresJSON:
+		b, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Errorf("could not encode features: %w", err)
+		}
+		fmt.Fprintln(w, string(b))
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", format)
+	}
+}
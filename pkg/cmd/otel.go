@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// Standard environment variables of OpenTelemetry to configure the exporter.
+//
+// See: https://opentelemetry.io/docs/specs/otel/protocol/exporter/
+const (
+	otelEndpointEnv       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otelTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	otelHeadersEnv        = "OTEL_EXPORTER_OTLP_HEADERS"
+	otelTracesHeadersEnv  = "OTEL_EXPORTER_OTLP_TRACES_HEADERS"
+	otelTimeoutEnv        = "OTEL_EXPORTER_OTLP_TIMEOUT"
+	otelTracesTimeoutEnv  = "OTEL_EXPORTER_OTLP_TRACES_TIMEOUT"
+)
+
+// defaultOTLPTimeout is the timeout of exporting spans, which is the default of OpenTelemetry.
+const defaultOTLPTimeout = 10 * time.Second
+
+// otlpExporter is the destination of spans.
+type otlpExporter struct {
+	url     string
+	headers http.Header
+	timeout time.Duration
+}
+
+// newOTLPExporter returns the exporter to the endpoint given by --otel-endpoint or environment variables of OpenTelemetry.
+// It returns nil when no endpoint is given.
+//
+// Like the SDKs of OpenTelemetry, /v1/traces is appended to the endpoint except OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// and variables for traces take precedence over the generic ones.
+func newOTLPExporter(endpoint string, getenv func(key string) string) (*otlpExporter, error) {
+	var url string
+	switch {
+	case endpoint != "":
+		url = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	case getenv(otelTracesEndpointEnv) != "":
+		url = getenv(otelTracesEndpointEnv)
+	case getenv(otelEndpointEnv) != "":
+		url = strings.TrimSuffix(getenv(otelEndpointEnv), "/") + "/v1/traces"
+	default:
+		return nil, nil
+	}
+
+	headers := make(http.Header)
+	for _, key := range []string{otelHeadersEnv, otelTracesHeadersEnv} {
+		h, err := parseOTLPHeaders(getenv(key))
+		if err != nil {
+			return nil, fmt.Errorf("%s is invalid: %w", key, err)
+		}
+		for name, values := range h {
+			headers[name] = values
+		}
+	}
+
+	timeout := defaultOTLPTimeout
+	for _, key := range []string{otelTimeoutEnv, otelTracesTimeoutEnv} {
+		if v := getenv(key); v != "" {
+			ms, err := strconv.Atoi(v)
+			if err != nil || ms <= 0 {
+				return nil, fmt.Errorf("%s is invalid: %q is not a positive number of milliseconds", key, v)
+			}
+			timeout = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	return &otlpExporter{url: url, headers: headers, timeout: timeout}, nil
+}
+
+// parseOTLPHeaders parses headers like "api-key=xxx,tenant=yyy" whose values are percent-encoded.
+func parseOTLPHeaders(s string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || name == "" {
+			return nil, fmt.Errorf("%q is not a pair of key=value", strings.TrimSpace(pair))
+		}
+		value, err := neturl.PathUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("value of %s is not percent-encoded", name)
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
+
+// tracer records spans of an invocation and exports them with OTLP/HTTP in JSON encoding.
+//
+// See: https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type tracer struct {
+	traceID  string
+	spans    []*span
+	redactor *auth.Redactor
+}
+
+// span is a span recorded by tracer.
+type span struct {
+	tracer   *tracer
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    []otlpKeyValue
+	err      error
+}
+
+type otlpKeyValue struct {
+	Key   string            `json:"key"`
+	Value map[string]string `json:"value"`
+}
+
+// newTracer returns a tracer redacting attributes and error messages of spans with redactor.
+func newTracer(redactor *auth.Redactor) *tracer {
+	return &tracer{traceID: randomHex(16), redactor: redactor}
+}
+
+// start starts a new span. parent can be nil for the root span.
+func (t *tracer) start(name string, parent *span) *span {
+	s := &span{tracer: t, spanID: randomHex(8), name: name, start: time.Now()}
+	if parent != nil {
+		s.parentID = parent.spanID
+	}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func (s *span) setInt(key string, value int) {
+	s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: map[string]string{"intValue": strconv.Itoa(value)}})
+}
+
+func (s *span) setString(key string, value string) {
+	s.attrs = append(s.attrs, otlpKeyValue{Key: key, Value: map[string]string{"stringValue": s.tracer.redactor.String(value)}})
+}
+
+// finish ends the span. err is recorded as the status of the span.
+func (s *span) finish(err error) {
+	s.end = time.Now()
+	s.err = err
+}
+
+// export sends the finished spans to the OTLP/HTTP exporter.
+func (t *tracer) export(exporter *otlpExporter, version string) error {
+	type otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	type otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+
+	spans := make([]otlpSpan, 0, len(t.spans))
+	for _, s := range t.spans {
+		if s.end.IsZero() {
+			continue
+		}
+
+		// STATUS_CODE_OK = 1, STATUS_CODE_ERROR = 2
+		status := otlpStatus{Code: 1}
+		if s.err != nil {
+			status = otlpStatus{Code: 2, Message: t.redactor.String(s.err.Error())}
+		}
+
+		spans = append(spans, otlpSpan{
+			TraceID:      t.traceID,
+			SpanID:       s.spanID,
+			ParentSpanID: s.parentID,
+			Name:         s.name,
+			// SPAN_KIND_INTERNAL
+			Kind:              1,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        s.attrs,
+			Status:            status,
+		})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": []otlpKeyValue{
+						{Key: "service.name", Value: map[string]string{"stringValue": "a0daf"}},
+						{Key: "service.version", Value: map[string]string{"stringValue": version}},
+					},
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]string{"name": "github.com/autopp/go-a0daf/pkg/cmd", "version": version},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode spans: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", exporter.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not export spans: %w", err)
+	}
+	for name, values := range exporter.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("content-type", "application/json")
+
+	client := &http.Client{Timeout: exporter.timeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not export spans: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("could not export spans: %s returned %s", exporter.url, res.Status)
+	}
+
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+const (
+	formatJSON              = "json"
+	formatRaw               = "raw"
+	formatK8sSecret         = "k8s-secret"
+	formatTerraformExternal = "terraform-external"
+)
+
+// outputOptions specifies how to write token response.
+type outputOptions struct {
+	format    string
+	name      string
+	namespace string
+	// showToken disables masking of tokens on terminal.
+	showToken bool
+	// timeFormat is how to show expiries to users.
+	timeFormat string
+	// interactive is true when the output is a terminal.
+	interactive bool
+}
+
+func (o *outputOptions) validate() error {
+	if err := validateTimeFormat(o.timeFormat); err != nil {
+		return err
+	}
+
+	switch o.format {
+	case formatJSON, formatRaw:
+		return nil
+	case formatK8sSecret:
+		if o.name == "" {
+			return fmt.Errorf("--name is required for --format %s", formatK8sSecret)
+		}
+		return nil
+	case formatTerraformExternal:
+		return nil
+	default:
+		return fmt.Errorf("unknown format: %s", o.format)
+	}
+}
+
+// isMachineReadable reports whether the output is intended to be consumed by other programs.
+// In that case, messages for users should not be written to stdout.
+func (o *outputOptions) isMachineReadable() bool {
+	return o.format != formatJSON
+}
+
+func (o *outputOptions) masksToken() bool {
+	return o.format == formatJSON && o.interactive && !o.showToken
+}
+
+func writeToken(w io.Writer, token *auth.TokenResponse, o *outputOptions) error {
+	if o.masksToken() {
+		writeMaskedToken(w, token, time.Now(), o.timeFormat)
+		return nil
+	}
+
+	switch o.format {
+	case formatRaw:
+		fmt.Fprintln(w, token.AccessToken)
+		return nil
+	case formatK8sSecret:
+		return writeK8sSecret(w, token, o.name, o.namespace)
+	case formatTerraformExternal:
+		return writeTerraformExternal(w, token)
+	default:
+		tokenJSON, err := json.Marshal(token)
+		if err != nil {
+			return fmt.Errorf("cannot encode token response to json: %w", err)
+		}
+
+		fmt.Fprintln(w, string(tokenJSON))
+		return nil
+	}
+}
+
+// writeErrorLine writes err in a line of JSON like error responses of OAuth, for --quiet.
+// error is the error code of the server if available.
+func writeErrorLine(w io.Writer, err error, redactor *auth.Redactor) {
+	description := err.Error()
+	if redactor != nil {
+		description = redactor.String(description)
+	}
+	v := map[string]string{"error": "error", "error_description": description}
+
+	var apiErr *auth.APIError
+	var expiredErr *auth.ExpiredError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Body != nil && apiErr.Body.Error != "":
+		v["error"] = apiErr.Body.Error
+	case errors.As(err, &expiredErr):
+		v["error"] = "expired_token"
+	}
+
+	b, _ := json.Marshal(v)
+	fmt.Fprintln(w, string(b))
+}
+
+// writeMaskedToken writes only a preview of tokens, to prevent tokens from leaking via terminal scrollback or screenshots.
+func writeMaskedToken(w io.Writer, token *auth.TokenResponse, now time.Time, timeFormat string) {
+	tokens := []struct {
+		label string
+		value string
+	}{
+		{"Access Token", token.AccessToken},
+		{"Refresh Token", token.RefreshToken},
+		{"ID Token", token.IdToken},
+	}
+
+	for _, t := range tokens {
+		if t.value == "" {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s (%d characters)\n", t.label, maskToken(t.value), len(t.value))
+	}
+	fmt.Fprintf(w, "Token Type: %s\n", token.TokenType)
+	fmt.Fprintf(w, "Expires: %s\n", formatTime(now.Add(time.Duration(token.ExpiresIn)*time.Second), now, timeFormat))
+	fmt.Fprintln(w, "(use --show-token or --format raw to show the full token)")
+}
+
+func maskToken(token string) string {
+	previewLen := 5
+	if len(token)/2 < previewLen {
+		previewLen = len(token) / 2
+	}
+
+	return token[:previewLen] + "…truncated…"
+}
+
+func writeK8sSecret(w io.Writer, token *auth.TokenResponse, name, namespace string) error {
+	data := []struct {
+		key   string
+		value string
+	}{
+		{"access_token", token.AccessToken},
+		{"refresh_token", token.RefreshToken},
+		{"id_token", token.IdToken},
+		{"token_type", token.TokenType},
+		{"expires_in", strconv.Itoa(token.ExpiresIn)},
+	}
+
+	fmt.Fprintln(w, "apiVersion: v1")
+	fmt.Fprintln(w, "kind: Secret")
+	fmt.Fprintln(w, "metadata:")
+	fmt.Fprintf(w, "  name: %s\n", strconv.Quote(name))
+	if namespace != "" {
+		fmt.Fprintf(w, "  namespace: %s\n", strconv.Quote(namespace))
+	}
+	fmt.Fprintln(w, "type: Opaque")
+	fmt.Fprintln(w, "data:")
+	for _, d := range data {
+		if d.value == "" {
+			continue
+		}
+		fmt.Fprintf(w, "  %s: %s\n", d.key, base64.StdEncoding.EncodeToString([]byte(d.value)))
+	}
+
+	return nil
+}
+
+// writeTerraformExternal writes token as a flat string map, as required by the external data source of Terraform.
+//
+// See: https://registry.terraform.io/providers/hashicorp/external/latest/docs/data-sources/external#external-program-protocol
+func writeTerraformExternal(w io.Writer, token *auth.TokenResponse) error {
+	result := map[string]string{
+		"access_token":  token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"id_token":      token.IdToken,
+		"token_type":    token.TokenType,
+		"expires_in":    strconv.Itoa(token.ExpiresIn),
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("cannot encode token response to json: %w", err)
+	}
+
+	fmt.Fprintln(w, string(resultJSON))
+	return nil
+}
+
+// readTerraformQuery reads the query of the external data source of Terraform.
+//
+// The query can override the configurations with keys base_url, client_id, scope and audience.
+func readTerraformQuery(r io.Reader) (map[string]string, error) {
+	query := make(map[string]string)
+	if err := json.NewDecoder(r).Decode(&query); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("cannot decode query: %w", err)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newPingCommand(stdout, stderr io.Writer) *cobra.Command {
+	countFlag := "count"
+
+	cmd := &cobra.Command{
+		Use:   "ping",
+		Short: "check reachability and latency of the tenant",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			count, err := cmd.Flags().GetInt(countFlag)
+			if err != nil {
+				return err
+			}
+
+			lookup, err := lookupWithProfile(os.LookupEnv)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			baseURL, ok := lookup(baseURLEnv)
+			if !ok {
+				err := fmt.Errorf("undefined environment variables: %s", baseURLEnv)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			baseURL = strings.TrimSuffix(baseURL, "/")
+
+			urls := []string{
+				baseURL + "/.well-known/openid-configuration",
+				baseURL + "/.well-known/jwks.json",
+			}
+			for i := 0; i < count; i++ {
+				for _, url := range urls {
+					if err := ping(stdout, url); err != nil {
+						fmt.Fprintln(stderr, err)
+						return err
+					}
+				}
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Int(countFlag, 1, "number of times to send requests")
+
+	return cmd
+}
+
+// ping requests url and writes its latency and TLS details.
+func ping(w io.Writer, url string) error {
+	var start, dnsStart, dnsDone, connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	var reused bool
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { connectDone = time.Now() },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotConn:              func(info httptrace.GotConnInfo) { reused = info.Reused },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start = time.Now()
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request was failed: %w", err)
+	}
+	defer res.Body.Close()
+	if _, err := io.Copy(io.Discard, res.Body); err != nil {
+		return fmt.Errorf("could not read response body: %w", err)
+	}
+	total := time.Since(start)
+
+	since := func(from, to time.Time) string {
+		if from.IsZero() || to.IsZero() {
+			return "-"
+		}
+		return to.Sub(from).Round(time.Millisecond).String()
+	}
+
+	fmt.Fprintf(w, "GET %s: %s\n", url, res.Status)
+	if reused {
+		fmt.Fprintf(w, "  reused connection, first byte %s, total %s\n", since(start, firstByte), total.Round(time.Millisecond))
+	} else {
+		fmt.Fprintf(w, "  dns %s, connect %s, tls %s, first byte %s, total %s\n",
+			since(dnsStart, dnsDone), since(connectStart, connectDone), since(tlsStart, tlsDone), since(start, firstByte), total.Round(time.Millisecond))
+	}
+	if res.TLS != nil {
+		fmt.Fprintf(w, "  %s, %s, server name %s\n", tls.VersionName(res.TLS.Version), tls.CipherSuiteName(res.TLS.CipherSuite), res.TLS.ServerName)
+	}
+
+	return nil
+}
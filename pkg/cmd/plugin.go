@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// pluginPrefix is the prefix of executables of plugins.
+// Like kubectl, `a0daf foo args...` runs `a0daf-foo args...` on PATH when foo is not a builtin subcommand.
+const pluginPrefix = "a0daf-"
+
+// lookupPlugin returns the path of the plugin executable for the subcommand name.
+func lookupPlugin(name string) (string, bool) {
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return "", false
+	}
+
+	return path, true
+}
+
+// runPlugin runs the plugin with args.
+//
+// The plugin inherits environment variables, and the configurations resolved by a0daf are exported to it (see pluginEnv).
+// A0DAF_EXECUTABLE is set to the path of a0daf so that the plugin can invoke it.
+func runPlugin(path string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	env, err := pluginEnv(os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return err
+	}
+
+	c := exec.Command(path, args...)
+	c.Stdin = stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+	c.Env = append(os.Environ(), env...)
+	if exe, err := os.Executable(); err == nil {
+		c.Env = append(c.Env, "A0DAF_EXECUTABLE="+exe)
+	}
+
+	if err := c.Run(); err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return fmt.Errorf("plugin %s exited with status %d", path, exitError.ExitCode())
+		}
+		err = fmt.Errorf("cannot run plugin %s: %w", path, err)
+		fmt.Fprintln(stderr, err)
+		return err
+	}
+
+	return nil
+}
+
+// pluginEnv returns environment variables exported to plugins in addition to the inherited ones.
+//
+// They are the path of the config file as A0DAF_CONFIG, the active profile as A0DAF_PROFILE if it is defined (even if it is selected by .a0daf-profile),
+// and configurations like A0DAF_BASE_URL in the profile, so that plugins see the same configurations as a0daf.
+// Configurations given by environment variables are inherited as they are.
+func pluginEnv(lookupEnv func(key string) (string, bool)) ([]string, error) {
+	name, path, profile, err := loadProfile(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{configEnv + "=" + path}
+	if profile != nil {
+		env = append(env, profileEnv+"="+name)
+	}
+	keys := make([]string, 0, len(configKeys))
+	for key := range configKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := lookupEnv(key); ok {
+			continue
+		}
+		if v, ok := profile[configKeys[key]]; ok {
+			env = append(env, key+"="+v)
+		}
+	}
+
+	return env, nil
+}
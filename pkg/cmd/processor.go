@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// commandTokenProcessor returns the token processor which pipes tokens through the command line of A0DAF_TOKEN_PROCESSOR,
+// so that organizations can shape tokens in one place for all of logins, refreshes and batches.
+//
+// The command reads the token response in JSON (including fields not modeled like scope) from stdin,
+// and writes the token response to use instead to stdout. Like plugins, A0DAF_EXECUTABLE is set to the path of a0daf.
+func commandTokenProcessor(command string) auth.WithTokenProcessor {
+	return func(ctx context.Context, t *auth.TokenResponse) (*auth.TokenResponse, error) {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			return t, nil
+		}
+
+		in, err := encodeTokenResponse(t)
+		if err != nil {
+			return nil, err
+		}
+
+		var stdout, stderr bytes.Buffer
+		c := exec.CommandContext(ctx, args[0], args[1:]...)
+		c.Stdin = bytes.NewReader(in)
+		c.Stdout = &stdout
+		c.Stderr = &stderr
+		c.Env = os.Environ()
+		if exe, err := os.Executable(); err == nil {
+			c.Env = append(c.Env, "A0DAF_EXECUTABLE="+exe)
+		}
+
+		if err := c.Run(); err != nil {
+			var exitError *exec.ExitError
+			if errors.As(err, &exitError) {
+				err = fmt.Errorf("token processor %s exited with status %d", args[0], exitError.ExitCode())
+				if msg := strings.TrimSpace(stderr.String()); msg != "" {
+					err = fmt.Errorf("%w: %s", err, msg)
+				}
+				return nil, err
+			}
+			return nil, fmt.Errorf("cannot run token processor %s: %w", args[0], err)
+		}
+
+		processed := new(auth.TokenResponse)
+		if err := json.Unmarshal(stdout.Bytes(), processed); err != nil {
+			return nil, fmt.Errorf("cannot decode token from token processor %s: %w", args[0], err)
+		}
+		if processed.AccessToken == "" {
+			return nil, fmt.Errorf("token processor %s returned no access token", args[0])
+		}
+		processed.Metadata = t.Metadata
+
+		return processed, nil
+	}
+}
+
+// encodeTokenResponse encodes t in JSON with Extra, which is dropped by json.Marshal.
+func encodeTokenResponse(t *auth.TokenResponse) ([]byte, error) {
+	v := make(map[string]interface{}, len(t.Extra)+5)
+	for k, raw := range t.Extra {
+		v[k] = raw
+	}
+	v["access_token"] = t.AccessToken
+	v["token_type"] = t.TokenType
+	v["expires_in"] = t.ExpiresIn
+	if t.RefreshToken != "" {
+		v["refresh_token"] = t.RefreshToken
+	}
+	if t.IdToken != "" {
+		v["id_token"] = t.IdToken
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode token response to json: %w", err)
+	}
+	return b, nil
+}
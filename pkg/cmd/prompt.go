@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/headless"
+)
+
+const (
+	promptAuto   = "auto"
+	promptPlain  = "plain"
+	promptTUI    = "tui"
+	promptJSON   = "json"
+	promptSilent = "silent"
+)
+
+// prompter shows the device code and the result of the flow to the user.
+// New presentation modes can be added by implementing it without changing the flow.
+type prompter interface {
+	// deviceCode is called each time a device code is issued.
+	deviceCode(dc *auth.DeviceCodeResponse) error
+	// remind is called while polling has waited for authorization for a while, to show the device code again.
+	remind(dc *auth.DeviceCodeResponse, waited time.Duration)
+	// done is called when polling is finished. err is nil when authorized.
+	done(err error)
+}
+
+// promptOptions specifies what to show in prompters.
+type promptOptions struct {
+	complete      bool
+	serverMessage bool
+	timeFormat    string
+	// flowID is included in events of promptJSON.
+	flowID string
+}
+
+func validatePrompt(mode string) error {
+	switch mode {
+	case promptAuto, promptPlain, promptTUI, promptJSON, promptSilent:
+		return nil
+	default:
+		return fmt.Errorf("unknown prompt: %s", mode)
+	}
+}
+
+// newPrompter returns the prompter of mode writing to w.
+// promptAuto selects promptTUI when w is a terminal and promptPlain otherwise.
+func newPrompter(mode string, w io.Writer, o *promptOptions) (prompter, error) {
+	if mode == promptAuto {
+		mode = promptPlain
+		if isTerminal(w) {
+			mode = promptTUI
+		}
+	}
+
+	switch mode {
+	case promptPlain:
+		return &plainPrompter{w: w, o: o}, nil
+	case promptTUI:
+		return &tuiPrompter{w: w, o: o}, nil
+	case promptJSON:
+		return &jsonPrompter{enc: json.NewEncoder(w), flowID: o.flowID}, nil
+	case promptSilent:
+		return silentPrompter{}, nil
+	default:
+		return nil, validatePrompt(mode)
+	}
+}
+
+// plainPrompter shows the device code as plain lines.
+type plainPrompter struct {
+	w io.Writer
+	o *promptOptions
+}
+
+func (p *plainPrompter) deviceCode(dc *auth.DeviceCodeResponse) error {
+	printDeviceCode(p.w, dc, p.o.complete, p.o.serverMessage, p.o.timeFormat)
+	return nil
+}
+
+func (p *plainPrompter) remind(dc *auth.DeviceCodeResponse, waited time.Duration) {
+	fmt.Fprintf(p.w, "Still waiting for authorization (%s):\n", waited.Round(time.Second))
+	printDeviceCode(p.w, dc, p.o.complete, p.o.serverMessage, p.o.timeFormat)
+}
+
+func (p *plainPrompter) done(err error) {}
+
+// tuiPrompter highlights the device code and shows the status of polling on a terminal.
+type tuiPrompter struct {
+	w io.Writer
+	o *promptOptions
+}
+
+const (
+	ansiBold      = "\x1b[1m"
+	ansiUnderline = "\x1b[4m"
+	ansiReset     = "\x1b[0m"
+	// ansiClearLine moves the cursor to the start of the line and clears it.
+	ansiClearLine = "\r\x1b[K"
+)
+
+func (p *tuiPrompter) deviceCode(dc *auth.DeviceCodeResponse) error {
+	if p.o.serverMessage && dc.Message != "" {
+		fmt.Fprintln(p.w, dc.Message)
+	} else {
+		url := dc.VerificationURI
+		if p.o.complete {
+			url = dc.VerificationURIComplete
+		}
+		fmt.Fprintf(p.w, "Code: %s%s%s\n", ansiBold, dc.UserCode, ansiReset)
+		fmt.Fprintf(p.w, "Access: %s%s%s\n", ansiUnderline, url, ansiReset)
+	}
+	fmt.Fprintf(p.w, "Expires: %s\n", formatTime(dc.ExpiresAt, time.Now(), p.o.timeFormat))
+
+	if env := headless.Detect(); env.IsHeadless() {
+		fmt.Fprintln(p.w, env.Instruction())
+	}
+
+	fmt.Fprint(p.w, "Waiting for authorization...")
+	return nil
+}
+
+func (p *tuiPrompter) remind(dc *auth.DeviceCodeResponse, waited time.Duration) {
+	url := dc.VerificationURI
+	if p.o.complete {
+		url = dc.VerificationURIComplete
+	}
+	fmt.Fprintf(p.w, "%sStill waiting for authorization (%s)\n", ansiClearLine, waited.Round(time.Second))
+	fmt.Fprintf(p.w, "Code: %s%s%s\n", ansiBold, dc.UserCode, ansiReset)
+	fmt.Fprintf(p.w, "Access: %s%s%s\n", ansiUnderline, url, ansiReset)
+	fmt.Fprintf(p.w, "Expires: %s\n", formatTime(dc.ExpiresAt, time.Now(), p.o.timeFormat))
+	fmt.Fprint(p.w, "Waiting for authorization...")
+}
+
+func (p *tuiPrompter) done(err error) {
+	if err != nil {
+		fmt.Fprintln(p.w, ansiClearLine+"Not authorized.")
+		return
+	}
+	fmt.Fprintln(p.w, ansiClearLine+"Authorized.")
+}
+
+// jsonPrompter writes events of the flow as JSON lines, for wrappers like GUI or IDE extensions.
+type jsonPrompter struct {
+	enc    *json.Encoder
+	flowID string
+}
+
+type promptEvent struct {
+	// Event is "device_code", "reminder", "authorized" or "failed".
+	Event                   string `json:"event"`
+	FlowID                  string `json:"flow_id,omitempty"`
+	UserCode                string `json:"user_code,omitempty"`
+	VerificationURI         string `json:"verification_uri,omitempty"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	Message                 string `json:"message,omitempty"`
+	ExpiresAt               string `json:"expires_at,omitempty"`
+	WaitedSec               int    `json:"waited_sec,omitempty"`
+	Error                   string `json:"error,omitempty"`
+}
+
+func (p *jsonPrompter) deviceCode(dc *auth.DeviceCodeResponse) error {
+	return p.enc.Encode(&promptEvent{
+		Event:                   "device_code",
+		FlowID:                  p.flowID,
+		UserCode:                dc.UserCode,
+		VerificationURI:         dc.VerificationURI,
+		VerificationURIComplete: dc.VerificationURIComplete,
+		Message:                 dc.Message,
+		ExpiresAt:               dc.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+func (p *jsonPrompter) remind(dc *auth.DeviceCodeResponse, waited time.Duration) {
+	p.enc.Encode(&promptEvent{
+		Event:                   "reminder",
+		FlowID:                  p.flowID,
+		UserCode:                dc.UserCode,
+		VerificationURI:         dc.VerificationURI,
+		VerificationURIComplete: dc.VerificationURIComplete,
+		ExpiresAt:               dc.ExpiresAt.Format(time.RFC3339),
+		WaitedSec:               int(waited / time.Second),
+	})
+}
+
+func (p *jsonPrompter) done(err error) {
+	if err != nil {
+		p.enc.Encode(&promptEvent{Event: "failed", FlowID: p.flowID, Error: err.Error()})
+		return
+	}
+	p.enc.Encode(&promptEvent{Event: "authorized", FlowID: p.flowID})
+}
+
+// silentPrompter shows nothing, e.g. when the URL is opened by --open or shown by --qr-file.
+type silentPrompter struct{}
+
+func (silentPrompter) deviceCode(dc *auth.DeviceCodeResponse) error {
+	return nil
+}
+
+func (silentPrompter) remind(dc *auth.DeviceCodeResponse, waited time.Duration) {}
+
+func (silentPrompter) done(err error) {}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// newRedactor returns the redactor shared by dry run, reports, error messages and spans,
+// with extra sensitive names given by A0DAF_REDACT, which are separated by commas or spaces.
+func newRedactor(names string) *auth.Redactor {
+	r := auth.NewRedactor()
+	r.AddNames(strings.FieldsFunc(names, func(c rune) bool { return c == ',' || unicode.IsSpace(c) })...)
+	return r
+}
+
+// redactWriter redacts secrets in each write, which is a whole message written by fmt.Fprint* in this package.
+type redactWriter struct {
+	w        io.Writer
+	redactor *auth.Redactor
+}
+
+func (rw *redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(rw.redactor.Bytes(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/clipboard"
+)
+
+// startReminder calls remind with the elapsed time every interval until the returned stop is called,
+// so that users who lost the device code in scrollback can find it again. It does nothing when interval is not positive.
+//
+// stop waits for remind being called, so that nothing is written after stop returns.
+func startReminder(interval time.Duration, remind func(waited time.Duration)) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		start := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				remind(now.Sub(start))
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// copyUserCode copies the user code to the clipboard, warning to w on failure because it is optional.
+func copyUserCode(w io.Writer, dc *auth.DeviceCodeResponse) {
+	if err := clipboard.Copy(dc.UserCode); err != nil {
+		fmt.Fprintf(w, "warning: %s\n", err)
+	}
+}
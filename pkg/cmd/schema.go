@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSchema is the JSON Schema of the config file.
+//
+//go:embed config.schema.json
+var configSchema []byte
+
+// parsedConfigSchema is configSchema used to validate config files.
+var parsedConfigSchema = mustParseSchema(configSchema)
+
+// jsonSchema is the subset of JSON Schema which config.schema.json uses.
+//
+// Keywords out of the subset are rejected on parsing, so that the schema cannot have rules which are not validated.
+type jsonSchema struct {
+	Schema               string                 `json:"$schema"`
+	ID                   string                 `json:"$id"`
+	Title                string                 `json:"title"`
+	Description          string                 `json:"description"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties *additionalProperties  `json:"additionalProperties"`
+}
+
+// additionalProperties is a boolean or a schema of additionalProperties.
+type additionalProperties struct {
+	allowed bool
+	schema  *jsonSchema
+}
+
+func (a *additionalProperties) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &a.allowed); err == nil {
+		return nil
+	}
+
+	schema, err := parseSchema(b)
+	if err != nil {
+		return err
+	}
+	a.allowed = true
+	a.schema = schema
+	return nil
+}
+
+func parseSchema(b []byte) (*jsonSchema, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	s := new(jsonSchema)
+	if err := d.Decode(s); err != nil {
+		return nil, err
+	}
+
+	switch s.Type {
+	case "object", "string":
+	default:
+		return nil, fmt.Errorf("unsupported type %q", s.Type)
+	}
+	if s.Format != "" && s.Format != "uri" {
+		return nil, fmt.Errorf("unsupported format %q", s.Format)
+	}
+
+	return s, nil
+}
+
+func mustParseSchema(b []byte) *jsonSchema {
+	s, err := parseSchema(b)
+	if err != nil {
+		panic(fmt.Sprintf("invalid config.schema.json: %s", err))
+	}
+	return s
+}
+
+// configError represents a violation of the schema in the config file.
+type configError struct {
+	path    string
+	line    int
+	column  int
+	message string
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.path, e.line, e.column, e.message)
+}
+
+// validateConfigFile validates the YAML document of the config file against config.schema.json.
+func validateConfigFile(path string, doc *yaml.Node) error {
+	if doc.Kind == 0 {
+		// empty file
+		return nil
+	}
+
+	root := doc
+	if root.Kind == yaml.DocumentNode {
+		root = root.Content[0]
+	}
+
+	return validateNode(path, root, parsedConfigSchema, "")
+}
+
+// validateNode validates the YAML node at location (like "profiles.default") against the schema.
+func validateNode(path string, n *yaml.Node, schema *jsonSchema, location string) error {
+	errorAt := func(n *yaml.Node, format string, args ...interface{}) error {
+		return &configError{path: path, line: n.Line, column: n.Column, message: fmt.Sprintf(format, args...)}
+	}
+
+	name := location
+	if name == "" {
+		name = "root"
+	}
+
+	switch schema.Type {
+	case "object":
+		if n.Kind != yaml.MappingNode {
+			return errorAt(n, "%s must be a mapping", name)
+		}
+
+		for i := 0; i < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			child := key.Value
+			if location != "" {
+				child = location + "." + key.Value
+			}
+
+			if s, ok := schema.Properties[key.Value]; ok {
+				if err := validateNode(path, value, s, child); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if schema.AdditionalProperties == nil {
+				continue
+			}
+			if !schema.AdditionalProperties.allowed {
+				if location == "" {
+					return errorAt(key, "unknown key %q", key.Value)
+				}
+				return errorAt(key, "unknown key %q in %s", key.Value, location)
+			}
+			if s := schema.AdditionalProperties.schema; s != nil {
+				if err := validateNode(path, value, s, child); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		if n.Kind != yaml.ScalarNode || n.Tag != "!!str" {
+			return errorAt(n, "%s must be a string", name)
+		}
+		if schema.Format == "uri" {
+			if u, err := neturl.Parse(n.Value); err != nil || u.Scheme == "" {
+				return errorAt(n, "%s must be an absolute URI", name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const latestReleaseURL = "https://api.github.com/repos/autopp/go-a0daf/releases/latest"
+
+// selfUpdateTimeout is the timeout of each request of self-update, including the download of the archive.
+const selfUpdateTimeout = 60 * time.Second
+
+var selfUpdateClient = &http.Client{Timeout: selfUpdateTimeout}
+
+// release represents a response of GitHub's release API.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) assetURL(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.BrowserDownloadURL, nil
+		}
+	}
+
+	return "", fmt.Errorf("release %s does not contain %s", r.TagName, name)
+}
+
+func newSelfUpdateCommand(version string, stdout, stderr io.Writer) *cobra.Command {
+	checkOnlyFlag := "check-only"
+
+	cmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "update a0daf to the latest release",
+		Long: `Update a0daf to the latest release.
+
+The downloaded archive is verified with checksums.txt of the same release.
+It detects corrupted downloads, but it is not a signature and does not prove who published the release.
+Development builds are not updated, and releases older than the running binary are never installed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checkOnly, err := cmd.Flags().GetBool(checkOnlyFlag)
+			if err != nil {
+				return err
+			}
+
+			latest := new(release)
+			if err := getJSON(latestReleaseURL, latest); err != nil {
+				err = fmt.Errorf("cannot get the latest release: %w", err)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			latestVersion, err := parseVersion(latest.TagName)
+			if err != nil {
+				err = fmt.Errorf("cannot get the latest release: %w", err)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			current, err := parseVersion(version)
+			if err != nil {
+				if checkOnly {
+					fmt.Fprintf(stdout, "a0daf %s is available (current: %s, development build)\n", latest.TagName, version)
+					return nil
+				}
+				err = fmt.Errorf("cannot update a development build (%s), install a release instead", version)
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			if latestVersion.compare(current) <= 0 {
+				fmt.Fprintf(stdout, "a0daf %s is up to date\n", version)
+				return nil
+			}
+
+			if checkOnly {
+				fmt.Fprintf(stdout, "a0daf %s is available (current: %s)\n", latest.TagName, version)
+				return nil
+			}
+
+			if err := updateExecutable(latest); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			fmt.Fprintf(stdout, "updated a0daf from %s to %s\n", version, latest.TagName)
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool(checkOnlyFlag, false, "only check whether a new release is available")
+
+	return cmd
+}
+
+// semanticVersion is a version of releases like v1.2.3 or 1.2.3-rc.1. Build metadata is ignored.
+type semanticVersion struct {
+	core       [3]int
+	prerelease []string
+}
+
+// parseVersion parses a tag of releases like v0.1.0, or the version of goreleaser like 0.1.0.
+func parseVersion(v string) (*semanticVersion, error) {
+	s := strings.TrimPrefix(v, "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+
+	sv := new(semanticVersion)
+	if i := strings.Index(s, "-"); i >= 0 {
+		sv.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%q is not a semantic version", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%q is not a semantic version", v)
+		}
+		sv.core[i] = n
+	}
+
+	return sv, nil
+}
+
+// compare returns a negative number, 0 or a positive number when v precedes, equals or follows other.
+//
+// See: https://semver.org/#spec-item-11
+func (v *semanticVersion) compare(other *semanticVersion) int {
+	for i := range v.core {
+		if v.core[i] != other.core[i] {
+			return v.core[i] - other.core[i]
+		}
+	}
+
+	// a prerelease precedes the release
+	if len(v.prerelease) == 0 || len(other.prerelease) == 0 {
+		return len(other.prerelease) - len(v.prerelease)
+	}
+
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		a, b := v.prerelease[i], other.prerelease[i]
+		if a == b {
+			continue
+		}
+		na, errA := strconv.Atoi(a)
+		nb, errB := strconv.Atoi(b)
+		switch {
+		case errA == nil && errB == nil:
+			return na - nb
+		case errA == nil:
+			// numeric identifiers precede alphanumeric ones
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			return strings.Compare(a, b)
+		}
+	}
+
+	return len(v.prerelease) - len(other.prerelease)
+}
+
+// updateExecutable replaces the running executable with the binary in the release, after verifying its checksum.
+//
+// checksums.txt is published with the archive in the same release, so it detects corruption but not tampering of the release.
+func updateExecutable(r *release) error {
+	// archive name is defined in .goreleaser.yml
+	dir := fmt.Sprintf("a0daf-%s-%s", runtime.GOOS, runtime.GOARCH)
+	archiveName := dir + ".tar.gz"
+
+	archiveURL, err := r.assetURL(archiveName)
+	if err != nil {
+		return err
+	}
+	checksumsURL, err := r.assetURL("checksums.txt")
+	if err != nil {
+		return err
+	}
+
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		return err
+	}
+	archive, err := download(archiveURL)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyChecksum(checksums, archiveName, archive); err != nil {
+		return err
+	}
+
+	binary, err := extractFile(archive, dir+"/a0daf")
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find the executable: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("cannot find the executable: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(exe), ".a0daf.*")
+	if err != nil {
+		return fmt.Errorf("cannot replace the executable: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot replace the executable: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot replace the executable: %w", err)
+	}
+	if err := os.Chmod(f.Name(), 0755); err != nil {
+		return fmt.Errorf("cannot replace the executable: %w", err)
+	}
+	if err := os.Rename(f.Name(), exe); err != nil {
+		return fmt.Errorf("cannot replace the executable: %w", err)
+	}
+
+	return nil
+}
+
+// verifyChecksum verifies content with the SHA-256 checksum of name in checksums.txt generated by goreleaser.
+func verifyChecksum(checksums []byte, name string, content []byte) error {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || fields[1] != name {
+			continue
+		}
+
+		sum := sha256.Sum256(content)
+		if hex.EncodeToString(sum[:]) != fields[0] {
+			return fmt.Errorf("checksum of %s does not match", name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("checksum of %s is not found", name)
+}
+
+func extractFile(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("cannot extract archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive does not contain %s", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot extract archive: %w", err)
+		}
+
+		if h.Name == name {
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot extract archive: %w", err)
+			}
+			return b, nil
+		}
+	}
+}
+
+func getJSON(url string, v interface{}) error {
+	b, err := download(url)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("could not decode response body: %w", err)
+	}
+
+	return nil
+}
+
+func download(url string) ([]byte, error) {
+	res, err := selfUpdateClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("request was failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("request to %s was failed: %s", url, res.Status)
+	}
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parseVersion()", func() {
+	DescribeTable("parses versions with or without the v prefix",
+		func(v string, expected *semanticVersion) {
+			// Act
+			actual, err := parseVersion(v)
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+		},
+		Entry("tag", "v1.2.3", &semanticVersion{core: [3]int{1, 2, 3}}),
+		Entry("without the v prefix", "1.2.3", &semanticVersion{core: [3]int{1, 2, 3}}),
+		Entry("prerelease", "v1.2.3-rc.1", &semanticVersion{core: [3]int{1, 2, 3}, prerelease: []string{"rc", "1"}}),
+		Entry("build metadata", "v1.2.3+abc", &semanticVersion{core: [3]int{1, 2, 3}}),
+		Entry("prerelease and build metadata", "1.2.3-beta+abc", &semanticVersion{core: [3]int{1, 2, 3}, prerelease: []string{"beta"}}),
+	)
+
+	DescribeTable("rejects invalid versions",
+		func(v string) {
+			// Act
+			_, err := parseVersion(v)
+
+			// Assert
+			Expect(err).To(MatchError(fmt.Sprintf("%q is not a semantic version", v)))
+		},
+		Entry("empty", ""),
+		Entry("two parts", "v1.2"),
+		Entry("four parts", "v1.2.3.4"),
+		Entry("not a number", "v1.x.3"),
+		Entry("negative", "v1.-2.3"),
+		Entry("development build", "dev"),
+	)
+})
+
+var _ = Describe("semanticVersion.compare()", func() {
+	DescribeTable("orders versions by the semantic versioning",
+		func(a, b string, expected int) {
+			// Arrange
+			va, err := parseVersion(a)
+			Expect(err).NotTo(HaveOccurred())
+			vb, err := parseVersion(b)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Act
+			actual := va.compare(vb)
+
+			// Assert
+			switch {
+			case expected < 0:
+				Expect(actual).To(BeNumerically("<", 0))
+			case expected > 0:
+				Expect(actual).To(BeNumerically(">", 0))
+			default:
+				Expect(actual).To(BeZero())
+			}
+		},
+		Entry("equal", "v1.2.3", "v1.2.3", 0),
+		Entry("equal with and without the v prefix", "v1.2.3", "1.2.3", 0),
+		Entry("build metadata is ignored", "v1.2.3+a", "v1.2.3+b", 0),
+		Entry("major", "v2.0.0", "v1.9.9", 1),
+		Entry("minor", "v1.2.0", "v1.10.0", -1),
+		Entry("patch", "v1.2.3", "v1.2.4", -1),
+		Entry("prerelease precedes the release", "v1.2.3-rc.1", "v1.2.3", -1),
+		Entry("release follows the prerelease", "v1.2.3", "v1.2.3-rc.1", 1),
+		Entry("prerelease of the next version follows the release", "v1.2.4-alpha", "v1.2.3", 1),
+		Entry("numeric identifiers are compared numerically", "v1.0.0-rc.2", "v1.0.0-rc.10", -1),
+		Entry("alphanumeric identifiers are compared lexically", "v1.0.0-alpha", "v1.0.0-beta", -1),
+		Entry("numeric identifiers precede alphanumeric ones", "v1.0.0-1", "v1.0.0-alpha", -1),
+		Entry("more identifiers follow fewer ones", "v1.0.0-alpha.1", "v1.0.0-alpha", 1),
+	)
+})
+
+var _ = Describe("verifyChecksum()", func() {
+	content := []byte("binary")
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	It("accepts the content matching the entry of the name", func() {
+		// Arrange
+		checksums := []byte(fmt.Sprintf("%s  a0daf_linux_arm64.tar.gz\n%s  a0daf_linux_amd64.tar.gz\n", "0000", checksum))
+
+		// Act
+		err := verifyChecksum(checksums, "a0daf_linux_amd64.tar.gz", content)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("rejects the content",
+		func(checksums string, message string) {
+			// Act
+			err := verifyChecksum([]byte(checksums), "a0daf_linux_amd64.tar.gz", content)
+
+			// Assert
+			Expect(err).To(MatchError(message))
+		},
+		Entry("mismatched", fmt.Sprintf("%s  a0daf_linux_amd64.tar.gz\n", hex.EncodeToString(make([]byte, 32))), "checksum of a0daf_linux_amd64.tar.gz does not match"),
+		Entry("missing entry", fmt.Sprintf("%s  a0daf_darwin_amd64.tar.gz\n", checksum), "checksum of a0daf_linux_amd64.tar.gz is not found"),
+		Entry("entry of the name with a suffix", fmt.Sprintf("%s  a0daf_linux_amd64.tar.gz.sig\n", checksum), "checksum of a0daf_linux_amd64.tar.gz is not found"),
+		Entry("empty checksums", "", "checksum of a0daf_linux_amd64.tar.gz is not found"),
+	)
+})
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/autopp/go-a0daf/pkg/mockauth"
+	"github.com/spf13/cobra"
+)
+
+func newServeOIDCStubCommand(stdout, stderr io.Writer) *cobra.Command {
+	addrFlag := "addr"
+	userFlag := "user"
+
+	cmd := &cobra.Command{
+		Use:   "serve-oidc-stub",
+		Short: "serve a minimal OIDC provider stub for local development",
+		Long: `Serve a minimal OIDC provider stub for local development.
+
+It serves the discovery, JWKS, device code and token endpoints.
+Device codes are authorized immediately for the first user, or the user whose subject is given as login_hint.
+Users are given as --user SUBJECT[,CLAIM=VALUE...] like --user 'auth0|alice,email=alice@example.com'.
+
+Users are not authenticated at all. Never use it in production.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			addr, err := cmd.Flags().GetString(addrFlag)
+			if err != nil {
+				return err
+			}
+
+			userSpecs, err := cmd.Flags().GetStringArray(userFlag)
+			if err != nil {
+				return err
+			}
+
+			users := make([]mockauth.User, 0, len(userSpecs))
+			for _, spec := range userSpecs {
+				user, err := parseStubUser(spec)
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				users = append(users, user)
+			}
+
+			s, err := mockauth.New(users)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			srv := &http.Server{Handler: s}
+			errCh := make(chan error, 1)
+			go func() { errCh <- srv.Serve(ln) }()
+
+			fmt.Fprintf(stdout, "Serving OIDC stub on http://%s/ (%s=http://%s)\n", ln.Addr(), baseURLEnv, ln.Addr())
+
+			sigCh := make(chan os.Signal, 1)
+			signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sigCh)
+
+			select {
+			case err := <-errCh:
+				fmt.Fprintln(stderr, err)
+				return err
+			case <-sigCh:
+				return srv.Shutdown(context.Background())
+			}
+		},
+	}
+
+	cmd.Flags().String(addrFlag, "127.0.0.1:8080", "address to listen on")
+	cmd.Flags().StringArray(userFlag, []string{"auth0|user"}, "user as SUBJECT[,CLAIM=VALUE...] (repeatable, the first one is the default)")
+
+	return cmd
+}
+
+// parseStubUser parses SUBJECT[,CLAIM=VALUE...]. Values of claims are strings.
+func parseStubUser(spec string) (mockauth.User, error) {
+	fields := strings.Split(spec, ",")
+	user := mockauth.User{Subject: fields[0], Claims: make(map[string]interface{}, len(fields)-1)}
+	if user.Subject == "" {
+		return mockauth.User{}, fmt.Errorf("invalid user %q: subject is required", spec)
+	}
+
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok || name == "" {
+			return mockauth.User{}, fmt.Errorf("invalid user %q: claim must be CLAIM=VALUE", spec)
+		}
+		user.Claims[name] = value
+	}
+
+	return user, nil
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+const (
+	statsText = "text"
+	statsJSON = "json"
+)
+
+// loginStats is a summary of the flow shown by --stats.
+type loginStats struct {
+	FlowID string
+	// TimeToDeviceCode is the duration until the last device code is issued.
+	TimeToDeviceCode time.Duration
+	Polls            int
+	Reissues         int
+	// Connections is how requests of the flow got connections, to see whether handshakes are repeated.
+	Connections auth.ConnectionStats
+	Total       time.Duration
+	// ExpiresAt is the expiry of the access token. It is zero when the flow failed.
+	ExpiresAt time.Time
+}
+
+func writeStats(w io.Writer, format string, timeFormat string, s *loginStats) error {
+	switch format {
+	case statsText:
+		fmt.Fprintf(w, "Flow ID: %s\n", s.FlowID)
+		fmt.Fprintf(w, "Time to device code: %s\n", s.TimeToDeviceCode.Round(time.Millisecond))
+		fmt.Fprintf(w, "Polls: %d\n", s.Polls)
+		fmt.Fprintf(w, "Reissues: %d\n", s.Reissues)
+		fmt.Fprintf(w, "Connections: %d new, %d reused\n", s.Connections.Requests-s.Connections.Reused, s.Connections.Reused)
+		fmt.Fprintf(w, "Total: %s\n", s.Total.Round(time.Millisecond))
+		if !s.ExpiresAt.IsZero() {
+			fmt.Fprintf(w, "Token expires: %s\n", formatTime(s.ExpiresAt, time.Now(), timeFormat))
+		}
+		return nil
+	case statsJSON:
+		v := map[string]interface{}{
+			"flow_id":                s.FlowID,
+			"time_to_device_code_ms": s.TimeToDeviceCode.Milliseconds(),
+			"polls":                  s.Polls,
+			"reissues":               s.Reissues,
+			"new_connections":        s.Connections.Requests - s.Connections.Reused,
+			"reused_connections":     s.Connections.Reused,
+			"total_ms":               s.Total.Milliseconds(),
+		}
+		if !s.ExpiresAt.IsZero() {
+			v["expires_at"] = s.ExpiresAt.Format(time.RFC3339)
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("could not encode stats: %w", err)
+		}
+		fmt.Fprintln(w, string(b))
+		return nil
+	default:
+		return fmt.Errorf("unknown stats format: %s", format)
+	}
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// Phases of the flow written to the status file.
+const (
+	phaseRequestingCode = "requesting_code"
+	phaseWaitingForUser = "waiting_for_user"
+	phaseAuthorized     = "authorized"
+	phaseRefreshing     = "refreshing"
+	phaseFailed         = "failed"
+)
+
+// flowStatus is the state of the flow written to the status file, for supervisors like systemd watchdogs.
+type flowStatus struct {
+	Phase           string     `json:"phase"`
+	FlowID          string     `json:"flow_id,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	PID             int        `json:"pid"`
+	UserCode        string     `json:"user_code,omitempty"`
+	VerificationURI string     `json:"verification_uri,omitempty"`
+	CodeExpiresAt   *time.Time `json:"code_expires_at,omitempty"`
+	NextPollAt      *time.Time `json:"next_poll_at,omitempty"`
+	TokenExpiresAt  *time.Time `json:"token_expires_at,omitempty"`
+	NextRefreshAt   *time.Time `json:"next_refresh_at,omitempty"`
+	Reissues        int        `json:"reissues"`
+	LastError       string     `json:"last_error,omitempty"`
+}
+
+// statusFile writes flowStatus to a file or a named pipe on every transition.
+// A regular file is replaced atomically with the latest state, and a line of JSON is written to a named pipe
+// while a reader opens it. Methods of nil do nothing, so that callers need not check whether it is enabled.
+type statusFile struct {
+	path     string
+	warn     io.Writer
+	redactor *auth.Redactor
+	mu       sync.Mutex
+	status   flowStatus
+	// pipe is kept open while the reader of the named pipe is alive, so that it does not see EOF between lines.
+	pipe *os.File
+}
+
+// newStatusFile returns statusFile of the flow writing to path, or nil if path is empty. Failures to write are warned to warn.
+func newStatusFile(path string, flowID string, warn io.Writer, redactor *auth.Redactor) *statusFile {
+	if path == "" {
+		return nil
+	}
+	return &statusFile{path: path, warn: warn, redactor: redactor, status: flowStatus{PID: os.Getpid(), FlowID: flowID}}
+}
+
+// options returns options of DeviceAuthFlow to record the next poll time.
+func (f *statusFile) options() []auth.DeviceAuthFlowOption {
+	if f == nil {
+		return nil
+	}
+	return []auth.DeviceAuthFlowOption{auth.WithTimeSleepContext(f.sleep)}
+}
+
+// sleep records the next poll time, and sleeps until it or ctx is done.
+func (f *statusFile) sleep(ctx context.Context, d time.Duration) error {
+	f.update(func(s *flowStatus) {
+		s.NextPollAt = timeRef(time.Now().Add(d))
+	})
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *statusFile) requestingCode(reissues int) {
+	f.update(func(s *flowStatus) {
+		s.Phase = phaseRequestingCode
+		s.UserCode, s.VerificationURI, s.CodeExpiresAt, s.NextPollAt = "", "", nil, nil
+		s.Reissues = reissues
+	})
+}
+
+// waitingForUser records the device code shown to the user. dc is nil in the authorization code flow.
+func (f *statusFile) waitingForUser(dc *auth.DeviceCodeResponse) {
+	f.update(func(s *flowStatus) {
+		s.Phase = phaseWaitingForUser
+		if dc != nil {
+			s.UserCode, s.VerificationURI, s.CodeExpiresAt = dc.UserCode, dc.VerificationURI, timeRef(dc.ExpiresAt)
+		}
+	})
+}
+
+// authorized records the expiry of the token, and the next refresh time which is zero unless it is refreshed.
+func (f *statusFile) authorized(token *auth.TokenResponse, nextRefresh time.Time) {
+	f.update(func(s *flowStatus) {
+		s.Phase = phaseAuthorized
+		s.UserCode, s.VerificationURI, s.CodeExpiresAt, s.NextPollAt = "", "", nil, nil
+		s.TokenExpiresAt = nil
+		if token.ExpiresIn > 0 {
+			s.TokenExpiresAt = timeRef(time.Now().Add(time.Duration(token.ExpiresIn) * time.Second))
+		}
+		s.NextRefreshAt = nil
+		if !nextRefresh.IsZero() {
+			s.NextRefreshAt = timeRef(nextRefresh)
+		}
+		s.LastError = ""
+	})
+}
+
+func (f *statusFile) refreshing() {
+	f.update(func(s *flowStatus) {
+		s.Phase = phaseRefreshing
+		s.NextRefreshAt = nil
+	})
+}
+
+// failed records err. The phase is kept if the flow continues, e.g. when a new code is issued.
+func (f *statusFile) failed(err error, final bool) {
+	f.update(func(s *flowStatus) {
+		if final {
+			s.Phase = phaseFailed
+			s.NextPollAt = nil
+		}
+		s.LastError = f.redactor.String(err.Error())
+	})
+}
+
+func (f *statusFile) update(fn func(s *flowStatus)) {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fn(&f.status)
+	f.status.UpdatedAt = time.Now()
+	b, err := json.Marshal(&f.status)
+	if err != nil {
+		fmt.Fprintf(f.warn, "warning: cannot encode status: %s\n", err)
+		return
+	}
+	b = append(b, '\n')
+
+	if fi, err := os.Stat(f.path); err == nil && fi.Mode()&os.ModeNamedPipe != 0 {
+		err = f.writePipe(b)
+	} else {
+		err = writeStatusFile(f.path, b)
+	}
+	if err != nil {
+		fmt.Fprintf(f.warn, "warning: %s\n", err)
+	}
+}
+
+// close closes the named pipe if it is open.
+func (f *statusFile) close() {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.pipe != nil {
+		f.pipe.Close()
+		f.pipe = nil
+	}
+}
+
+// writePipe writes b to the named pipe. b is dropped while no reader opens it. f.mu must be held.
+func (f *statusFile) writePipe(b []byte) error {
+	if f.pipe == nil {
+		// opening without readers fails instead of blocking the flow
+		p, err := os.OpenFile(f.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if errors.Is(err, syscall.ENXIO) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot open status file: %w", err)
+		}
+		f.pipe = p
+	}
+
+	if _, err := f.pipe.Write(b); err != nil {
+		f.pipe.Close()
+		f.pipe = nil
+		// the reader has gone, and the next reader gets the next state
+		if errors.Is(err, syscall.EPIPE) {
+			return nil
+		}
+		return fmt.Errorf("cannot write status file: %w", err)
+	}
+	return nil
+}
+
+// writeStatusFile replaces the content of the regular file at path with b atomically.
+func writeStatusFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot create status file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write status file: %w", err)
+	}
+	// the status has no secrets, and supervisors may run as other users
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write status file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write status file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("cannot write status file: %w", err)
+	}
+
+	return nil
+}
+
+func timeRef(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	timeFormatLocal   = "local"
+	timeFormatUTC     = "utc"
+	timeFormatRFC3339 = "rfc3339"
+)
+
+func validateTimeFormat(format string) error {
+	switch format {
+	case timeFormatLocal, timeFormatUTC, timeFormatRFC3339:
+		return nil
+	default:
+		return fmt.Errorf("unknown time format: %s", format)
+	}
+}
+
+// formatTime renders t for users like "in 9m, at 14:32 JST", or as RFC 3339 for scripts.
+// The date is also shown when t is not today.
+func formatTime(t, now time.Time, format string) string {
+	switch format {
+	case timeFormatRFC3339:
+		return t.Format(time.RFC3339)
+	case timeFormatUTC:
+		t = t.UTC()
+		now = now.UTC()
+	default:
+		t = t.Local()
+		now = now.Local()
+	}
+
+	layout := "15:04 MST"
+	if t.Year() != now.Year() || t.YearDay() != now.YearDay() {
+		layout = "2006-01-02 15:04 MST"
+	}
+
+	d := t.Sub(now)
+	if d < 0 {
+		return fmt.Sprintf("%s ago, at %s", humanDuration(-d), t.Format(layout))
+	}
+	return fmt.Sprintf("in %s, at %s", humanDuration(d), t.Format(layout))
+}
+
+// humanDuration rounds d to at most two units, like "9m", "1h30m" or "2d3h".
+func humanDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	case d < 24*time.Hour:
+		h := int(d / time.Hour)
+		if m := int(d%time.Hour) / int(time.Minute); m != 0 {
+			return fmt.Sprintf("%dh%dm", h, m)
+		}
+		return fmt.Sprintf("%dh", h)
+	default:
+		days := int(d / (24 * time.Hour))
+		if h := int(d%(24*time.Hour)) / int(time.Hour); h != 0 {
+			return fmt.Sprintf("%dd%dh", days, h)
+		}
+		return fmt.Sprintf("%dd", days)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+func newTokenCommand(stdout, stderr io.Writer) *cobra.Command {
+	refreshBeforeFlag := "refresh-before"
+	timeFormatFlag := "time-format"
+
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "print the access token saved by --save, refreshing it if needed",
+		Long: `Print the access token of the profile saved by a0daf --save or a0daf watch --save.
+
+The token is refreshed with the refresh token near its expiry, and the refreshed token is saved.
+When the refresh token is rejected (e.g. revoked or rotated away) or no token is saved,
+the device authorization flow is started on stderr if it is a terminal.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			refreshBefore, err := cmd.Flags().GetDuration(refreshBeforeFlag)
+			if err != nil {
+				return err
+			}
+
+			timeFormat, err := cmd.Flags().GetString(timeFormatFlag)
+			if err != nil {
+				return err
+			}
+			if err := validateTimeFormat(timeFormat); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			o, err := tokenStoreOptionsOf(cmd)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			profile, _, err := activeProfile(os.LookupEnv)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			c, err := loadConfig(os.LookupEnv, &configFlags{})
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			stderr := &redactWriter{w: stderr, redactor: c.redactor}
+
+			daf, err := c.newDeviceAuthFlow()
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			s, _, err := o.open(true)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			prompted := false
+			// the code is shown only when the user can see it, and stdout is kept for the token
+			var pr prompter
+			var prompt func(dc *auth.DeviceCodeResponse) error
+			if isTerminal(stderr) {
+				pr, err = newPrompter(promptAuto, stderr, &promptOptions{serverMessage: true, timeFormat: timeFormat})
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					return err
+				}
+				prompt = func(dc *auth.DeviceCodeResponse) error {
+					prompted = true
+					return pr.deviceCode(dc)
+				}
+			}
+
+			m, err := store.NewTokenManager(s, profile, daf, prompt, store.WithScope(c.scope), store.WithAudience(c.audience), store.WithRefreshBefore(refreshBefore))
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			token, err := m.GetAccessToken()
+			if prompted {
+				pr.done(err)
+			}
+			if errors.Is(err, store.ErrAuthorizationRequired) {
+				err = fmt.Errorf("cannot get the token of %s: no valid token is saved or the refresh token is rejected, run a0daf token on a terminal or a0daf --save", profile)
+			}
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			fmt.Fprintln(stdout, token)
+			return nil
+		},
+	}
+
+	cmd.Flags().Duration(refreshBeforeFlag, time.Minute, "how long before expiry to refresh access token")
+	cmd.Flags().String(timeFormatFlag, timeFormatLocal, "how to show expiries (local, utc, rfc3339)")
+	addTokenStoreFlags(cmd)
+
+	return cmd
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+const (
+	backendFile           = "file"
+	backendEncryptedFile  = "encrypted file"
+	backendPassphraseFile = "passphrase-encrypted file"
+)
+
+// flags of the token store shared by login, watch and token
+const (
+	saveFlag          = "save"
+	tokenDirFlag      = "token-dir"
+	keyEnvFlag        = "key-env"
+	passphraseEnvFlag = "passphrase-env"
+)
+
+// addTokenStoreFlags adds the flags of the token store to cmd, which are read by tokenStoreOptionsOf.
+func addTokenStoreFlags(cmd *cobra.Command) {
+	defaultDir, _ := store.DefaultDir()
+	cmd.Flags().String(tokenDirFlag, defaultDir, "directory of the token files")
+	cmd.Flags().String(keyEnvFlag, "", "environment variable of the base64 key to encrypt the token files")
+	cmd.Flags().String(passphraseEnvFlag, "", "environment variable of the passphrase to encrypt the token files")
+}
+
+func tokenStoreOptionsOf(cmd *cobra.Command) (*tokenStoreOptions, error) {
+	dir, err := cmd.Flags().GetString(tokenDirFlag)
+	if err != nil {
+		return nil, err
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("cannot find the directory of the token files, specify --%s", tokenDirFlag)
+	}
+	keyEnv, err := cmd.Flags().GetString(keyEnvFlag)
+	if err != nil {
+		return nil, err
+	}
+	passphraseEnv, err := cmd.Flags().GetString(passphraseEnvFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenStoreOptions{dir: dir, keyEnv: keyEnv, passphraseEnv: passphraseEnv}, nil
+}
+
+// tokenStoreOptions specifies FileStore of the library to keep tokens in, which is given by flags.
+type tokenStoreOptions struct {
+	dir       string
+	namespace string
+	// keyEnv is the environment variable of the base64 encryption key.
+	keyEnv string
+	// passphraseEnv is the environment variable of the passphrase to derive the encryption key from.
+	passphraseEnv string
+}
+
+// open opens the store, and returns it with the name of the backend.
+// The directory is created only when create is true, so that commands only reading tokens leave no trace.
+func (o *tokenStoreOptions) open(create bool) (*store.FileStore, string, error) {
+	if o.keyEnv != "" && o.passphraseEnv != "" {
+		return nil, "", fmt.Errorf("--%s and --%s cannot be used together", keyEnvFlag, passphraseEnvFlag)
+	}
+
+	opts := []store.FileStoreOption{store.WithoutCreatingDir(!create)}
+	if o.namespace != "" {
+		opts = append(opts, store.WithNamespace(o.namespace))
+	}
+
+	var key *store.EncryptionKey
+	backend := backendFile
+	switch {
+	case o.keyEnv != "":
+		k, err := store.EncryptionKeyFromEnv(o.keyEnv)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read encryption key: %w", err)
+		}
+		key, backend = k, backendEncryptedFile
+	case o.passphraseEnv != "":
+		passphrase, ok := os.LookupEnv(o.passphraseEnv)
+		if !ok {
+			return nil, "", fmt.Errorf("cannot read passphrase: environment variable %s is not set", o.passphraseEnv)
+		}
+		k, err := store.NewPassphraseKey(passphrase)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read passphrase: %w", err)
+		}
+		key, backend = k, backendPassphraseFile
+	}
+
+	if key == nil {
+		s, err := store.NewFileStore(o.dir, opts...)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot open token files: %w", err)
+		}
+		return s, backend, nil
+	}
+
+	s, err := store.NewEncryptedFileStore(o.dir, key, opts...)
+	if err != nil {
+		return nil, "", fmt.Errorf("cannot open token files: %w", err)
+	}
+	return s, backend, nil
+}
+
+// tokenSaver saves tokens obtained by login and watch, so that `a0daf token` and `a0daf cache` can use them.
+// The nil tokenSaver saves nothing.
+type tokenSaver struct {
+	store   *store.FileStore
+	profile string
+}
+
+// newTokenSaver opens the store given by the flags to save tokens under the profile of the configuration,
+// or returns nil without --save.
+func newTokenSaver(cmd *cobra.Command, lookupEnv func(key string) (string, bool)) (*tokenSaver, error) {
+	save, err := cmd.Flags().GetBool(saveFlag)
+	if err != nil || !save {
+		return nil, err
+	}
+
+	o, err := tokenStoreOptionsOf(cmd)
+	if err != nil {
+		return nil, err
+	}
+	profile, _, err := activeProfile(lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	s, _, err := o.open(true)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenSaver{store: s, profile: profile}, nil
+}
+
+// save saves token issued at issuedAt.
+func (s *tokenSaver) save(token *auth.TokenResponse, issuedAt time.Time) error {
+	if s == nil {
+		return nil
+	}
+	if err := s.store.Save(s.profile, store.NewToken(token, issuedAt)); err != nil {
+		return fmt.Errorf("cannot save the token of %s: %w", s.profile, err)
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/spf13/cobra"
+)
+
+func newWatchCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
+	fileFlag := "file"
+	refreshBeforeFlag := "refresh-before"
+	completeFlag := "complete"
+	serverMessageFlag := "server-message"
+	openFlag := "open"
+	qrFileFlag := "qr-file"
+	scopeFlag := "scope"
+	audienceFlag := "audience"
+	clientSecretFileFlag := "client-secret-file"
+	clientSecretStdinFlag := "client-secret-stdin"
+	timeFormatFlag := "time-format"
+	promptFlag := "prompt"
+	remindAfterFlag := "remind-after"
+	copyFlag := "copy"
+	statusFileFlag := "status-file"
+	flowIDFlag := "flow-id"
+	flowIDHeaderFlag := "flow-id-header"
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "write access token to a file and keep it fresh until terminated",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, err := cmd.Flags().GetString(fileFlag)
+			if err != nil {
+				return err
+			}
+			if file == "" {
+				err := errors.New("--file is required")
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			refreshBefore, err := cmd.Flags().GetDuration(refreshBeforeFlag)
+			if err != nil {
+				return err
+			}
+
+			complete, err := cmd.Flags().GetBool(completeFlag)
+			if err != nil {
+				return err
+			}
+
+			serverMessage, err := cmd.Flags().GetBool(serverMessageFlag)
+			if err != nil {
+				return err
+			}
+
+			open, err := cmd.Flags().GetBool(openFlag)
+			if err != nil {
+				return err
+			}
+
+			qrFile, err := cmd.Flags().GetString(qrFileFlag)
+			if err != nil {
+				return err
+			}
+
+			remindAfter, err := cmd.Flags().GetDuration(remindAfterFlag)
+			if err != nil {
+				return err
+			}
+
+			copyCode, err := cmd.Flags().GetBool(copyFlag)
+			if err != nil {
+				return err
+			}
+
+			statusFilePath, err := cmd.Flags().GetString(statusFileFlag)
+			if err != nil {
+				return err
+			}
+
+			flowID, err := cmd.Flags().GetString(flowIDFlag)
+			if err != nil {
+				return err
+			}
+			if flowID == "" {
+				flowID = randomHex(8)
+			}
+
+			flowIDHeader, err := cmd.Flags().GetString(flowIDHeaderFlag)
+			if err != nil {
+				return err
+			}
+
+			timeFormat, err := cmd.Flags().GetString(timeFormatFlag)
+			if err != nil {
+				return err
+			}
+			if err := validateTimeFormat(timeFormat); err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			promptMode, err := cmd.Flags().GetString(promptFlag)
+			if err != nil {
+				return err
+			}
+			pr, err := newPrompter(promptMode, stdout, &promptOptions{complete: complete, serverMessage: serverMessage, timeFormat: timeFormat, flowID: flowID})
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			scopes, err := cmd.Flags().GetStringSlice(scopeFlag)
+			if err != nil {
+				return err
+			}
+
+			audiences, err := cmd.Flags().GetStringSlice(audienceFlag)
+			if err != nil {
+				return err
+			}
+
+			clientSecretFile, err := cmd.Flags().GetString(clientSecretFileFlag)
+			if err != nil {
+				return err
+			}
+
+			clientSecretStdin, err := cmd.Flags().GetBool(clientSecretStdinFlag)
+			if err != nil {
+				return err
+			}
+
+			flags := &configFlags{scopes: scopes, audiences: audiences, clientSecretFile: clientSecretFile}
+			if clientSecretStdin {
+				flags.clientSecretStdin = stdin
+			}
+
+			c, err := loadConfig(os.LookupEnv, flags)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+			stderr := &redactWriter{w: stderr, redactor: c.redactor}
+			status := newStatusFile(statusFilePath, flowID, stderr, c.redactor)
+			defer status.close()
+
+			daf, err := c.newDeviceAuthFlow(append(status.options(), flowIDOptions(flowID, flowIDHeader)...)...)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			saver, err := newTokenSaver(cmd, os.LookupEnv)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return err
+			}
+
+			// signals are handled from the first authorization, so that the deferred cleanup runs when terminated at any time
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			authorize := func() (*auth.TokenResponse, error) {
+				stopReminder := func() {}
+				status.requestingCode(0)
+				token, err := authorizeContext(ctx, daf, c.scope, c.audience, func(dc *auth.DeviceCodeResponse) error {
+					if err := pr.deviceCode(dc); err != nil {
+						return err
+					}
+					if open {
+						openVerificationURI(stderr, dc, complete)
+					}
+					if qrFile != "" {
+						if err := writeQRCode(qrFile, dc, complete); err != nil {
+							return err
+						}
+					}
+					if copyCode {
+						copyUserCode(stderr, dc)
+					}
+					status.waitingForUser(dc)
+					// polling starts after the prompt returns
+					stopReminder()
+					stopReminder = startReminder(remindAfter, func(waited time.Duration) {
+						pr.remind(dc, waited)
+						if copyCode {
+							copyUserCode(stderr, dc)
+						}
+					})
+					return nil
+				})
+				stopReminder()
+				pr.done(err)
+				if err != nil {
+					return nil, err
+				}
+
+				if token.RefreshToken == "" {
+					return nil, fmt.Errorf("token response does not contain refresh token, add offline_access to %s", scopeEnv)
+				}
+
+				return token, nil
+			}
+
+			token, err := authorize()
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				status.failed(err, true)
+				return err
+			}
+
+			for {
+				if err := writeTokenFile(file, token.AccessToken); err != nil {
+					fmt.Fprintln(stderr, err)
+					status.failed(err, true)
+					return err
+				}
+				// the rotated refresh token must be saved, or the saved one is rejected
+				if err := saver.save(token, time.Now()); err != nil {
+					fmt.Fprintln(stderr, err)
+					status.failed(err, true)
+					return err
+				}
+
+				// the lead is shortened to the half of the lifetime for short-lived tokens,
+				// and the token without expires_in is never refreshed
+				source := daf.NewCachedTokenSource(token, refreshBefore)
+				refreshAt := source.RefreshAt()
+				now := time.Now()
+				status.authorized(token, refreshAt)
+				if refreshAt.IsZero() {
+					fmt.Fprintf(stdout, "Wrote access token to %s, which never expires\n", file)
+					<-ctx.Done()
+					return nil
+				}
+				fmt.Fprintf(stdout, "Wrote access token to %s, next refresh: %s\n", file, formatTime(refreshAt, now, timeFormat))
+
+				timer := time.NewTimer(refreshAt.Sub(now))
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil
+				case <-timer.C:
+				}
+
+				status.refreshing()
+				refreshed, err := source.Refresh(ctx)
+				// the refresh token is revoked or rotated away, so authorize again if the user can see the code
+				if auth.IsInvalidGrant(err) && isTerminal(stdout) {
+					fmt.Fprintf(stderr, "refresh token was rejected (%s), authorizing again\n", err)
+					refreshed, err = authorize()
+				}
+				if ctx.Err() != nil {
+					return nil
+				}
+				if err != nil {
+					fmt.Fprintln(stderr, err)
+					status.failed(err, true)
+					return err
+				}
+				token = refreshed
+			}
+		},
+	}
+
+	cmd.Flags().String(fileFlag, "", "path of the file to write access token")
+	cmd.Flags().Duration(refreshBeforeFlag, time.Minute, "how long before expiry to refresh access token")
+	cmd.Flags().Bool(completeFlag, false, "auto complete user code")
+	cmd.Flags().Bool(serverMessageFlag, true, "show the message of the server (e.g. Microsoft Entra ID) instead of the code and the URL if given")
+	cmd.Flags().String(promptFlag, promptAuto, "how to show the code (auto, plain, tui, json, silent)")
+	cmd.Flags().Bool(openFlag, false, "open the URL in the browser unless headless")
+	cmd.Flags().String(qrFileFlag, "", "write QR code of the URL to the file (.png or .svg)")
+	cmd.Flags().Duration(remindAfterFlag, 0, "show the code again every duration while waiting for authorization (e.g. 1m, default never)")
+	cmd.Flags().Bool(copyFlag, false, "copy the user code to the clipboard, again on each reminder")
+	cmd.Flags().StringSlice(scopeFlag, nil, "scope to request in addition to A0DAF_SCOPE (repeatable)")
+	cmd.Flags().StringSlice(audienceFlag, nil, "audience to request instead of A0DAF_AUDIENCE")
+	cmd.Flags().String(clientSecretFileFlag, "", "path of the file containing the client secret (e.g. /dev/fd/3) instead of A0DAF_CLIENT_SECRET_FILE")
+	cmd.Flags().Bool(clientSecretStdinFlag, false, "read the client secret from the first line of stdin")
+	cmd.Flags().String(timeFormatFlag, timeFormatLocal, "how to show expiries (local, utc, rfc3339)")
+	cmd.Flags().String(statusFileFlag, "", "write the state of the flow in JSON to the file or named pipe on every transition")
+	cmd.Flags().String(flowIDFlag, "", "ID of the login shown in the status file and --prompt json, shared by refreshes (default random)")
+	cmd.Flags().String(flowIDHeaderFlag, "", "request header to send the flow ID in (e.g. X-Flow-ID)")
+	cmd.Flags().Bool(saveFlag, false, "save the token to the token files under the name of the profile on every refresh")
+	addTokenStoreFlags(cmd)
+
+	return cmd
+}
+
+// authorizeContext is like DeviceAuthFlow.Authorize, but the flow is canceled with ctx.
+func authorizeContext(ctx context.Context, daf *auth.DeviceAuthFlow, scope, audience string, prompt func(dc *auth.DeviceCodeResponse) error) (*auth.TokenResponse, error) {
+	dc, err := daf.FetchDeviceCodeContext(ctx, scope, audience)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prompt(dc); err != nil {
+		return nil, err
+	}
+
+	return daf.PollTokenContext(ctx, dc)
+}
+
+// writeTokenFile replaces the content of path with token atomically,
+// so that readers never see a partially written file.
+func writeTokenFile(path string, token string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot create token file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(token); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write token file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write token file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("cannot write token file: %w", err)
+	}
+
+	return nil
+}
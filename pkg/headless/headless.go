@@ -0,0 +1,91 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package headless detects environments where a browser cannot be opened on the same machine,
+// so that the user should be asked to verify the device code on another device.
+package headless
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Environment represents the detected environment.
+type Environment struct {
+	// SSH is true in SSH sessions.
+	SSH bool
+	// WSL is true on Windows Subsystem for Linux, where the browser of Windows can be opened.
+	WSL bool
+	// Container is true in containers like Docker, Podman or Kubernetes pods.
+	Container bool
+	// NoDisplay is true when no X11 or Wayland display is available on Linux or BSD.
+	NoDisplay bool
+}
+
+// Detect detects the current environment.
+func Detect() *Environment {
+	return &Environment{
+		SSH:       hasEnv("SSH_CONNECTION") || hasEnv("SSH_CLIENT") || hasEnv("SSH_TTY"),
+		WSL:       isWSL(),
+		Container: isContainer(),
+		NoDisplay: runtime.GOOS != "darwin" && runtime.GOOS != "windows" && !hasEnv("DISPLAY") && !hasEnv("WAYLAND_DISPLAY"),
+	}
+}
+
+// IsHeadless reports whether a browser cannot be opened on the machine.
+func (e *Environment) IsHeadless() bool {
+	if e.SSH || e.Container {
+		return true
+	}
+
+	// WSL can open the browser of Windows without display
+	return e.NoDisplay && !e.WSL
+}
+
+// Instruction returns a message for the user to access the verification URI.
+func (e *Environment) Instruction() string {
+	if e.IsHeadless() {
+		return "Open the URL on another device (e.g. your laptop or phone) and enter the code."
+	}
+
+	return "Open the URL in your browser and enter the code."
+}
+
+func hasEnv(key string) bool {
+	return os.Getenv(key) != ""
+}
+
+func isWSL() bool {
+	if hasEnv("WSL_DISTRO_NAME") || hasEnv("WSL_INTEROP") {
+		return true
+	}
+
+	b, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(b)), "microsoft")
+}
+
+func isContainer() bool {
+	if hasEnv("KUBERNETES_SERVICE_HOST") || hasEnv("container") {
+		return true
+	}
+
+	for _, path := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,13 @@
+package headless_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestHeadless(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Headless Suite")
+}
@@ -0,0 +1,66 @@
+package headless_test
+
+import (
+	"os"
+
+	"github.com/autopp/go-a0daf/pkg/headless"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Detect()", func() {
+	setenv := func(key, value string) {
+		old, ok := os.LookupEnv(key)
+		os.Setenv(key, value)
+		DeferCleanup(func() {
+			if ok {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+
+	It("detects SSH sessions", func() {
+		// Arrange
+		setenv("SSH_CONNECTION", "192.0.2.1 50000 192.0.2.2 22")
+
+		// Act
+		actual := headless.Detect()
+
+		// Assert
+		Expect(actual.SSH).To(BeTrue())
+		Expect(actual.IsHeadless()).To(BeTrue())
+	})
+
+	It("detects WSL", func() {
+		// Arrange
+		setenv("WSL_DISTRO_NAME", "Ubuntu")
+
+		// Act
+		actual := headless.Detect()
+
+		// Assert
+		Expect(actual.WSL).To(BeTrue())
+	})
+})
+
+var _ = Describe("Environment", func() {
+	DescribeTable("IsHeadless()",
+		func(e headless.Environment, expected bool) {
+			Expect(e.IsHeadless()).To(Equal(expected))
+		},
+		Entry("on desktop", headless.Environment{}, false),
+		Entry("in SSH sessions", headless.Environment{SSH: true}, true),
+		Entry("in containers", headless.Environment{Container: true}, true),
+		Entry("without display", headless.Environment{NoDisplay: true}, true),
+		Entry("on WSL without display", headless.Environment{WSL: true, NoDisplay: true}, false),
+	)
+
+	It("Instruction() asks to use another device when headless", func() {
+		e := headless.Environment{SSH: true}
+
+		Expect(e.Instruction()).To(ContainSubstring("another device"))
+	})
+})
@@ -0,0 +1,362 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwks provides a client of JSON Web Key Sets of a tenant, which caches the keys to verify tokens locally.
+//
+// The URL of JWKS is https://{tenant}/.well-known/jwks.json for Auth0, or JWKSURI of auth.Endpoints for other issuers.
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTTL is how long the keys are cached by default.
+	defaultTTL = 10 * time.Minute
+	// minRefetchInterval limits refetching for unknown key IDs and after failures,
+	// so that tokens with random kid or an unavailable tenant do not cause a flood of requests.
+	minRefetchInterval = 30 * time.Second
+	// maxBodySize limits the size of JWKS.
+	maxBodySize = 1 << 20
+)
+
+// Key is a public key in JWKS.
+type Key struct {
+	// ID is "kid" of the key.
+	ID string
+	// Algorithm is "alg" of the key like "RS256". It may be empty.
+	Algorithm string
+	// Use is "use" of the key like "sig". It may be empty.
+	Use string
+	// Public is *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey.
+	Public crypto.PublicKey
+}
+
+// KeyNotFoundError is returned by Client.Key when the key ID is not in JWKS even after refetching.
+type KeyNotFoundError struct {
+	KeyID string
+}
+
+func (e *KeyNotFoundError) Error() string {
+	return fmt.Sprintf("key %q is not found in JWKS", e.KeyID)
+}
+
+// FetchError is returned when JWKS could not be fetched or decoded.
+type FetchError struct {
+	URL string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("could not fetch JWKS from %s: %s", e.URL, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Client fetches JWKS and caches the keys for TTL. It is safe for concurrent use.
+//
+// When a key ID is not cached, JWKS is refetched to follow the rotation of keys.
+// When refetching fails, the cached keys are used until they are refreshed successfully.
+type Client struct {
+	url        string
+	ttl        time.Duration
+	httpClient *http.Client
+	timeNow    func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+	// attemptedAt is when fetching was attempted last, which is later than fetchedAt if it failed.
+	attemptedAt time.Time
+}
+
+type ClientOption interface {
+	apply(c *Client) error
+}
+
+// WithTTL specifies how long the keys are cached. It is 10 minutes by default.
+type WithTTL time.Duration
+
+func (ttl WithTTL) apply(c *Client) error {
+	if ttl <= 0 {
+		return fmt.Errorf("WithTTL must be positive: %s", time.Duration(ttl))
+	}
+	c.ttl = time.Duration(ttl)
+	return nil
+}
+
+// WithHTTPClient specifies the client to fetch JWKS. http.DefaultClient is used by default.
+type WithHTTPClient struct {
+	Client *http.Client
+}
+
+func (o WithHTTPClient) apply(c *Client) error {
+	if o.Client == nil {
+		return errors.New("Client of WithHTTPClient is nil")
+	}
+	c.httpClient = o.Client
+	return nil
+}
+
+type WithTimeNow func() time.Time
+
+func (timeNow WithTimeNow) apply(c *Client) error {
+	c.timeNow = timeNow
+	return nil
+}
+
+// NewClient returns new instance of Client for JWKS at url. Keys are fetched lazily.
+func NewClient(url string, opts ...ClientOption) (*Client, error) {
+	if url == "" {
+		return nil, errors.New("URL of JWKS is not given")
+	}
+
+	c := &Client{url: url, ttl: defaultTTL, httpClient: http.DefaultClient, timeNow: time.Now}
+	for _, opt := range opts {
+		if err := opt.apply(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Key returns the key of kid, fetching JWKS if the cache is expired or kid is not cached.
+func (c *Client) Key(ctx context.Context, kid string) (*Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.timeNow()
+	keys, err := c.cached(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	// the key may be rotated after fetching
+	if now.Sub(c.attemptedAt) >= minRefetchInterval {
+		if err := c.refresh(ctx, now); err != nil {
+			return nil, err
+		}
+		if key, ok := c.keys[kid]; ok {
+			return key, nil
+		}
+	}
+
+	return nil, &KeyNotFoundError{KeyID: kid}
+}
+
+// Keys returns all keys in JWKS, fetching it if the cache is expired.
+func (c *Client) Keys(ctx context.Context) ([]*Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, err := c.cached(ctx, c.timeNow())
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(cached))
+	for _, key := range cached {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// cached returns the cached keys, refreshing them if expired. Stale keys are returned if refreshing fails. c.mu must be locked.
+func (c *Client) cached(ctx context.Context, now time.Time) (map[string]*Key, error) {
+	if c.keys == nil || (now.Sub(c.fetchedAt) >= c.ttl && now.Sub(c.attemptedAt) >= minRefetchInterval) {
+		if err := c.refresh(ctx, now); err != nil && c.keys == nil {
+			return nil, err
+		}
+	}
+	return c.keys, nil
+}
+
+// Refresh fetches JWKS regardless of the cache.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.refresh(ctx, c.timeNow())
+}
+
+// refresh fetches JWKS and replaces the cache. The cache is kept if it fails. c.mu must be locked.
+func (c *Client) refresh(ctx context.Context, now time.Time) error {
+	c.attemptedAt = now
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return &FetchError{URL: c.url, Err: err}
+	}
+
+	c.keys = keys
+	c.fetchedAt = now
+	return nil
+}
+
+func (c *Client) fetch(ctx context.Context) (map[string]*Key, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/json")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	return parse(body)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parse decodes JWKS and returns keys by key ID. Keys of unsupported types or for encryption are ignored.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7517#section-5
+func parse(body []byte) (map[string]*Key, error) {
+	set := new(struct {
+		Keys []jsonWebKey `json:"keys"`
+	})
+	if err := json.Unmarshal(body, set); err != nil {
+		return nil, fmt.Errorf("could not decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		public, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q is invalid: %w", jwk.Kid, err)
+		}
+		if public == nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &Key{ID: jwk.Kid, Algorithm: jwk.Alg, Use: jwk.Use, Public: public}
+	}
+
+	return keys, nil
+}
+
+// publicKey returns the public key of jwk, or nil if the type of it is not supported.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7518#section-6
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("n is invalid: %w", err)
+		}
+		e, err := decodeInt(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("e is invalid: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeInt(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("x is invalid: %w", err)
+		}
+		y, err := decodeInt(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y is invalid: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("x is invalid: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("x is not an Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,208 @@
+package jwks_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/jwks"
+	"github.com/autopp/go-a0daf/pkg/mockauth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// jwksServer serves body as JWKS and counts requests.
+type jwksServer struct {
+	*httptest.Server
+	body     string
+	status   int
+	requests int
+}
+
+func newJWKSServer(body string) *jwksServer {
+	s := &jwksServer{body: body, status: 200}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests++
+		w.WriteHeader(s.status)
+		fmt.Fprint(w, s.body)
+	}))
+	return s
+}
+
+// clock is WithTimeNow which can be advanced.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) timeNow() time.Time {
+	return c.now
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+var _ = Describe("Client", func() {
+	ctx := context.Background()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	rsaJWK := fmt.Sprintf(`{"kty": "RSA", "kid": "rsa", "alg": "RS256", "use": "sig", "n": "%s", "e": "%s"}`,
+		encode(rsaKey.N.Bytes()), encode(big.NewInt(int64(rsaKey.E)).Bytes()))
+	ecJWK := fmt.Sprintf(`{"kty": "EC", "kid": "ec", "crv": "P-256", "x": "%s", "y": "%s"}`, encode(ecKey.X.Bytes()), encode(ecKey.Y.Bytes()))
+	edJWK := fmt.Sprintf(`{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "%s"}`, encode(edPublic))
+
+	var c *clock
+	BeforeEach(func() {
+		c = &clock{now: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	})
+
+	It("resolves keys by kid and ignores unsupported keys", func() {
+		// Arrange
+		s := newJWKSServer(fmt.Sprintf(`{"keys": [%s, %s, %s, {"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}, {"kty": "oct", "kid": "oct", "k": "c2VjcmV0"}]}`, rsaJWK, ecJWK, edJWK))
+		defer s.Close()
+		client, err := jwks.NewClient(s.URL, jwks.WithTimeNow(c.timeNow))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		rsaActual, rsaErr := client.Key(ctx, "rsa")
+		ecActual, ecErr := client.Key(ctx, "ec")
+		edActual, edErr := client.Key(ctx, "ed")
+		keys, keysErr := client.Keys(ctx)
+
+		// Assert
+		Expect(rsaErr).NotTo(HaveOccurred())
+		Expect(rsaActual).To(Equal(&jwks.Key{ID: "rsa", Algorithm: "RS256", Use: "sig", Public: &rsaKey.PublicKey}))
+		Expect(ecErr).NotTo(HaveOccurred())
+		Expect(ecActual.Public.(*ecdsa.PublicKey).Equal(&ecKey.PublicKey)).To(BeTrue())
+		Expect(edErr).NotTo(HaveOccurred())
+		Expect(edActual.Public).To(Equal(edPublic))
+		Expect(keysErr).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(3))
+		Expect(s.requests).To(Equal(1))
+	})
+
+	It("fetches again after TTL", func() {
+		// Arrange
+		s := newJWKSServer(fmt.Sprintf(`{"keys": [%s]}`, rsaJWK))
+		defer s.Close()
+		client, _ := jwks.NewClient(s.URL, jwks.WithTimeNow(c.timeNow), jwks.WithTTL(time.Minute))
+		_, err := client.Key(ctx, "rsa")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		c.now = c.now.Add(59 * time.Second)
+		_, err1 := client.Key(ctx, "rsa")
+		requests1 := s.requests
+		c.now = c.now.Add(time.Second)
+		_, err2 := client.Key(ctx, "rsa")
+
+		// Assert
+		Expect(err1).NotTo(HaveOccurred())
+		Expect(requests1).To(Equal(1))
+		Expect(err2).NotTo(HaveOccurred())
+		Expect(s.requests).To(Equal(2))
+	})
+
+	It("fetches again for unknown kid to follow rotation, but not too often", func() {
+		// Arrange
+		s := newJWKSServer(fmt.Sprintf(`{"keys": [%s]}`, rsaJWK))
+		defer s.Close()
+		client, _ := jwks.NewClient(s.URL, jwks.WithTimeNow(c.timeNow))
+		_, err := client.Key(ctx, "rsa")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err1 := client.Key(ctx, "ec")
+		requests1 := s.requests
+		s.body = fmt.Sprintf(`{"keys": [%s, %s]}`, rsaJWK, ecJWK)
+		c.now = c.now.Add(30 * time.Second)
+		key, err2 := client.Key(ctx, "ec")
+
+		// Assert
+		Expect(err1).To(MatchError(&jwks.KeyNotFoundError{KeyID: "ec"}))
+		Expect(requests1).To(Equal(1))
+		Expect(err2).NotTo(HaveOccurred())
+		Expect(key.ID).To(Equal("ec"))
+		Expect(s.requests).To(Equal(2))
+	})
+
+	It("keeps the cached keys when fetching fails", func() {
+		// Arrange
+		s := newJWKSServer(fmt.Sprintf(`{"keys": [%s]}`, rsaJWK))
+		defer s.Close()
+		client, _ := jwks.NewClient(s.URL, jwks.WithTimeNow(c.timeNow), jwks.WithTTL(time.Minute))
+		_, err := client.Key(ctx, "rsa")
+		Expect(err).NotTo(HaveOccurred())
+		s.status = 503
+
+		// Act
+		c.now = c.now.Add(time.Hour)
+		key, err := client.Key(ctx, "rsa")
+		refreshErr := client.Refresh(ctx)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key.ID).To(Equal("rsa"))
+		var fetchErr *jwks.FetchError
+		Expect(errors.As(refreshErr, &fetchErr)).To(BeTrue())
+		Expect(fetchErr.URL).To(Equal(s.URL))
+	})
+
+	It("returns FetchError when JWKS is invalid", func() {
+		// Arrange
+		s := newJWKSServer(`{"keys": [{"kty": "RSA", "kid": "rsa", "n": "!!!", "e": "AQAB"}]}`)
+		defer s.Close()
+		client, _ := jwks.NewClient(s.URL)
+
+		// Act
+		_, err := client.Key(ctx, "rsa")
+
+		// Assert
+		var fetchErr *jwks.FetchError
+		Expect(errors.As(err, &fetchErr)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring(`key "rsa" is invalid`))
+	})
+
+	It("resolves the key of mockauth", func() {
+		// Arrange
+		server, err := mockauth.New([]mockauth.User{{Subject: "auth0|alice"}})
+		Expect(err).NotTo(HaveOccurred())
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+		client, _ := jwks.NewClient(ts.URL + "/.well-known/jwks.json")
+
+		// Act
+		keys, err := client.Keys(ctx)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(keys).To(HaveLen(1))
+		Expect(keys[0].Public).To(Equal(server.PublicKey()))
+	})
+
+	DescribeTable("rejects invalid options",
+		func(url string, opts ...jwks.ClientOption) {
+			// Act
+			_, err := jwks.NewClient(url, opts...)
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("empty URL", ""),
+		Entry("non-positive TTL", "https://example.com/.well-known/jwks.json", jwks.WithTTL(0)),
+		Entry("nil HTTP client", "https://example.com/.well-known/jwks.json", jwks.WithHTTPClient{}),
+	)
+})
@@ -0,0 +1,140 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package jwt decodes JWTs like access tokens and ID tokens without verifying them, for display and debugging.
+//
+// Never trust decoded claims for authorization. Use ValidateIDToken of auth.DeviceAuthFlow to verify ID tokens.
+package jwt
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Token is a decoded JWT.
+type Token struct {
+	// Header is the JOSE header like {"alg": "RS256", "typ": "JWT", "kid": "..."}.
+	Header map[string]interface{}
+	// Claims are all claims in the payload. Numbers are float64.
+	Claims map[string]interface{}
+	// Standard are the registered claims decoded from Claims.
+	Standard StandardClaims
+	// Signature is the decoded signature, which is not verified.
+	Signature []byte
+	// SigningInput is the encoded header and payload joined with ".", which is signed by Signature.
+	SigningInput string
+}
+
+// StandardClaims are the registered claims of JWT and frequently used claims of access tokens and ID tokens.
+// Missing claims are zero values.
+//
+// See: https://datatracker.ietf.org/doc/html/rfc7519#section-4.1
+type StandardClaims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	// AuthorizedParty is azp claim, which is the client ID of access tokens of Auth0.
+	AuthorizedParty string
+	// Scope is scope claim of access tokens.
+	Scope string
+}
+
+// Decode decodes token without verifying the signature.
+func Decode(token string) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	t := &Token{Header: make(map[string]interface{}), Claims: make(map[string]interface{}), SigningInput: parts[0] + "." + parts[1]}
+	if err := decodePart(parts[0], &t.Header); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	if err := decodePart(parts[1], &t.Claims); err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT signature: %w", err)
+	}
+	t.Signature = sig
+	t.Standard = Standard(t.Claims)
+
+	return t, nil
+}
+
+// Algorithm returns alg of the header.
+func (t *Token) Algorithm() string {
+	alg, _ := t.Header["alg"].(string)
+	return alg
+}
+
+// KeyID returns kid of the header.
+func (t *Token) KeyID() string {
+	kid, _ := t.Header["kid"].(string)
+	return kid
+}
+
+// Standard returns StandardClaims in claims. Claims of unexpected types are ignored.
+func Standard(claims map[string]interface{}) StandardClaims {
+	s := StandardClaims{}
+	s.Issuer, _ = claims["iss"].(string)
+	s.Subject, _ = claims["sub"].(string)
+	s.ID, _ = claims["jti"].(string)
+	s.AuthorizedParty, _ = claims["azp"].(string)
+	s.Scope, _ = claims["scope"].(string)
+	s.ExpiresAt = NumericDate(claims["exp"])
+	s.NotBefore = NumericDate(claims["nbf"])
+	s.IssuedAt = NumericDate(claims["iat"])
+
+	// aud is a string or an array of strings
+	switch aud := claims["aud"].(type) {
+	case string:
+		s.Audience = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if a, ok := a.(string); ok {
+				s.Audience = append(s.Audience, a)
+			}
+		}
+	}
+
+	return s
+}
+
+// NumericDate returns the time of the NumericDate claim decoded as float64, or zero time if v is not a number.
+func NumericDate(v interface{}) time.Time {
+	n, ok := v.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	sec := int64(n)
+	return time.Unix(sec, int64((n-float64(sec))*float64(time.Second)))
+}
+
+func decodePart(part string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,71 @@
+package jwt_test
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/jwt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func encode(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+var _ = Describe("Decode", func() {
+	It("decodes the header, claims and standard claims", func() {
+		// Arrange
+		token := encode(`{"alg": "RS256", "typ": "JWT", "kid": "key"}`) + "." +
+			encode(`{"iss": "https://example.us.auth0.com/", "sub": "auth0|alice", "aud": ["https://example.com/api", "https://example.us.auth0.com/userinfo"], "exp": 1640998800, "iat": 1640995200.5, "azp": "clientID", "scope": "openid profile", "custom": {"role": "admin"}}`) + "." +
+			encode("signature")
+
+		// Act
+		actual, err := jwt.Decode(token)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.Algorithm()).To(Equal("RS256"))
+		Expect(actual.KeyID()).To(Equal("key"))
+		Expect(actual.Claims["custom"]).To(Equal(map[string]interface{}{"role": "admin"}))
+		Expect(actual.Signature).To(Equal([]byte("signature")))
+		Expect(actual.SigningInput + "." + encode("signature")).To(Equal(token))
+		Expect(actual.Standard).To(Equal(jwt.StandardClaims{
+			Issuer:          "https://example.us.auth0.com/",
+			Subject:         "auth0|alice",
+			Audience:        []string{"https://example.com/api", "https://example.us.auth0.com/userinfo"},
+			ExpiresAt:       time.Unix(1640998800, 0),
+			IssuedAt:        time.Unix(1640995200, int64(500*time.Millisecond)),
+			AuthorizedParty: "clientID",
+			Scope:           "openid profile",
+		}))
+	})
+
+	It("decodes aud of a string", func() {
+		// Arrange
+		token := encode(`{"alg": "HS256"}`) + "." + encode(`{"aud": "clientID"}`) + "."
+
+		// Act
+		actual, err := jwt.Decode(token)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.Standard.Audience).To(Equal([]string{"clientID"}))
+		Expect(actual.Standard.ExpiresAt.IsZero()).To(BeTrue())
+	})
+
+	DescribeTable("returns error for malformed tokens",
+		func(token string, message string) {
+			// Act
+			_, err := jwt.Decode(token)
+
+			// Assert
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("without parts", "opaque-access-token", "malformed JWT"),
+		Entry("invalid header", "!!!."+encode(`{}`)+".", "malformed JWT header"),
+		Entry("invalid payload", encode(`{}`)+"."+encode(`[]`)+".", "malformed JWT payload"),
+		Entry("invalid signature", encode(`{}`)+"."+encode(`{}`)+".!!!", "malformed JWT signature"),
+	)
+})
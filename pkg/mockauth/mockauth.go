@@ -0,0 +1,376 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mockauth is a minimal OIDC provider stub which issues tokens by the device authorization flow,
+// so that applications and resource servers can be tested locally without a real tenant.
+//
+// Tokens are signed by a key published in JWKS, but users are not authenticated at all.
+// Never use it in production.
+package mockauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// deviceCodeLifetime is expires_in of device codes.
+	deviceCodeLifetime = 5 * time.Minute
+	// tokenLifetime is expires_in of access tokens and ID tokens.
+	tokenLifetime = time.Hour
+)
+
+// User is an identity of issued tokens.
+type User struct {
+	// Subject is the sub claim like "auth0|alice".
+	Subject string
+	// Claims are additional claims of ID tokens and access tokens like email.
+	Claims map[string]interface{}
+}
+
+// Server is an http.Handler serving the discovery, JWKS, device code and token endpoints.
+//
+// Device codes are authorized immediately for the first user, or the user whose subject is given as login_hint.
+// The issuer is derived from the Host header of each request like "http://127.0.0.1:8080/".
+type Server struct {
+	key   *rsa.PrivateKey
+	keyID string
+	users []User
+	mux   *http.ServeMux
+
+	mu sync.Mutex
+	// grants are pending device codes and refresh tokens.
+	grants map[string]*grant
+}
+
+type grant struct {
+	user     User
+	clientID string
+	scope    string
+	audience string
+	// expiresAt is zero for refresh tokens.
+	expiresAt time.Time
+}
+
+// New returns a Server issuing tokens for users with a new signing key.
+func New(users []User) (*Server, error) {
+	if len(users) == 0 {
+		return nil, errors.New("at least one user is required")
+	}
+	for _, u := range users {
+		if u.Subject == "" {
+			return nil, errors.New("subject of user is required")
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate signing key: %w", err)
+	}
+	sum := sha256.Sum256(key.PublicKey.N.Bytes())
+
+	s := &Server{
+		key:    key,
+		keyID:  base64.RawURLEncoding.EncodeToString(sum[:8]),
+		users:  users,
+		mux:    http.NewServeMux(),
+		grants: make(map[string]*grant),
+	}
+	s.mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	s.mux.HandleFunc("/.well-known/jwks.json", s.handleJWKS)
+	s.mux.HandleFunc("/oauth/device/code", s.handleDeviceCode)
+	s.mux.HandleFunc("/oauth/token", s.handleToken)
+
+	return s, nil
+}
+
+// PublicKey returns the key to verify tokens, which is also published in JWKS.
+func (s *Server) PublicKey() *rsa.PublicKey {
+	return &s.key.PublicKey
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// baseURL returns the URL of the server without the trailing slash.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	base := baseURL(r)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                base + "/",
+		"device_authorization_endpoint":         base + "/oauth/device/code",
+		"token_endpoint":                        base + "/oauth/token",
+		"jwks_uri":                              base + "/.well-known/jwks.json",
+		"grant_types_supported":                 []string{"urn:ietf:params:oauth:grant-type:device_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": s.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.PublicKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.PublicKey.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) handleDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "form must be POSTed")
+		return
+	}
+
+	clientID := r.PostForm.Get("client_id")
+	if clientID == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "client_id is required")
+		return
+	}
+
+	user, ok := s.user(r.PostForm.Get("login_hint"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid_request", "unknown login_hint")
+		return
+	}
+
+	deviceCode, err := randomString(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.grants[deviceCode] = &grant{
+		user:      user,
+		clientID:  clientID,
+		scope:     r.PostForm.Get("scope"),
+		audience:  r.PostForm.Get("audience"),
+		expiresAt: time.Now().Add(deviceCodeLifetime),
+	}
+	s.mu.Unlock()
+
+	verificationURI := baseURL(r) + "/activate"
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + userCode,
+		"expires_in":                int(deviceCodeLifetime / time.Second),
+		"interval":                  1,
+	})
+}
+
+// user returns the user of subject, or the first user if subject is empty.
+func (s *Server) user(subject string) (User, bool) {
+	if subject == "" {
+		return s.users[0], true
+	}
+	for _, u := range s.users {
+		if u.Subject == subject {
+			return u, true
+		}
+	}
+	return User{}, false
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "form must be POSTed")
+		return
+	}
+
+	var key string
+	switch r.PostForm.Get("grant_type") {
+	case "urn:ietf:params:oauth:grant-type:device_code":
+		key = r.PostForm.Get("device_code")
+	case "refresh_token":
+		key = r.PostForm.Get("refresh_token")
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "grant type is not supported")
+		return
+	}
+
+	s.mu.Lock()
+	g, ok := s.grants[key]
+	// device codes can be used only once
+	if ok && !g.expiresAt.IsZero() {
+		delete(s.grants, key)
+	}
+	s.mu.Unlock()
+
+	if !ok || g.clientID != r.PostForm.Get("client_id") {
+		writeError(w, http.StatusForbidden, "invalid_grant", "unknown or already used grant")
+		return
+	}
+	if !g.expiresAt.IsZero() && time.Now().After(g.expiresAt) {
+		writeError(w, http.StatusForbidden, "expired_token", "device code is expired")
+		return
+	}
+
+	res, err := s.issue(baseURL(r)+"/", g)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// issue issues tokens of g. The ID token is issued for openid scope, and the refresh token for offline_access scope.
+func (s *Server) issue(issuer string, g *grant) (map[string]interface{}, error) {
+	now := time.Now()
+	claims := func(audience string) map[string]interface{} {
+		c := make(map[string]interface{}, len(g.user.Claims)+5)
+		for k, v := range g.user.Claims {
+			c[k] = v
+		}
+		c["iss"] = issuer
+		c["sub"] = g.user.Subject
+		c["iat"] = now.Unix()
+		c["exp"] = now.Add(tokenLifetime).Unix()
+		if audience != "" {
+			c["aud"] = audience
+		}
+		return c
+	}
+
+	accessClaims := claims(g.audience)
+	accessClaims["azp"] = g.clientID
+	accessClaims["scope"] = g.scope
+	accessToken, err := s.sign(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenLifetime / time.Second),
+		"scope":        g.scope,
+	}
+
+	scopes := strings.Fields(g.scope)
+	if containsString(scopes, "openid") {
+		idToken, err := s.sign(claims(g.clientID))
+		if err != nil {
+			return nil, err
+		}
+		res["id_token"] = idToken
+	}
+
+	if containsString(scopes, "offline_access") {
+		refreshToken, err := randomString(32)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.grants[refreshToken] = &grant{user: g.user, clientID: g.clientID, scope: g.scope, audience: g.audience}
+		s.mu.Unlock()
+		res["refresh_token"] = refreshToken
+	}
+
+	return res, nil
+}
+
+// sign returns a JWT of claims signed with RS256.
+func (s *Server) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign token: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// randomString returns a URL-safe random string of n bytes of entropy.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate random string: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// userCodeAlphabet is consonants without ambiguous ones, as Auth0 uses for user codes.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// newUserCode returns a user code like "BCDF-GHJK".
+func newUserCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("could not generate user code: %w", err)
+	}
+	for i := range b {
+		b[i] = userCodeAlphabet[int(b[i])%len(userCodeAlphabet)]
+	}
+	return string(b[:4]) + "-" + string(b[4:]), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
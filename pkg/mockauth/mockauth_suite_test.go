@@ -0,0 +1,13 @@
+package mockauth_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestMockauth(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mockauth Suite")
+}
@@ -0,0 +1,153 @@
+package mockauth_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/mockauth"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var ts *httptest.Server
+	var daf *auth.DeviceAuthFlow
+	BeforeEach(func() {
+		s, err := mockauth.New([]mockauth.User{
+			{Subject: "auth0|alice", Claims: map[string]interface{}{"email": "alice@example.com"}},
+			{Subject: "auth0|bob"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ts = httptest.NewServer(s)
+		DeferCleanup(ts.Close)
+
+		daf, err = auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithTimeSleep(func(time.Duration) {}))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	getJSON := func(url string) map[string]interface{} {
+		res, err := http.Get(url)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		Expect(res.StatusCode).To(Equal(http.StatusOK))
+
+		var body map[string]interface{}
+		Expect(json.NewDecoder(res.Body).Decode(&body)).To(Succeed())
+		return body
+	}
+
+	// verify verifies token with the key in JWKS of the discovery document and returns its claims
+	verify := func(token string) map[string]interface{} {
+		discovery := getJSON(ts.URL + "/.well-known/openid-configuration")
+		jwk := getJSON(discovery["jwks_uri"].(string))["keys"].([]interface{})[0].(map[string]interface{})
+		n, err := base64.RawURLEncoding.DecodeString(jwk["n"].(string))
+		Expect(err).NotTo(HaveOccurred())
+		e, err := base64.RawURLEncoding.DecodeString(jwk["e"].(string))
+		Expect(err).NotTo(HaveOccurred())
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+		parts := strings.Split(token, ".")
+		Expect(parts).To(HaveLen(3))
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		Expect(err).NotTo(HaveOccurred())
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		Expect(rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig)).To(Succeed())
+
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		Expect(err).NotTo(HaveOccurred())
+		var claims map[string]interface{}
+		Expect(json.Unmarshal(payload, &claims)).To(Succeed())
+		Expect(claims["iss"]).To(Equal(discovery["issuer"]))
+		return claims
+	}
+
+	It("issues tokens of the first user by the device authorization flow", func() {
+		// Act
+		token, err := daf.Authorize("openid offline_access", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.RefreshToken).NotTo(BeEmpty())
+
+		access := verify(token.AccessToken)
+		Expect(access["sub"]).To(Equal("auth0|alice"))
+		Expect(access["aud"]).To(Equal("https://example.com/api"))
+		Expect(access["scope"]).To(Equal("openid offline_access"))
+
+		id := verify(token.IdToken)
+		Expect(id["sub"]).To(Equal("auth0|alice"))
+		Expect(id["aud"]).To(Equal("clientID"))
+		Expect(id["email"]).To(Equal("alice@example.com"))
+	})
+
+	It("issues tokens of the user given as login_hint", func() {
+		// Arrange
+		dc, err := daf.RequestDeviceCode(&auth.DeviceCodeRequest{Scope: "openid", Extra: neturl.Values{"login_hint": {"auth0|bob"}}})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		token, err := daf.PollToken(dc)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token.RefreshToken).To(BeEmpty())
+		Expect(dc.UserCode).To(MatchRegexp(`^[B-Z]{4}-[B-Z]{4}$`))
+		Expect(verify(token.IdToken)["sub"]).To(Equal("auth0|bob"))
+	})
+
+	It("issues tokens with the refresh token", func() {
+		// Arrange
+		token, err := daf.Authorize("offline_access", "https://example.com/api", func(dc *auth.DeviceCodeResponse) error { return nil })
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		refreshed, err := daf.ExchangeRefreshToken(token.RefreshToken)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verify(refreshed.AccessToken)["sub"]).To(Equal("auth0|alice"))
+	})
+
+	It("rejects device codes already used", func() {
+		// Arrange
+		dc, err := daf.FetchDeviceCode("openid", "")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = daf.PollToken(dc)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		_, err = daf.PollToken(dc)
+
+		// Assert
+		Expect(auth.IsInvalidGrant(err)).To(BeTrue())
+	})
+
+	It("rejects unknown login_hint", func() {
+		// Act
+		_, err := daf.RequestDeviceCode(&auth.DeviceCodeRequest{Extra: neturl.Values{"login_hint": {"auth0|carol"}}})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("New", func() {
+	It("requires users", func() {
+		// Act
+		_, err := mockauth.New(nil)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,61 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package prommetrics provides prometheus.Collector of auth.Metrics.
+//
+// It is a separate module, so that the main module does not depend on the client library of Prometheus.
+package prommetrics
+
+import (
+	"strconv"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector collects auth.Metrics as a0daf_requests_total counter by endpoint and code ("error" for requests without responses)
+// and a0daf_request_duration_seconds histogram by endpoint, which are the same as auth.Metrics.WriteTo.
+type Collector struct {
+	metrics  *auth.Metrics
+	requests *prometheus.Desc
+	duration *prometheus.Desc
+}
+
+// NewCollector returns Collector of m.
+func NewCollector(m *auth.Metrics) *Collector {
+	return &Collector{
+		metrics:  m,
+		requests: prometheus.NewDesc("a0daf_requests_total", "Requests to the endpoints by status code.", []string{"endpoint", "code"}, nil),
+		duration: prometheus.NewDesc("a0daf_request_duration_seconds", "Durations of requests to the endpoints.", []string{"endpoint"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.requests
+	ch <- c.duration
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.metrics.Requests() {
+		for code, n := range s.Codes {
+			label := "error"
+			if code != 0 {
+				label = strconv.Itoa(code)
+			}
+			ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(n), s.Endpoint, label)
+		}
+		ch <- prometheus.MustNewConstHistogram(c.duration, s.Count, s.DurationSum, s.DurationBuckets, s.Endpoint)
+	}
+}
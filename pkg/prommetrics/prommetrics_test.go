@@ -0,0 +1,70 @@
+package prommetrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Collector", func() {
+	It("collects requests and durations of Metrics", func() {
+		// Arrange
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+		}))
+		defer ts.Close()
+
+		metrics, err := auth.NewMetrics(1, 60)
+		Expect(err).NotTo(HaveOccurred())
+		daf, err := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"), auth.WithMetrics{Metrics: metrics})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(daf.Revoke("refresh_token")).To(Succeed())
+
+		registry := prometheus.NewPedanticRegistry()
+		Expect(registry.Register(prommetrics.NewCollector(metrics))).To(Succeed())
+
+		// Act
+		families, err := registry.Gather()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(families).To(HaveLen(2))
+
+		Expect(families[0].GetName()).To(Equal("a0daf_request_duration_seconds"))
+		Expect(families[0].Metric).To(HaveLen(1))
+		histogram := families[0].Metric[0].GetHistogram()
+		Expect(histogram.GetSampleCount()).To(Equal(uint64(1)))
+		Expect(histogram.Bucket).To(HaveLen(2))
+		Expect(histogram.Bucket[1].GetUpperBound()).To(Equal(60.0))
+		Expect(histogram.Bucket[1].GetCumulativeCount()).To(Equal(uint64(1)))
+
+		Expect(families[1].GetName()).To(Equal("a0daf_requests_total"))
+		Expect(families[1].Metric).To(HaveLen(1))
+		labels := map[string]string{}
+		for _, l := range families[1].Metric[0].Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		Expect(labels).To(Equal(map[string]string{"endpoint": "/oauth/revoke", "code": "200"}))
+		Expect(families[1].Metric[0].GetCounter().GetValue()).To(Equal(1.0))
+	})
+
+	It("collects nothing without requests", func() {
+		// Arrange
+		metrics, _ := auth.NewMetrics()
+		registry := prometheus.NewPedanticRegistry()
+		Expect(registry.Register(prommetrics.NewCollector(metrics))).To(Succeed())
+
+		// Act
+		families, err := registry.Gather()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(families).To(BeEmpty())
+	})
+})
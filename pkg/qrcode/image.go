@@ -0,0 +1,75 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrcode
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// quietZone is the width of the margin in modules required by the specification.
+const quietZone = 4
+
+// Image returns the QR code as an image, in which each module is scale pixels square.
+func (c *Code) Image(scale int) image.Image {
+	side := (c.size + quietZone*2) * scale
+	img := image.NewGray(image.Rect(0, 0, side, side))
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			mx, my := x/scale-quietZone, y/scale-quietZone
+			if mx >= 0 && mx < c.size && my >= 0 && my < c.size && c.modules[my][mx] {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 0xFF})
+			}
+		}
+	}
+
+	return img
+}
+
+// WritePNG writes the QR code as a PNG image, in which each module is scale pixels square.
+func (c *Code) WritePNG(w io.Writer, scale int) error {
+	return png.Encode(w, c.Image(scale))
+}
+
+// WriteSVG writes the QR code as an SVG image, in which each module is scale pixels square.
+func (c *Code) WriteSVG(w io.Writer, scale int) error {
+	side := c.size + quietZone*2
+	if _, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", side*scale, side*scale, side, side); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", side, side); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprint(w, `<path fill="#000" d="`); err != nil {
+		return err
+	}
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				if _, err := fmt.Fprintf(w, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	_, err := fmt.Fprint(w, "\"/>\n</svg>\n")
+	return err
+}
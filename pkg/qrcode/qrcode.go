@@ -0,0 +1,479 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qrcode encodes text like verification URIs into QR codes and renders them as PNG or SVG images.
+//
+// It supports byte mode and error correction level M with versions 1 to 10 (up to 213 bytes),
+// which is enough for verification URIs.
+package qrcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// eccBlocks is the block structure of error correction level M for each version.
+//
+// See: ISO/IEC 18004 Table 9
+var eccBlocks = []struct {
+	eccPerBlock  int
+	shortBlocks  int
+	shortDataLen int
+	longBlocks   int
+}{
+	{}, // version 0 does not exist
+	{10, 1, 16, 0},
+	{16, 1, 28, 0},
+	{26, 1, 44, 0},
+	{18, 2, 32, 0},
+	{24, 2, 43, 0},
+	{16, 4, 27, 0},
+	{18, 4, 31, 0},
+	{22, 2, 38, 2},
+	{22, 3, 36, 2},
+	{26, 4, 43, 1},
+}
+
+// alignmentPositions is the center positions of alignment patterns for each version.
+var alignmentPositions = [][]int{
+	{},
+	{},
+	{6, 18},
+	{6, 22},
+	{6, 26},
+	{6, 30},
+	{6, 34},
+	{6, 22, 38},
+	{6, 24, 42},
+	{6, 26, 46},
+	{6, 28, 50},
+}
+
+const maxVersion = 10
+
+// ErrTooLong is returned by Encode when the text does not fit in the supported versions.
+var ErrTooLong = errors.New("text is too long for QR code")
+
+// Code is an encoded QR code.
+type Code struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode encodes text into a QR code of the smallest version.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if len(data) <= capacity(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLong, len(data))
+	}
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(addECC(version, encodeData(version, data)))
+
+	best, minPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); minPenalty < 0 || p < minPenalty {
+			best, minPenalty = mask, p
+		}
+		// masking twice restores the modules
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormat(best)
+
+	return c, nil
+}
+
+// Size returns the number of modules in each side, without the quiet zone.
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Black reports whether the module at column x and row y is black.
+func (c *Code) Black(x, y int) bool {
+	return c.modules[y][x]
+}
+
+func newCode(version int) *Code {
+	size := version*4 + 17
+	c := &Code{version: version, size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.function[i] = make([]bool, size)
+	}
+	return c
+}
+
+func dataCodewords(version int) int {
+	b := eccBlocks[version]
+	return b.shortBlocks*b.shortDataLen + b.longBlocks*(b.shortDataLen+1)
+}
+
+// capacity returns the maximum number of bytes in byte mode.
+func capacity(version int) int {
+	return (dataCodewords(version)*8 - 4 - countBits(version)) / 8
+}
+
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// encodeData encodes data in byte mode and pads it to the data capacity.
+func encodeData(version int, data []byte) []byte {
+	bits := make([]bool, 0, dataCodewords(version)*8)
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (v>>i)&1 == 1)
+		}
+	}
+
+	appendBits(0x4, 4)
+	appendBits(len(data), countBits(version))
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+
+	limit := dataCodewords(version) * 8
+	terminator := 4
+	if limit-len(bits) < terminator {
+		terminator = limit - len(bits)
+	}
+	appendBits(0, terminator)
+	appendBits(0, (8-len(bits)%8)%8)
+
+	codewords := make([]byte, 0, dataCodewords(version))
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < dataCodewords(version); pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	return codewords
+}
+
+// addECC splits data into blocks, appends error correction codewords and interleaves them.
+func addECC(version int, data []byte) []byte {
+	b := eccBlocks[version]
+	divisor := rsDivisor(b.eccPerBlock)
+
+	dataBlocks := make([][]byte, 0, b.shortBlocks+b.longBlocks)
+	eccBlocks := make([][]byte, 0, b.shortBlocks+b.longBlocks)
+	for i, offset := 0, 0; i < b.shortBlocks+b.longBlocks; i++ {
+		n := b.shortDataLen
+		if i >= b.shortBlocks {
+			n++
+		}
+		block := data[offset : offset+n]
+		offset += n
+		dataBlocks = append(dataBlocks, block)
+		eccBlocks = append(eccBlocks, rsRemainder(block, divisor))
+	}
+
+	result := make([]byte, 0, len(data)+len(eccBlocks)*b.eccPerBlock)
+	for i := 0; i <= b.shortDataLen; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < b.eccPerBlock; i++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+
+	return result
+}
+
+func (c *Code) set(x, y int, black bool) {
+	c.modules[y][x] = black
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	positions := alignmentPositions[c.version]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// skip the corners overlapping with finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// reserve the areas of format information, drawn for real after masking
+	c.drawFormat(0)
+	c.drawVersion()
+}
+
+func (c *Code) drawFinder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || x >= c.size || y < 0 || y >= c.size {
+				continue
+			}
+			dist := abs(dx)
+			if abs(dy) > dist {
+				dist = abs(dy)
+			}
+			c.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			dist := abs(dx)
+			if abs(dy) > dist {
+				dist = abs(dy)
+			}
+			c.set(cx+dx, cy+dy, dist != 1)
+		}
+	}
+}
+
+// drawFormat draws the format information of error correction level M and mask.
+func (c *Code) drawFormat(mask int) {
+	// level M is 00
+	data := mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool {
+		return (bits>>i)&1 == 1
+	}
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.size-15+i, bit(i))
+	}
+	// dark module
+	c.set(8, c.size-8, true)
+}
+
+// drawVersion draws the version information for version 7 or later.
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+
+	rem := c.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		black := (bits>>i)&1 == 1
+		a, b := c.size-11+i%3, i/3
+		c.set(a, b, black)
+		c.set(b, a, black)
+	}
+}
+
+// drawCodewords places codewords in the zigzag order.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		// skip the vertical timing pattern
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = c.size - 1 - vert
+				}
+				if c.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.function[y][x] {
+				continue
+			}
+
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty evaluates the masked symbol. The lower is the better.
+func (c *Code) penalty() int {
+	penalty := 0
+	at := func(x, y int, vertical bool) bool {
+		if vertical {
+			return c.modules[x][y]
+		}
+		return c.modules[y][x]
+	}
+
+	finderLike := []bool{true, false, true, true, true, false, true}
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < c.size; y++ {
+			// adjacent modules in the same color
+			run := 1
+			for x := 1; x < c.size; x++ {
+				if at(x, y, vertical) == at(x-1, y, vertical) {
+					run++
+					if run == 5 {
+						penalty += 3
+					} else if run > 5 {
+						penalty++
+					}
+				} else {
+					run = 1
+				}
+			}
+
+			// patterns like finder patterns with 4 light modules on a side
+			for x := 0; x+len(finderLike) <= c.size; x++ {
+				matched := true
+				for i, black := range finderLike {
+					if at(x+i, y, vertical) != black {
+						matched = false
+						break
+					}
+				}
+				if matched && (c.isLight(x-4, x, y, vertical) || c.isLight(x+7, x+11, y, vertical)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			// 2x2 blocks in the same color
+			if x > 0 && y > 0 {
+				m := c.modules[y][x]
+				if c.modules[y-1][x] == m && c.modules[y][x-1] == m && c.modules[y-1][x-1] == m {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// proportion of dark modules apart from 50%
+	percent := dark * 100 / (c.size * c.size)
+	penalty += abs(percent-50) / 5 * 10
+
+	return penalty
+}
+
+// isLight reports whether modules in [from, to) of the line are light. Outside of the symbol is light.
+func (c *Code) isLight(from, to, line int, vertical bool) bool {
+	for i := from; i < to; i++ {
+		if i < 0 || i >= c.size {
+			continue
+		}
+		if (vertical && c.modules[i][line]) || (!vertical && c.modules[line][i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
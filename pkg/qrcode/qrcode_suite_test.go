@@ -0,0 +1,13 @@
+package qrcode_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestQrcode(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Qrcode Suite")
+}
@@ -0,0 +1,115 @@
+package qrcode_test
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+
+	"github.com/autopp/go-a0daf/pkg/qrcode"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Encode()", func() {
+	DescribeTable("chooses the smallest version",
+		func(length int, expectedSize int) {
+			// Act
+			c, err := qrcode.Encode(strings.Repeat("a", length))
+
+			// Assert
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Size()).To(Equal(expectedSize))
+		},
+		Entry("version 1", 14, 21),
+		Entry("version 2", 15, 25),
+		Entry("version 7", 122, 45),
+		Entry("version 10", 213, 57),
+	)
+
+	It("returns ErrTooLong when the text does not fit", func() {
+		// Act
+		_, err := qrcode.Encode(strings.Repeat("a", 214))
+
+		// Assert
+		Expect(errors.Is(err, qrcode.ErrTooLong)).To(BeTrue())
+	})
+
+	It("draws finder patterns at the corners", func() {
+		// Act
+		c, _ := qrcode.Encode("https://example.us.auth0.com/activate")
+
+		// Assert
+		for _, corner := range [][2]int{{0, 0}, {c.Size() - 7, 0}, {0, c.Size() - 7}} {
+			for i := 0; i < 7; i++ {
+				Expect(c.Black(corner[0]+i, corner[1])).To(BeTrue())
+				Expect(c.Black(corner[0], corner[1]+i)).To(BeTrue())
+			}
+			Expect(c.Black(corner[0]+1, corner[1]+1)).To(BeFalse())
+			Expect(c.Black(corner[0]+3, corner[1]+3)).To(BeTrue())
+		}
+	})
+
+	It("draws valid format information of error correction level M", func() {
+		// Act
+		c, _ := qrcode.Encode("https://example.us.auth0.com/activate")
+
+		// Assert
+		bits := 0
+		for i := 14; i >= 0; i-- {
+			// the second copy of format information
+			var black bool
+			if i < 8 {
+				black = c.Black(c.Size()-1-i, 8)
+			} else {
+				black = c.Black(8, c.Size()-15+i)
+			}
+			bits <<= 1
+			if black {
+				bits |= 1
+			}
+		}
+		bits ^= 0x5412
+		Expect(bits>>13).To(Equal(0), "error correction level M")
+
+		rem := bits
+		for i := 14; i >= 10; i-- {
+			if (rem>>i)&1 == 1 {
+				rem ^= 0x537 << (i - 10)
+			}
+		}
+		Expect(rem).To(Equal(0), "BCH code")
+	})
+})
+
+var _ = Describe("Code", func() {
+	It("WritePNG() writes an image with the quiet zone", func() {
+		// Arrange
+		c, _ := qrcode.Encode("https://example.us.auth0.com/activate")
+		buf := new(bytes.Buffer)
+
+		// Act
+		err := c.WritePNG(buf, 2)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		img, err := png.Decode(buf)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Bounds().Dx()).To(Equal((c.Size() + 8) * 2))
+	})
+
+	It("WriteSVG() writes an SVG image", func() {
+		// Arrange
+		c, _ := qrcode.Encode("https://example.us.auth0.com/activate")
+		buf := new(bytes.Buffer)
+
+		// Act
+		err := c.WriteSVG(buf, 4)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buf.String()).To(HavePrefix("<svg "))
+		Expect(buf.String()).To(ContainSubstring("M4,4h1v1h-1z"))
+	})
+})
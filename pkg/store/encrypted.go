@@ -0,0 +1,166 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	encryptionVersion = 1
+	kdfNone           = "none"
+	kdfPBKDF2SHA256   = "pbkdf2-sha256"
+	// pbkdf2Iterations follows the recommendation of OWASP for PBKDF2-HMAC-SHA256.
+	pbkdf2Iterations = 600000
+	// maxPBKDF2Iterations bounds the work of files which may have been replaced.
+	maxPBKDF2Iterations = 10000000
+	saltSize            = 16
+	keySize             = 32
+)
+
+// EncryptionKey is the key to encrypt files of FileStore with AES-256-GCM,
+// which is a random key or derived from a passphrase for each file.
+type EncryptionKey struct {
+	key        []byte
+	passphrase []byte
+}
+
+// NewEncryptionKey returns EncryptionKey of the 32 bytes random key.
+func NewEncryptionKey(key []byte) (*EncryptionKey, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes: %d", keySize, len(key))
+	}
+	return &EncryptionKey{key: append([]byte(nil), key...)}, nil
+}
+
+// EncryptionKeyFromEnv returns EncryptionKey of the 32 bytes key encoded in base64 in the environment variable,
+// e.g. generated by `openssl rand -base64 32`.
+func EncryptionKeyFromEnv(name string) (*EncryptionKey, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s is not base64: %w", name, err)
+	}
+	return NewEncryptionKey(key)
+}
+
+// NewPassphraseKey returns EncryptionKey derived from the passphrase with PBKDF2-HMAC-SHA256 and a random salt for each file.
+// Deriving the key takes a moment on purpose to slow down guessing passphrases.
+func NewPassphraseKey(passphrase string) (*EncryptionKey, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	return &EncryptionKey{passphrase: []byte(passphrase)}, nil
+}
+
+// encryptedFile is the content of encrypted files of FileStore.
+// The profile and the namespace are authenticated as the additional data, so that files cannot be swapped between them.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func (k *EncryptionKey) seal(additionalData string, plaintext []byte) ([]byte, error) {
+	f := &encryptedFile{Version: encryptionVersion, KDF: kdfNone}
+	key := k.key
+	if k.passphrase != nil {
+		f.KDF, f.Iterations, f.Salt = kdfPBKDF2SHA256, pbkdf2Iterations, make([]byte, saltSize)
+		if _, err := rand.Read(f.Salt); err != nil {
+			return nil, fmt.Errorf("could not generate salt: %w", err)
+		}
+		key = pbkdf2.Key(k.passphrase, f.Salt, f.Iterations, keySize, sha256.New)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return nil, fmt.Errorf("could not generate nonce: %w", err)
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, []byte(additionalData))
+
+	return json.Marshal(f)
+}
+
+func (k *EncryptionKey) open(additionalData string, b []byte) ([]byte, error) {
+	f := new(encryptedFile)
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, err
+	}
+	if f.Version != encryptionVersion {
+		return nil, fmt.Errorf("unsupported version of encryption: %d (not encrypted?)", f.Version)
+	}
+
+	key := k.key
+	switch {
+	case f.KDF == kdfNone && k.passphrase == nil:
+	case f.KDF == kdfPBKDF2SHA256 && k.passphrase != nil:
+		if f.Iterations < 1 || f.Iterations > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("invalid iterations of PBKDF2: %d", f.Iterations)
+		}
+		if len(f.Salt) != saltSize {
+			return nil, fmt.Errorf("invalid salt of PBKDF2: %d bytes", len(f.Salt))
+		}
+		key = pbkdf2.Key(k.passphrase, f.Salt, f.Iterations, keySize, sha256.New)
+	case f.KDF == kdfPBKDF2SHA256:
+		return nil, errors.New("token is encrypted with a passphrase, not a key")
+	case f.KDF == kdfNone:
+		return nil, errors.New("token is encrypted with a key, not a passphrase")
+	default:
+		return nil, fmt.Errorf("unsupported KDF: %s", f.KDF)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, []byte(additionalData))
+	if err != nil {
+		return nil, errors.New("could not decrypt token with the key (wrong key or modified file)")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
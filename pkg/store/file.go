@@ -0,0 +1,328 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// FileStore is TokenStore keeping a token of each profile in a JSON file named after the profile in a directory.
+//
+// Files are readable and writable only by the owner, and replaced atomically so that readers never see partial files.
+// Load rejects files accessible by other users, because the tokens may have been stolen or replaced.
+// Files are also encrypted with EncryptionKey when the store is created by NewEncryptedFileStore.
+//
+// DefaultDir is separated by OS users, and WithNamespace separates applications sharing the directory.
+type FileStore struct {
+	dir       string
+	namespace string
+	// noCreate is set by WithoutCreatingDir.
+	noCreate bool
+	key      *EncryptionKey
+	// mu serializes operations in the process. Other processes may see only whole files.
+	mu sync.Mutex
+}
+
+var _ TokenStore = (*FileStore)(nil)
+
+// fileRecord is the content of files of FileStore.
+type fileRecord struct {
+	AccessToken  string                     `json:"access_token"`
+	RefreshToken string                     `json:"refresh_token,omitempty"`
+	IdToken      string                     `json:"id_token,omitempty"`
+	TokenType    string                     `json:"token_type"`
+	ExpiresIn    int                        `json:"expires_in"`
+	ExpiresAt    time.Time                  `json:"expires_at"`
+	Extra        map[string]json.RawMessage `json:"extra,omitempty"`
+}
+
+// FileStoreOption is an option of NewFileStore and NewEncryptedFileStore.
+type FileStoreOption interface {
+	apply(s *FileStore) error
+}
+
+// WithNamespace keeps tokens in the subdirectory named after namespace (e.g. the ID of the application),
+// so that applications sharing the directory do not overwrite tokens of each other.
+type WithNamespace string
+
+func (namespace WithNamespace) apply(s *FileStore) error {
+	if !profilePattern.MatchString(string(namespace)) {
+		return fmt.Errorf("invalid namespace: %q", string(namespace))
+	}
+	s.namespace = string(namespace)
+	return nil
+}
+
+// WithoutCreatingDir opens the store without creating the directory, e.g. for commands which only read tokens.
+// When the directory does not exist, the store has no tokens and Save fails.
+type WithoutCreatingDir bool
+
+func (noCreate WithoutCreatingDir) apply(s *FileStore) error {
+	s.noCreate = bool(noCreate)
+	return nil
+}
+
+// DefaultDir returns the directory of FileStore for the current OS user, which is a0daf/tokens in the user cache directory.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find cache directory: %w", err)
+	}
+	return filepath.Join(dir, "a0daf", "tokens"), nil
+}
+
+// NewFileStore returns FileStore in dir, which is created accessible only by the owner if it does not exist
+// unless WithoutCreatingDir is given. The existing directory accessible by other users is rejected like files.
+func NewFileStore(dir string, opts ...FileStoreOption) (*FileStore, error) {
+	s := &FileStore{}
+	for _, opt := range opts {
+		if err := opt.apply(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.namespace != "" {
+		dir = filepath.Join(dir, s.namespace)
+	}
+
+	if !s.noCreate {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("could not create token store: %w", err)
+		}
+	}
+
+	fi, err := os.Stat(dir)
+	if s.noCreate && errors.Is(err, fs.ErrNotExist) {
+		s.dir = dir
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create token store: %w", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("could not create token store: %s is not a directory", dir)
+	}
+	if err := checkPerm(dir, fi); err != nil {
+		return nil, fmt.Errorf("could not create token store: %w", err)
+	}
+
+	s.dir = dir
+	return s, nil
+}
+
+// checkPerm rejects the file accessible by other users.
+func checkPerm(path string, fi fs.FileInfo) error {
+	// permissions are not represented by mode bits on Windows
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return fmt.Errorf("%s is accessible by other users (mode %s)", path, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// NewEncryptedFileStore is like NewFileStore, but tokens are encrypted at rest with AES-256-GCM by key.
+// It is for environments without a keyring of the system, e.g. containers and headless servers.
+func NewEncryptedFileStore(dir string, key *EncryptionKey, opts ...FileStoreOption) (*FileStore, error) {
+	if key == nil {
+		return nil, errors.New("encryption key is required")
+	}
+
+	s, err := NewFileStore(dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s.key = key
+	return s, nil
+}
+
+func (s *FileStore) path(profile string) string {
+	return filepath.Join(s.dir, profile+".json")
+}
+
+// additionalData returns the data authenticated with the encrypted token, so that files cannot be moved
+// to other profiles or namespaces. It is the namespace and the profile joined with "/", or only the profile without the namespace.
+func (s *FileStore) additionalData(profile string) string {
+	if s.namespace == "" {
+		return profile
+	}
+	return s.namespace + "/" + profile
+}
+
+func (s *FileStore) Save(profile string, token *Token) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	if err := validateToken(token); err != nil {
+		return err
+	}
+
+	r := token.Response
+	b, err := json.Marshal(&fileRecord{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+		IdToken:      r.IdToken,
+		TokenType:    r.TokenType,
+		ExpiresIn:    r.ExpiresIn,
+		ExpiresAt:    token.ExpiresAt,
+		Extra:        r.Extra,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode token: %w", err)
+	}
+	if s.key != nil {
+		if b, err = s.key.seal(s.additionalData(profile), b); err != nil {
+			return fmt.Errorf("could not encrypt token: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(profile)
+	// CreateTemp creates the file with 0600
+	f, err := os.CreateTemp(s.dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("could not save token: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("could not save token: %w", err)
+	}
+	// the content must be on the disk before the rename, or a crash may leave the empty file
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not save token: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not save token: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("could not save token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) Load(profile string) (*Token, error) {
+	if err := validateProfile(profile); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.path(profile)
+	// the opened file is checked, so that it cannot be replaced between the check and the read
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load token: %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("could not load token: %w", err)
+	}
+	if err := checkPerm(path, fi); err != nil {
+		return nil, fmt.Errorf("could not load token: %w", err)
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not load token: %w", err)
+	}
+	if s.key != nil {
+		if b, err = s.key.open(s.additionalData(profile), b); err != nil {
+			return nil, fmt.Errorf("could not decrypt token in %s: %w", path, err)
+		}
+	}
+
+	r := new(fileRecord)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("could not decode token in %s: %w", path, err)
+	}
+	if r.AccessToken == "" {
+		return nil, fmt.Errorf("could not decode token in %s: no access token (encrypted?)", path)
+	}
+
+	return &Token{
+		Response: &auth.TokenResponse{
+			AccessToken:  r.AccessToken,
+			RefreshToken: r.RefreshToken,
+			IdToken:      r.IdToken,
+			TokenType:    r.TokenType,
+			ExpiresIn:    r.ExpiresIn,
+			Extra:        r.Extra,
+		},
+		ExpiresAt: r.ExpiresAt,
+	}, nil
+}
+
+func (s *FileStore) Delete(profile string) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(profile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not delete token: %w", err)
+	}
+	return nil
+}
+
+// Profiles returns the sorted profiles which have tokens in the store.
+// Files which are not named like tokens, e.g. temporary files of Save, are ignored.
+func (s *FileStore) Profiles() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not list tokens: %w", err)
+	}
+
+	profiles := make([]string, 0, len(entries))
+	for _, e := range entries {
+		profile := strings.TrimSuffix(e.Name(), ".json")
+		if !e.Type().IsRegular() || profile == e.Name() || !profilePattern.MatchString(profile) {
+			continue
+		}
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles, nil
+}
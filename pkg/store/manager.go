@@ -0,0 +1,315 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// defaultRefreshBefore is the default lead time of TokenManager to refresh tokens before their expiry.
+const defaultRefreshBefore = time.Minute
+
+// ErrAuthorizationRequired is returned by TokenManager without the prompt when the user has to authorize again.
+var ErrAuthorizationRequired = errors.New("authorization is required, but no prompt is given")
+
+// TokenManager provides the access token of a profile. It returns the token saved in TokenStore while it is valid,
+// refreshes it with the refresh token when it is near expiry, and runs the device authorization flow only as a last resort,
+// i.e. when no token is saved, or the refresh token is missing or rejected with invalid_grant.
+// Obtained tokens are saved to the store, so that later processes can reuse them.
+// Refreshing is done by auth.CachedTokenSource of the token.
+//
+// It is safe for concurrent use, and concurrent calls share a refresh or a flow.
+type TokenManager struct {
+	store         TokenStore
+	profile       string
+	daf           *auth.DeviceAuthFlow
+	prompt        func(dc *auth.DeviceCodeResponse) error
+	scope         string
+	audience      string
+	refreshBefore time.Duration
+	timeNow       func() time.Time
+
+	// sem serializes loading and refreshing the token. It is a channel so that waiting for it can be canceled.
+	sem    chan struct{}
+	token  *Token
+	source *auth.CachedTokenSource
+	// flow is the device authorization flow in progress, which is run without sem and shared by concurrent calls.
+	flow *sharedFlow
+}
+
+// sharedFlow is the result of the device authorization flow, which is available after done is closed.
+type sharedFlow struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// ManagerOption is an option of NewTokenManager.
+type ManagerOption interface {
+	apply(m *TokenManager) error
+}
+
+// WithScope specifies the scope requested by the device authorization flow.
+// By default, WithDefaultScope of the flow is used.
+type WithScope string
+
+func (scope WithScope) apply(m *TokenManager) error {
+	m.scope = string(scope)
+	return nil
+}
+
+// WithAudience specifies the audience requested by the device authorization flow.
+// By default, WithDefaultAudience of the flow is used.
+type WithAudience string
+
+func (audience WithAudience) apply(m *TokenManager) error {
+	m.audience = string(audience)
+	return nil
+}
+
+// WithRefreshBefore specifies the lead time to refresh tokens before their expiry (1 minute by default).
+// It is shortened to the half of the lifetime for short-lived tokens.
+type WithRefreshBefore time.Duration
+
+func (d WithRefreshBefore) apply(m *TokenManager) error {
+	if d < 0 {
+		return fmt.Errorf("refresh lead time must not be negative: %s", time.Duration(d))
+	}
+	m.refreshBefore = time.Duration(d)
+	return nil
+}
+
+// WithTimeNow specifies the function to get the current time (time.Now by default).
+type WithTimeNow func() time.Time
+
+func (timeNow WithTimeNow) apply(m *TokenManager) error {
+	m.timeNow = timeNow
+	return nil
+}
+
+// NewTokenManager returns TokenManager of profile in store, which obtains tokens with daf.
+// prompt shows the user code and the verification URI to the user like Authorize.
+// When prompt is nil, the flow is never run and ErrAuthorizationRequired is returned instead, e.g. for batch jobs.
+func NewTokenManager(store TokenStore, profile string, daf *auth.DeviceAuthFlow, prompt func(dc *auth.DeviceCodeResponse) error, opts ...ManagerOption) (*TokenManager, error) {
+	if store == nil || daf == nil {
+		return nil, errors.New("token store and flow are required")
+	}
+	if err := validateProfile(profile); err != nil {
+		return nil, err
+	}
+
+	m := &TokenManager{
+		store:         store,
+		profile:       profile,
+		daf:           daf,
+		prompt:        prompt,
+		refreshBefore: defaultRefreshBefore,
+		timeNow:       time.Now,
+		sem:           make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		if err := opt.apply(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// GetAccessToken returns a valid access token, refreshing or authorizing as needed.
+func (m *TokenManager) GetAccessToken() (string, error) {
+	return m.GetAccessTokenContext(context.Background())
+}
+
+// GetAccessTokenContext is like GetAccessToken, but requests are canceled when ctx is done.
+func (m *TokenManager) GetAccessTokenContext(ctx context.Context) (string, error) {
+	token, err := m.GetTokenContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	return token.Response.AccessToken, nil
+}
+
+// GetToken is like GetAccessToken, but returns the whole Token including the refresh token and the ID token.
+func (m *TokenManager) GetToken() (*Token, error) {
+	return m.GetTokenContext(context.Background())
+}
+
+// GetTokenContext is like GetToken, but requests and waiting for other calls are canceled when ctx is done.
+func (m *TokenManager) GetTokenContext(ctx context.Context) (*Token, error) {
+	token, flow, err := m.tokenOrFlow(ctx)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	select {
+	case <-flow.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if flow.err != nil {
+		return nil, flow.err
+	}
+	return flow.token.clone(), nil
+}
+
+// tokenOrFlow returns the valid token by loading or refreshing it, or the device authorization flow to wait for.
+func (m *TokenManager) tokenOrFlow(ctx context.Context) (*Token, *sharedFlow, error) {
+	select {
+	case m.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	defer func() { <-m.sem }()
+
+	if m.flow != nil {
+		return nil, m.flow, nil
+	}
+
+	now := m.timeNow()
+	if m.fresh(now) {
+		return m.token.clone(), nil, nil
+	}
+
+	// other processes may have refreshed the token, and the refresh token may be rotated by them
+	if err := m.reload(); err != nil {
+		return nil, nil, err
+	}
+	if m.fresh(now) {
+		return m.token.clone(), nil, nil
+	}
+
+	if m.token != nil && m.token.Response.RefreshToken != "" {
+		token, err := m.refresh(ctx, now)
+		if err == nil {
+			return token, nil, nil
+		}
+		if !auth.IsInvalidGrant(err) {
+			// the token can be used until its expiry even if the server is unavailable
+			if !m.token.Expired(now) {
+				return m.token.clone(), nil, nil
+			}
+			return nil, nil, err
+		}
+	}
+
+	if m.prompt == nil {
+		return nil, nil, ErrAuthorizationRequired
+	}
+	m.flow = &sharedFlow{done: make(chan struct{})}
+	go m.authorize(ctx, m.flow)
+	return nil, m.flow, nil
+}
+
+// reload replaces the token with the saved one if any.
+func (m *TokenManager) reload() error {
+	saved, err := m.store.Load(m.profile)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	m.setToken(saved)
+	return nil
+}
+
+func (m *TokenManager) setToken(token *Token) {
+	m.token = token
+	m.source = m.daf.NewCachedTokenSourceExpiringAt(token.Response, token.ExpiresAt, m.refreshBefore)
+}
+
+// fresh reports whether the token is valid at now and does not have to be refreshed yet.
+// The token which never expires is always fresh.
+func (m *TokenManager) fresh(now time.Time) bool {
+	if m.token == nil {
+		return false
+	}
+	refreshAt := m.source.RefreshAt()
+	return refreshAt.IsZero() || now.Before(refreshAt)
+}
+
+// refresh refreshes the token. When the refresh token is rejected, it is retried once with the saved token
+// if another process has rotated the refresh token in the meantime.
+func (m *TokenManager) refresh(ctx context.Context, now time.Time) (*Token, error) {
+	response, err := m.source.Refresh(ctx)
+	if err != nil && auth.IsInvalidGrant(err) {
+		rejected := m.token.Response.RefreshToken
+		if reloadErr := m.reload(); reloadErr != nil {
+			return nil, reloadErr
+		}
+		if m.token.Response.RefreshToken == rejected {
+			return nil, err
+		}
+		if m.fresh(now) {
+			return m.token.clone(), nil
+		}
+		response, err = m.source.Refresh(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return m.save(NewToken(response, now))
+}
+
+// authorize runs the device authorization flow with ctx of the call which started it, and saves the token.
+func (m *TokenManager) authorize(ctx context.Context, flow *sharedFlow) {
+	defer close(flow.done)
+
+	token, err := m.runFlow(ctx)
+
+	// waiting calls hold sem only for a moment, because they return the flow in progress
+	m.sem <- struct{}{}
+	defer func() { <-m.sem }()
+	m.flow = nil
+	if err != nil {
+		flow.err = err
+		return
+	}
+	flow.token, flow.err = m.save(token)
+}
+
+func (m *TokenManager) runFlow(ctx context.Context) (*Token, error) {
+	dc, err := m.daf.FetchDeviceCodeContext(ctx, m.scope, m.audience)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.prompt(dc); err != nil {
+		return nil, err
+	}
+	response, err := m.daf.PollTokenContext(ctx, dc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the user may take minutes to authorize
+	return NewToken(response, m.timeNow()), nil
+}
+
+// save saves token to the store. Even if it fails, token is kept in memory so that it is not lost.
+func (m *TokenManager) save(token *Token) (*Token, error) {
+	m.setToken(token)
+	if err := m.store.Save(m.profile, token); err != nil {
+		return nil, err
+	}
+	return token.clone(), nil
+}
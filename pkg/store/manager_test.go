@@ -0,0 +1,324 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TokenManager", func() {
+	var ts *httptest.Server
+	var mu sync.Mutex
+	var requests map[string]int
+	// refreshStatus is the status code of responses to the refresh token grant
+	var refreshStatus int
+	var now time.Time
+	var s *store.MemoryStore
+
+	BeforeEach(func() {
+		requests = make(map[string]int)
+		refreshStatus = 200
+		now = issuedAt
+		s = store.NewMemoryStore()
+		ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			mu.Lock()
+			defer mu.Unlock()
+			w.Header().Set("content-type", "application/json")
+
+			if r.URL.Path == "/oauth/device/code" {
+				requests["device_code"]++
+				w.Write([]byte(`{"device_code": "device_code", "user_code": "ABCD-EFGH", "verification_uri": "https://example.com/activate", "expires_in": 900, "interval": 5}`))
+				return
+			}
+
+			grant := r.PostForm.Get("grant_type")
+			requests[grant]++
+			if grant == "refresh_token" {
+				if r.PostForm.Get("refresh_token") == "rotated_refresh_token" {
+					w.Write([]byte(`{"access_token": "refreshed_access_token", "token_type": "Bearer", "expires_in": 86400}`))
+					return
+				}
+				switch refreshStatus {
+				case 200:
+					w.Write([]byte(`{"access_token": "refreshed_access_token", "token_type": "Bearer", "expires_in": 86400}`))
+				case 400:
+					w.WriteHeader(400)
+					w.Write([]byte(`{"error": "invalid_grant", "error_description": "Unknown or invalid refresh token."}`))
+				default:
+					w.WriteHeader(refreshStatus)
+				}
+				return
+			}
+			w.Write([]byte(`{"access_token": "authorized_access_token", "refresh_token": "new_refresh_token", "token_type": "Bearer", "expires_in": 86400}`))
+		}))
+	})
+
+	AfterEach(func() {
+		ts.Close()
+	})
+
+	newManagerOf := func(s store.TokenStore, prompt func(dc *auth.DeviceCodeResponse) error) *store.TokenManager {
+		daf, err := auth.NewDeviceAuthFlow(
+			auth.WithBaseURL(ts.URL),
+			auth.WithClientID("clientID"),
+			auth.WithTimeSleep(func(d time.Duration) {}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		m, err := store.NewTokenManager(s, "default", daf, prompt, store.WithScope("openid offline_access"), store.WithTimeNow(func() time.Time { return now }))
+		Expect(err).NotTo(HaveOccurred())
+		return m
+	}
+
+	newManager := func(prompt func(dc *auth.DeviceCodeResponse) error) *store.TokenManager {
+		return newManagerOf(s, prompt)
+	}
+
+	prompted := 0
+	prompt := func(dc *auth.DeviceCodeResponse) error {
+		prompted++
+		return nil
+	}
+
+	BeforeEach(func() {
+		prompted = 0
+	})
+
+	It("returns the saved token while it is valid", func() {
+		// Arrange
+		Expect(s.Save("default", newToken())).To(Succeed())
+		m := newManager(prompt)
+		now = issuedAt.Add(23 * time.Hour)
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("access_token"))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("returns the saved token without expires_in without refreshing it", func() {
+		// Arrange
+		token := store.NewToken(&auth.TokenResponse{AccessToken: "access_token", RefreshToken: "refresh_token", TokenType: "Bearer"}, issuedAt)
+		Expect(s.Save("default", token)).To(Succeed())
+		m := newManager(prompt)
+		now = issuedAt.Add(365 * 24 * time.Hour)
+
+		// Act
+		actual, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual).To(Equal("access_token"))
+		Expect(requests).To(BeEmpty())
+		Expect(prompted).To(Equal(0))
+	})
+
+	It("refreshes the token near expiry and saves it", func() {
+		// Arrange
+		Expect(s.Save("default", newToken())).To(Succeed())
+		m := newManager(prompt)
+		now = issuedAt.Add(24*time.Hour - 30*time.Second)
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("refreshed_access_token"))
+		Expect(requests).To(Equal(map[string]int{"refresh_token": 1}))
+		saved, _ := s.Load("default")
+		Expect(saved.Response.AccessToken).To(Equal("refreshed_access_token"))
+		Expect(saved.Response.RefreshToken).To(Equal("refresh_token"))
+		Expect(saved.ExpiresAt).To(Equal(now.Add(24 * time.Hour)))
+
+		token, _ = m.GetAccessToken()
+		Expect(token).To(Equal("refreshed_access_token"))
+		Expect(requests).To(Equal(map[string]int{"refresh_token": 1}))
+	})
+
+	It("runs the device authorization flow when no token is saved", func() {
+		// Arrange
+		m := newManager(prompt)
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("authorized_access_token"))
+		Expect(prompted).To(Equal(1))
+		saved, _ := s.Load("default")
+		Expect(saved.Response.RefreshToken).To(Equal("new_refresh_token"))
+	})
+
+	It("runs the device authorization flow when the refresh token is rejected", func() {
+		// Arrange
+		Expect(s.Save("default", newToken())).To(Succeed())
+		refreshStatus = 400
+		m := newManager(prompt)
+		now = issuedAt.Add(24 * time.Hour)
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("authorized_access_token"))
+		Expect(requests["refresh_token"]).To(Equal(1))
+		Expect(prompted).To(Equal(1))
+	})
+
+	It("returns the valid token when the server is unavailable to refresh it", func() {
+		// Arrange
+		Expect(s.Save("default", newToken())).To(Succeed())
+		refreshStatus = 503
+		m := newManager(prompt)
+		now = issuedAt.Add(24*time.Hour - 30*time.Second)
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("access_token"))
+		Expect(prompted).To(BeZero())
+
+		now = issuedAt.Add(24 * time.Hour)
+		_, err = m.GetAccessToken()
+		var serverErr *auth.ServerError
+		Expect(errors.As(err, &serverErr)).To(BeTrue())
+		Expect(prompted).To(BeZero())
+	})
+
+	It("returns ErrAuthorizationRequired without the prompt", func() {
+		// Arrange
+		m := newManager(nil)
+
+		// Act
+		_, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).To(MatchError(store.ErrAuthorizationRequired))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("returns the error of the prompt without polling", func() {
+		// Arrange
+		canceled := errors.New("canceled")
+		m := newManager(func(dc *auth.DeviceCodeResponse) error { return canceled })
+
+		// Act
+		_, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).To(MatchError(canceled))
+		Expect(requests).To(Equal(map[string]int{"device_code": 1}))
+	})
+
+	It("uses the token refreshed by another manager of the store", func() {
+		// Arrange
+		Expect(s.Save("default", newToken())).To(Succeed())
+		m := newManager(prompt)
+		other := newManager(prompt)
+		Expect(m.GetAccessToken()).To(Equal("access_token"))
+		now = issuedAt.Add(24 * time.Hour)
+		Expect(other.GetAccessToken()).To(Equal("refreshed_access_token"))
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("refreshed_access_token"))
+		Expect(requests).To(Equal(map[string]int{"refresh_token": 1}))
+	})
+
+	It("retries with the refresh token rotated by another process when it is rejected", func() {
+		// Arrange
+		refreshStatus = 400
+		rotated := newToken()
+		rotated.Response.RefreshToken = "rotated_refresh_token"
+		Expect(s.Save("default", rotated)).To(Succeed())
+		m := newManagerOf(&staleStore{TokenStore: s, stale: newToken()}, prompt)
+		now = issuedAt.Add(24 * time.Hour)
+
+		// Act
+		token, err := m.GetAccessToken()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("refreshed_access_token"))
+		Expect(requests).To(Equal(map[string]int{"refresh_token": 2}))
+		Expect(prompted).To(BeZero())
+		saved, _ := s.Load("default")
+		Expect(saved.Response.RefreshToken).To(Equal("rotated_refresh_token"))
+	})
+
+	It("does not block other calls beyond their context while the flow is in progress", func() {
+		// Arrange
+		prompting := make(chan struct{})
+		unblock := make(chan struct{})
+		m := newManager(func(dc *auth.DeviceCodeResponse) error {
+			close(prompting)
+			<-unblock
+			return nil
+		})
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := m.GetAccessToken()
+			errCh <- err
+		}()
+		Eventually(prompting).Should(BeClosed())
+
+		// Act
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := m.GetAccessTokenContext(ctx)
+
+		// Assert
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		close(unblock)
+		Eventually(errCh).Should(Receive(BeNil()))
+		token, err := m.GetAccessToken()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal("authorized_access_token"))
+		Expect(requests["device_code"]).To(Equal(1))
+	})
+
+	It("rejects invalid options", func() {
+		// Arrange
+		daf, _ := auth.NewDeviceAuthFlow(auth.WithBaseURL(ts.URL), auth.WithClientID("clientID"))
+
+		// Act
+		_, err := store.NewTokenManager(s, "default", daf, nil, store.WithRefreshBefore(-time.Second))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+// staleStore returns the stale token on the first Load, like the token loaded before another process rotates it.
+type staleStore struct {
+	store.TokenStore
+	stale *store.Token
+}
+
+func (s *staleStore) Load(profile string) (*store.Token, error) {
+	if stale := s.stale; stale != nil {
+		s.stale = nil
+		return stale, nil
+	}
+	return s.TokenStore.Load(profile)
+}
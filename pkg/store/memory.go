@@ -0,0 +1,69 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import "sync"
+
+// MemoryStore is TokenStore keeping tokens in memory, e.g. for tests and long-running processes.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*Token
+}
+
+var _ TokenStore = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{tokens: make(map[string]*Token)}
+}
+
+func (s *MemoryStore) Save(profile string, token *Token) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	if err := validateToken(token); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[profile] = token.clone()
+	return nil
+}
+
+func (s *MemoryStore) Load(profile string) (*Token, error) {
+	if err := validateProfile(profile); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[profile]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return token.clone(), nil
+}
+
+func (s *MemoryStore) Delete(profile string) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, profile)
+	return nil
+}
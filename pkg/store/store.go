@@ -0,0 +1,87 @@
+// Copyright (C) 2022	 Akira Tanimura (@autopp)
+//
+// Licensed under the Apache License, Version 2.0 (the “License”);
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an “AS IS” BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store persists tokens obtained by the flows of pkg/auth, so that they can be reused by later processes,
+// and provides TokenManager to refresh or obtain them as needed.
+//
+// Only tokens are saved, because nothing else is needed to refresh them after restarts. The PKCE verifier of
+// the authorization code flow is used once for the code exchange, and tokens are not sender-constrained (e.g. by DPoP).
+package store
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+)
+
+// ErrNotFound is returned by Load when no token is saved for the profile.
+var ErrNotFound = errors.New("token is not found")
+
+// TokenStore saves tokens keyed by the profile.
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// Save saves token for profile, replacing the saved one.
+	Save(profile string, token *Token) error
+	// Load returns the token saved for profile, or ErrNotFound.
+	Load(profile string) (*Token, error)
+	// Delete deletes the token saved for profile. It is not an error that no token is saved.
+	Delete(profile string) error
+}
+
+// Token is a token response with its expiry, which is an absolute time unlike ExpiresIn of the response.
+type Token struct {
+	Response *auth.TokenResponse
+	// ExpiresAt is zero when the response has no expires_in, and then the token never expires.
+	ExpiresAt time.Time
+}
+
+// NewToken returns Token of the response issued at issuedAt.
+func NewToken(response *auth.TokenResponse, issuedAt time.Time) *Token {
+	if response.ExpiresIn <= 0 {
+		return &Token{Response: response}
+	}
+	return &Token{Response: response, ExpiresAt: issuedAt.Add(time.Duration(response.ExpiresIn) * time.Second)}
+}
+
+// Expired reports whether the access token is expired at now.
+// The refresh token may still be valid.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// clone returns a copy of t which does not share the response.
+func (t *Token) clone() *Token {
+	response := *t.Response
+	return &Token{Response: &response, ExpiresAt: t.ExpiresAt}
+}
+
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// validateProfile rejects names which cannot be a file name, e.g. paths to other directories.
+func validateProfile(profile string) error {
+	if !profilePattern.MatchString(profile) {
+		return fmt.Errorf("invalid profile name: %q", profile)
+	}
+	return nil
+}
+
+func validateToken(token *Token) error {
+	if token == nil || token.Response == nil {
+		return errors.New("token to save must have the response")
+	}
+	return nil
+}
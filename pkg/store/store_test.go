@@ -0,0 +1,470 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/autopp/go-a0daf/pkg/auth"
+	"github.com/autopp/go-a0daf/pkg/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var issuedAt = time.Date(2022, 8, 29, 10, 0, 0, 0, time.UTC)
+
+func newToken() *store.Token {
+	return store.NewToken(&auth.TokenResponse{
+		AccessToken:  "access_token",
+		RefreshToken: "refresh_token",
+		IdToken:      "id_token",
+		TokenType:    "Bearer",
+		ExpiresIn:    86400,
+		Extra:        map[string]json.RawMessage{"scope": json.RawMessage(`"openid offline_access"`)},
+	}, issuedAt)
+}
+
+// itBehavesLikeTokenStore describes the behavior common to implementations of TokenStore.
+func itBehavesLikeTokenStore(newStore func() store.TokenStore) {
+	It("loads the saved token", func() {
+		// Arrange
+		s := newStore()
+		Expect(s.Save("default", newToken())).To(Succeed())
+
+		// Act
+		token, err := s.Load("default")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal(newToken()))
+	})
+
+	It("replaces the saved token", func() {
+		// Arrange
+		s := newStore()
+		Expect(s.Save("default", newToken())).To(Succeed())
+		newer := newToken()
+		newer.Response.AccessToken = "newer_access_token"
+
+		// Act
+		err := s.Save("default", newer)
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		token, _ := s.Load("default")
+		Expect(token.Response.AccessToken).To(Equal("newer_access_token"))
+	})
+
+	It("keeps tokens of profiles separately", func() {
+		// Arrange
+		s := newStore()
+		Expect(s.Save("default", newToken())).To(Succeed())
+
+		// Act
+		_, err := s.Load("staging")
+
+		// Assert
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+
+	It("deletes the saved token", func() {
+		// Arrange
+		s := newStore()
+		Expect(s.Save("default", newToken())).To(Succeed())
+
+		// Act
+		err := s.Delete("default")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		_, err = s.Load("default")
+		Expect(errors.Is(err, store.ErrNotFound)).To(BeTrue())
+		Expect(s.Delete("default")).To(Succeed())
+	})
+
+	It("does not share the token with the caller", func() {
+		// Arrange
+		s := newStore()
+		token := newToken()
+		Expect(s.Save("default", token)).To(Succeed())
+
+		// Act
+		token.Response.AccessToken = "modified"
+
+		// Assert
+		loaded, _ := s.Load("default")
+		Expect(loaded.Response.AccessToken).To(Equal("access_token"))
+	})
+
+	DescribeTable("rejects invalid profile names",
+		func(profile string) {
+			// Arrange
+			s := newStore()
+
+			// Act
+			err := s.Save(profile, newToken())
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("empty", ""),
+		Entry("parent directory", ".."),
+		Entry("path", "../default"),
+		Entry("hidden", ".default"),
+	)
+
+	It("rejects the token without the response", func() {
+		// Act
+		err := newStore().Save("default", &store.Token{})
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+}
+
+var _ = Describe("Token", func() {
+	It("expires after ExpiresIn from issuedAt", func() {
+		// Arrange
+		token := newToken()
+
+		// Assert
+		Expect(token.ExpiresAt).To(Equal(issuedAt.Add(24 * time.Hour)))
+		Expect(token.Expired(issuedAt.Add(24*time.Hour - time.Second))).To(BeFalse())
+		Expect(token.Expired(issuedAt.Add(24 * time.Hour))).To(BeTrue())
+	})
+
+	It("never expires without expires_in", func() {
+		// Arrange
+		token := store.NewToken(&auth.TokenResponse{AccessToken: "access_token", TokenType: "Bearer"}, issuedAt)
+
+		// Assert
+		Expect(token.ExpiresAt.IsZero()).To(BeTrue())
+		Expect(token.Expired(issuedAt.Add(365 * 24 * time.Hour))).To(BeFalse())
+	})
+})
+
+var _ = Describe("MemoryStore", func() {
+	itBehavesLikeTokenStore(func() store.TokenStore {
+		return store.NewMemoryStore()
+	})
+})
+
+var _ = Describe("FileStore", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "tokens")
+	})
+
+	itBehavesLikeTokenStore(func() store.TokenStore {
+		s, err := store.NewFileStore(dir)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	})
+
+	It("writes files and the directory accessible only by the owner", func() {
+		// Arrange
+		s, _ := store.NewFileStore(dir)
+
+		// Act
+		err := s.Save("default", newToken())
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		di, _ := os.Stat(dir)
+		Expect(di.Mode().Perm()).To(Equal(os.FileMode(0o700)))
+		fi, _ := os.Stat(filepath.Join(dir, "default.json"))
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		entries, _ := os.ReadDir(dir)
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("keeps tokens across stores in the same directory", func() {
+		// Arrange
+		s, _ := store.NewFileStore(dir)
+		Expect(s.Save("default", newToken())).To(Succeed())
+		other, _ := store.NewFileStore(dir)
+
+		// Act
+		token, err := other.Load("default")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal(newToken()))
+	})
+
+	It("rejects files accessible by other users", func() {
+		// Arrange
+		s, _ := store.NewFileStore(dir)
+		Expect(s.Save("default", newToken())).To(Succeed())
+		Expect(os.Chmod(filepath.Join(dir, "default.json"), 0o644)).To(Succeed())
+
+		// Act
+		_, err := s.Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("accessible by other users")))
+	})
+
+	It("keeps tokens of namespaces separately", func() {
+		// Arrange
+		s, _ := store.NewFileStore(dir, store.WithNamespace("app1"))
+		other, _ := store.NewFileStore(dir, store.WithNamespace("app2"))
+		Expect(s.Save("default", newToken())).To(Succeed())
+
+		// Act
+		_, err := other.Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(store.ErrNotFound))
+		fi, _ := os.Stat(filepath.Join(dir, "app1", "default.json"))
+		Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+	})
+
+	It("rejects invalid namespaces", func() {
+		// Act
+		_, err := store.NewFileStore(dir, store.WithNamespace("../app"))
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists profiles which have tokens", func() {
+		// Arrange
+		s, _ := store.NewFileStore(dir)
+		Expect(s.Save("staging", newToken())).To(Succeed())
+		Expect(s.Save("default", newToken())).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, ".default.json.123"), []byte("{}"), 0o600)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(""), 0o600)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(dir, "app1"), 0o700)).To(Succeed())
+
+		// Act
+		profiles, err := s.Profiles()
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(profiles).To(Equal([]string{"default", "staging"}))
+	})
+
+	It("does not create the directory with WithoutCreatingDir", func() {
+		// Arrange
+		s, err := store.NewFileStore(dir, store.WithoutCreatingDir(true))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		profiles, profilesErr := s.Profiles()
+		_, loadErr := s.Load("default")
+
+		// Assert
+		Expect(profilesErr).NotTo(HaveOccurred())
+		Expect(profiles).To(BeEmpty())
+		Expect(loadErr).To(MatchError(store.ErrNotFound))
+		Expect(dir).NotTo(BeADirectory())
+	})
+
+	It("reads tokens in the existing directory with WithoutCreatingDir", func() {
+		// Arrange
+		created, _ := store.NewFileStore(dir)
+		Expect(created.Save("default", newToken())).To(Succeed())
+		s, err := store.NewFileStore(dir, store.WithoutCreatingDir(true))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Act
+		actual, err := s.Load("default")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual).To(Equal(newToken()))
+	})
+
+	It("rejects the directory accessible by other users", func() {
+		// Arrange
+		Expect(os.Mkdir(dir, 0o700)).To(Succeed())
+		Expect(os.Chmod(dir, 0o755)).To(Succeed())
+
+		// Act
+		_, err := store.NewFileStore(dir)
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("accessible by other users")))
+	})
+})
+
+var _ = Describe("FileStore encrypted", func() {
+	var dir string
+	rawKey := bytes.Repeat([]byte{0x42}, 32)
+
+	BeforeEach(func() {
+		dir = filepath.Join(GinkgoT().TempDir(), "tokens")
+	})
+
+	newEncryptedStore := func(key []byte) *store.FileStore {
+		k, err := store.NewEncryptionKey(key)
+		Expect(err).NotTo(HaveOccurred())
+		s, err := store.NewEncryptedFileStore(dir, k)
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	itBehavesLikeTokenStore(func() store.TokenStore {
+		return newEncryptedStore(rawKey)
+	})
+
+	It("does not write tokens in plain text", func() {
+		// Arrange
+		s := newEncryptedStore(rawKey)
+
+		// Act
+		err := s.Save("default", newToken())
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		b, _ := os.ReadFile(filepath.Join(dir, "default.json"))
+		Expect(string(b)).NotTo(ContainSubstring("access_token"))
+		Expect(string(b)).NotTo(ContainSubstring("refresh_token"))
+	})
+
+	It("rejects the token encrypted with another key", func() {
+		// Arrange
+		Expect(newEncryptedStore(rawKey).Save("default", newToken())).To(Succeed())
+
+		// Act
+		_, err := newEncryptedStore(bytes.Repeat([]byte{0x43}, 32)).Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("could not decrypt token")))
+	})
+
+	It("rejects the token moved from another profile", func() {
+		// Arrange
+		s := newEncryptedStore(rawKey)
+		Expect(s.Save("default", newToken())).To(Succeed())
+		Expect(os.Rename(filepath.Join(dir, "default.json"), filepath.Join(dir, "staging.json"))).To(Succeed())
+
+		// Act
+		_, err := s.Load("staging")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("could not decrypt token")))
+	})
+
+	It("rejects the token moved from another namespace", func() {
+		// Arrange
+		k, _ := store.NewEncryptionKey(rawKey)
+		s, _ := store.NewEncryptedFileStore(dir, k, store.WithNamespace("app1"))
+		other, _ := store.NewEncryptedFileStore(dir, k, store.WithNamespace("app2"))
+		Expect(s.Save("default", newToken())).To(Succeed())
+		Expect(os.Rename(filepath.Join(dir, "app1", "default.json"), filepath.Join(dir, "app2", "default.json"))).To(Succeed())
+
+		// Act
+		_, err := other.Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("could not decrypt token")))
+	})
+
+	It("rejects the token not encrypted", func() {
+		// Arrange
+		plain, _ := store.NewFileStore(dir)
+		Expect(plain.Save("default", newToken())).To(Succeed())
+
+		// Act
+		_, err := newEncryptedStore(rawKey).Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("not encrypted")))
+	})
+
+	It("is rejected by FileStore without the key", func() {
+		// Arrange
+		Expect(newEncryptedStore(rawKey).Save("default", newToken())).To(Succeed())
+		plain, _ := store.NewFileStore(dir)
+
+		// Act
+		_, err := plain.Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("encrypted?")))
+	})
+
+	It("loads the token encrypted with the same passphrase", func() {
+		// Arrange
+		k, err := store.NewPassphraseKey("correct horse battery staple")
+		Expect(err).NotTo(HaveOccurred())
+		s, _ := store.NewEncryptedFileStore(dir, k)
+		Expect(s.Save("default", newToken())).To(Succeed())
+		wrong, _ := store.NewPassphraseKey("wrong")
+		other, _ := store.NewEncryptedFileStore(dir, wrong)
+
+		// Act
+		token, err := s.Load("default")
+		_, otherErr := other.Load("default")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal(newToken()))
+		Expect(otherErr).To(MatchError(ContainSubstring("could not decrypt token")))
+	})
+
+	It("rejects the salt of the passphrase which is too short", func() {
+		// Arrange
+		k, _ := store.NewPassphraseKey("correct horse battery staple")
+		s, _ := store.NewEncryptedFileStore(dir, k)
+		Expect(s.Save("default", newToken())).To(Succeed())
+		path := filepath.Join(dir, "default.json")
+		b, _ := os.ReadFile(path)
+		f := map[string]interface{}{}
+		Expect(json.Unmarshal(b, &f)).To(Succeed())
+		f["salt"] = base64.StdEncoding.EncodeToString([]byte("salt"))
+		b, _ = json.Marshal(f)
+		Expect(os.WriteFile(path, b, 0o600)).To(Succeed())
+
+		// Act
+		_, err := s.Load("default")
+
+		// Assert
+		Expect(err).To(MatchError(ContainSubstring("invalid salt")))
+	})
+
+	It("reads the key from the environment variable", func() {
+		// Arrange
+		GinkgoT().Setenv("A0DAF_TEST_TOKEN_KEY", base64.StdEncoding.EncodeToString(rawKey))
+		Expect(newEncryptedStore(rawKey).Save("default", newToken())).To(Succeed())
+
+		// Act
+		k, err := store.EncryptionKeyFromEnv("A0DAF_TEST_TOKEN_KEY")
+
+		// Assert
+		Expect(err).NotTo(HaveOccurred())
+		s, _ := store.NewEncryptedFileStore(dir, k)
+		token, err := s.Load("default")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(token).To(Equal(newToken()))
+	})
+
+	DescribeTable("rejects invalid keys",
+		func(newKey func() (*store.EncryptionKey, error)) {
+			// Act
+			_, err := newKey()
+
+			// Assert
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("short key", func() (*store.EncryptionKey, error) { return store.NewEncryptionKey([]byte("short")) }),
+		Entry("unset environment variable", func() (*store.EncryptionKey, error) { return store.EncryptionKeyFromEnv("A0DAF_TEST_UNSET_KEY") }),
+		Entry("empty passphrase", func() (*store.EncryptionKey, error) { return store.NewPassphraseKey("") }),
+	)
+
+	It("requires the key", func() {
+		// Act
+		_, err := store.NewEncryptedFileStore(dir, nil)
+
+		// Assert
+		Expect(err).To(HaveOccurred())
+	})
+})